@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "advisory-lock",
+		Description: "Taking and releasing advisory locks",
+		Params: []Param{
+			{Name: "advisory.locks", Default: "1", Description: "distinct lock keys the workers compete for"},
+			{Name: "advisory.workers", Default: "8", Description: "concurrent sessions taking locks"},
+			{Name: "advisory.hold", Default: "0s", Description: "how long each lock is held before it's released"},
+			{Name: "advisory.seed", Default: "1", Description: "seed for choosing which key each acquisition takes"},
+		},
+		Workload: workloadAdvisoryLock,
+		// Locks touch no table.
+		Table:   sharedTable,
+		Enabled: func(opts RunOptions) bool { return opts.Engine != nil && opts.Engine.AdvisoryLock != "" },
+		Probe:   probeAdvisoryLocks,
+		Run:     lockUsingAdvisoryLocks,
+	})
+}
+
+// lockUsingAdvisoryLocks has advisory.workers sessions repeatedly take one
+// of advisory.locks advisory locks, hold it for advisory.hold and release
+// it. Rows counts acquisitions; each latency sample is the time from
+// requesting a lock until it's granted. Fairness is Jain's index over the
+// acquisitions per worker: 1 when all workers got the lock equally often,
+// approaching 1/workers when one worker starves the rest.
+func lockUsingAdvisoryLocks(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	keys := opts.intParam("advisory.locks", 1)
+	workers := opts.intParam("advisory.workers", 8)
+	hold := opts.durationParam("advisory.hold", 0)
+	if keys < 1 || workers < 1 {
+		return Result{}, fmt.Errorf("advisory.locks and advisory.workers must be at least 1")
+	}
+	lockSQL, unlockSQL := opts.bind(opts.Engine.AdvisoryLock), opts.bind(opts.Engine.AdvisoryUnlock)
+
+	var (
+		attempted atomic.Int64
+		perWorker = make([]int, workers)
+		mu        sync.Mutex
+		rec       latencyRecorder
+	)
+	seed := int64(opts.intParam("advisory.seed", 1))
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		// Advisory locks belong to the session, so each worker keeps its
+		// own connection.
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("get connection error: %v", err)
+		}
+		defer conn.Close()
+		for ctx.Err() == nil {
+			if opts.done(int(attempted.Add(1))-1, start) {
+				return nil
+			}
+			key := rng.Intn(keys)
+			opStart := time.Now()
+			if err := advisoryCall(ctx, conn, lockSQL, key); err != nil {
+				return fmt.Errorf("advisory lock: %v", err)
+			}
+			wait := time.Since(opStart)
+			if hold > 0 {
+				time.Sleep(hold)
+			}
+			if err := advisoryCall(ctx, conn, unlockSQL, key); err != nil {
+				return fmt.Errorf("advisory unlock: %v", err)
+			}
+			mu.Lock()
+			rec.observe(wait)
+			perWorker[w]++
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	acquired := len(rec.samples)
+	result := rec.result(acquired, time.Since(start))
+	fairness, least, most := jainFairness(perWorker)
+	result.Metrics = map[string]float64{
+		"fairness":           fairness,
+		"worker_min_acquire": float64(least),
+		"worker_max_acquire": float64(most),
+		"locks":              float64(keys),
+		"workers":            float64(workers),
+	}
+	log.Printf("advisory-lock: %d acquisitions of %d locks by %d workers, fairness %.3f (per worker %d-%d)",
+		acquired, keys, workers, fairness, least, most)
+	return result, nil
+}
+
+// probeAdvisoryLocks takes and releases one advisory lock, which servers
+// and proxies that disable the lock functions refuse.
+func probeAdvisoryLocks(ctx context.Context, db *sql.DB, opts RunOptions) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection error: %v", err)
+	}
+	defer conn.Close()
+	if err := advisoryCall(ctx, conn, opts.bind(opts.Engine.AdvisoryLock), 0); err != nil {
+		return fmt.Errorf("advisory lock: %v", err)
+	}
+	if err := advisoryCall(ctx, conn, opts.bind(opts.Engine.AdvisoryUnlock), 0); err != nil {
+		return fmt.Errorf("advisory unlock: %v", err)
+	}
+	return nil
+}
+
+// advisoryCall runs a lock or unlock statement. GET_LOCK and RELEASE_LOCK
+// return 1 on success; statements returning nothing (pg_advisory_lock is
+// void) succeed unless they error.
+func advisoryCall(ctx context.Context, conn *sql.Conn, query string, key int) error {
+	var v any
+	if err := conn.QueryRowContext(ctx, query, key).Scan(&v); err != nil {
+		return err
+	}
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if s := fmt.Sprint(v); v != nil && s != "" && s != "1" {
+		return fmt.Errorf("lock %d: statement returned %s", key, s)
+	}
+	return nil
+}
+
+// jainFairness returns Jain's fairness index of counts along with the
+// smallest and largest count.
+func jainFairness(counts []int) (index float64, least, most int) {
+	if len(counts) == 0 {
+		return 0, 0, 0
+	}
+	least, most = math.MaxInt, 0
+	var sum, squares float64
+	for _, c := range counts {
+		least, most = min(least, c), max(most, c)
+		sum += float64(c)
+		squares += float64(c) * float64(c)
+	}
+	if squares == 0 {
+		return 0, least, most
+	}
+	return sum * sum / (float64(len(counts)) * squares), least, most
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// aggSummaryTable holds the per-category aggregates the summary phase
+// maintains next to the events.
+const aggSummaryTable = "benchmark_agg_summary"
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "materialized-aggregates",
+		Description: "GROUP BY on every read against a summary table updated on every write",
+		Params: []Param{
+			{Name: "agg.categories", Default: "20", Description: "categories the events are aggregated by"},
+			{Name: "agg.read_rate", Default: "20", Description: "percentage of operations that read the aggregates"},
+			{Name: "agg.workers", Default: "8", Description: "concurrent workers"},
+			{Name: "agg.seed", Default: "1", Description: "seed for choosing categories and operations"},
+		},
+		Workload: workloadAggregates,
+		Table:    "benchmark_agg_events",
+		Schema: func(e *engine, table string) string {
+			return e.createTable(table, []column{
+				{Name: "id", Type: typeBigInt, NotNull: true},
+				{Name: "category", Type: typeBigInt, NotNull: true},
+				{Name: "amount", Type: typeBigInt, NotNull: true},
+			}, "id")
+		},
+		Run: compareAggregation,
+	})
+}
+
+// aggPhase is what one approach measured.
+type aggPhase struct {
+	elapsed       time.Duration
+	reads, writes []time.Duration
+}
+
+// compareAggregation runs the same mix of event inserts and aggregate
+// reads twice from empty tables, splitting Rows and Duration between the
+// two approaches: first every read runs the GROUP BY over the events, then
+// every write also updates the category's row of a summary table in the
+// same transaction and reads just select from it. The first makes reads
+// grow with the table, the second makes writes contend on the summary
+// rows; which costs the system less overall depends on the read rate.
+// Metrics report per approach (groupby_, summary_) the throughput, the
+// read and write p50 and p99 and the mean latency of an operation, and
+// warn if the summary disagrees with the events. Rows counts operations.
+func compareAggregation(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	categories := opts.intParam("agg.categories", 20)
+	readRate := opts.intParam("agg.read_rate", 20)
+	workers := opts.intParam("agg.workers", 8)
+	if categories < 1 || workers < 1 || readRate < 0 || readRate > 100 {
+		return Result{}, fmt.Errorf("agg.categories and agg.workers must be at least 1 and agg.read_rate a percentage")
+	}
+	summary := opts.Engine.createTable(aggSummaryTable, []column{
+		{Name: "category", Type: typeBigInt, NotNull: true},
+		{Name: "events", Type: typeBigInt, NotNull: true},
+		{Name: "total", Type: typeBigInt, NotNull: true},
+	}, "category")
+	if _, err := db.ExecContext(ctx, summary); err != nil {
+		return Result{}, fmt.Errorf("create table %s: %v", aggSummaryTable, err)
+	}
+	phaseOpts := opts.phase(2)
+
+	plans := opts.planRecorder()
+	var rec latencyRecorder
+	var total time.Duration
+	ops := 0
+	metrics := map[string]float64{}
+	for _, approach := range []string{"groupby", "summary"} {
+		if err := resetAggregates(ctx, db, opts, categories); err != nil {
+			return Result{}, err
+		}
+		p, err := runAggPhase(ctx, db, phaseOpts, approach == "summary", categories, readRate, workers, &rec, plans)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %v", approach, err)
+		}
+		n := len(p.reads) + len(p.writes)
+		var sum time.Duration
+		for _, d := range append(p.reads, p.writes...) {
+			sum += d
+		}
+		ops += n
+		total += p.elapsed
+
+		key := approach + "_"
+		reads, writes := summarizeLatency(p.reads), summarizeLatency(p.writes)
+		metrics[key+"ops_per_sec"] = float64(n) / p.elapsed.Seconds()
+		metrics[key+"read_p50_ns"] = float64(reads.P50.Nanoseconds())
+		metrics[key+"read_p99_ns"] = float64(reads.P99.Nanoseconds())
+		metrics[key+"write_p50_ns"] = float64(writes.P50.Nanoseconds())
+		metrics[key+"write_p99_ns"] = float64(writes.P99.Nanoseconds())
+		metrics[key+"mean_op_ns"] = float64(sum.Nanoseconds()) / float64(max(n, 1))
+		log.Printf("materialized-aggregates: %s: %s ops/s, reads p50 %s (p99 %s), writes p50 %s (p99 %s)",
+			approach, formatRate(metrics[key+"ops_per_sec"]), formatDuration(reads.P50), formatDuration(reads.P99), formatDuration(writes.P50), formatDuration(writes.P99))
+		if approach == "summary" {
+			if err := checkSummary(ctx, db, opts); err != nil {
+				log.Printf("Warning: materialized-aggregates: %v", err)
+			}
+		}
+	}
+
+	result := rec.result(ops, total)
+	result.Metrics = metrics
+	result.Plans = plans.plans
+	return result, nil
+}
+
+// resetAggregates empties the events and zeroes the summary.
+func resetAggregates(ctx context.Context, db *sql.DB, opts RunOptions, categories int) error {
+	for _, table := range []string{opts.table(), aggSummaryTable} {
+		if _, err := db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("reset %s: %v", table, err)
+		}
+	}
+	for c := 0; c < categories; c++ {
+		if _, err := db.ExecContext(ctx, opts.bind("INSERT INTO "+aggSummaryTable+" (category, events, total) VALUES (?, 0, 0)"), c); err != nil {
+			return fmt.Errorf("reset %s: %v", aggSummaryTable, err)
+		}
+	}
+	return nil
+}
+
+// runAggPhase runs the workload until opts is done, maintaining and reading
+// the summary table if summary is set and observing each operation in rec
+// as it finishes. The read's plan is captured in plans first.
+func runAggPhase(ctx context.Context, db *sql.DB, opts RunOptions, summary bool, categories, readRate, workers int, rec *latencyRecorder, plans *planRecorder) (aggPhase, error) {
+	insert := opts.bind("INSERT INTO " + opts.table() + " (id, category, amount) VALUES (?, ?, ?)")
+	update := opts.bind("UPDATE " + aggSummaryTable + " SET events = events + 1, total = total + ? WHERE category = ?")
+	read := "SELECT category, COUNT(*), SUM(amount) FROM " + opts.table() + " GROUP BY category"
+	if summary {
+		read = "SELECT category, events, total FROM " + aggSummaryTable
+	}
+	seed := int64(opts.intParam("agg.seed", 1))
+	var (
+		claimed atomic.Int64
+		mu      sync.Mutex
+		p       aggPhase
+	)
+	plans.capture(ctx, db, read)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		var reads, writes []time.Duration
+		defer func() {
+			mu.Lock()
+			p.reads, p.writes = append(p.reads, reads...), append(p.writes, writes...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			i := int(claimed.Add(1)) - 1
+			if opts.done(i, start) {
+				return nil
+			}
+			opStart := time.Now()
+			if rng.Intn(100) < readRate {
+				rows, err := db.QueryContext(ctx, read)
+				if err != nil {
+					return fmt.Errorf("read error: %v", err)
+				}
+				if err := drainRows(rows); err != nil {
+					return fmt.Errorf("read error: %v", err)
+				}
+				d := time.Since(opStart)
+				reads = append(reads, d)
+				mu.Lock()
+				rec.observe(d)
+				mu.Unlock()
+				continue
+			}
+			category, amount := rng.Intn(categories), 1+rng.Intn(100)
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return fmt.Errorf("begin: %v", err)
+			}
+			if _, err := tx.ExecContext(ctx, insert, i, category, amount); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("insert error: %v", err)
+			}
+			if summary {
+				if _, err := tx.ExecContext(ctx, update, amount, category); err != nil {
+					tx.Rollback()
+					return fmt.Errorf("update error: %v", err)
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("commit: %v", err)
+			}
+			d := time.Since(opStart)
+			writes = append(writes, d)
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+		}
+		return nil
+	})
+	p.elapsed = time.Since(start)
+	return p, err
+}
+
+// checkSummary compares the summary's totals with the events'.
+func checkSummary(ctx context.Context, db *sql.DB, opts RunOptions) error {
+	var events, summed sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*), SUM(amount) FROM "+opts.table()).Scan(&events, &summed); err != nil {
+		return fmt.Errorf("check summary: %v", err)
+	}
+	var count, total sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT SUM(events), SUM(total) FROM "+aggSummaryTable).Scan(&count, &total); err != nil {
+		return fmt.Errorf("check summary: %v", err)
+	}
+	if events.Int64 != count.Int64 || summed.Int64 != total.Int64 {
+		return fmt.Errorf("summary counts %d events totalling %d, the events table has %d totalling %d",
+			count.Int64, total.Int64, events.Int64, summed.Int64)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math"
+	"time"
+)
+
+// autoIterations sizes each strategy's run the way go test sizes b.N:
+// instead of one -n for every strategy, it runs the strategy with a
+// growing row count until a run lasts MinTime and, if CI is set, the 95%
+// confidence interval of its mean latency is within CI percent of the
+// mean. Only that last run is reported; the ones before it are
+// calibration.
+type autoIterations struct {
+	MinTime time.Duration
+	CI      float64
+	MaxRows int
+}
+
+// autoMaxGrowth caps how much the row count grows between two runs, as
+// the prediction from a short run is rough.
+const autoMaxGrowth = 100
+
+// wrap returns s's Run sized by a.
+func (a *autoIterations) wrap(s Strategy) func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	return func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+		n := 1
+		for attempt := 1; ; attempt++ {
+			opts.Rows = n
+			result, err := s.Run(ctx, db, opts)
+			if err != nil {
+				return result, err
+			}
+			ci := latencyCI(result.samples)
+			timeDone := result.Duration >= a.MinTime || (opts.Duration > 0 && result.Duration >= opts.Duration)
+			ciDone := a.CI <= 0 || ci <= a.CI
+			if (timeDone && ciDone) || n >= a.MaxRows || ctx.Err() != nil {
+				if result.Metrics == nil {
+					result.Metrics = map[string]float64{}
+				}
+				result.Metrics["auto_rows"] = float64(n)
+				result.Metrics["auto_attempts"] = float64(attempt)
+				if !math.IsInf(ci, 1) {
+					result.Metrics["latency_ci_pct"] = ci
+				}
+				if !ciDone {
+					log.Printf("Warning: %s: stopped at %d rows with the mean latency within ±%.1f%%, short of -auto-ci %g%%", s.Name, n, ci, a.CI)
+				}
+				log.Printf("%s: -auto settled on %d rows after %d runs", s.Name, n, attempt)
+				return result, nil
+			}
+			n = a.next(n, result.Duration, ci)
+		}
+	}
+}
+
+// next predicts the row count that meets both goals from a run of n rows
+// that took d with a relative confidence interval of ci, which narrows
+// with the square root of the samples, and adds a fifth as go test does.
+func (a *autoIterations) next(n int, d time.Duration, ci float64) int {
+	growth := float64(autoMaxGrowth)
+	if d > 0 {
+		growth = float64(a.MinTime) / float64(d)
+	}
+	if a.CI > 0 && !math.IsInf(ci, 1) {
+		growth = math.Max(growth, (ci/a.CI)*(ci/a.CI))
+	}
+	growth = math.Min(growth*1.2, autoMaxGrowth)
+	next := int(float64(n) * growth)
+	if next <= n {
+		next = n + 1
+	}
+	return min(next, a.MaxRows)
+}
+
+// latencyCI is the half-width of the 95% confidence interval of the mean
+// of samples, in percent of the mean; +Inf with fewer than two.
+func latencyCI(samples []time.Duration) float64 {
+	if len(samples) < 2 {
+		return math.Inf(1)
+	}
+	var sum float64
+	for _, d := range samples {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(samples))
+	if mean == 0 {
+		return 0
+	}
+	var squares float64
+	for _, d := range samples {
+		squares += (float64(d) - mean) * (float64(d) - mean)
+	}
+	stddev := math.Sqrt(squares / float64(len(samples)-1))
+	return 1.96 * stddev / math.Sqrt(float64(len(samples))) / mean * 100
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "backpressure",
+		Description: "Inserting from more callers than connections, limited by the pool or by a semaphore",
+		Params: append([]Param{
+			{Name: "backpressure.limit", Default: "4", Description: "concurrent inserts allowed: the pool's SetMaxOpenConns in pool mode, the semaphore's slots in semaphore mode"},
+			{Name: "backpressure.workers", Default: "32", Description: "concurrent callers competing for the limit"},
+			{Name: "backpressure.modes", Default: "pool/semaphore", Description: "slash-separated modes to compare: pool (SetMaxOpenConns alone) and semaphore (an application semaphore in front of an unlimited pool)"},
+		}, dataParams...),
+		Workload: workloadSingleInsert,
+		Run:      insertUnderBackpressure,
+	})
+}
+
+// Backpressure modes: where callers in excess of the limit queue.
+const (
+	backpressurePool      = "pool"
+	backpressureSemaphore = "semaphore"
+)
+
+// insertUnderBackpressure runs the same insert workload from
+// backpressure.workers callers once per backpressure.modes, splitting Rows
+// and Duration between them, with the concurrency held to
+// backpressure.limit either by the pool alone, its SetMaxOpenConns making
+// callers wait inside database/sql for a connection, or by a semaphore the
+// callers acquire before using a pool that is otherwise unlimited.
+// Frameworks disagree on which is better: the pool hands a freed
+// connection to a random waiter, while the semaphore's channel admits
+// waiters in the order they came, but leaves the pool unbounded for any
+// code that skips it. Each insert takes its connection explicitly, so that
+// the wait for a slot is measured apart from the insert. Metrics report
+// per mode the throughput, the p50 and p99 of the whole operation and of
+// the wait, the longest wait and how often database/sql made a caller wait
+// for a connection, e.g. semaphore_wait_p99_ns. The pool gets its limit
+// back afterwards.
+func insertUnderBackpressure(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	limit := opts.intParam("backpressure.limit", 4)
+	workers := opts.intParam("backpressure.workers", 32)
+	modes := opts.listParam("backpressure.modes", "pool/semaphore")
+	if limit < 1 || workers < 1 {
+		return Result{}, fmt.Errorf("backpressure.limit and backpressure.workers must be at least 1")
+	}
+	if len(modes) == 0 {
+		return Result{}, fmt.Errorf("backpressure.modes must not be empty")
+	}
+	for _, m := range modes {
+		if m != backpressurePool && m != backpressureSemaphore {
+			return Result{}, fmt.Errorf("unknown backpressure mode %q (available: pool, semaphore)", m)
+		}
+	}
+	if workers <= limit {
+		log.Printf("Warning: backpressure: %d workers don't exceed the limit of %d, so nothing queues", workers, limit)
+	}
+	maxOpen := db.Stats().MaxOpenConnections
+	defer func() {
+		db.SetMaxOpenConns(maxOpen)
+		db.SetMaxIdleConns(maxOpen)
+	}()
+	phaseOpts := opts.phase(len(modes))
+
+	var rec latencyRecorder
+	var total time.Duration
+	rows := 0
+	metrics := map[string]float64{}
+	for _, mode := range modes {
+		var sem chan struct{}
+		if mode == backpressureSemaphore {
+			sem = make(chan struct{}, limit)
+			db.SetMaxOpenConns(0)
+			db.SetMaxIdleConns(limit)
+		} else {
+			db.SetMaxOpenConns(limit)
+			db.SetMaxIdleConns(limit)
+		}
+		before := db.Stats()
+		phase, err := runBackpressurePhase(ctx, db, phaseOpts, workers, rows, sem, &rec)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s mode: %v", mode, err)
+		}
+		after := db.Stats()
+		rows += len(phase.latency)
+		total += phase.elapsed
+
+		stats := summarizeLatency(phase.latency)
+		waits := summarizeLatency(phase.waits)
+		rate := float64(len(phase.latency)) / phase.elapsed.Seconds()
+		key := mode + "_"
+		metrics[key+"ops_per_sec"] = rate
+		metrics[key+"p50_ns"] = float64(stats.P50.Nanoseconds())
+		metrics[key+"p99_ns"] = float64(stats.P99.Nanoseconds())
+		metrics[key+"wait_p50_ns"] = float64(waits.P50.Nanoseconds())
+		metrics[key+"wait_p99_ns"] = float64(waits.P99.Nanoseconds())
+		metrics[key+"wait_max_ns"] = float64(waits.Max.Nanoseconds())
+		metrics[key+"pool_waits"] = float64(after.WaitCount - before.WaitCount)
+		log.Printf("backpressure: %s mode: %s inserts/s, p50 %s, p99 %s, waiting p50 %s, p99 %s, max %s, %d waits in the pool",
+			mode, formatRate(rate), formatDuration(stats.P50), formatDuration(stats.P99),
+			formatDuration(waits.P50), formatDuration(waits.P99), formatDuration(waits.Max), after.WaitCount-before.WaitCount)
+	}
+
+	result := rec.result(rows, total)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// backpressurePhase is what one mode measured: each insert's latency from
+// asking for a slot to finishing, and its wait for the slot.
+type backpressurePhase struct {
+	latency, waits []time.Duration
+	elapsed        time.Duration
+}
+
+// runBackpressurePhase inserts from workers until opts is done, each
+// insert first acquiring sem, if set, then a connection from db, with the
+// generated rows offset past earlier phases', observing each in rec as it
+// finishes.
+func runBackpressurePhase(ctx context.Context, db *sql.DB, opts RunOptions, workers, first int, sem chan struct{}, rec *latencyRecorder) (backpressurePhase, error) {
+	var (
+		claimed atomic.Int64
+		mu      sync.Mutex
+		phase   backpressurePhase
+	)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		gen := opts.rowGen("Backpressure")
+		var latency, waits []time.Duration
+		defer func() {
+			mu.Lock()
+			phase.latency = append(phase.latency, latency...)
+			phase.waits = append(phase.waits, waits...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			i := int(claimed.Add(1)) - 1
+			if opts.done(i, start) {
+				return nil
+			}
+			name, email := gen.row(first + i)
+			opStart := time.Now()
+			if sem != nil {
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				if sem != nil {
+					<-sem
+				}
+				return fmt.Errorf("get connection error: %v", err)
+			}
+			wait := time.Since(opStart)
+			_, err = conn.ExecContext(ctx, opts.insertSQL(), name, email)
+			conn.Close()
+			if sem != nil {
+				<-sem
+			}
+			if err != nil {
+				return fmt.Errorf("insert error: %v", err)
+			}
+			d := time.Since(opStart)
+			latency = append(latency, d)
+			waits = append(waits, wait)
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+		}
+		return nil
+	})
+	phase.elapsed = time.Since(start)
+	return phase, err
+}
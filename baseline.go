@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// baselineFile is the on-disk format written by record-baseline.
+type baselineFile struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	Target     string    `json:"target"`
+	Options    struct {
+		Rows     int           `json:"rows"`
+		Duration time.Duration `json:"duration_ns"`
+	} `json:"options"`
+	Results    []Result    `json:"results"`
+	Provenance *provenance `json:"provenance,omitempty"`
+}
+
+// Thresholds are the tolerated regressions, in percent, before assert fails.
+type Thresholds struct {
+	MaxThroughputDrop float64
+	MaxLatencyRise    float64
+	// FailOnPlanChange turns a changed query plan into a regression; by
+	// default plan changes are only flagged.
+	FailOnPlanChange bool
+	// RequireSignificance only counts a throughput drop or latency rise
+	// past its threshold as a regression when the latencies differ
+	// significantly from the baseline's.
+	RequireSignificance bool
+}
+
+// comparison is one strategy measured against its baseline.
+type comparison struct {
+	Strategy         string
+	Baseline         *Result
+	Current          *Result
+	ThroughputChange float64 // percent, positive = faster
+	LatencyChange    float64 // percent change of p95, positive = slower
+	Regressed        bool
+	Reason           string
+	// PlanChanges lists the queries whose plan shape differs from the
+	// baseline's.
+	PlanChanges []planChange
+	// Significance tests the current latencies against the baseline's; nil
+	// when either has too few samples, e.g. a baseline recorded before
+	// they were stored.
+	Significance *significance
+}
+
+func saveBaseline(path string, b baselineFile) error {
+	return writeJSON(path, b)
+}
+
+func loadBaseline(path string) (baselineFile, error) {
+	var b baselineFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return b, fmt.Errorf("read baseline: %v", err)
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return b, fmt.Errorf("parse baseline %s: %v", path, err)
+	}
+	return b, nil
+}
+
+// compareToBaseline pairs current results with the baseline by strategy
+// name. Strategies missing from the current run, or skipped in it, count
+// as regressions; strategies absent from the baseline are reported but
+// never fail. Strategies the baseline skipped aren't compared.
+func compareToBaseline(baseline, current []Result, t Thresholds) []comparison {
+	byName := map[string]*Result{}
+	skipped := map[string]string{}
+	for i := range current {
+		if current[i].Skipped != "" {
+			skipped[current[i].Strategy] = current[i].Skipped
+			continue
+		}
+		byName[current[i].Strategy] = &current[i]
+	}
+
+	var out []comparison
+	seen := map[string]bool{}
+	for i := range baseline {
+		base := &baseline[i]
+		seen[base.Strategy] = true
+		if base.Skipped != "" {
+			continue
+		}
+		c := comparison{Strategy: base.Strategy, Baseline: base, Current: byName[base.Strategy]}
+		if c.Current == nil {
+			c.Regressed = true
+			c.Reason = "missing from current run"
+			if reason, ok := skipped[base.Strategy]; ok {
+				c.Reason = "skipped: " + reason
+			}
+			out = append(out, c)
+			continue
+		}
+		c.ThroughputChange = percentChange(base.RowsPerSec(), c.Current.RowsPerSec())
+		c.LatencyChange = percentChange(float64(base.Latency.P95), float64(c.Current.Latency.P95))
+		switch {
+		case -c.ThroughputChange > t.MaxThroughputDrop:
+			c.Regressed = true
+			c.Reason = fmt.Sprintf("throughput dropped %.1f%% (limit %.1f%%)", -c.ThroughputChange, t.MaxThroughputDrop)
+		case base.Latency.P95 > 0 && c.LatencyChange > t.MaxLatencyRise:
+			c.Regressed = true
+			c.Reason = fmt.Sprintf("p95 latency rose %.1f%% (limit %.1f%%)", c.LatencyChange, t.MaxLatencyRise)
+		}
+		c.Significance = testSignificance(*base, *c.Current)
+		if c.Regressed && c.Significance != nil && !c.Significance.significant() {
+			c.Reason += ", " + c.Significance.String()
+			if t.RequireSignificance {
+				c.Regressed = false
+			}
+		}
+		c.PlanChanges = comparePlans(base.Plans, c.Current.Plans)
+		if len(c.PlanChanges) > 0 && t.FailOnPlanChange && !c.Regressed {
+			c.Regressed = true
+			c.Reason = fmt.Sprintf("query plan changed for %d queries", len(c.PlanChanges))
+		}
+		out = append(out, c)
+	}
+	for i := range current {
+		if !seen[current[i].Strategy] && current[i].Skipped == "" {
+			out = append(out, comparison{Strategy: current[i].Strategy, Current: &current[i], Reason: "not in baseline"})
+		}
+	}
+	return out
+}
+
+func percentChange(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (after - before) / before * 100
+}
+
+func regressions(comparisons []comparison) int {
+	n := 0
+	for _, c := range comparisons {
+		if c.Regressed {
+			n++
+		}
+	}
+	return n
+}
+
+func recordBaselineCommand(config DBConfig, args []string) error {
+	f := newRunFlags("record-baseline")
+	path := f.fs.String("baseline", getEnv("BENCHMARK_BASELINE", "benchmark-baseline.json"), "baseline file to write")
+	f.fs.Parse(args)
+	opts, err := f.options(config)
+	if err != nil {
+		return err
+	}
+	if f.soak || f.count != 1 {
+		return fmt.Errorf("record-baseline does not support soak mode or -count")
+	}
+
+	results, err := benchmarkTarget(config, opts, 1)
+	f.publish(config, opts, results, nil, err)
+	if err != nil {
+		return err
+	}
+
+	b := baselineFile{RecordedAt: time.Now().UTC(), Target: config.Target(), Results: results}
+	b.Options.Rows, b.Options.Duration = opts.Rows, opts.Duration
+	b.Provenance = newProvenance(config, opts, 1)
+	if err := saveBaseline(*path, b); err != nil {
+		return err
+	}
+	if f.signKey != "" {
+		if err := signFile(f.signKey, *path); err != nil {
+			return fmt.Errorf("sign baseline: %v", err)
+		}
+	}
+	log.Printf("Baseline with %d strategies written to %s", len(results), *path)
+	return nil
+}
+
+// thresholdFlags registers the regression thresholds on fs.
+func thresholdFlags(fs *flag.FlagSet) *Thresholds {
+	var t Thresholds
+	fs.Float64Var(&t.MaxThroughputDrop, "max-throughput-drop", 10, "fail if rows/s drops by more than this percentage")
+	fs.Float64Var(&t.MaxLatencyRise, "max-latency-rise", 20, "fail if p95 latency rises by more than this percentage")
+	fs.BoolVar(&t.RequireSignificance, "require-significance", getEnvAsBool("BENCHMARK_REQUIRE_SIGNIFICANCE", false), "fail on a throughput drop or latency rise only when the latencies differ significantly from the baseline's (see -alpha)")
+	fs.BoolVar(&t.FailOnPlanChange, "fail-on-plan-change", getEnvAsBool("BENCHMARK_FAIL_ON_PLAN_CHANGE", false), "fail if a captured query plan differs from the baseline's (needs -explain)")
+	return &t
+}
+
+func logComparisons(comparisons []comparison) {
+	for _, c := range comparisons {
+		status := "ok"
+		if c.Regressed {
+			status = "REGRESSION"
+		}
+		switch {
+		case c.Reason == "" && c.Significance != nil:
+			log.Printf("%s: %s (throughput %+.1f%%, p95 latency %+.1f%%, %s)", c.Strategy, status, c.ThroughputChange, c.LatencyChange, c.Significance)
+		case c.Reason == "":
+			log.Printf("%s: %s (throughput %+.1f%%, p95 latency %+.1f%%)", c.Strategy, status, c.ThroughputChange, c.LatencyChange)
+		default:
+			log.Printf("%s: %s (%s)", c.Strategy, status, c.Reason)
+		}
+		for _, pc := range c.PlanChanges {
+			log.Printf("%s: query plan changed for %q", c.Strategy, pc.Query)
+		}
+	}
+}
+
+func assertCommand(config DBConfig, args []string) error {
+	f := newRunFlags("assert")
+	path := f.fs.String("baseline", getEnv("BENCHMARK_BASELINE", "benchmark-baseline.json"), "baseline file to compare against")
+	t := thresholdFlags(f.fs)
+	f.fs.Parse(args)
+	opts, err := f.options(config)
+	if err != nil {
+		return err
+	}
+	if f.soak || f.count != 1 {
+		return fmt.Errorf("assert does not support soak mode or -count")
+	}
+
+	baseline, err := loadBaseline(*path)
+	if err != nil {
+		return err
+	}
+	if baseline.Options.Rows != opts.Rows || baseline.Options.Duration != opts.Duration {
+		log.Printf("Warning: baseline was recorded with rows=%d duration=%v, current run uses rows=%d duration=%v",
+			baseline.Options.Rows, baseline.Options.Duration, opts.Rows, opts.Duration)
+	}
+
+	results, err := benchmarkTarget(config, opts, 1)
+	comparisons := compareToBaseline(baseline.Results, results, *t)
+	logComparisons(comparisons)
+	f.publish(config, opts, results, comparisons, err)
+	if err != nil {
+		return err
+	}
+	if n := regressions(comparisons); n > 0 {
+		return fmt.Errorf("%d of %d strategies regressed against %s", n, len(comparisons), *path)
+	}
+	log.Printf("All strategies within thresholds of %s", *path)
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// batchConfig is the single JSON document that drives a batch run. Every
+// field is optional; unset fields fall back to the environment/.env values
+// used by the interactive commands.
+type batchConfig struct {
+	DB          targetDB          `json:"db"`
+	Profile     string            `json:"profile"`
+	Rows        int               `json:"rows"`
+	Duration    string            `json:"duration"`
+	BatchSize   int               `json:"batch_size"`
+	Params      map[string]string `json:"params"`
+	SharedTable bool              `json:"shared_table"`
+	Explain     string            `json:"explain"`
+	Preflight   *bool             `json:"preflight"`
+	Webhook     struct {
+		URL    string `json:"url"`
+		Format string `json:"format"`
+	} `json:"webhook"`
+}
+
+// targetDB overrides the connection settings of DBConfig; empty fields
+// keep the configured value.
+type targetDB struct {
+	Host     string `json:"host"`
+	User     string `json:"user"`
+	Engine   string `json:"engine"`
+	Password string `json:"password"`
+	Database string `json:"database"`
+	PoolSize int    `json:"pool_size"`
+}
+
+func (t targetDB) apply(config DBConfig) DBConfig {
+	if t.Engine != "" {
+		config.Engine = t.Engine
+	}
+	if t.Host != "" {
+		config.Host = t.Host
+	}
+	if t.User != "" {
+		config.User = t.User
+	}
+	if t.Password != "" {
+		redactor.add(t.Password)
+		config.Password, config.Secrets = t.Password, nil
+	}
+	if t.Database != "" {
+		config.Database = t.Database
+	}
+	if t.PoolSize > 0 {
+		config.PoolSize = t.PoolSize
+	}
+	return config
+}
+
+// batchOutput is the only thing a batch run writes to stdout.
+type batchOutput struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Results    []Result  `json:"results"`
+}
+
+// batchCommand runs the benchmark without any interaction: configuration
+// comes from -config (inline JSON, or "-" for stdin, the default) and the
+// results are emitted as one JSON document on stdout. Logs stay on stderr.
+func batchCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	configFlag := fs.String("config", getEnv("BENCHMARK_BATCH_CONFIG", "-"), `JSON config blob, or "-" to read it from stdin`)
+	fs.Parse(args)
+
+	out := batchOutput{Status: "ok", StartedAt: time.Now().UTC(), Results: []Result{}}
+	results, err := runBatch(config, *configFlag)
+	out.FinishedAt = time.Now().UTC()
+	if results != nil {
+		out.Results = results
+	}
+	if err != nil {
+		out.Status = "error"
+		out.Error = redact(err.Error())
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(out); encErr != nil {
+		return fmt.Errorf("encode batch output: %v", encErr)
+	}
+	return err
+}
+
+// runFlags returns the run command's flags as the config sets them, so
+// that the batch run's options are built the way the run command's are;
+// unset fields keep the flags' environment defaults.
+func (cfg batchConfig) runFlags() (*runFlags, error) {
+	f := newRunFlags("batch")
+	f.fs.Parse(nil)
+	set := map[string]string{"profile": cfg.Profile, "duration": cfg.Duration, "explain": cfg.Explain}
+	if cfg.Rows > 0 {
+		set["n"] = strconv.Itoa(cfg.Rows)
+	}
+	if cfg.BatchSize > 0 {
+		set["batch-size"] = strconv.Itoa(cfg.BatchSize)
+	}
+	if cfg.SharedTable {
+		set["shared-table"] = "true"
+	}
+	if cfg.Preflight != nil {
+		set["preflight"] = strconv.FormatBool(*cfg.Preflight)
+	}
+	for name, value := range set {
+		if value == "" {
+			continue
+		}
+		if err := f.fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", strings.ReplaceAll(name, "-", "_"), value, err)
+		}
+	}
+	f.extraParams = cfg.Params
+	return f, nil
+}
+
+func runBatch(config DBConfig, source string) ([]Result, error) {
+	raw := []byte(source)
+	if source == "-" {
+		var err error
+		if raw, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, fmt.Errorf("read config from stdin: %v", err)
+		}
+	}
+
+	var cfg batchConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %v", err)
+	}
+
+	config = cfg.DB.apply(config)
+
+	f, err := cfg.runFlags()
+	if err != nil {
+		return nil, err
+	}
+	opts, err := f.options(config)
+	if err != nil {
+		return nil, err
+	}
+	if f.soak {
+		return nil, fmt.Errorf("soak mode is not supported in batch mode")
+	}
+
+	results, err := benchmarkTarget(config, opts, 1)
+	if cfg.Webhook.URL != "" {
+		format := cfg.Webhook.Format
+		if format == "" {
+			format = "slack"
+		}
+		notifyWebhook(cfg.Webhook.URL, format, summarizeRun(config.Target(), results, nil, err))
+	}
+	return results, err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// formatBenchstat renders results in the Go benchmark output format so that
+// golang.org/x/perf/cmd/benchstat can compare result files directly. Each
+// strategy run becomes one line; use -count to produce the repeated samples
+// benchstat needs for its significance tests.
+func formatBenchstat(target string, results []Result) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "goos: %s\n", runtime.GOOS)
+	fmt.Fprintf(&b, "goarch: %s\n", runtime.GOARCH)
+	b.WriteString("pkg: benchmark\n")
+	fmt.Fprintf(&b, "target: %s\n", target)
+	procs := runtime.GOMAXPROCS(0)
+	for _, r := range results {
+		if r.Rows == 0 {
+			continue
+		}
+		nsPerOp := float64(r.Duration.Nanoseconds()) / float64(r.Rows)
+		fmt.Fprintf(&b, "BenchmarkInsert/%s-%d\t%d\t%.0f ns/op\t%.2f rows/s\t%d p50-ns\t%d p95-ns\t%d p99-ns",
+			r.Strategy, procs, r.Rows, nsPerOp, r.RowsPerSec(),
+			r.Latency.P50.Nanoseconds(), r.Latency.P95.Nanoseconds(), r.Latency.P99.Nanoseconds())
+		if r.Transactions > 0 {
+			fmt.Fprintf(&b, "\t%.4f retries/tx", r.RetryRate())
+		}
+		keys := make([]string, 0, len(r.Metrics))
+		for k := range r.Metrics {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "\t%g %s", r.Metrics[k], k)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// writeBenchstat writes the benchmark-format output to path ("-" = stdout).
+func writeBenchstat(path, target string, results []Result) error {
+	out := formatBenchstat(target, results)
+	if path == "-" {
+		_, err := fmt.Print(out)
+		return err
+	}
+	if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+		return fmt.Errorf("write %s: %v", path, err)
+	}
+	return nil
+}
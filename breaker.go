@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "circuit-breaker",
+		Description: "Inserting through a circuit breaker during an induced outage",
+		Params: append([]Param{
+			{Name: "breaker.enabled", Default: "false", Description: "set to true to run this strategy"},
+			{Name: "breaker.failures", Default: "5", Description: "consecutive failures that trip the breaker open"},
+			{Name: "breaker.timeout", Default: "1s", Description: "how long the breaker stays open before letting trial requests through"},
+			{Name: "breaker.half_open_requests", Default: "1", Description: "trial requests let through half-open, all of which must succeed to close the breaker"},
+			{Name: "breaker.backoff", Default: "10ms", Description: "how long a worker waits after a failed or rejected request, as a retrying client would"},
+			{Name: "breaker.workers", Default: "4", Description: "concurrent inserters"},
+			{Name: "breaker.outage_at", Default: "0.3", Description: "fraction of -n, or of -duration without it, after which the outage starts"},
+			{Name: "breaker.outage", Default: "2s", Description: "how long the induced outage lasts, during which every insert the breaker lets through fails"},
+		}, dataParams...),
+		Workload: workloadOutage,
+		Enabled:  func(opts RunOptions) bool { return opts.param("breaker.enabled", "false") == "true" },
+		Requires: "-param breaker.enabled=true",
+		Run:      insertThroughBreaker,
+	})
+}
+
+// breakerState is a circuit breaker's state: closed passes requests,
+// open rejects them, half-open passes a few trial requests to decide
+// between the two.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	return [...]string{"closed", "open", "half-open"}[s]
+}
+
+// errBreakerOpen is returned for requests the breaker rejects.
+var errBreakerOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker is a circuit breaker in the manner of gobreaker: it opens
+// after Failures consecutive failures, rejects every request for Timeout,
+// then goes half-open and lets HalfOpenRequests requests through, closing
+// once all of them succeed and opening again as soon as one fails. The
+// outcome of a request from before the last change of state is ignored.
+type circuitBreaker struct {
+	Failures         int
+	Timeout          time.Duration
+	HalfOpenRequests int
+	// OnChange, if set, is called with the breaker's lock held on every
+	// change of state.
+	OnChange func(from, to breakerState, at time.Time)
+
+	mu          sync.Mutex
+	state       breakerState
+	generation  int
+	consecutive int
+	openedAt    time.Time
+	trials      int
+	successes   int
+}
+
+// allow admits a request, returning the generation to report its outcome
+// with, or errBreakerOpen.
+func (b *circuitBreaker) allow() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.state == breakerOpen && now.Sub(b.openedAt) >= b.Timeout {
+		b.setState(breakerHalfOpen, now)
+	}
+	switch b.state {
+	case breakerOpen:
+		return 0, errBreakerOpen
+	case breakerHalfOpen:
+		if b.trials >= b.HalfOpenRequests {
+			return 0, errBreakerOpen
+		}
+		b.trials++
+	}
+	return b.generation, nil
+}
+
+// done reports the outcome of a request allow admitted in generation.
+func (b *circuitBreaker) done(generation int, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	now := time.Now()
+	switch {
+	case b.state == breakerClosed && success:
+		b.consecutive = 0
+	case b.state == breakerClosed:
+		if b.consecutive++; b.consecutive >= b.Failures {
+			b.setState(breakerOpen, now)
+		}
+	case b.state == breakerHalfOpen && success:
+		if b.successes++; b.successes >= b.HalfOpenRequests {
+			b.setState(breakerClosed, now)
+		}
+	case b.state == breakerHalfOpen:
+		b.setState(breakerOpen, now)
+	}
+}
+
+func (b *circuitBreaker) setState(to breakerState, at time.Time) {
+	from := b.state
+	b.state, b.generation = to, b.generation+1
+	b.consecutive, b.trials, b.successes = 0, 0, 0
+	if to == breakerOpen {
+		b.openedAt = at
+	}
+	if b.OnChange != nil {
+		b.OnChange(from, to, at)
+	}
+}
+
+// outageWindow is when the induced outage ran, and when the breaker first
+// opened after it started and last closed after it ended.
+type outageWindow struct {
+	start, end        time.Time
+	opened, recovered time.Time
+	trips             int
+}
+
+// insertThroughBreaker inserts from breaker.workers through a shared
+// circuitBreaker, and once breaker.outage_at of the run is done induces an
+// outage of breaker.outage during which every insert the breaker lets
+// through goes to a table that doesn't exist and fails on the server. It
+// measures how fast the breaker sheds the load, as the time from the start
+// of the outage to the breaker opening and the share of the outage's
+// requests that never reached the database, and how fast it recovers, as
+// the time from the end of the outage to the breaker closing again. The
+// strategy runs on past its rows or duration until the breaker has closed,
+// and only the successful inserts count as rows.
+func insertThroughBreaker(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	b := &circuitBreaker{
+		Failures:         opts.intParam("breaker.failures", 5),
+		Timeout:          opts.durationParam("breaker.timeout", time.Second),
+		HalfOpenRequests: opts.intParam("breaker.half_open_requests", 1),
+	}
+	backoff := opts.durationParam("breaker.backoff", 10*time.Millisecond)
+	workers := opts.intParam("breaker.workers", 4)
+	outageAt := opts.floatParam("breaker.outage_at", 0.3)
+	outageFor := opts.durationParam("breaker.outage", 2*time.Second)
+	if b.Failures < 1 || b.HalfOpenRequests < 1 || workers < 1 {
+		return Result{}, fmt.Errorf("breaker.failures, breaker.half_open_requests and breaker.workers must be at least 1")
+	}
+	if b.Timeout <= 0 || outageFor <= 0 || backoff < 0 {
+		return Result{}, fmt.Errorf("breaker.timeout and breaker.outage must be positive and breaker.backoff not negative")
+	}
+	if outageAt < 0 || outageAt >= 1 {
+		return Result{}, fmt.Errorf("breaker.outage_at must be at least 0 and below 1")
+	}
+	failingSQL := opts.bind("INSERT INTO " + opts.table() + "_outage (name, email) VALUES (?, ?)")
+
+	var (
+		mu     sync.Mutex
+		window outageWindow
+		// inOutage is 0 before the outage, 1 during it and 2 after it.
+		inOutage                       atomic.Int32
+		inserted, claimed              atomic.Int64
+		outageRequests, outageAttempts atomic.Int64
+		rejected, failed               atomic.Int64
+		rec                            latencyRecorder
+	)
+	b.OnChange = func(from, to breakerState, at time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		if verbosity >= verbosityVerbose {
+			log.Printf("circuit-breaker: %s -> %s", from, to)
+		}
+		if inOutage.Load() == 0 {
+			return
+		}
+		switch to {
+		case breakerOpen:
+			window.trips++
+			if window.opened.IsZero() {
+				window.opened = at
+			}
+		case breakerClosed:
+			window.recovered = at
+		}
+	}
+
+	start := time.Now()
+	outageDue := func() bool {
+		if opts.Rows > 0 {
+			return float64(inserted.Load()) >= outageAt*float64(opts.Rows)
+		}
+		return time.Since(start) >= time.Duration(outageAt*float64(opts.Duration))
+	}
+	// advance moves the outage along and reports whether the run is over:
+	// done, past the outage and with the breaker closed again. It takes mu
+	// apart from the breaker's lock, which OnChange takes mu under.
+	advance := func() bool {
+		done := opts.done(int(inserted.Load()), start)
+		if ctx.Err() != nil {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch inOutage.Load() {
+		case 0:
+			if outageDue() {
+				inOutage.Store(1)
+				window.start = time.Now()
+				log.Printf("circuit-breaker: outage started for %s", formatDuration(outageFor))
+			}
+		case 1:
+			if time.Since(window.start) >= outageFor {
+				inOutage.Store(2)
+				window.end = time.Now()
+			}
+		case 2:
+			return done && (window.recovered.After(window.end) || window.opened.IsZero())
+		}
+		return false
+	}
+
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		gen := opts.rowGen("Breaker")
+		pause := func() {
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+		}
+		for !advance() {
+			outage := inOutage.Load() == 1
+			if outage {
+				outageRequests.Add(1)
+			}
+			generation, err := b.allow()
+			if err != nil {
+				rejected.Add(1)
+				pause()
+				continue
+			}
+			var query string
+			var i int
+			if outage {
+				query, i = failingSQL, int(outageAttempts.Add(1))
+			} else {
+				// Rows bound the successful inserts; once the breaker has
+				// recovered, they are all successful.
+				query, i = opts.insertSQL(), int(claimed.Add(1))-1
+				if opts.Rows > 0 && i >= opts.Rows && inOutage.Load() == 2 && b.closed() {
+					return nil
+				}
+			}
+			name, email := gen.row(i)
+			opStart := time.Now()
+			_, err = db.ExecContext(ctx, query, name, email)
+			if ctx.Err() != nil {
+				return nil
+			}
+			b.done(generation, err == nil)
+			if err != nil {
+				if !outage {
+					return fmt.Errorf("insert error: %v", err)
+				}
+				failed.Add(1)
+				pause()
+				continue
+			}
+			d := time.Since(opStart)
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+			inserted.Add(1)
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	elapsed := time.Since(start)
+
+	result := rec.result(len(rec.samples), elapsed)
+	metrics := map[string]float64{
+		"breaker_trips":      float64(window.trips),
+		"rejected_requests":  float64(rejected.Load()),
+		"failed_inserts":     float64(failed.Load()),
+		"outage_requests":    float64(outageRequests.Load()),
+		"outage_db_attempts": float64(outageAttempts.Load()),
+	}
+	if window.end.IsZero() {
+		log.Printf("Warning: circuit-breaker: the run ended before the outage did")
+		result.Metrics = metrics
+		return result, nil
+	}
+	metrics["outage_ms"] = float64(window.end.Sub(window.start)) / float64(time.Millisecond)
+	if n := outageRequests.Load(); n > 0 {
+		metrics["shed_pct"] = float64(n-outageAttempts.Load()) / float64(n) * 100
+	}
+	summary := fmt.Sprintf("circuit-breaker: outage of %s: ", formatDuration(window.end.Sub(window.start)))
+	if window.opened.IsZero() {
+		summary += "the breaker never opened"
+	} else {
+		metrics["open_after_ms"] = float64(window.opened.Sub(window.start)) / float64(time.Millisecond)
+		summary += fmt.Sprintf("opened after %s, %d trips, %.0f%% of %d requests shed",
+			formatDuration(window.opened.Sub(window.start)), window.trips, metrics["shed_pct"], outageRequests.Load())
+	}
+	if window.recovered.After(window.end) {
+		metrics["recover_ms"] = float64(window.recovered.Sub(window.end)) / float64(time.Millisecond)
+		summary += fmt.Sprintf(", closed %s after it ended", formatDuration(window.recovered.Sub(window.end)))
+	} else if !window.opened.IsZero() {
+		log.Printf("Warning: circuit-breaker: the breaker hadn't closed again when the run ended")
+	}
+	log.Print(summary)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// closed reports whether b is closed.
+func (b *circuitBreaker) closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerClosed
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// coldRestartTimeout bounds how long a cold pass waits for the target to
+// accept connections again after the cold command.
+const coldRestartTimeout = 2 * time.Minute
+
+// coldCache measures read strategies twice, cold and then warm, instead
+// of once with a cache that is warm for part of the run. Command, if set,
+// runs before the cold pass to empty the caches for real, e.g. by
+// restarting the server; otherwise the cold pass is only the first one,
+// with whatever the caches held before.
+type coldCache struct {
+	Command string
+}
+
+// run runs s like Strategy.Run does, and read strategies twice when c is
+// set. The result is the warm pass's, which is what steady-state reads
+// look like; Metrics report the cold pass as cold_rows_per_sec,
+// cold_p50_ns, cold_p95_ns and cold_p99_ns, and how much slower its p50 was
+// as cold_p50_ratio.
+func (c *coldCache) run(ctx context.Context, db *sql.DB, s Strategy, opts RunOptions) (Result, error) {
+	if c == nil || !s.Read {
+		return s.Run(ctx, db, opts)
+	}
+	if c.Command != "" {
+		log.Printf("%s: emptying caches with %q", s.Name, c.Command)
+		if err := shellCommand(ctx, c.Command, strategyEnv(s, opts)...).Run(); err != nil {
+			return Result{}, fmt.Errorf("cold command: %v", err)
+		}
+		if err := reconnect(ctx, db); err != nil {
+			return Result{}, fmt.Errorf("after cold command: %v", err)
+		}
+	}
+	cold, err := s.Run(ctx, db, opts)
+	if err != nil {
+		return cold, fmt.Errorf("cold pass: %v", err)
+	}
+	warm, err := s.Run(ctx, db, opts)
+	if err != nil {
+		return warm, fmt.Errorf("warm pass: %v", err)
+	}
+	if warm.Metrics == nil {
+		warm.Metrics = map[string]float64{}
+	}
+	warm.Metrics["cold_rows_per_sec"] = cold.RowsPerSec()
+	warm.Metrics["cold_p50_ns"] = float64(cold.Latency.P50.Nanoseconds())
+	warm.Metrics["cold_p95_ns"] = float64(cold.Latency.P95.Nanoseconds())
+	warm.Metrics["cold_p99_ns"] = float64(cold.Latency.P99.Nanoseconds())
+	if warm.Latency.P50 > 0 {
+		warm.Metrics["cold_p50_ratio"] = float64(cold.Latency.P50) / float64(warm.Latency.P50)
+	}
+	log.Printf("%s: cold %s ops/s (p50 %s, p99 %s), warm %s ops/s (p50 %s, p99 %s)", s.Name,
+		formatRate(cold.RowsPerSec()), formatDuration(cold.Latency.P50), formatDuration(cold.Latency.P99),
+		formatRate(warm.RowsPerSec()), formatDuration(warm.Latency.P50), formatDuration(warm.Latency.P99))
+	return warm, nil
+}
+
+// reconnect drops db's idle connections, which a server restart has
+// broken, and waits until the target answers a ping.
+func reconnect(ctx context.Context, db *sql.DB) error {
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(db.Stats().MaxOpenConnections)
+	deadline := time.Now().Add(coldRestartTimeout)
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			return fmt.Errorf("target not reachable after %v: %v", coldRestartTimeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// probeTable is the scratch table the capability probes create and drop.
+const probeTable = "benchmark_probe"
+
+// capabilities is what probing the target before the run found: its
+// version and, for each optional feature its dialect claims but the target
+// refused, the error it gave. A managed service may turn off what the
+// engine supports, or the user may lack the privilege for it.
+type capabilities struct {
+	Version string
+	lacking map[feature]string
+}
+
+// featureProbes exercise each optional feature against probeTable, which
+// has an id primary key and an int column v.
+var featureProbes = []struct {
+	feature feature
+	probe   func(ctx context.Context, db *sql.DB, d dialect) error
+}{
+	{featureMultiRowValues, func(ctx context.Context, db *sql.DB, d dialect) error {
+		_, err := db.ExecContext(ctx, d.rebind("INSERT INTO "+probeTable+" (id, v) VALUES (?, ?), (?, ?)"), 1, 0, 2, 0)
+		return err
+	}},
+	{featureRowLocks, func(ctx context.Context, db *sql.DB, d dialect) error {
+		return inRolledBackTx(ctx, db, func(tx *sql.Tx) error {
+			return queryAndClose(ctx, tx, d.rebind("SELECT v FROM "+probeTable+" WHERE id = ? FOR UPDATE"), 1)
+		})
+	}},
+	{featureSkipLocked, func(ctx context.Context, db *sql.DB, d dialect) error {
+		return inRolledBackTx(ctx, db, func(tx *sql.Tx) error {
+			return queryAndClose(ctx, tx, d.rebind("SELECT v FROM "+probeTable+" WHERE id = ? FOR UPDATE SKIP LOCKED"), 1)
+		})
+	}},
+	{featureSavepoints, func(ctx context.Context, db *sql.DB, d dialect) error {
+		return inRolledBackTx(ctx, db, func(tx *sql.Tx) error {
+			for _, stmt := range []string{"SAVEPOINT benchmark_probe", "ROLLBACK TO SAVEPOINT benchmark_probe", "RELEASE SAVEPOINT benchmark_probe"} {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}},
+}
+
+// inRolledBackTx runs fn in a transaction it then rolls back.
+func inRolledBackTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+func queryAndClose(ctx context.Context, tx *sql.Tx, query string, args ...any) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// probeCapabilities reads the target's version and tries each optional
+// feature its dialect claims. Nothing it finds is fatal: the strategies
+// needing what the target lacks are skipped when their turn comes.
+func probeCapabilities(ctx context.Context, db *sql.DB, e *engine) *capabilities {
+	caps := &capabilities{lacking: map[feature]string{}}
+	for _, q := range e.Info {
+		if q.Name == "version" {
+			if v, err := queryInfo(db, q.Query); err == nil {
+				caps.Version = v
+			}
+		}
+	}
+	d := e.dialect
+	if d.Features&featureCreateTable != 0 {
+		// A table left behind by an interrupted probe may hold rows.
+		db.ExecContext(ctx, "DROP TABLE IF EXISTS "+probeTable)
+		cols := []column{{Name: "id", Type: typeBigInt, NotNull: true}, {Name: "v", Type: typeInt}}
+		if _, err := db.ExecContext(ctx, d.createTable(probeTable, cols, "id")); err != nil {
+			// The remaining probes need the table, so their features
+			// stay assumed.
+			caps.lacking[featureCreateTable] = err.Error()
+		} else {
+			for _, p := range featureProbes {
+				if d.Features&p.feature == 0 {
+					continue
+				}
+				if err := p.probe(ctx, db, d); err != nil {
+					caps.lacking[p.feature] = err.Error()
+				}
+			}
+			if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+probeTable); err != nil {
+				log.Printf("Warning: could not drop %s: %v", probeTable, err)
+			}
+		}
+	}
+
+	summary := "all features available"
+	if lacking := caps.lackingNames(); len(lacking) > 0 {
+		summary = "lacking " + strings.Join(lacking, ", ")
+	}
+	log.Printf("Target %s: %s", orDash(caps.Version), summary)
+	events.emit("capabilities", map[string]any{"version": caps.Version, "lacking": caps.lackingNames()})
+	return caps
+}
+
+// lackingNames names the features the target lacks.
+func (c *capabilities) lackingNames() []string {
+	var missing feature
+	for f := range c.lacking {
+		missing |= f
+	}
+	return missing.names()
+}
+
+// unsupported returns why the target can't run s, or "" if it can as far
+// as the probes tell: a needed feature it refused, or the error of the
+// strategy's own Probe.
+func (c *capabilities) unsupported(ctx context.Context, db *sql.DB, s Strategy, opts RunOptions) string {
+	if c == nil {
+		return ""
+	}
+	needs := s.Features
+	if s.Schema != nil {
+		needs |= featureCreateTable
+	}
+	for _, n := range featureNames {
+		if reason, ok := c.lacking[n.f]; ok && needs&n.f != 0 {
+			return fmt.Sprintf("target lacks %s: %s", n.name, reason)
+		}
+	}
+	if s.Probe != nil {
+		if err := s.Probe(ctx, db, opts); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
+// probeSchema is a Strategy.Probe for strategies needing column types,
+// indexes or functions the target may not have: it creates the table
+// schema returns as probeTable, runs the query query returns against it,
+// if query is set, and drops it again.
+func probeSchema(schema func(e *engine, table string) string, query func(e *engine, table string) (string, []any)) func(ctx context.Context, db *sql.DB, opts RunOptions) error {
+	return func(ctx context.Context, db *sql.DB, opts RunOptions) error {
+		if _, err := db.ExecContext(ctx, schema(opts.Engine, probeTable)); err != nil {
+			return fmt.Errorf("target can't create the table: %v", err)
+		}
+		defer func() {
+			if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+probeTable); err != nil {
+				log.Printf("Warning: could not drop %s: %v", probeTable, err)
+			}
+		}()
+		if query == nil {
+			return nil
+		}
+		q, args := query(opts.Engine, probeTable)
+		rows, err := db.QueryContext(ctx, q, args...)
+		if err != nil {
+			return fmt.Errorf("target can't run the query: %v", err)
+		}
+		return rows.Close()
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// capturedWorkload is the weighted workload definition written by capture
+// and executed by the captured-workload strategy.
+type capturedWorkload struct {
+	CapturedAt time.Time           `json:"captured_at"`
+	Target     string              `json:"target"`
+	Statements []capturedStatement `json:"statements"`
+}
+
+// capturedStatement is one statement digest. Weight is its share of the
+// captured executions; Sample is a concrete statement with real values,
+// which is what gets executed.
+//
+// Hand-written workload files may give a Template instead of a Sample; its
+// {{...}} generators (see workloadgen.go) become bind parameters drawn
+// afresh for every execution. InsertID names the generated keys of a
+// templated INSERT so that later statements can ref() them.
+type capturedStatement struct {
+	Digest     string        `json:"digest,omitempty"`
+	DigestText string        `json:"digest_text,omitempty"`
+	Sample     string        `json:"sample,omitempty"`
+	Template   string        `json:"template,omitempty"`
+	InsertID   string        `json:"insert_id,omitempty"`
+	Count      int64         `json:"count,omitempty"`
+	Weight     float64       `json:"weight"`
+	AvgLatency time.Duration `json:"avg_latency_ns,omitempty"`
+	Read       bool          `json:"read"`
+
+	template paramTemplate
+}
+
+// label names the statement in errors.
+func (s capturedStatement) label() string {
+	if s.Digest != "" {
+		return "digest " + s.Digest
+	}
+	return fmt.Sprintf("statement %q", s.query())
+}
+
+func (s capturedStatement) query() string {
+	if s.Template != "" {
+		return s.Template
+	}
+	return s.Sample
+}
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "captured-workload",
+		Description: "Running the captured statement mix",
+		Engines:     []string{"mysql"},
+		Params: []Param{
+			{Name: "workload.file", Description: "workload definition written by the capture command; the strategy runs only when set"},
+			{Name: "workload.writes", Default: "false", Description: "also execute captured statements that modify data"},
+			{Name: "workload.seed", Default: "1", Description: "seed for the weighted statement choice and the template generators"},
+		},
+		Read: true,
+		// The samples name their own tables; don't create a dedicated one.
+		Table:    sharedTable,
+		Enabled:  func(opts RunOptions) bool { return opts.param("workload.file", "") != "" },
+		Requires: "-param workload.file",
+		Run:      runCapturedWorkload,
+	})
+}
+
+// captureCommand derives a workload definition from the statement digests
+// the target's performance_schema has collected, weighting each digest by
+// its execution count. Digests without a sample statement (truncated or
+// never sampled) are dropped since they can't be executed.
+func captureCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	output := fs.String("output", getEnv("BENCHMARK_WORKLOAD_FILE", "workload.json"), "file to write the workload definition to")
+	schema := fs.String("schema", config.Database, "schema whose statements are captured")
+	top := fs.Int("top", 50, "capture at most this many digests, by execution count")
+	minCount := fs.Int64("min-count", 10, "ignore digests executed fewer times")
+	fs.Parse(args)
+
+	if config.Engine != "mysql" {
+		return fmt.Errorf("capture reads MySQL's performance_schema; engine %q is not supported", config.Engine)
+	}
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+
+	stmts, err := captureDigests(context.Background(), db, *schema, *top, *minCount)
+	if err != nil {
+		return err
+	}
+	if len(stmts) == 0 {
+		return fmt.Errorf("no statement digests with samples found for schema %q", *schema)
+	}
+
+	w := capturedWorkload{CapturedAt: time.Now().UTC(), Target: config.Target(), Statements: stmts}
+	if err := writeJSON(*output, w); err != nil {
+		return err
+	}
+
+	reads := 0
+	for _, s := range stmts {
+		if s.Read {
+			reads++
+		}
+	}
+	log.Printf("Captured %d statement digests (%d reads) into %s; run them with -param workload.file=%s",
+		len(stmts), reads, *output, *output)
+	return nil
+}
+
+func captureDigests(ctx context.Context, db *sql.DB, schema string, top int, minCount int64) ([]capturedStatement, error) {
+	// Digests that haven't executed since the statistics were last
+	// truncated have no average latency or weight, so at least one
+	// execution is required whatever -min-count says.
+	rows, err := db.QueryContext(ctx, `SELECT DIGEST, DIGEST_TEXT, QUERY_SAMPLE_TEXT, COUNT_STAR, SUM_TIMER_WAIT
+		FROM performance_schema.events_statements_summary_by_digest
+		WHERE SCHEMA_NAME = ? AND DIGEST_TEXT IS NOT NULL AND COUNT_STAR >= ?
+		ORDER BY COUNT_STAR DESC LIMIT ?`, schema, max(minCount, 1), top)
+	if err != nil {
+		return nil, fmt.Errorf("query statement digests (needs MySQL 8.0 and performance_schema): %v", err)
+	}
+	defer rows.Close()
+
+	var stmts []capturedStatement
+	var total int64
+	for rows.Next() {
+		var s capturedStatement
+		var sample sql.NullString
+		var timerWait uint64
+		if err := rows.Scan(&s.Digest, &s.DigestText, &sample, &s.Count, &timerWait); err != nil {
+			return nil, fmt.Errorf("scan digest: %v", err)
+		}
+		// Samples cut off at performance_schema_max_sql_text_length end in "...".
+		if !sample.Valid || sample.String == "" || strings.HasSuffix(sample.String, "...") {
+			continue
+		}
+		s.Sample = sample.String
+		s.Read = isReadStatement(s.DigestText)
+		// SUM_TIMER_WAIT is in picoseconds.
+		s.AvgLatency = time.Duration(timerWait / uint64(s.Count) / 1000)
+		total += s.Count
+		stmts = append(stmts, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read digests: %v", err)
+	}
+	for i := range stmts {
+		stmts[i].Weight = float64(stmts[i].Count) / float64(total)
+	}
+	return stmts, nil
+}
+
+func loadCapturedWorkload(path string, writes bool) ([]capturedStatement, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read workload: %v", err)
+	}
+	var w capturedWorkload
+	if err := json.Unmarshal(raw, &w); err != nil {
+		return nil, fmt.Errorf("parse workload %s: %v", path, err)
+	}
+	var stmts []capturedStatement
+	for _, s := range w.Statements {
+		if s.Template != "" {
+			t, err := compileTemplate(s.Template)
+			if err != nil {
+				return nil, fmt.Errorf("workload %s: %v", path, err)
+			}
+			s.template = t
+			s.Read = isReadStatement(s.Template)
+		}
+		if s.InsertID != "" && (s.Template == "" || s.Read) {
+			return nil, fmt.Errorf("workload %s: insert_id %q needs a templated INSERT", path, s.InsertID)
+		}
+		if s.query() == "" {
+			return nil, fmt.Errorf("workload %s: statement without a sample or template", path)
+		}
+		if s.Weight > 0 && (s.Read || writes) {
+			stmts = append(stmts, s)
+		}
+	}
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("workload %s has no statements to run", path)
+	}
+	return stmts, nil
+}
+
+// runCapturedWorkload executes the captured statements, choosing each one
+// at random in proportion to its weight. A templated statement that refs
+// IDs before any were inserted is passed over for another choice. Rows
+// counts statements executed; Metrics reports how many digests the mix
+// contains.
+func runCapturedWorkload(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	stmts, err := loadCapturedWorkload(opts.param("workload.file", ""), opts.param("workload.writes", "false") == "true")
+	if err != nil {
+		return Result{}, err
+	}
+	cumulative := make([]float64, len(stmts))
+	sum := 0.0
+	for i, s := range stmts {
+		sum += s.Weight
+		cumulative[i] = sum
+	}
+	rng := rand.New(rand.NewSource(int64(opts.intParam("workload.seed", 1))))
+	start := time.Now()
+
+	state := newWorkloadState()
+
+	var rec latencyRecorder
+	plans := opts.planRecorder()
+	i, passed := 0, 0
+	for !opts.done(i, start) {
+		k := sort.SearchFloat64s(cumulative, rng.Float64()*sum)
+		if k == len(stmts) {
+			k--
+		}
+		s := stmts[k]
+		query, args := s.Sample, []any(nil)
+		if s.Template != "" {
+			query = opts.bind(s.template.query)
+			if args, err = s.template.args(rng, state); errors.Is(err, errNoRef) {
+				// Give up if the statements that insert the IDs never come up.
+				if passed++; passed > 1000 {
+					return Result{}, fmt.Errorf("%s: %v", s.label(), err)
+				}
+				continue
+			} else if err != nil {
+				return Result{}, fmt.Errorf("%s: %v", s.label(), err)
+			}
+		}
+		passed = 0
+		if s.Read {
+			// A template's arguments only exist once the run is under way,
+			// so the plan is captured in the loop with its time left out
+			// of the run's.
+			explainStart := time.Now()
+			plans.capture(ctx, db, query, args...)
+			start = start.Add(time.Since(explainStart))
+		}
+
+		opStart := time.Now()
+		if s.InsertID != "" {
+			res, err := db.ExecContext(ctx, query, args...)
+			if err != nil {
+				return Result{}, fmt.Errorf("%s: %v", s.label(), err)
+			}
+			rec.observe(time.Since(opStart))
+			id, err := res.LastInsertId()
+			if err != nil {
+				return Result{}, fmt.Errorf("%s: insert ID: %v", s.label(), err)
+			}
+			state.recordID(s.InsertID, id)
+		} else {
+			if err := execReplay(ctx, db, replayStatement{query: query, args: args, read: s.Read}); err != nil {
+				return Result{}, fmt.Errorf("%s: %v", s.label(), err)
+			}
+			rec.observe(time.Since(opStart))
+		}
+		i++
+	}
+
+	result := rec.result(i, time.Since(start))
+	result.Metrics = map[string]float64{"digests": float64(len(stmts))}
+	result.Plans = plans.plans
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "client-cache",
+		Description: "Point reads with and without an in-process LRU cache in front",
+		Params: []Param{
+			{Name: "cache.keys", Default: "1000", Description: "rows read, uniformly at random"},
+			{Name: "cache.hit_ratio", Default: "0.8", Description: "target hit ratio; the cache holds this fraction of the keys"},
+			{Name: "cache.ttl", Default: "1s", Description: "how long a cached row is served before it's read again, the bound on staleness"},
+			{Name: "cache.write_rate", Default: "5", Description: "percentage of operations that update a row in the database"},
+			{Name: "cache.invalidate", Default: "false", Description: "evict a row from the cache when it is updated (true) or let it expire (false)"},
+			{Name: "cache.workers", Default: "8", Description: "concurrent workers"},
+			{Name: "cache.seed", Default: "1", Description: "seed for choosing rows and operations"},
+		},
+		Read:     true,
+		Workload: workloadPointRead,
+		Table:    "benchmark_cache",
+		Schema:   accountsSchema,
+		Run:      compareClientCache,
+	})
+}
+
+// cachedRow is a row's version as read from the database, and when.
+type cachedRow struct {
+	version int64
+	at      time.Time
+}
+
+// cachePhase is what one phase of the client cache comparison measured.
+type cachePhase struct {
+	ops, reads, hits, stale int
+	staleAge                time.Duration // the oldest stale row served
+	elapsed                 time.Duration
+	latency                 []time.Duration
+}
+
+// compareClientCache runs the same mix of point reads and updates twice,
+// splitting Rows and Duration between the phases: reading from the
+// database every time, then through a cache-aside LRU of
+// cache.hit_ratio × cache.keys rows that expire after cache.ttl. The
+// rows are read uniformly, so the hit ratio settles near the cache's share
+// of the keys. Metrics report what the cache saves and costs: the
+// throughput and p50 of both phases, the hit ratio and so the share of
+// reads the database no longer serves, and the stale reads (rows served
+// from the cache after an update) with the oldest stale row's age as
+// stale_age_max_ns. Rows counts operations.
+func compareClientCache(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	keys := opts.intParam("cache.keys", 1000)
+	hitRatio := opts.floatParam("cache.hit_ratio", 0.8)
+	writeRate := opts.intParam("cache.write_rate", 5)
+	workers := opts.intParam("cache.workers", 8)
+	if keys < 1 || workers < 1 || hitRatio <= 0 || hitRatio > 1 || writeRate < 0 || writeRate > 100 {
+		return Result{}, fmt.Errorf("cache.keys and cache.workers must be at least 1, cache.hit_ratio in (0, 1] and cache.write_rate a percentage")
+	}
+	ttl, err := time.ParseDuration(opts.param("cache.ttl", "1s"))
+	if err != nil || ttl <= 0 {
+		return Result{}, fmt.Errorf("cache.ttl: invalid duration %q", opts.param("cache.ttl", "1s"))
+	}
+	if err := resetAccounts(ctx, db, opts, keys); err != nil {
+		return Result{}, err
+	}
+	// The versions the workers have written, which a cached row older than
+	// is stale.
+	versions := make([]atomic.Int64, keys)
+	phaseOpts := opts.phase(2)
+
+	var rec latencyRecorder
+	plans := opts.planRecorder()
+	uncached, err := runCachePhase(ctx, db, phaseOpts, versions, nil, false, &rec, plans)
+	if err != nil {
+		return Result{}, fmt.Errorf("without cache: %v", err)
+	}
+	cache := expirable.NewLRU[int, cachedRow](max(int(hitRatio*float64(keys)), 1), nil, ttl)
+	cached, err := runCachePhase(ctx, db, phaseOpts, versions, cache, opts.param("cache.invalidate", "false") == "true", &rec, plans)
+	if err != nil {
+		return Result{}, fmt.Errorf("with cache: %v", err)
+	}
+
+	result := rec.result(uncached.ops+cached.ops, uncached.elapsed+cached.elapsed)
+	result.Plans = plans.plans
+	reads := max(cached.reads, 1)
+	result.Metrics = map[string]float64{
+		"uncached_ops_per_sec": float64(uncached.ops) / uncached.elapsed.Seconds(),
+		"cached_ops_per_sec":   float64(cached.ops) / cached.elapsed.Seconds(),
+		"uncached_p50_ns":      float64(summarizeLatency(uncached.latency).P50.Nanoseconds()),
+		"cached_p50_ns":        float64(summarizeLatency(cached.latency).P50.Nanoseconds()),
+		"hit_ratio":            float64(cached.hits) / float64(reads),
+		"stale_reads":          float64(cached.stale),
+		"stale_read_pct":       100 * float64(cached.stale) / float64(reads),
+		"stale_age_max_ns":     float64(cached.staleAge.Nanoseconds()),
+	}
+	log.Printf("client-cache: %s ops/s uncached, %s ops/s cached; %.1f%% of reads served by the cache, %d stale (up to %s old)",
+		formatRate(result.Metrics["uncached_ops_per_sec"]), formatRate(result.Metrics["cached_ops_per_sec"]), 100*result.Metrics["hit_ratio"], cached.stale, formatDuration(cached.staleAge))
+	return result, nil
+}
+
+// runCachePhase runs the workload until opts is done, reading through
+// cache unless it is nil, and observes each operation in rec as it
+// finishes. The read's plan is captured in plans first.
+func runCachePhase(ctx context.Context, db *sql.DB, opts RunOptions, versions []atomic.Int64, cache *expirable.LRU[int, cachedRow], invalidate bool, rec *latencyRecorder, plans *planRecorder) (cachePhase, error) {
+	writeRate := opts.intParam("cache.write_rate", 5)
+	seed := int64(opts.intParam("cache.seed", 1))
+	read := opts.bind("SELECT version FROM " + opts.table() + " WHERE id = ?")
+	update := opts.bind("UPDATE " + opts.table() + " SET version = version + 1 WHERE id = ?")
+	var (
+		claimed atomic.Int64
+		mu      sync.Mutex
+		p       cachePhase
+	)
+	plans.capture(ctx, db, read, 0)
+	start := time.Now()
+	err := runWorkers(ctx, opts.intParam("cache.workers", 8), func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		var local cachePhase
+		defer func() {
+			mu.Lock()
+			p.ops += local.ops
+			p.reads += local.reads
+			p.hits += local.hits
+			p.stale += local.stale
+			p.staleAge = max(p.staleAge, local.staleAge)
+			p.latency = append(p.latency, local.latency...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			if opts.done(int(claimed.Add(1))-1, start) {
+				return nil
+			}
+			k := rng.Intn(len(versions))
+			opStart := time.Now()
+			if rng.Intn(100) < writeRate {
+				if _, err := db.ExecContext(ctx, update, k); err != nil {
+					return fmt.Errorf("update error: %v", err)
+				}
+				versions[k].Add(1)
+				if cache != nil && invalidate {
+					cache.Remove(k)
+				}
+			} else {
+				local.reads++
+				row, hit := cachedRow{}, false
+				if cache != nil {
+					row, hit = cache.Get(k)
+				}
+				if hit {
+					local.hits++
+					if row.version < versions[k].Load() {
+						local.stale++
+						local.staleAge = max(local.staleAge, time.Since(row.at))
+					}
+				} else {
+					row.at = time.Now()
+					if err := db.QueryRowContext(ctx, read, k).Scan(&row.version); err != nil {
+						return fmt.Errorf("read error: %v", err)
+					}
+					if cache != nil {
+						cache.Add(k, row)
+					}
+				}
+			}
+			d := time.Since(opStart)
+			local.latency = append(local.latency, d)
+			local.ops++
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+		}
+		return nil
+	})
+	p.elapsed = time.Since(start)
+	return p, err
+}
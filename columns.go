@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "wide-rows",
+		Description: "Inserting and selecting rows of 5, 50 and 200 columns",
+		Features:    featureCreateTable,
+		Params: []Param{
+			{Name: "wide.columns", Default: "5/50/200", Description: "slash-separated column counts to compare, id included; the columns alternate BIGINT and VARCHAR(32)"},
+			{Name: "wide.read_batch", Default: "100", Description: "rows each SELECT * returns"},
+		},
+		Workload: workloadSingleInsert,
+		Run:      compareColumnCounts,
+	})
+}
+
+// manyColumnsTable is the table with the given number of columns.
+func manyColumnsTable(columns int) string {
+	return fmt.Sprintf("benchmark_wide_%d", columns)
+}
+
+// manyColumns are id and then columns-1 alternating BIGINT and VARCHAR
+// columns c1, c2, ...
+func manyColumns(columns int) []column {
+	cols := []column{{Name: "id", Type: typeBigInt, NotNull: true}}
+	for i := 1; i < columns; i++ {
+		c := column{Name: "c" + strconv.Itoa(i), Type: typeBigInt, NotNull: true}
+		if i%2 == 0 {
+			c.Type, c.Size = typeVarchar, 32
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+// manyColumnValues are the values of row id's columns after id.
+func manyColumnValues(cols []column, id int) []any {
+	values := make([]any, 0, len(cols))
+	values = append(values, id)
+	for i, c := range cols[1:] {
+		if c.Type == typeVarchar {
+			values = append(values, fmt.Sprintf("value %d of %d", i+1, id))
+		} else {
+			values = append(values, int64(id)*int64(i+1))
+		}
+	}
+	return values
+}
+
+// compareColumnCounts inserts into and then reads back from one table per
+// count in wide.columns, splitting Rows and Duration evenly between the
+// insert and the read phase of each; a read phase bounded by Rows runs
+// that many queries. Serialization in the driver, the
+// protocol and the server grows with the column count in ways the two
+// columns of benchmark_users can't show. Inserts are single-row; reads are
+// SELECT * of wide.read_batch rows. Rows counts inserted rows. Metrics
+// report per column count the insert and read throughput and p50, e.g.
+// c200_insert_rows_per_sec and c200_select_p50_ns.
+func compareColumnCounts(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	var counts []int
+	for _, v := range opts.listParam("wide.columns", "5/50/200") {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Result{}, fmt.Errorf("wide.columns: %q is not a column count", v)
+		}
+		counts = append(counts, n)
+	}
+	if len(counts) == 0 {
+		return Result{}, fmt.Errorf("wide.columns is empty")
+	}
+	readBatch := opts.intParam("wide.read_batch", 100)
+	if readBatch < 1 {
+		return Result{}, fmt.Errorf("wide.read_batch must be at least 1")
+	}
+	phaseOpts := opts.phase(2 * len(counts))
+
+	var rec latencyRecorder
+	var total time.Duration
+	inserted := 0
+	metrics := map[string]float64{}
+	for _, n := range counts {
+		table, cols := manyColumnsTable(n), manyColumns(n)
+		if _, err := db.ExecContext(ctx, opts.Engine.createTable(table, cols, "id")); err != nil {
+			return Result{}, fmt.Errorf("create table %s: %v", table, err)
+		}
+		var first int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&first); err != nil {
+			return Result{}, fmt.Errorf("count rows: %v", err)
+		}
+
+		names := make([]string, len(cols))
+		for i, c := range cols {
+			names[i] = c.Name
+		}
+		insert := opts.bind("INSERT INTO " + table + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")")
+		var inserts []time.Duration
+		start := time.Now()
+		for i := 0; !phaseOpts.done(i, start); i++ {
+			values := manyColumnValues(cols, first+i)
+			opStart := time.Now()
+			if _, err := db.ExecContext(ctx, insert, values...); err != nil {
+				return Result{}, fmt.Errorf("%d columns: insert error: %v", n, err)
+			}
+			d := time.Since(opStart)
+			rec.observe(d)
+			inserts = append(inserts, d)
+		}
+		insertTime := time.Since(start)
+
+		rowsInTable := first + len(inserts)
+		query := opts.bind("SELECT * FROM " + table + " WHERE id >= ? ORDER BY id " + opts.Engine.limit(readBatch))
+		var selects []time.Duration
+		read := 0
+		start = time.Now()
+		for q := 0; rowsInTable > 0 && !phaseOpts.done(q, start); q++ {
+			opStart := time.Now()
+			got, err := selectManyColumns(ctx, db, query, (q*readBatch)%rowsInTable, len(cols))
+			if err != nil {
+				return Result{}, fmt.Errorf("%d columns: %v", n, err)
+			}
+			selects = append(selects, time.Since(opStart))
+			read += got
+		}
+		selectTime := time.Since(start)
+		inserted += len(inserts)
+		total += insertTime + selectTime
+
+		key := "c" + strconv.Itoa(n) + "_"
+		insertStats, selectStats := summarizeLatency(inserts), summarizeLatency(selects)
+		metrics[key+"insert_rows_per_sec"] = float64(len(inserts)) / insertTime.Seconds()
+		metrics[key+"insert_p50_ns"] = float64(insertStats.P50.Nanoseconds())
+		metrics[key+"select_rows_per_sec"] = float64(read) / selectTime.Seconds()
+		metrics[key+"select_p50_ns"] = float64(selectStats.P50.Nanoseconds())
+		log.Printf("wide-rows: %d columns: %s inserts/s (p50 %s), %s rows/s read by SELECT * (p50 %s per query)",
+			n, formatRate(metrics[key+"insert_rows_per_sec"]), formatDuration(insertStats.P50), formatRate(metrics[key+"select_rows_per_sec"]), formatDuration(selectStats.P50))
+	}
+
+	result := rec.result(inserted, total)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// selectManyColumns runs query from id and reads every column of its rows as raw
+// bytes, returning how many rows it read.
+func selectManyColumns(ctx context.Context, db *sql.DB, query string, from, columns int) (int, error) {
+	rows, err := db.QueryContext(ctx, query, from)
+	if err != nil {
+		return 0, fmt.Errorf("select error: %v", err)
+	}
+	defer rows.Close()
+	raw := make([]sql.RawBytes, columns)
+	dest := make([]any, columns)
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return n, fmt.Errorf("scan error: %v", err)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, fmt.Errorf("select error: %v", err)
+	}
+	return n, nil
+}
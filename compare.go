@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// compareConfig lists the targets benchmarked by the compare command. The
+// run bounds apply to every target alike.
+type compareConfig struct {
+	Targets []struct {
+		Name    string   `json:"name"`
+		DB      targetDB `json:"db"`
+		Caveats []string `json:"caveats"`
+	} `json:"targets"`
+	Rows        int               `json:"rows"`
+	Duration    string            `json:"duration"`
+	BatchSize   int               `json:"batch_size"`
+	Params      map[string]string `json:"params"`
+	SharedTable bool              `json:"shared_table"`
+}
+
+// engineReport is the normalized outcome for one target: what it is, how
+// it was configured and the results of each strategy it ran.
+type engineReport struct {
+	Name    string            `json:"name"`
+	Engine  string            `json:"engine"`
+	Target  string            `json:"target"`
+	Info    map[string]string `json:"info,omitempty"`
+	Caveats []string          `json:"caveats,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Results []Result          `json:"results"`
+}
+
+// compareCommand benchmarks several targets, possibly of different
+// engines, and tabulates their results per workload in one matrix.
+func compareCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	configPath := fs.String("config", getEnv("BENCHMARK_COMPARE_CONFIG", "-"), `JSON file listing the targets, or "-" for stdin`)
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the comparison matrix to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", getEnv("BENCHMARK_COMPARE_JSON", ""), `also write the normalized reports as JSON to this file ("-" for stdout)`)
+	preflight := fs.Bool("preflight", getEnvAsBool("BENCHMARK_PREFLIGHT", true), "check on each target before any work starts that the user has SELECT, INSERT, CREATE and DROP on the database, naming those missing")
+	fs.Parse(args)
+
+	cfg, err := loadCompareConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	opts := RunOptions{Rows: cfg.Rows, BatchSize: cfg.BatchSize, Params: cfg.Params, SharedTable: cfg.SharedTable, Preflight: *preflight}
+	if cfg.Duration != "" {
+		if opts.Duration, err = time.ParseDuration(cfg.Duration); err != nil {
+			return fmt.Errorf("invalid duration %q: %v", cfg.Duration, err)
+		}
+	}
+	if opts.Rows <= 0 && opts.Duration <= 0 {
+		opts.Rows = getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000)
+	}
+
+	var reports []engineReport
+	failed := 0
+	for _, t := range cfg.Targets {
+		target := t.DB.apply(config)
+		name := t.Name
+		if name == "" {
+			name = target.Engine
+		}
+		log.Printf("Benchmarking %s (%s)", name, target.Target())
+		report := benchmarkEngine(target, opts)
+		report.Name = name
+		report.Caveats = append(t.Caveats, report.Caveats...)
+		if report.Error != "" {
+			log.Printf("Warning: %s failed: %s", name, report.Error)
+			failed++
+		}
+		reports = append(reports, report)
+	}
+
+	if err := writeMarkdown(*markdown, renderComparison(reports), false); err != nil {
+		return err
+	}
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, reports); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(reports))
+	}
+	return nil
+}
+
+func loadCompareConfig(path string) (compareConfig, error) {
+	var cfg compareConfig
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return cfg, fmt.Errorf("open config: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("parse config: %v", err)
+	}
+	if len(cfg.Targets) == 0 {
+		return cfg, fmt.Errorf("config lists no targets")
+	}
+	return cfg, nil
+}
+
+// benchmarkEngine runs the strategy sequence against one target and
+// collects its version and durability settings. Failures are recorded in
+// the report so that the remaining targets still run.
+func benchmarkEngine(config DBConfig, opts RunOptions) engineReport {
+	report := engineReport{Engine: config.Engine, Target: config.Target(), Results: []Result{}}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	opts.Engine = eng
+
+	if eng.Native != nil {
+		report.Caveats = append(report.Caveats, "native client mapping of the workloads; version and durability settings not collected")
+	} else if len(eng.Info) > 0 {
+		db, err := createConnectionPool(config)
+		if err != nil {
+			report.Error = fmt.Sprintf("failed to create connection pool: %v", err)
+			return report
+		}
+		report.Info = map[string]string{}
+		for _, q := range eng.Info {
+			value, err := queryInfo(db, q.Query)
+			if err != nil {
+				report.Caveats = append(report.Caveats, fmt.Sprintf("could not read %s: %v", q.Name, err))
+				continue
+			}
+			report.Info[q.Name] = value
+		}
+		db.Close()
+	}
+
+	results, err := benchmarkTarget(config, opts, 1)
+	if results != nil {
+		report.Results = results
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+func queryInfo(db *sql.DB, query string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var value sql.NullString
+	if err := db.QueryRowContext(ctx, query).Scan(&value); err != nil {
+		return "", err
+	}
+	if !value.Valid {
+		return "NULL", nil
+	}
+	return value.String, nil
+}
+
+// workloadOf is the comparison row a result belongs to; strategies without
+// an engine-neutral workload get a row of their own.
+func workloadOf(r Result) string {
+	if r.Workload != "" {
+		return r.Workload
+	}
+	return r.Strategy
+}
+
+// renderComparison produces the engine summary and the workload × engine
+// matrix. Where an engine ran several strategies of the same workload, the
+// cell shows its fastest one.
+func renderComparison(reports []engineReport) string {
+	var b strings.Builder
+	b.WriteString("### Engine comparison\n\n")
+	b.WriteString("| Target | Engine | Version | Durability settings | Caveats |\n|---|---|---|---|---|\n")
+	for _, r := range reports {
+		var settings []string
+		for k, v := range r.Info {
+			if k != "version" {
+				settings = append(settings, fmt.Sprintf("`%s=%s`", k, v))
+			}
+		}
+		sort.Strings(settings)
+		caveats := append([]string(nil), r.Caveats...)
+		if r.Error != "" {
+			caveats = append(caveats, ":x: "+strings.ReplaceAll(r.Error, "\n", " "))
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", r.Name, r.Engine, orDash(r.Info["version"]),
+			orDash(strings.Join(settings, " ")), orDash(strings.Join(caveats, "; ")))
+	}
+
+	var workloads []string
+	best := make([]map[string]Result, len(reports))
+	for i, r := range reports {
+		best[i] = map[string]Result{}
+		for _, res := range r.Results {
+			if res.Skipped != "" {
+				continue
+			}
+			w := workloadOf(res)
+			if !slices.Contains(workloads, w) {
+				workloads = append(workloads, w)
+			}
+			if cur, ok := best[i][w]; !ok || res.RowsPerSec() > cur.RowsPerSec() {
+				best[i][w] = res
+			}
+		}
+	}
+	if len(workloads) == 0 {
+		b.WriteString("\n_No strategies completed._\n")
+		return b.String()
+	}
+
+	b.WriteString("\n| Workload |")
+	for _, r := range reports {
+		fmt.Fprintf(&b, " %s |", r.Name)
+	}
+	b.WriteString("\n|---|" + strings.Repeat("--:|", len(reports)) + "\n")
+	for _, w := range workloads {
+		fmt.Fprintf(&b, "| %s |", w)
+		for i := range reports {
+			res, ok := best[i][w]
+			if !ok {
+				b.WriteString(" – |")
+				continue
+			}
+			fmt.Fprintf(&b, " %s/s, p95 %s (`%s`) |", formatRate(res.RowsPerSec()), formatDuration(res.Latency.P95), res.Strategy)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\nRates are rows/s for inserts and queries/s for reads.\n")
+	return b.String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "–"
+	}
+	return s
+}
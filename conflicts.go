@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// uniqueConflictTable gets a unique index on email, so unique-conflict
+// uses it even with -shared-table.
+const uniqueConflictTable = "benchmark_users_unique"
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "unique-conflict",
+		Description: "Using single-row INSERT against a unique email index",
+		// Creates and indexes its own copy of benchmark_users.
+		Features: featureCreateTable,
+		Params: []Param{
+			{Name: "conflict.rate", Default: "10", Description: "percentage of inserts that reuse an existing email (0-100)"},
+			{Name: "conflict.seed", Default: "1", Description: "seed for choosing which inserts conflict"},
+		},
+		Workload: workloadSingleInsert,
+		Table:    uniqueConflictTable,
+		// Duplicates are told apart from failures by the error class.
+		Enabled: func(opts RunOptions) bool { return opts.Engine != nil && opts.Engine.Classify != nil },
+		Run:     insertWithUniqueConflicts,
+	})
+}
+
+func createUniqueEmailIndex(ctx context.Context, db *sql.DB, opts RunOptions) error {
+	table := opts.table()
+	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE UNIQUE INDEX %s_email_key ON %s (email)", table, table))
+	if err != nil && opts.Engine.classify(err) != errAlreadyExists {
+		return fmt.Errorf("create unique index: %v", err)
+	}
+	return nil
+}
+
+// insertWithUniqueConflicts inserts single rows of which conflict.rate
+// percent deliberately reuse the email of an earlier row. Duplicate-key
+// errors are expected and counted; Rows counts attempts, so throughput
+// includes the cost of rejected inserts. Latency of accepted and rejected
+// inserts is reported separately in Metrics.
+func insertWithUniqueConflicts(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	rate := opts.floatParam("conflict.rate", 10)
+	if rate < 0 || rate > 100 {
+		return Result{}, fmt.Errorf("conflict.rate must be between 0 and 100, got %g", rate)
+	}
+	if err := createUniqueEmailIndex(ctx, db, opts); err != nil {
+		return Result{}, err
+	}
+	rng := rand.New(rand.NewSource(int64(opts.intParam("conflict.seed", 1))))
+	// The table outlives the run, so fresh emails carry a run-unique base.
+	base := time.Now().UnixMicro()
+	start := time.Now()
+
+	var rec latencyRecorder
+	var accepted, rejected []time.Duration
+	i, inserted := 0, 0
+	for ; !opts.done(i, start); i++ {
+		email := fmt.Sprintf("unique%d-%d@example.com", base, inserted)
+		if inserted > 0 && rng.Float64()*100 < rate {
+			email = fmt.Sprintf("unique%d-%d@example.com", base, rng.Intn(inserted))
+		}
+
+		opStart := time.Now()
+		_, err := db.ExecContext(ctx, opts.insertSQL(), fmt.Sprintf("UserUnique%d", i), email)
+		elapsed := time.Since(opStart)
+		rec.observe(elapsed)
+		switch {
+		case err == nil:
+			accepted = append(accepted, elapsed)
+			inserted++
+		case opts.Engine.classify(err) == errDuplicateKey:
+			rejected = append(rejected, elapsed)
+		default:
+			return Result{}, fmt.Errorf("insert error: %v", err)
+		}
+	}
+
+	result := rec.result(i, time.Since(start))
+	conflicts := i - inserted
+	result.Metrics = map[string]float64{
+		"conflict_rate_target": rate,
+		"conflicts":            float64(conflicts),
+	}
+	if i > 0 {
+		result.Metrics["conflict_rate"] = 100 * float64(conflicts) / float64(i)
+	}
+	acceptedStats, rejectedStats := summarizeLatency(accepted), summarizeLatency(rejected)
+	result.Metrics["accepted_p50_ns"] = float64(acceptedStats.P50.Nanoseconds())
+	result.Metrics["rejected_p50_ns"] = float64(rejectedStats.P50.Nanoseconds())
+	log.Printf("unique-conflict: %d of %d inserts rejected as duplicates (p50 accepted %s, rejected %s)",
+		conflicts, i, formatDuration(acceptedStats.P50), formatDuration(rejectedStats.P50))
+	return result, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// tracedNetwork is the network MySQL DSNs name to dial through a
+// connectTrace.
+const tracedNetwork = "traced"
+
+// connectPhases are the parts of establishing a connection that the
+// connect-breakdown command reports, in order.
+var connectPhases = []string{"dns", "tcp connect", "tls handshake", "startup and auth", "session init", "total"}
+
+// connectTrace times the network parts of one connection attempt. Name
+// resolution and dialing are timed where the driver calls out to them;
+// the TLS handshake is found on the wire, from the client's ClientHello
+// to its first application data record, which is the first message sent
+// over the encrypted connection.
+type connectTrace struct {
+	dns, tcp, tls time.Duration
+	tlsStart      time.Time
+	proxy         *proxyDialer
+}
+
+type connectTraceKey struct{}
+
+func traceFrom(ctx context.Context) *connectTrace {
+	if t, ok := ctx.Value(connectTraceKey{}).(*connectTrace); ok {
+		return t
+	}
+	return &connectTrace{}
+}
+
+// lookup resolves host, adding the time it took to the trace.
+func (t *connectTrace) lookup(ctx context.Context, host string) ([]string, error) {
+	start := time.Now()
+	defer func() { t.dns += time.Since(start) }()
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// dial connects to addr, resolving its host first unless it is an IP
+// address or DB_PROXY does, and trying each of its addresses in turn.
+func (t *connectTrace) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if t.proxy != nil {
+		start := time.Now()
+		conn, err := t.proxy.DialContext(ctx, network, addr)
+		t.tcp += time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+		return &tracedConn{Conn: conn, trace: t}, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips := []string{host}
+	if net.ParseIP(host) == nil {
+		if ips, err = t.lookup(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	var d net.Dialer
+	start := time.Now()
+	defer func() { t.tcp += time.Since(start) }()
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = d.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+			return &tracedConn{Conn: conn, trace: t}, nil
+		}
+	}
+	return nil, err
+}
+
+// tracedConn watches what the client writes for the TLS records that
+// begin and end its handshake.
+type tracedConn struct {
+	net.Conn
+	trace *connectTrace
+}
+
+func (c *tracedConn) Write(b []byte) (int, error) {
+	t := c.trace
+	switch {
+	case t.tlsStart.IsZero() && len(b) > 5 && b[0] == 0x16 && b[1] == 0x03 && b[5] == 0x01: // handshake record, ClientHello
+		t.tlsStart = time.Now()
+	case !t.tlsStart.IsZero() && t.tls == 0 && len(b) > 2 && b[0] == 0x17 && b[1] == 0x03: // application data record
+		t.tls = time.Since(t.tlsStart)
+	}
+	return c.Conn.Write(b)
+}
+
+var registerTracedNetwork sync.Once
+
+// tracedConnectors build a connector per SQL driver whose connections
+// dial through the connectTrace in the context they are made with.
+var tracedConnectors = map[string]func(eng *engine, config DBConfig) (driver.Connector, error){
+	"mysql": func(eng *engine, config DBConfig) (driver.Connector, error) {
+		registerTracedNetwork.Do(func() {
+			mysql.RegisterDialContext(tracedNetwork, func(ctx context.Context, addr string) (net.Conn, error) {
+				return traceFrom(ctx).dial(ctx, "tcp", withDefaultPort(addr, defaultPorts["mysql"]))
+			})
+		})
+		cfg, err := mysql.ParseDSN(eng.DSN(config))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net = tracedNetwork
+		return mysql.NewConnector(cfg)
+	},
+	"pgx": func(eng *engine, config DBConfig) (driver.Connector, error) {
+		cfg, err := pgx.ParseConfig(eng.DSN(config))
+		if err != nil {
+			return nil, err
+		}
+		cfg.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+			return traceFrom(ctx).lookup(ctx, host)
+		}
+		cfg.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return traceFrom(ctx).dial(ctx, network, addr)
+		}
+		return stdlib.GetConnector(*cfg), nil
+	},
+}
+
+// connectPhase is the latency of one part of establishing a connection
+// across the connect-breakdown command's connections.
+type connectPhase struct {
+	Phase   string       `json:"phase"`
+	Latency LatencyStats `json:"latency"`
+}
+
+// connectBreakdownCommand opens -n fresh connections one after the other
+// and splits the time each takes into name resolution, the TCP connect,
+// the TLS handshake, the protocol startup and authentication (including
+// whatever the driver sets up itself, such as DSN parameters sent as SET),
+// and DB_SESSION_INIT's statements, to show where per-connection cost
+// goes. Pair it with DB_PARAMS to compare e.g. TLS settings or
+// authentication plugins.
+func connectBreakdownCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("connect-breakdown", flag.ExitOnError)
+	n := fs.Int("n", 100, "fresh connections to open")
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the breakdown to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write the breakdown as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+	if *n < 1 {
+		return fmt.Errorf("-n must be at least 1")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	newConnector, ok := tracedConnectors[eng.Driver]
+	if !ok {
+		return fmt.Errorf("engine %s's driver can't be traced; connect-breakdown supports MySQL and pgx engines", eng.Name)
+	}
+	if len(splitHosts(config.Host)) > 1 {
+		return fmt.Errorf("connect-breakdown traces one host; DB_HOST lists several")
+	}
+	ctx := context.Background()
+	if config.Secrets != nil {
+		creds, err := config.Secrets.get(ctx, false)
+		if err != nil {
+			return err
+		}
+		config = withCredentials(config, creds)
+	}
+	connector, err := newConnector(eng, config)
+	if err != nil {
+		return err
+	}
+	if config.TunneledHost != "" {
+		log.Printf("Warning: connecting through the ssh tunnel; tcp connect is to its local end and the rest includes the forwarding")
+	}
+
+	samples := make([][]time.Duration, len(connectPhases))
+	for i := 0; i < *n; i++ {
+		trace := &connectTrace{}
+		if eng.Driver == "mysql" && config.Proxy != nil && config.TunneledHost == "" {
+			trace.proxy = config.Proxy
+		}
+		start := time.Now()
+		conn, err := connector.Connect(context.WithValue(ctx, connectTraceKey{}, trace))
+		if err != nil {
+			return fmt.Errorf("connect: %v", err)
+		}
+		connected := time.Since(start)
+		initStart := time.Now()
+		for _, s := range config.SessionInit {
+			if err := execDriverConn(ctx, conn, s); err != nil {
+				conn.Close()
+				return fmt.Errorf("session init %q: %v", s, err)
+			}
+		}
+		sessionInit := time.Since(initStart)
+		conn.Close()
+		for p, d := range []time.Duration{trace.dns, trace.tcp, trace.tls, connected - trace.dns - trace.tcp - trace.tls, sessionInit, connected + sessionInit} {
+			samples[p] = append(samples[p], d)
+		}
+	}
+
+	phases := make([]connectPhase, len(connectPhases))
+	for p, name := range connectPhases {
+		phases[p] = connectPhase{Phase: name, Latency: summarizeLatency(samples[p])}
+		log.Printf("%s: mean %v, p99 %v", name, roundLatency(phases[p].Latency.Mean), roundLatency(phases[p].Latency.P99))
+	}
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, phases); err != nil {
+			return err
+		}
+	}
+	return writeMarkdown(*markdown, renderConnectBreakdown(config.Target(), *n, phases), false)
+}
+
+func renderConnectBreakdown(target string, n int, phases []connectPhase) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Connection establishment on %s\n\nAveraged over %d fresh connections; the share is of the mean total.\n\n", target, n)
+	b.WriteString("| phase | mean | p50 | p99 | share |\n|---|--:|--:|--:|--:|\n")
+	total := phases[len(phases)-1].Latency.Mean
+	for _, p := range phases {
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(p.Latency.Mean) / float64(total)
+		}
+		fmt.Fprintf(&b, "| %s | %v | %v | %v | %.0f%% |\n", p.Phase, roundLatency(p.Latency.Mean), roundLatency(p.Latency.P50), roundLatency(p.Latency.P99), share)
+	}
+	return b.String()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// instanceType is the billing and sizing metadata of a database instance.
+type instanceType struct {
+	HourlyUSD float64 `json:"hourly_usd"`
+	VCPUs     float64 `json:"vcpus"`
+	MemoryGB  float64 `json:"memory_gb"`
+}
+
+// instanceTypes are on-demand, single-AZ list prices in us-east-1 (or the
+// nearest equivalent region), without storage, I/O or licensing. They go
+// stale; pass -pricing with the prices you actually pay.
+var instanceTypes = map[string]instanceType{
+	// Amazon RDS for MySQL and PostgreSQL.
+	"db.t4g.micro":  {0.016, 2, 1},
+	"db.t4g.medium": {0.065, 2, 4},
+	"db.t3.micro":   {0.017, 2, 1},
+	"db.t3.medium":  {0.068, 2, 4},
+	"db.m6g.large":  {0.152, 2, 8},
+	"db.m6g.xlarge": {0.304, 4, 16},
+	"db.m6i.large":  {0.171, 2, 8},
+	"db.m5.large":   {0.171, 2, 8},
+	"db.m5.xlarge":  {0.342, 4, 16},
+	"db.r6g.large":  {0.225, 2, 16},
+	"db.r6g.xlarge": {0.45, 4, 32},
+	"db.r6i.large":  {0.25, 2, 16},
+	"db.r5.large":   {0.25, 2, 16},
+	"db.r5.xlarge":  {0.50, 4, 32},
+	// Amazon EC2, for self-managed servers.
+	"c5.large":  {0.085, 2, 4},
+	"m5.large":  {0.096, 2, 8},
+	"m6i.large": {0.096, 2, 8},
+	"m6g.large": {0.077, 2, 8},
+	"r5.large":  {0.126, 2, 16},
+	// Google Compute Engine.
+	"e2-standard-2": {0.067, 2, 8},
+	"n2-standard-2": {0.0971, 2, 8},
+	"n2-standard-4": {0.1942, 4, 16},
+	// Azure virtual machines.
+	"Standard_D2s_v5": {0.096, 2, 8},
+	"Standard_D4s_v5": {0.192, 4, 16},
+}
+
+// Per-vCPU power at idle and at full load and per-GB memory power, the
+// averages the Cloud Carbon Footprint methodology uses for cloud servers.
+const (
+	minWattsPerVCPU  = 0.74
+	maxWattsPerVCPU  = 3.5
+	wattsPerMemoryGB = 0.392
+)
+
+// costModel estimates what each strategy's rows cost on the instance the
+// database runs on (-instance-type), assuming the benchmark has it to
+// itself and pays for it by the second. Energy follows the instance's
+// vCPUs and memory, at the CPU utilization -host-metrics measured or at
+// half load without it.
+type costModel struct {
+	Type  instanceType
+	Watts float64 // if positive, the instance's power draw instead of the estimate
+}
+
+// newCostModel looks up the instance type in instanceTypes and the JSON
+// pricing file, if any, which maps instance type names to instanceType
+// and takes precedence. hourly, if positive, overrides the price.
+func newCostModel(instance, pricing string, hourly, watts float64) (*costModel, error) {
+	types := instanceTypes
+	if pricing != "" {
+		data, err := os.ReadFile(pricing)
+		if err != nil {
+			return nil, fmt.Errorf("read pricing: %v", err)
+		}
+		var custom map[string]instanceType
+		if err := json.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("parse pricing %s: %v", pricing, err)
+		}
+		types = map[string]instanceType{}
+		for name, t := range instanceTypes {
+			types[name] = t
+		}
+		for name, t := range custom {
+			types[name] = t
+		}
+	}
+	m := &costModel{Watts: watts}
+	t, ok := types[instance]
+	switch {
+	case ok:
+		m.Type = t
+	case hourly <= 0:
+		names := make([]string, 0, len(types))
+		for name := range types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown instance type %q: set -hourly-cost or add it to -pricing (known: %s)", instance, strings.Join(names, ", "))
+	}
+	if hourly > 0 {
+		m.Type.HourlyUSD = hourly
+	}
+	return m, nil
+}
+
+// estimate adds to result's Metrics the instance's hourly_cost_usd, the
+// cost_usd and, when the instance's size is known, energy_wh of the
+// strategy's run, and both per million rows as cost_per_million_rows_usd
+// and energy_wh_per_million_rows.
+func (m *costModel) estimate(result *Result) {
+	if m == nil || result.Rows == 0 {
+		return
+	}
+	if result.Metrics == nil {
+		result.Metrics = map[string]float64{}
+	}
+	hours := result.Duration.Hours()
+	perMillion := 1e6 / float64(result.Rows)
+	cost := m.Type.HourlyUSD * hours
+	result.Metrics["hourly_cost_usd"] = m.Type.HourlyUSD
+	result.Metrics["cost_usd"] = cost
+	result.Metrics["cost_per_million_rows_usd"] = cost * perMillion
+
+	watts := m.Watts
+	if watts <= 0 && m.Type.VCPUs > 0 {
+		util := 0.5
+		if cpu, ok := result.Metrics["host_cpu_pct"]; ok {
+			util = cpu / 100
+		}
+		watts = m.Type.VCPUs*(minWattsPerVCPU+util*(maxWattsPerVCPU-minWattsPerVCPU)) + m.Type.MemoryGB*wattsPerMemoryGB
+	}
+	if watts > 0 {
+		result.Metrics["energy_wh"] = watts * hours
+		result.Metrics["energy_wh_per_million_rows"] = watts * hours * perMillion
+	}
+}
+
+// renderCosts tabulates the estimated cost per million rows of the
+// strategies that have one.
+func renderCosts(results []Result) string {
+	var b strings.Builder
+	for _, r := range results {
+		cost, ok := r.Metrics["cost_per_million_rows_usd"]
+		if !ok {
+			continue
+		}
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "\n#### Estimated cost per million rows\n\nAt $%.4f per instance hour, with the instance dedicated to the benchmark.\n\n", r.Metrics["hourly_cost_usd"])
+			b.WriteString("| Strategy | Cost | Energy |\n|---|--:|--:|\n")
+		}
+		energy := "–"
+		if wh, ok := r.Metrics["energy_wh_per_million_rows"]; ok {
+			energy = fmt.Sprintf("%.2f Wh", wh)
+		}
+		fmt.Fprintf(&b, "| `%s` | $%.4f | %s |\n", r.Strategy, cost, energy)
+	}
+	return b.String()
+}
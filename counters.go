@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tables of the counter strategies. counter-update and counter-sharded
+// use the same layout, a counter-update counter being a single shard.
+const (
+	countersTable       = "benchmark_counters"
+	shardedCounterTable = "benchmark_counters_sharded"
+	counterEventsTable  = "benchmark_counter_events"
+)
+
+var counterParams = []Param{
+	{Name: "counter.counters", Default: "1", Description: "distinct counters the increments are spread over"},
+	{Name: "counter.workers", Default: "8", Description: "concurrent incrementers"},
+	{Name: "counter.seed", Default: "1", Description: "seed for choosing which counter (and shard) each increment hits"},
+}
+
+func init() {
+	strategies = append(strategies,
+		Strategy{
+			Name:        "counter-update",
+			Description: "Incrementing counter rows with UPDATE",
+			Features:    featureRowLocks,
+			Params:      counterParams,
+			Workload:    workloadCounter,
+			Table:       countersTable,
+			Schema:      counterSchema,
+			Run:         incrementUsingUpdate,
+		},
+		Strategy{
+			Name:        "counter-sharded",
+			Description: "Incrementing a random shard row per counter",
+			Features:    featureRowLocks,
+			Params: append([]Param{
+				{Name: "counter.shards", Default: "16", Description: "rows each counter is split over"},
+			}, counterParams...),
+			Workload: workloadCounter,
+			Table:    shardedCounterTable,
+			Schema:   counterSchema,
+			Run:      incrementUsingShards,
+		},
+		Strategy{
+			Name:        "counter-append",
+			Description: "Inserting increment rows and aggregating on read",
+			Params:      counterParams,
+			Workload:    workloadCounter,
+			Table:       counterEventsTable,
+			Schema: func(e *engine, table string) string {
+				return e.createTable(table, []column{
+					{Name: "counter_id", Type: typeBigInt, NotNull: true},
+					{Name: "delta", Type: typeBigInt, NotNull: true},
+				})
+			},
+			Run: incrementUsingInserts,
+		},
+	)
+}
+
+func counterSchema(e *engine, table string) string {
+	return e.createTable(table, []column{
+		{Name: "id", Type: typeBigInt, NotNull: true},
+		{Name: "shard", Type: typeInt, NotNull: true},
+		{Name: "n", Type: typeBigInt, NotNull: true},
+	}, "id", "shard")
+}
+
+// resetCounters empties the table and, for row-per-counter layouts,
+// creates shards rows per counter at zero.
+func resetCounters(ctx context.Context, db *sql.DB, opts RunOptions, counters, shards int) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM "+opts.table()); err != nil {
+		return fmt.Errorf("reset counters: %v", err)
+	}
+	insertSQL := opts.bind("INSERT INTO " + opts.table() + " (id, shard, n) VALUES (?, ?, 0)")
+	for id := 0; id < counters; id++ {
+		for shard := 0; shard < shards; shard++ {
+			if _, err := db.ExecContext(ctx, insertSQL, id, shard); err != nil {
+				return fmt.Errorf("insert counter: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// runIncrements calls increment from counter.workers goroutines until the
+// run is done, then reads every counter's total back with readSQL (one
+// parameter, the counter id) and checks that no increment was lost. Rows
+// counts increments; Metrics has the cost of reading a total, which is
+// what sharding and append-only counters trade write throughput for.
+func runIncrements(ctx context.Context, db *sql.DB, opts RunOptions, readSQL string, increment func(ctx context.Context, rng *rand.Rand, counter int64) error) (Result, error) {
+	counters := opts.intParam("counter.counters", 1)
+	workers := opts.intParam("counter.workers", 8)
+	if counters < 1 || workers < 1 {
+		return Result{}, fmt.Errorf("counter.counters and counter.workers must be at least 1")
+	}
+
+	var (
+		attempted atomic.Int64
+		mu        sync.Mutex
+		rec       latencyRecorder
+	)
+	seed := int64(opts.intParam("counter.seed", 1))
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		for ctx.Err() == nil {
+			if opts.done(int(attempted.Add(1))-1, start) {
+				return nil
+			}
+			counter := rng.Int63n(int64(counters))
+			opStart := time.Now()
+			if err := increment(ctx, rng, counter); err != nil {
+				return fmt.Errorf("increment error: %v", err)
+			}
+			mu.Lock()
+			rec.observe(time.Since(opStart))
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	result := rec.result(len(rec.samples), time.Since(start))
+
+	var reads []time.Duration
+	var total int64
+	for id := 0; id < counters; id++ {
+		var n sql.NullInt64
+		readStart := time.Now()
+		if err := db.QueryRowContext(ctx, opts.bind(readSQL), id).Scan(&n); err != nil {
+			return Result{}, fmt.Errorf("read counter: %v", err)
+		}
+		reads = append(reads, time.Since(readStart))
+		total += n.Int64
+	}
+	if total != int64(result.Rows) {
+		log.Printf("Warning: %s: counters add up to %d, expected %d increments", opts.table(), total, result.Rows)
+	}
+	read := summarizeLatency(reads)
+	result.Metrics = map[string]float64{
+		"counters":    float64(counters),
+		"workers":     float64(workers),
+		"read_p50_ns": float64(read.P50.Nanoseconds()),
+	}
+	return result, nil
+}
+
+// incrementUsingUpdate is the naive approach: every increment updates the
+// counter's single row, so all writers of a counter serialize on its lock.
+func incrementUsingUpdate(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	if err := resetCounters(ctx, db, opts, opts.intParam("counter.counters", 1), 1); err != nil {
+		return Result{}, err
+	}
+	updateSQL := opts.bind("UPDATE " + opts.table() + " SET n = n + 1 WHERE id = ? AND shard = 0")
+	return runIncrements(ctx, db, opts, "SELECT n FROM "+opts.table()+" WHERE id = ? AND shard = 0",
+		func(ctx context.Context, _ *rand.Rand, counter int64) error {
+			_, err := db.ExecContext(ctx, updateSQL, counter)
+			return err
+		})
+}
+
+// incrementUsingShards spreads each counter over counter.shards rows and
+// updates a random one, dividing the lock contention by the shard count;
+// reading a counter sums its shards.
+func incrementUsingShards(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	shards := opts.intParam("counter.shards", 16)
+	if shards < 1 {
+		return Result{}, fmt.Errorf("counter.shards must be at least 1, got %d", shards)
+	}
+	if err := resetCounters(ctx, db, opts, opts.intParam("counter.counters", 1), shards); err != nil {
+		return Result{}, err
+	}
+	updateSQL := opts.bind("UPDATE " + opts.table() + " SET n = n + 1 WHERE id = ? AND shard = ?")
+	result, err := runIncrements(ctx, db, opts, "SELECT SUM(n) FROM "+opts.table()+" WHERE id = ?",
+		func(ctx context.Context, rng *rand.Rand, counter int64) error {
+			_, err := db.ExecContext(ctx, updateSQL, counter, rng.Intn(shards))
+			return err
+		})
+	if err == nil {
+		result.Metrics["shards"] = float64(shards)
+	}
+	return result, err
+}
+
+// incrementUsingInserts never updates: each increment is a new row, so
+// writers don't contend at all, and reading a counter aggregates every
+// row written for it.
+func incrementUsingInserts(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	if _, err := db.ExecContext(ctx, "DELETE FROM "+opts.table()); err != nil {
+		return Result{}, fmt.Errorf("reset counter events: %v", err)
+	}
+	insertSQL := opts.bind("INSERT INTO " + opts.table() + " (counter_id, delta) VALUES (?, 1)")
+	return runIncrements(ctx, db, opts, "SELECT SUM(delta) FROM "+opts.table()+" WHERE counter_id = ?",
+		func(ctx context.Context, _ *rand.Rand, counter int64) error {
+			_, err := db.ExecContext(ctx, insertSQL, counter)
+			return err
+		})
+}
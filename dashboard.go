@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const dashboardRefresh = 500 * time.Millisecond
+
+// errAborted is returned by a run the user aborted from the dashboard.
+var errAborted = errors.New("aborted from the dashboard")
+
+// activeMeter, while set, sees every latency a strategy records, so the
+// dashboard can chart a strategy while it runs without the strategies
+// knowing about it.
+var activeMeter atomic.Pointer[liveMeter]
+
+// liveMeter counts the operations of the running strategy and keeps the
+// latencies recorded since the dashboard last looked.
+type liveMeter struct {
+	mu     sync.Mutex
+	ops    int
+	window []time.Duration
+}
+
+func (m *liveMeter) observe(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ops++
+	m.window = append(m.window, d)
+}
+
+func (m *liveMeter) take() (int, []time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	window := m.window
+	m.window = nil
+	return m.ops, window
+}
+
+// dashboardRow is one strategy on the dashboard. While the strategy runs
+// ops counts recorded operations and latency covers the last refresh; once
+// it finishes they are replaced by its Result.
+type dashboardRow struct {
+	name    string
+	status  string
+	started time.Time
+	ops     int
+	perSec  float64
+	retries int
+	latency LatencyStats
+	history []float64
+	err     error
+}
+
+// dashboard follows a run for the -tui terminal UI and the serve web UI:
+// the strategies with their throughput history, latency percentiles and
+// connection pool statistics. Skipping cancels the running strategy,
+// aborting the whole run; on a terminal those are the s and q (or Ctrl-C)
+// keys, and log output is held back while the dashboard is up and written
+// to stderr when it closes.
+type dashboard struct {
+	target  string
+	out     *os.File // nil unless drawing on a terminal
+	restore func()
+	logs    *logTail
+	stop    chan struct{}
+	stopped chan struct{}
+
+	mu      sync.Mutex
+	started time.Time
+	rows    []*dashboardRow
+	current *dashboardRow
+	meter   *liveMeter
+	pool    *sql.DB
+	cancel  context.CancelFunc
+	skipped bool
+	aborted bool
+	lastOps int
+	lastAt  time.Time
+}
+
+// newDashboard returns a dashboard without a terminal, for frontends that
+// read its status; the caller starts d.refresh.
+func newDashboard(target string) *dashboard {
+	return &dashboard{
+		target:  target,
+		restore: func() {},
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		started: time.Now(),
+	}
+}
+
+// openDashboard takes over the terminal for the -tui dashboard.
+func openDashboard(target string) (*dashboard, error) {
+	out := os.Stdout
+	if !term.IsTerminal(int(out.Fd())) {
+		return nil, fmt.Errorf("-tui needs a terminal on stdout")
+	}
+	d := newDashboard(target)
+	d.out, d.logs = out, &logTail{}
+	// Key controls need unbuffered input; without a terminal on stdin the
+	// dashboard only displays.
+	if in := int(os.Stdin.Fd()); term.IsTerminal(in) {
+		state, err := term.MakeRaw(in)
+		if err != nil {
+			return nil, fmt.Errorf("set terminal to raw mode: %v", err)
+		}
+		d.restore = func() { term.Restore(in, state) }
+		go d.readKeys(os.Stdin)
+	}
+	setLogConsole(d.logs)
+	// Alternate screen, cursor hidden.
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	go d.refresh()
+	return d, nil
+}
+
+// close stops sampling and, on a terminal, takes the dashboard down,
+// restores the terminal and replays the log output of the run.
+func (d *dashboard) close() {
+	close(d.stop)
+	<-d.stopped
+	if d.out == nil {
+		return
+	}
+	fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+	d.restore()
+	setLogConsole(os.Stderr)
+	os.Stderr.Write(d.logs.bytes())
+}
+
+func (d *dashboard) readKeys(r io.Reader) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			return
+		}
+		switch buf[0] {
+		case 's', 'S':
+			d.skip()
+		case 'q', 'Q', 3:
+			d.abort()
+		}
+	}
+}
+
+func (d *dashboard) skip() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.current != nil && !d.skipped {
+		d.skipped = true
+		d.cancel()
+	}
+}
+
+func (d *dashboard) abort() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.aborted = true
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// start puts s on the dashboard as the running strategy and returns the
+// context to run it with, which skipping or aborting cancels.
+func (d *dashboard) start(ctx context.Context, s Strategy, db *sql.DB) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.aborted {
+		cancel()
+	}
+	d.current = &dashboardRow{name: s.Name, status: "running", started: time.Now()}
+	d.rows = append(d.rows, d.current)
+	d.meter = &liveMeter{}
+	d.pool, d.cancel, d.skipped = db, cancel, false
+	d.lastOps, d.lastAt = 0, time.Now()
+	activeMeter.Store(d.meter)
+	return ctx
+}
+
+// finish records how the running strategy ended. It reports whether the
+// user skipped it, in which case its result is to be discarded, and returns
+// errAborted once the user has aborted the run.
+func (d *dashboard) finish(result Result, err error) (bool, error) {
+	activeMeter.Store(nil)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row := d.current
+	d.current = nil
+	d.cancel()
+	switch {
+	case d.aborted:
+		row.status = "aborted"
+		return false, errAborted
+	case d.skipped:
+		row.status = "skipped"
+		return true, nil
+	case err != nil:
+		row.status, row.err = "failed", err
+	default:
+		row.status = "done"
+		row.ops, row.perSec, row.retries, row.latency = result.Rows, result.RowsPerSec(), result.Retries, result.Latency
+	}
+	return false, nil
+}
+
+func (d *dashboard) refresh() {
+	defer close(d.stopped)
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		d.mu.Lock()
+		d.sample()
+		d.mu.Unlock()
+		if d.out != nil {
+			d.draw()
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample moves the running strategy's meter readings onto its row.
+func (d *dashboard) sample() {
+	row := d.current
+	if row == nil {
+		return
+	}
+	ops, window := d.meter.take()
+	now := time.Now()
+	if elapsed := now.Sub(d.lastAt).Seconds(); elapsed > 0 {
+		row.perSec = float64(ops-d.lastOps) / elapsed
+		row.history = append(row.history, row.perSec)
+	}
+	d.lastOps, d.lastAt = ops, now
+	row.ops = ops
+	if len(window) > 0 {
+		row.latency = summarizeLatency(window)
+	}
+}
+
+func (d *dashboard) draw() {
+	width, height, err := term.GetSize(int(d.out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 120, 30
+	}
+	d.mu.Lock()
+	lines := d.render(width, height)
+	d.mu.Unlock()
+	for i, line := range lines {
+		lines[i] = truncateRunes(line, width) + "\x1b[K"
+	}
+	fmt.Fprint(d.out, "\x1b[H"+strings.Join(lines, "\r\n")+"\x1b[J")
+}
+
+func (d *dashboard) render(width, height int) []string {
+	failed := 0
+	for _, row := range d.rows {
+		if row.status == "failed" {
+			failed++
+		}
+	}
+	lines := []string{
+		fmt.Sprintf("Benchmarking %s for %v, %d strategies, %d failed    [s] skip strategy  [q] abort run",
+			d.target, time.Since(d.started).Round(time.Second), len(d.rows), failed),
+		"",
+		fmt.Sprintf("%-24s %-8s %9s %10s %10s %10s %10s %7s  %s", "Strategy", "Status", "Ops", "Ops/s", "p50", "p95", "p99", "Retries", "Throughput"),
+	}
+	const fixed = 24 + 8 + 9 + 4*10 + 7 + 9
+	sparkWidth := max(width-fixed, 10)
+
+	// Older strategies scroll off the top when the terminal is short.
+	logLines := 5
+	rows := d.rows
+	if room := height - len(lines) - logLines - 4; room > 0 && len(rows) > room {
+		rows = rows[len(rows)-room:]
+	}
+	for _, row := range rows {
+		status := row.status
+		if row == d.current {
+			status = time.Since(row.started).Round(time.Second).String()
+		}
+		lines = append(lines, fmt.Sprintf("%-24s %-8s %9d %10.0f %10v %10v %10v %7d  %s",
+			row.name, status, row.ops, row.perSec, roundLatency(row.latency.P50), roundLatency(row.latency.P95), roundLatency(row.latency.P99),
+			row.retries, sparkline(row.history, sparkWidth)))
+		if row.err != nil {
+			lines = append(lines, "  "+row.err.Error())
+		}
+	}
+
+	lines = append(lines, "")
+	if d.pool != nil {
+		s := d.pool.Stats()
+		lines = append(lines, fmt.Sprintf("Pool: %d open (%d in use, %d idle), max %d, waited %d times for %v, closed %d idle / %d lifetime",
+			s.OpenConnections, s.InUse, s.Idle, s.MaxOpenConnections, s.WaitCount, s.WaitDuration.Round(time.Millisecond), s.MaxIdleClosed, s.MaxLifetimeClosed))
+	}
+	lines = append(lines, "")
+	return append(lines, d.logs.last(logLines)...)
+}
+
+// dashboardStatus is a snapshot of the dashboard for the web UI.
+type dashboardStatus struct {
+	Target     string           `json:"target"`
+	Elapsed    time.Duration    `json:"elapsed_ns"`
+	Strategies []strategyStatus `json:"strategies"`
+	Pool       *sql.DBStats     `json:"pool,omitempty"`
+}
+
+type strategyStatus struct {
+	Name      string       `json:"name"`
+	Status    string       `json:"status"`
+	Ops       int          `json:"ops"`
+	OpsPerSec float64      `json:"ops_per_sec"`
+	Retries   int          `json:"retries"`
+	Latency   LatencyStats `json:"latency"`
+	History   []float64    `json:"history"`
+	Error     string       `json:"error,omitempty"`
+}
+
+func (d *dashboard) status() dashboardStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st := dashboardStatus{Target: d.target, Elapsed: time.Since(d.started)}
+	for _, row := range d.rows {
+		s := strategyStatus{
+			Name: row.name, Status: row.status, Ops: row.ops, OpsPerSec: row.perSec, Retries: row.retries,
+			Latency: row.latency, History: append([]float64(nil), row.history...),
+		}
+		if row.err != nil {
+			s.Error = row.err.Error()
+		}
+		st.Strategies = append(st.Strategies, s)
+	}
+	if d.pool != nil {
+		stats := d.pool.Stats()
+		st.Pool = &stats
+	}
+	return st
+}
+
+// sparkline charts the last width values, scaled to the largest of them.
+func sparkline(values []float64, width int) string {
+	const bars = "▁▂▃▄▅▆▇█"
+	levels := []rune(bars)
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	var most float64
+	for _, v := range values {
+		most = max(most, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if most > 0 {
+			level = int(v / most * float64(len(levels)-1))
+		}
+		b.WriteRune(levels[level])
+	}
+	return b.String()
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+// logTail captures log output, keeping all of it for replaying and
+// serving the last lines to the dashboard.
+type logTail struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.buf.Write(p)
+}
+
+func (t *logTail) bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.buf.Bytes()
+}
+
+func (t *logTail) last(n int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := strings.Split(strings.TrimRight(t.buf.String(), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
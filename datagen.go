@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+)
+
+// dataParams shape the generated name and email values. By default every
+// row gets unique, non-NULL values; realistic data has repeats and gaps,
+// which changes index selectivity and size. NULLs need nullable columns.
+var dataParams = []Param{
+	{Name: "data.name.null", Default: "0", Description: "probability (0-1) that a row's name is NULL"},
+	{Name: "data.name.distinct", Default: "0", Description: "number of distinct names (0 = unique per row)"},
+	{Name: "data.email.null", Default: "0", Description: "probability (0-1) that a row's email is NULL"},
+	{Name: "data.email.distinct", Default: "0", Description: "number of distinct emails (0 = unique per row)"},
+	{Name: "data.seed", Default: "1", Description: "seed for NULL and value selection"},
+}
+
+// columnGen controls one generated column.
+type columnGen struct {
+	null     float64
+	distinct int
+}
+
+// rowGen produces the (name, email) values of a strategy's rows. Values are
+// the usual User<Prefix><n> / <prefix><n>@example.com, where n is the row
+// number or, with a distinct count, drawn uniformly from [0, distinct).
+type rowGen struct {
+	prefix string
+	rng    *rand.Rand
+	name   columnGen
+	email  columnGen
+}
+
+func (o RunOptions) rowGen(prefix string) *rowGen {
+	return &rowGen{
+		prefix: prefix,
+		rng:    rand.New(rand.NewSource(int64(o.intParam("data.seed", 1)))),
+		name:   o.columnGen("name"),
+		email:  o.columnGen("email"),
+	}
+}
+
+func (o RunOptions) columnGen(column string) columnGen {
+	c := columnGen{
+		null:     o.floatParam("data."+column+".null", 0),
+		distinct: o.intParam("data."+column+".distinct", 0),
+	}
+	if c.null < 0 || c.null > 1 {
+		log.Printf("Warning: data.%s.null must be between 0 and 1, using 0", column)
+		c.null = 0
+	}
+	if c.distinct < 0 {
+		c.distinct = 0
+	}
+	return c
+}
+
+func (g *rowGen) value(c columnGen, i int, format string) any {
+	if c.null > 0 && g.rng.Float64() < c.null {
+		return nil
+	}
+	if c.distinct > 0 {
+		i = g.rng.Intn(c.distinct)
+	}
+	return fmt.Sprintf(format, i)
+}
+
+// row returns the name and email for row i; either may be nil (NULL).
+func (g *rowGen) row(i int) (name, email any) {
+	name = g.value(g.name, i, "User"+g.prefix+"%d")
+	email = g.value(g.email, i, strings.ToLower(g.prefix)+"%d@example.com")
+	return name, email
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ddlTable is altered while the inserts run; it is never the shared table,
+// even with -shared-table.
+const ddlTable = "benchmark_users_ddl"
+
+// ddlChange is one schema change and the statement undoing it, with %s
+// for the table.
+type ddlChange struct {
+	apply, revert string
+}
+
+// ddlChanges are the changes ddl.variants selects from, per engine. The
+// plain variants take the blocking path (MySQL's table copy); the -online
+// ones ask for the engine's online path, failing rather than silently
+// falling back if it is not available.
+var ddlChanges = map[string]map[string]ddlChange{
+	"mysql": {
+		"index":         {"ALTER TABLE %s ADD INDEX benchmark_ddl_idx (email), ALGORITHM=COPY", "ALTER TABLE %s DROP INDEX benchmark_ddl_idx"},
+		"index-online":  {"ALTER TABLE %s ADD INDEX benchmark_ddl_idx (email), ALGORITHM=INPLACE, LOCK=NONE", "ALTER TABLE %s DROP INDEX benchmark_ddl_idx"},
+		"column":        {"ALTER TABLE %s ADD COLUMN benchmark_ddl_col INT, ALGORITHM=COPY", "ALTER TABLE %s DROP COLUMN benchmark_ddl_col"},
+		"column-online": {"ALTER TABLE %s ADD COLUMN benchmark_ddl_col INT, ALGORITHM=INPLACE, LOCK=NONE", "ALTER TABLE %s DROP COLUMN benchmark_ddl_col"},
+	},
+	"cockroach": {
+		"index":         {"CREATE INDEX benchmark_ddl_idx ON %s (email)", "DROP INDEX %s@benchmark_ddl_idx"},
+		"index-online":  {"CREATE INDEX CONCURRENTLY benchmark_ddl_idx ON %s (email)", "DROP INDEX %s@benchmark_ddl_idx"},
+		"column":        {"ALTER TABLE %s ADD COLUMN benchmark_ddl_col INT", "ALTER TABLE %s DROP COLUMN benchmark_ddl_col"},
+		"column-online": {"ALTER TABLE %s ADD COLUMN benchmark_ddl_col INT", "ALTER TABLE %s DROP COLUMN benchmark_ddl_col"},
+	},
+}
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "ddl-under-load",
+		Description: "Running schema changes while inserting",
+		Engines:     []string{"mysql", "cockroach"},
+		Features:    featureMultiRowValues,
+		Params: append([]Param{
+			{Name: "ddl.variants", Default: "index/index-online", Description: "slash-separated schema changes, run one after another: index, index-online, column, column-online"},
+			{Name: "ddl.rows", Default: "100000", Description: "rows the table holds before the first change, so that the changes have data to rewrite"},
+			{Name: "ddl.workers", Default: "4", Description: "concurrent inserters"},
+		}, dataParams...),
+		Workload: workloadSingleInsert,
+		Table:    ddlTable,
+		Run:      runDDLUnderLoad,
+	})
+}
+
+// ddlPhase is the outcome of one schema change under load.
+type ddlPhase struct {
+	rows             int
+	elapsed, ddl     time.Duration
+	before, during   []time.Duration
+	beforeTime       time.Duration
+	maxDuringLatency time.Duration
+}
+
+// runDDLUnderLoad applies each change in ddl.variants while ddl.workers
+// insert into the table, splitting Rows and Duration between the changes,
+// and reverts it before the next. A change starts once a tenth of the
+// phase has run and the inserts keep going until it has finished, so a
+// slow change may take a phase past its share of Rows. Rows counts
+// inserts. Metrics report per change how long it took and the insert
+// throughput and p99 before and during it, e.g. index_online_ddl_ns and
+// index_online_during_ops_per_sec; the longest insert during a change is
+// the stall it caused.
+func runDDLUnderLoad(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	changes := ddlChanges[opts.Engine.Name]
+	variants := opts.listParam("ddl.variants", "index/index-online")
+	if len(variants) == 0 {
+		return Result{}, fmt.Errorf("ddl.variants is empty")
+	}
+	for _, v := range variants {
+		if _, ok := changes[v]; !ok {
+			return Result{}, fmt.Errorf("ddl.variants: unknown change %q (expected index, index-online, column or column-online)", v)
+		}
+	}
+	workers := opts.intParam("ddl.workers", 4)
+	if workers < 1 {
+		return Result{}, fmt.Errorf("ddl.workers must be at least 1")
+	}
+	if err := fillDDLTable(ctx, db, opts, opts.intParam("ddl.rows", 100000)); err != nil {
+		return Result{}, err
+	}
+	phaseOpts := opts.phase(len(variants))
+
+	var rec latencyRecorder
+	var total time.Duration
+	rows := 0
+	metrics := map[string]float64{}
+	for _, v := range variants {
+		change := changes[v]
+		p, err := runDDLPhase(ctx, db, phaseOpts, fmt.Sprintf(change.apply, opts.table()), workers, rows, &rec)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %v", v, err)
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(change.revert, opts.table())); err != nil {
+			return Result{}, fmt.Errorf("%s: revert: %v", v, err)
+		}
+		rows += p.rows
+		total += p.elapsed
+
+		key := strings.ReplaceAll(v, "-", "_") + "_"
+		before, during := summarizeLatency(p.before), summarizeLatency(p.during)
+		beforeRate := float64(len(p.before)) / p.beforeTime.Seconds()
+		duringRate := float64(len(p.during)) / p.ddl.Seconds()
+		metrics[key+"ddl_ns"] = float64(p.ddl.Nanoseconds())
+		metrics[key+"before_ops_per_sec"] = beforeRate
+		metrics[key+"during_ops_per_sec"] = duringRate
+		metrics[key+"before_p99_ns"] = float64(before.P99.Nanoseconds())
+		metrics[key+"during_p99_ns"] = float64(during.P99.Nanoseconds())
+		metrics[key+"max_stall_ns"] = float64(p.maxDuringLatency.Nanoseconds())
+		log.Printf("ddl-under-load: %s took %s: %s -> %s inserts/s, p99 %s -> %s, longest insert %s",
+			v, formatDuration(p.ddl), formatRate(beforeRate), formatRate(duringRate), formatDuration(before.P99), formatDuration(during.P99), formatDuration(p.maxDuringLatency))
+	}
+
+	result := rec.result(rows, total)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// fillDDLTable tops the table up to n rows in multi-row batches.
+func fillDDLTable(ctx context.Context, db *sql.DB, opts RunOptions, n int) error {
+	var have int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+opts.table()).Scan(&have); err != nil {
+		return fmt.Errorf("count rows: %v", err)
+	}
+	if have < n {
+		log.Printf("ddl-under-load: filling %s with %d rows", opts.table(), n-have)
+	}
+	gen := opts.rowGen("DDLFill")
+	for i := have; i < n; {
+		batch := min(opts.batchSize(), n-i)
+		query, args := multiRowInsert(opts.table(), gen, i, batch)
+		if _, err := db.ExecContext(ctx, opts.bind(query), args...); err != nil {
+			return fmt.Errorf("fill table: %v", err)
+		}
+		i += batch
+	}
+	return nil
+}
+
+// runDDLPhase inserts from workers, applies ddl once a tenth of the phase
+// has passed, and stops when the phase is done and the DDL has finished.
+// first offsets the generated rows past earlier phases'; each insert is
+// observed in rec as it finishes.
+func runDDLPhase(ctx context.Context, db *sql.DB, opts RunOptions, ddl string, workers, first int, rec *latencyRecorder) (ddlPhase, error) {
+	type op struct {
+		start   time.Time
+		latency time.Duration
+	}
+	var (
+		claimed   atomic.Int64
+		mu        sync.Mutex
+		ops       []op
+		ddlOnce   sync.Once
+		ddlDone   = make(chan struct{})
+		ddlErr    error
+		ddlStart  time.Time
+		ddlTook   time.Duration
+		warmRows  = opts.Rows / 10
+		warmUntil = opts.Duration / 10
+	)
+	start := time.Now()
+	startDDL := func() {
+		ddlOnce.Do(func() {
+			go func() {
+				defer close(ddlDone)
+				ddlStart = time.Now()
+				_, ddlErr = db.ExecContext(ctx, ddl)
+				ddlTook = time.Since(ddlStart)
+			}()
+		})
+	}
+	finished := func() bool {
+		select {
+		case <-ddlDone:
+			return true
+		default:
+			return false
+		}
+	}
+
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		gen := opts.rowGen("DDL")
+		var local []op
+		defer func() {
+			mu.Lock()
+			ops = append(ops, local...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			i := int(claimed.Add(1)) - 1
+			if (opts.Rows > 0 && i >= warmRows) || (opts.Duration > 0 && time.Since(start) >= warmUntil) {
+				startDDL()
+			}
+			if opts.done(i, start) && finished() {
+				return nil
+			}
+			name, email := gen.row(first + i)
+			opStart := time.Now()
+			if _, err := db.ExecContext(ctx, opts.insertSQL(), name, email); err != nil {
+				return fmt.Errorf("insert error: %v", err)
+			}
+			d := time.Since(opStart)
+			local = append(local, op{opStart, d})
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+		}
+		return nil
+	})
+	startDDL()
+	<-ddlDone
+	if err != nil {
+		return ddlPhase{}, err
+	}
+	if ddlErr != nil {
+		return ddlPhase{}, fmt.Errorf("DDL: %v", ddlErr)
+	}
+
+	p := ddlPhase{rows: len(ops), elapsed: time.Since(start), ddl: ddlTook, beforeTime: ddlStart.Sub(start)}
+	ddlEnd := ddlStart.Add(ddlTook)
+	for _, o := range ops {
+		switch {
+		case o.start.Before(ddlStart):
+			p.before = append(p.before, o.latency)
+		case o.start.Before(ddlEnd):
+			p.during = append(p.during, o.latency)
+			p.maxDuringLatency = max(p.maxDuringLatency, o.latency)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// decimalTable holds the amounts the decimals strategy writes, each next
+// to its exact text so that what the DECIMAL column kept can be checked.
+const decimalTable = "benchmark_decimals"
+
+// decimalMethods are the Go types decimal.methods selects for writing and
+// scanning the DECIMAL column.
+var decimalMethods = []string{"string", "float64", "decimal"}
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "decimals",
+		Description: "Writing and reading DECIMAL amounts as string, float64 and shopspring/decimal",
+		Features:    featureCreateTable,
+		Params: []Param{
+			{Name: "decimal.methods", Default: strings.Join(decimalMethods, "/"), Description: "slash-separated Go types to compare: string, float64 and decimal (github.com/shopspring/decimal)"},
+			{Name: "decimal.precision", Default: "38", Description: "DECIMAL precision, the total digits of the column"},
+			{Name: "decimal.scale", Default: "10", Description: "DECIMAL scale, the digits after the point (at most 18)"},
+			{Name: "decimal.read_batch", Default: "100", Description: "rows each read query returns"},
+		},
+		Workload: workloadSingleInsert,
+		Run:      compareDecimalTypes,
+	})
+}
+
+// decimalAmount is the exact amount of row id: up to 16 integer digits, as
+// many as the precision leaves, and scale fractional ones, which is more
+// than a float64's 15 to 17 significant digits hold.
+func decimalAmount(id, precision, scale int) string {
+	rng := rand.New(rand.NewSource(int64(id)))
+	intDigits := min(precision-scale, 16)
+	amount := strconv.FormatInt(rng.Int63n(pow10(intDigits)), 10)
+	if scale > 0 {
+		amount += fmt.Sprintf(".%0*d", scale, rng.Int63n(pow10(scale)))
+	}
+	return amount
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// decimalArg is amount as method sends it; float64 rounds it already.
+func decimalArg(method, amount string) any {
+	switch method {
+	case "float64":
+		f, _ := strconv.ParseFloat(amount, 64)
+		return f
+	case "decimal":
+		return decimal.RequireFromString(amount)
+	}
+	return amount
+}
+
+// compareDecimalTypes inserts amounts into a DECIMAL column and then reads
+// them back with each Go type in decimal.methods, splitting Rows and
+// Duration evenly between the insert and the read phase of each; a read
+// phase bounded by Rows runs that many queries. Money-handling code needs
+// both the speed and the exactness of its choice: besides the throughput,
+// the metrics count the amounts the type lost digits of, on the way in
+// (the stored value differs from the exact one) and on the way out (the
+// scanned value differs from the stored one as text), e.g.
+// float64_write_losses. Rows counts inserted rows.
+func compareDecimalTypes(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	methods := opts.listParam("decimal.methods", strings.Join(decimalMethods, "/"))
+	if len(methods) == 0 {
+		return Result{}, fmt.Errorf("decimal.methods is empty")
+	}
+	for _, m := range methods {
+		known := false
+		for _, k := range decimalMethods {
+			known = known || m == k
+		}
+		if !known {
+			return Result{}, fmt.Errorf("decimal.methods: unknown method %q (expected %s)", m, strings.Join(decimalMethods, ", "))
+		}
+	}
+	precision := opts.intParam("decimal.precision", 38)
+	scale := opts.intParam("decimal.scale", 10)
+	if scale < 0 || scale > 18 || precision <= scale {
+		return Result{}, fmt.Errorf("decimal.scale must be from 0 to 18 and below decimal.precision")
+	}
+	readBatch := opts.intParam("decimal.read_batch", 100)
+	if readBatch < 1 {
+		return Result{}, fmt.Errorf("decimal.read_batch must be at least 1")
+	}
+	cols := []column{
+		{Name: "id", Type: typeBigInt, NotNull: true},
+		{Name: "amount", Type: typeDecimal, Size: precision, Scale: scale, NotNull: true},
+		{Name: "exact", Type: typeVarchar, Size: 64, NotNull: true},
+	}
+	if _, err := db.ExecContext(ctx, opts.Engine.createTable(decimalTable, cols, "id")); err != nil {
+		return Result{}, fmt.Errorf("create table %s: %v", decimalTable, err)
+	}
+	// Earlier runs may have used another precision or scale.
+	if _, err := db.ExecContext(ctx, "DELETE FROM "+decimalTable); err != nil {
+		return Result{}, fmt.Errorf("clear table: %v", err)
+	}
+	insert := opts.bind("INSERT INTO " + decimalTable + " (id, amount, exact) VALUES (?, ?, ?)")
+	read := opts.bind("SELECT amount, amount FROM " + decimalTable + " WHERE id >= ? ORDER BY id " + opts.Engine.limit(readBatch))
+	phaseOpts := opts.phase(2 * len(methods))
+
+	var rec latencyRecorder
+	var total time.Duration
+	inserted := 0
+	metrics := map[string]float64{}
+	for _, m := range methods {
+		var inserts []time.Duration
+		start := time.Now()
+		for i := 0; !phaseOpts.done(i, start); i++ {
+			id := inserted + i
+			amount := decimalAmount(id, precision, scale)
+			opStart := time.Now()
+			if _, err := db.ExecContext(ctx, insert, id, decimalArg(m, amount), amount); err != nil {
+				return Result{}, fmt.Errorf("%s: insert error: %v", m, err)
+			}
+			d := time.Since(opStart)
+			rec.observe(d)
+			inserts = append(inserts, d)
+		}
+		insertTime := time.Since(start)
+		writeLosses, err := countDecimalWriteLosses(ctx, db, opts, inserted, inserted+len(inserts))
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %v", m, err)
+		}
+		inserted += len(inserts)
+
+		var reads []time.Duration
+		scanned, readLosses := 0, 0
+		start = time.Now()
+		for q := 0; inserted > 0 && !phaseOpts.done(q, start); q++ {
+			opStart := time.Now()
+			n, lost, err := readDecimals(ctx, db, read, m, (q*readBatch)%inserted)
+			if err != nil {
+				return Result{}, fmt.Errorf("%s: %v", m, err)
+			}
+			reads = append(reads, time.Since(opStart))
+			scanned += n
+			readLosses += lost
+		}
+		readTime := time.Since(start)
+		total += insertTime + readTime
+
+		insertStats, readStats := summarizeLatency(inserts), summarizeLatency(reads)
+		metrics[m+"_insert_rows_per_sec"] = float64(len(inserts)) / insertTime.Seconds()
+		metrics[m+"_insert_p50_ns"] = float64(insertStats.P50.Nanoseconds())
+		metrics[m+"_read_rows_per_sec"] = float64(scanned) / readTime.Seconds()
+		metrics[m+"_read_p50_ns"] = float64(readStats.P50.Nanoseconds())
+		metrics[m+"_write_losses"] = float64(writeLosses)
+		metrics[m+"_read_losses"] = float64(readLosses)
+		log.Printf("decimals: %s: %s inserts/s (p50 %s), %s rows/s read (p50 %s per query); precision lost on %d of %d writes and %d of %d reads",
+			m, formatRate(metrics[m+"_insert_rows_per_sec"]), formatDuration(insertStats.P50), formatRate(metrics[m+"_read_rows_per_sec"]), formatDuration(readStats.P50),
+			writeLosses, len(inserts), readLosses, scanned)
+		if writeLosses+readLosses > 0 {
+			log.Printf("Warning: decimals: %s does not hold DECIMAL(%d,%d) amounts exactly", m, precision, scale)
+		}
+	}
+
+	result := rec.result(inserted, total)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// countDecimalWriteLosses counts the rows with ids from first to end whose
+// stored amount differs from their exact text.
+func countDecimalWriteLosses(ctx context.Context, db *sql.DB, opts RunOptions, first, end int) (int, error) {
+	rows, err := db.QueryContext(ctx, opts.bind("SELECT amount, exact FROM "+decimalTable+" WHERE id >= ? AND id < ?"), first, end)
+	if err != nil {
+		return 0, fmt.Errorf("check error: %v", err)
+	}
+	defer rows.Close()
+	lost := 0
+	for rows.Next() {
+		var stored, exact string
+		if err := rows.Scan(&stored, &exact); err != nil {
+			return lost, fmt.Errorf("check error: %v", err)
+		}
+		if !decimalsEqual(stored, exact) {
+			lost++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return lost, fmt.Errorf("check error: %v", err)
+	}
+	return lost, nil
+}
+
+// readDecimals runs query from id, scanning the amount with method and
+// again as text, and returns the rows read and how many of them method
+// got wrong.
+func readDecimals(ctx context.Context, db *sql.DB, query, method string, from int) (n, lost int, err error) {
+	rows, err := db.QueryContext(ctx, query, from)
+	if err != nil {
+		return 0, 0, fmt.Errorf("read error: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var text string
+		var got decimal.Decimal
+		switch method {
+		case "string":
+			var s string
+			err = rows.Scan(&s, &text)
+			got, _ = decimal.NewFromString(s)
+		case "float64":
+			var f float64
+			err = rows.Scan(&f, &text)
+			got = decimal.NewFromFloat(f)
+		case "decimal":
+			err = rows.Scan(&got, &text)
+		}
+		if err != nil {
+			return n, lost, fmt.Errorf("scan error: %v", err)
+		}
+		n++
+		if stored, err := decimal.NewFromString(text); err != nil || !got.Equal(stored) {
+			lost++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, lost, fmt.Errorf("read error: %v", err)
+	}
+	return n, lost, nil
+}
+
+// decimalsEqual reports whether a and b are the same number however many
+// trailing zeros either has.
+func decimalsEqual(a, b string) bool {
+	x, err := decimal.NewFromString(a)
+	if err != nil {
+		return false
+	}
+	y, err := decimal.NewFromString(b)
+	return err == nil && x.Equal(y)
+}
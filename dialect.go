@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dialect is how a SQL target spells what the strategies need: bind
+// parameters, quoted identifiers, row limits, insert-or-skip and column
+// types, plus the optional SQL features it implements. Strategies write
+// "?" placeholders and portable pieces and let the dialect render them, so
+// a new target is a new dialect rather than a change to every strategy.
+type dialect struct {
+	Placeholder placeholderStyle
+	// IdentQuote quotes identifiers; Fold is the case the target folds
+	// unquoted identifiers to, which quote applies first so that quoting
+	// never changes which object a name refers to.
+	IdentQuote string
+	Fold       caseFold
+	Limit      limitStyle
+	Upsert     upsertStyle
+	// Types spells each column type; %d, if present, takes the size.
+	Types    map[columnType]string
+	Features feature
+}
+
+// placeholderStyle is how a dialect spells bind parameters.
+type placeholderStyle int
+
+const (
+	placeholderQuestion placeholderStyle = iota // ?, ?
+	placeholderColon                            // :1, :2
+	placeholderDollar                           // $1, $2
+)
+
+type caseFold int
+
+const (
+	foldNone caseFold = iota
+	foldLower
+	foldUpper
+)
+
+type limitStyle int
+
+const (
+	limitClause     limitStyle = iota // LIMIT n
+	limitFetchFirst                   // FETCH FIRST n ROWS ONLY
+)
+
+type upsertStyle int
+
+const (
+	upsertNone         upsertStyle = iota
+	upsertInsertIgnore             // INSERT IGNORE INTO
+	upsertOnConflict               // ... ON CONFLICT (key) DO NOTHING
+)
+
+type columnType int
+
+const (
+	typeBigInt columnType = iota
+	typeInt
+	typeVarchar
+	typeDecimal
+)
+
+// feature is a set of optional SQL features; strategies list the ones
+// they need in Strategy.Features.
+type feature uint
+
+const (
+	// featureCreateTable: the benchmark may create its own tables with
+	// CREATE TABLE IF NOT EXISTS. Strategies with a Schema need it.
+	featureCreateTable feature = 1 << iota
+	// featureMultiRowValues: INSERT ... VALUES (...), (...).
+	featureMultiRowValues
+	// featureRowLocks: SELECT ... FOR UPDATE, and concurrent updates of a
+	// row wait for each other rather than failing.
+	featureRowLocks
+	// featureSkipLocked: FOR UPDATE SKIP LOCKED.
+	featureSkipLocked
+	// featureSavepoints: SAVEPOINT, RELEASE SAVEPOINT and ROLLBACK TO.
+	featureSavepoints
+)
+
+// featureNames are the features as the list command prints them.
+var featureNames = []struct {
+	f    feature
+	name string
+}{
+	{featureCreateTable, "CREATE TABLE"},
+	{featureMultiRowValues, "multi-row VALUES"},
+	{featureRowLocks, "row locks"},
+	{featureSkipLocked, "SKIP LOCKED"},
+	{featureSavepoints, "savepoints"},
+}
+
+// names lists the features in f.
+func (f feature) names() []string {
+	var names []string
+	for _, n := range featureNames {
+		if f&n.f != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+var (
+	mysqlDialect = dialect{
+		Placeholder: placeholderQuestion,
+		IdentQuote:  "`",
+		Limit:       limitClause,
+		Upsert:      upsertInsertIgnore,
+		Types:       map[columnType]string{typeBigInt: "BIGINT", typeInt: "INT", typeVarchar: "VARCHAR(%d)", typeDecimal: "DECIMAL(%d,%d)"},
+		Features:    featureCreateTable | featureMultiRowValues | featureRowLocks | featureSkipLocked | featureSavepoints,
+	}
+	postgresDialect = dialect{
+		Placeholder: placeholderDollar,
+		IdentQuote:  `"`,
+		Fold:        foldLower,
+		Limit:       limitClause,
+		Upsert:      upsertOnConflict,
+		Types:       map[columnType]string{typeBigInt: "BIGINT", typeInt: "INT", typeVarchar: "VARCHAR(%d)", typeDecimal: "DECIMAL(%d,%d)"},
+		Features:    featureCreateTable | featureMultiRowValues | featureRowLocks | featureSkipLocked | featureSavepoints,
+	}
+	// Oracle gained IF NOT EXISTS and multi-row VALUES only in 23ai.
+	oracleDialect = dialect{
+		Placeholder: placeholderColon,
+		IdentQuote:  `"`,
+		Fold:        foldUpper,
+		Limit:       limitFetchFirst,
+		Types:       map[columnType]string{typeBigInt: "NUMBER(19)", typeInt: "NUMBER(10)", typeVarchar: "VARCHAR2(%d)", typeDecimal: "NUMBER(%d,%d)"},
+		Features:    featureRowLocks | featureSkipLocked | featureSavepoints,
+	}
+	// DuckDB's optimistic concurrency control fails conflicting updates
+	// instead of making them wait.
+	duckdbDialect = dialect{
+		Placeholder: placeholderQuestion,
+		IdentQuote:  `"`,
+		Limit:       limitClause,
+		Upsert:      upsertOnConflict,
+		Types:       map[columnType]string{typeBigInt: "BIGINT", typeInt: "INTEGER", typeVarchar: "VARCHAR(%d)", typeDecimal: "DECIMAL(%d,%d)"},
+		Features:    featureCreateTable | featureMultiRowValues,
+	}
+)
+
+// without returns d lacking the given features, for targets that speak a
+// dialect only in part.
+func (d dialect) without(f feature) dialect {
+	d.Features &^= f
+	return d
+}
+
+// column is one column of a table a strategy creates.
+type column struct {
+	Name    string
+	Type    columnType
+	Size    int // a VARCHAR's length or a DECIMAL's precision
+	Scale   int // a DECIMAL's digits after the point
+	NotNull bool
+}
+
+// rebind rewrites "?" placeholders into the dialect's style. Quoted
+// literals are left untouched.
+func (d dialect) rebind(query string) string {
+	if d.Placeholder == placeholderQuestion {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			n++
+			if d.Placeholder == placeholderDollar {
+				b.WriteByte('$')
+			} else {
+				b.WriteByte(':')
+			}
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// quote quotes an identifier, e.g. a user-supplied column name that may
+// be a reserved word.
+func (d dialect) quote(name string) string {
+	switch d.Fold {
+	case foldLower:
+		name = strings.ToLower(name)
+	case foldUpper:
+		name = strings.ToUpper(name)
+	}
+	if d.IdentQuote == "" {
+		return name
+	}
+	return d.IdentQuote + name + d.IdentQuote
+}
+
+// limit returns the clause that ends a query after n rows.
+func (d dialect) limit(n int) string {
+	if d.Limit == limitFetchFirst {
+		return fmt.Sprintf("FETCH FIRST %d ROWS ONLY", n)
+	}
+	return fmt.Sprintf("LIMIT %d", n)
+}
+
+// insertIgnore turns an INSERT into one that silently skips rows whose
+// key column already exists, or returns "" if the dialect can't.
+func (d dialect) insertIgnore(insert, key string) string {
+	switch d.Upsert {
+	case upsertInsertIgnore:
+		return strings.Replace(insert, "INSERT INTO", "INSERT IGNORE INTO", 1)
+	case upsertOnConflict:
+		return insert + " ON CONFLICT (" + key + ") DO NOTHING"
+	}
+	return ""
+}
+
+func (d dialect) typeName(c column) string {
+	name := d.Types[c.Type]
+	switch strings.Count(name, "%d") {
+	case 1:
+		name = fmt.Sprintf(name, c.Size)
+	case 2:
+		name = fmt.Sprintf(name, c.Size, c.Scale)
+	}
+	return name
+}
+
+// createTable returns the DDL creating table with cols and the given
+// primary key columns if it doesn't exist yet.
+func (d dialect) createTable(table string, cols []column, key ...string) string {
+	defs := make([]string, 0, len(cols)+1)
+	for _, c := range cols {
+		def := c.Name + " " + d.typeName(c)
+		if c.NotNull {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+	}
+	if len(key) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(key, ", ")+")")
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(defs, ", "))
+}
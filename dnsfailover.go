@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialTimeoutParams bound how long a connection attempt may take per SQL
+// driver, so that an attempt against an address that no longer answers
+// fails within a probe interval or so instead of the OS's TCP timeout.
+var dialTimeoutParams = map[string]func(d time.Duration) map[string]string{
+	"mysql": func(d time.Duration) map[string]string { return map[string]string{"timeout": d.String()} },
+	"pgx": func(d time.Duration) map[string]string {
+		return map[string]string{"connect_timeout": strconv.Itoa(max(int(d.Round(time.Second).Seconds()), 1))}
+	},
+}
+
+// dnsEvent is one thing that happened during a DNS failover run.
+type dnsEvent struct {
+	At      time.Duration `json:"at_ns"` // since the start
+	Kind    string        `json:"kind"`  // resolved, down, connected or up
+	Address string        `json:"address,omitempty"`
+	Detail  string        `json:"detail,omitempty"`
+}
+
+// dnsOutage is a stretch of failed probes and, if the run saw it end, how
+// it ended.
+type dnsOutage struct {
+	Start       time.Duration `json:"start_ns"`
+	End         time.Duration `json:"end_ns,omitempty"`
+	Downtime    time.Duration `json:"downtime_ns,omitempty"`
+	From        string        `json:"from"`
+	To          string        `json:"to,omitempty"`
+	Failover    bool          `json:"failover"`                  // ended on another address
+	DNSSwitched time.Duration `json:"dns_switched_ns,omitempty"` // when DNS first answered To, since Start; negative if before
+}
+
+// dnsFailoverRun is the dns-failover command's JSON output.
+type dnsFailoverRun struct {
+	Host    string        `json:"host"`
+	Probe   string        `json:"probe"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+	Probes  int           `json:"probes"`
+	Failed  int           `json:"failed"`
+	Events  []dnsEvent    `json:"events"`
+	Outages []dnsOutage   `json:"outages"`
+}
+
+// dnsFailoverCommand probes a target named by DNS every -interval for
+// -duration while its record is switched to another server, as DNS-based
+// HA schemes do on failover. It resolves the name itself and keeps one
+// connection to the address it got; when a probe fails it drops the
+// connection and reconnects to whatever the name resolves to then, like a
+// client that re-resolves on reconnect. Each outage is reported with its
+// downtime, whether it ended on another address and how long after it
+// began DNS pointed there. A probe that writes, e.g. an UPDATE, also
+// catches a demoted primary that still answers reads.
+func dnsFailoverCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("dns-failover", flag.ExitOnError)
+	duration := fs.Duration("duration", getEnvAsDuration("BENCHMARK_DURATION", 5*time.Minute), "how long to probe")
+	interval := fs.Duration("interval", 100*time.Millisecond, "time between probes")
+	timeout := fs.Duration("timeout", time.Second, "how long a probe or connection attempt may take before it counts as failed")
+	probe := fs.String("probe", "SELECT 1", "statement each probe runs")
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the report to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write the events and outages as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+	if *duration <= 0 || *interval <= 0 || *timeout <= 0 {
+		return fmt.Errorf("-duration, -interval and -timeout must be positive")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	if eng.Driver == "" {
+		return fmt.Errorf("engine %s has no SQL driver; dns-failover needs one", eng.Name)
+	}
+	if len(splitHosts(config.Host)) > 1 || config.TunneledHost != "" {
+		return fmt.Errorf("dns-failover needs DB_HOST to be a single name the client resolves itself")
+	}
+	host, port, err := net.SplitHostPort(withDefaultPort(config.Host, defaultPorts[eng.Name]))
+	if err != nil || port == "" {
+		return fmt.Errorf("dns-failover: give DB_HOST as host:port for engine %s", eng.Name)
+	}
+	if net.ParseIP(host) != nil {
+		return fmt.Errorf("DB_HOST %s is an IP address; dns-failover needs a name whose record is switched", host)
+	}
+	config.PoolSize = 1
+	if params, ok := dialTimeoutParams[eng.Driver]; ok {
+		config = config.withParams(params(*timeout))
+	}
+
+	run := dnsFailoverRun{Host: config.Host, Probe: *probe}
+	ctx := context.Background()
+	start := time.Now()
+	event := func(kind, address, detail string) {
+		e := dnsEvent{At: time.Since(start), Kind: kind, Address: address, Detail: detail}
+		run.Events = append(run.Events, e)
+		msg := fmt.Sprintf("%v: %s %s", e.At.Round(time.Millisecond), kind, address)
+		if detail != "" {
+			msg += ": " + detail
+		}
+		log.Print(msg)
+	}
+
+	var (
+		db       *sql.DB
+		address  string   // the one connected or last tried
+		resolved []string // the latest answer
+		outage   *dnsOutage
+		switched = map[string]time.Duration{} // when each address first appeared
+	)
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for ; time.Since(start) < *duration; <-ticker.C {
+		run.Probes++
+		var err error
+		if db == nil {
+			if addrs, lookupErr := lookupAddresses(ctx, host, *timeout); lookupErr != nil {
+				err = fmt.Errorf("resolve %s: %v", host, lookupErr)
+			} else {
+				if !slices.Equal(addrs, resolved) {
+					resolved = addrs
+					event("resolved", strings.Join(addrs, ", "), "")
+					for _, a := range addrs {
+						if _, ok := switched[a]; !ok {
+							switched[a] = time.Since(start)
+						}
+					}
+				}
+				address = addrs[0]
+				c := config
+				c.Host = net.JoinHostPort(address, port)
+				if db, err = createConnectionPool(c); err == nil {
+					event("connected", address, "")
+				}
+			}
+		}
+		if err == nil {
+			probeCtx, cancel := context.WithTimeout(ctx, *timeout)
+			_, err = db.ExecContext(probeCtx, *probe)
+			cancel()
+		}
+
+		if err != nil {
+			run.Failed++
+			if db != nil {
+				db.Close()
+				db = nil
+			}
+			if outage == nil {
+				outage = &dnsOutage{Start: time.Since(start), From: address}
+				event("down", address, err.Error())
+			}
+			continue
+		}
+		if outage != nil {
+			outage.End = time.Since(start)
+			outage.Downtime = outage.End - outage.Start
+			outage.To = address
+			outage.Failover = address != outage.From
+			if outage.Failover {
+				outage.DNSSwitched = switched[address] - outage.Start
+			}
+			event("up", address, fmt.Sprintf("after %v", outage.Downtime.Round(time.Millisecond)))
+			run.Outages = append(run.Outages, *outage)
+			outage = nil
+		}
+	}
+	if outage != nil {
+		run.Outages = append(run.Outages, *outage)
+	}
+	run.Elapsed = time.Since(start)
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, run); err != nil {
+			return err
+		}
+	}
+	return writeMarkdown(*markdown, renderDNSFailover(run), false)
+}
+
+// lookupAddresses resolves host, sorted so that answers compare equal
+// whatever order the server returns them in.
+func lookupAddresses(ctx context.Context, host string, timeout time.Duration) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(addrs)
+	return addrs, nil
+}
+
+func renderDNSFailover(run dnsFailoverRun) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### DNS failover of `%s`\n\n", run.Host)
+	fmt.Fprintf(&b, "%d probes (`%s`) over %v, %d failed.\n\n", run.Probes, run.Probe, run.Elapsed.Round(time.Second), run.Failed)
+	if len(run.Outages) == 0 {
+		b.WriteString("_No outages._\n")
+		return b.String()
+	}
+	b.WriteString("| Down at | Downtime | From | To | DNS switched |\n|--:|--:|---|---|--:|\n")
+	for _, o := range run.Outages {
+		downtime, to, dns := "still down", "-", "-"
+		if o.End > 0 {
+			downtime, to = o.Downtime.Round(time.Millisecond).String(), o.To
+		}
+		if o.Failover {
+			dns = fmt.Sprintf("%+v", o.DNSSwitched.Round(time.Millisecond))
+		}
+		fmt.Fprintf(&b, "| %v | %s | %s | %s | %s |\n", o.Start.Round(time.Millisecond), downtime, o.From, to, dns)
+	}
+	return b.String()
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/lib/pq"
+)
+
+// driversTable receives the inserts of the drivers command.
+const driversTable = "benchmark_users_drivers"
+
+// driverSession runs statements through one client library. w is the
+// calling worker, for clients without a pool of their own.
+type driverSession interface {
+	query(ctx context.Context, w int, query string, args ...any) error // reads every row
+	exec(ctx context.Context, w int, query string, args ...any) error
+	Close()
+}
+
+// driverClient is a client library for an engine's wire protocol, opened
+// with the connections for the given number of workers.
+type driverClient struct {
+	Name string
+	Open func(eng *engine, config DBConfig, workers int) (driverSession, error)
+}
+
+// driverClients are the client libraries per wire protocol, keyed by the
+// engine's SQL driver, with that driver first. All run with their default
+// settings, so e.g. go-sql-driver and go-mysql both prepare a statement
+// for each execution with arguments, and pgx caches its prepared
+// statements both through database/sql and natively.
+var driverClients = map[string][]driverClient{
+	"mysql": {
+		{"go-sql-driver", openSQLDriver("mysql")},
+		{"go-mysql", openGoMySQL},
+	},
+	"pgx": {
+		{"pgx-stdlib", openSQLDriver("pgx")},
+		{"pgx", openPgxPool},
+		{"pq", openSQLDriver("postgres")},
+	},
+}
+
+// driversCommand runs the same statements through each client library
+// for the engine's wire protocol, database/sql drivers and native clients
+// alike, to compare what the client costs per statement. With -workers the
+// statements run concurrently on that many connections. Reads return the
+// shared table's rows, so seed it first for the range read to return any.
+func driversCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("drivers", flag.ExitOnError)
+	n := fs.Int("n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000), "executions per statement and driver")
+	workers := fs.Int("workers", 1, "concurrent workers, each with its own connection")
+	only := fs.String("drivers", "", "comma-separated drivers to compare (default: all for the engine)")
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the comparison to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write the measurements as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+	if *n < 1 || *workers < 1 {
+		return fmt.Errorf("-n and -workers must be at least 1")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	clients, ok := driverClients[eng.Driver]
+	if !ok {
+		return fmt.Errorf("engine %s has no alternative drivers; drivers supports MySQL and pgx engines", eng.Name)
+	}
+	if *only != "" {
+		if clients, err = selectDrivers(clients, *only); err != nil {
+			return err
+		}
+	}
+	if len(splitHosts(config.Host)) > 1 {
+		return fmt.Errorf("drivers compares clients against one host; DB_HOST lists several")
+	}
+	ctx := context.Background()
+	if config.Secrets != nil {
+		creds, err := config.Secrets.get(ctx, false)
+		if err != nil {
+			return err
+		}
+		config = withCredentials(config, creds)
+	}
+	statements := []protocolStatement{
+		{"point read", eng.rebind("SELECT name, email FROM " + sharedTable + " WHERE id = ?"), true},
+		{"range read", eng.rebind("SELECT id, name, email FROM " + sharedTable + " WHERE id > ? ORDER BY id " + eng.limit(100)), true},
+		{"insert", eng.rebind("INSERT INTO " + driversTable + " (name, email) VALUES (?, ?)"), false},
+	}
+
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	err = eng.cloneTable(ctx, db, driversTable)
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("create table %s: %v", driversTable, err)
+	}
+
+	config.PoolSize = *workers
+	var points []protocolPoint
+	for _, c := range clients {
+		session, err := c.Open(eng, config, *workers)
+		if err != nil {
+			return fmt.Errorf("%s: %v", c.Name, err)
+		}
+		for _, s := range statements {
+			p, err := runDriverStatement(ctx, session, s, *n, *workers)
+			if err != nil {
+				session.Close()
+				return fmt.Errorf("%s: %s: %v", c.Name, s.Name, err)
+			}
+			p.Mode = c.Name
+			log.Printf("%s: %s: %s ops/s (p50 %s)", c.Name, s.Name, formatRate(p.OpsPerSec), formatDuration(p.Latency.P50))
+			points = append(points, p)
+		}
+		session.Close()
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, points); err != nil {
+			return err
+		}
+	}
+	return writeMarkdown(*markdown, renderProtocolComparison("Driver comparison", config.Target(), statements, points), false)
+}
+
+// selectDrivers returns the clients named in the comma-separated list, in
+// the list's order.
+func selectDrivers(clients []driverClient, list string) ([]driverClient, error) {
+	var selected []driverClient
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, c := range clients {
+			if c.Name == name {
+				selected, found = append(selected, c), true
+			}
+		}
+		if !found {
+			names := make([]string, len(clients))
+			for i, c := range clients {
+				names[i] = c.Name
+			}
+			return nil, fmt.Errorf("unknown driver %q (available: %s)", name, strings.Join(names, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// runDriverStatement executes s n times in all, split across workers.
+func runDriverStatement(ctx context.Context, session driverSession, s protocolStatement, n, workers int) (protocolPoint, error) {
+	var (
+		mu  sync.Mutex
+		rec latencyRecorder
+	)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		samples := make([]time.Duration, 0, n/workers+1)
+		for i := w; i < n; i += workers {
+			opStart := time.Now()
+			var err error
+			if s.Read {
+				err = session.query(ctx, w, s.Query, i)
+			} else {
+				err = session.exec(ctx, w, s.Query, fmt.Sprintf("UserDrivers%d", i), fmt.Sprintf("drivers%d@example.com", i))
+			}
+			if err != nil {
+				return err
+			}
+			samples = append(samples, time.Since(opStart))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, d := range samples {
+			rec.observe(d)
+		}
+		return nil
+	})
+	if err != nil {
+		return protocolPoint{}, err
+	}
+	r := rec.result(n, time.Since(start))
+	return protocolPoint{Statement: s.Name, Ops: n, OpsPerSec: r.RowsPerSec(), Latency: r.Latency}, nil
+}
+
+// sqlSession runs statements through a database/sql driver.
+type sqlSession struct{ db *sql.DB }
+
+// openSQLDriver opens a pool of the named database/sql driver on the
+// engine's DSN, sized like createConnectionPool's but without its session
+// setup, which is specific to the engine's own driver.
+func openSQLDriver(name string) func(eng *engine, config DBConfig, workers int) (driverSession, error) {
+	return func(eng *engine, config DBConfig, workers int) (driverSession, error) {
+		db, err := sql.Open(name, eng.DSN(config))
+		if err != nil {
+			return nil, fmt.Errorf("error opening database: %v", err)
+		}
+		db.SetMaxOpenConns(workers)
+		db.SetMaxIdleConns(workers)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.PingContext(ctx); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("database ping failed: %v", err)
+		}
+		return sqlSession{db}, nil
+	}
+}
+
+func (s sqlSession) query(ctx context.Context, _ int, query string, args ...any) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return drainRows(rows)
+}
+
+func (s sqlSession) exec(ctx context.Context, _ int, query string, args ...any) error {
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s sqlSession) Close() { s.db.Close() }
+
+// pgxSession runs statements through pgx's native interface.
+type pgxSession struct{ pool *pgxpool.Pool }
+
+func openPgxPool(eng *engine, config DBConfig, workers int) (driverSession, error) {
+	cfg, err := pgxpool.ParseConfig(eng.DSN(config))
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxConns, cfg.MinConns = int32(workers), int32(workers)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("database ping failed: %v", err)
+	}
+	return pgxSession{pool}, nil
+}
+
+func (s pgxSession) query(ctx context.Context, _ int, query string, args ...any) error {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+func (s pgxSession) exec(ctx context.Context, _ int, query string, args ...any) error {
+	_, err := s.pool.Exec(ctx, query, args...)
+	return err
+}
+
+func (s pgxSession) Close() { s.pool.Close() }
+
+// goMySQLSession runs statements through go-mysql's client, which has no
+// pool of its own: each worker gets a connection.
+type goMySQLSession struct{ conns []*client.Conn }
+
+func openGoMySQL(eng *engine, config DBConfig, workers int) (driverSession, error) {
+	addr := withDefaultPort(config.Host, defaultPorts[eng.Name])
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := goMySQLSession{}
+	for range workers {
+		var conn *client.Conn
+		var err error
+		if config.Proxy != nil && config.TunneledHost == "" {
+			conn, err = client.ConnectWithDialer(ctx, "tcp", addr, config.User, config.Password, config.Database, config.Proxy.DialContext)
+		} else {
+			conn, err = client.ConnectWithContext(ctx, addr, config.User, config.Password, config.Database, 10*time.Second)
+		}
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.conns = append(s.conns, conn)
+	}
+	return s, nil
+}
+
+func (s goMySQLSession) query(_ context.Context, w int, query string, args ...any) error {
+	r, err := s.conns[w].Execute(query, args...)
+	if err != nil {
+		return err
+	}
+	r.Close()
+	return nil
+}
+
+func (s goMySQLSession) exec(ctx context.Context, w int, query string, args ...any) error {
+	return s.query(ctx, w, query, args...)
+}
+
+func (s goMySQLSession) Close() {
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// engine describes a database target: which database/sql driver to open,
+// how to build its DSN and the SQL dialect it speaks. Strategies write SQL
+// with "?" placeholders and rebind it for the target. Setup, if set,
+// runs once after connecting, e.g. to create the schema for embedded
+// engines that start empty.
+//
+// Engines without a database/sql driver (document stores, caches) leave
+// Driver empty and implement Native instead, which runs their own mapping
+// of the workloads and returns results in the same shape. Workloads lists
+// that mapping, which list shows and -only and -skip select from in place
+// of the SQL strategies.
+//
+// Info lists single-value queries reporting the server version and the
+// settings that decide durability, shown alongside comparison results.
+// CloneTable returns the DDL creating table dst with the structure of src
+// if it doesn't exist yet; engines without it need per-strategy tables
+// created in advance. Classify maps driver errors to the engine-neutral
+// classes strategies react to. Explain and ExplainAnalyze are the statement
+// prefixes that show a query's plan, without and with executing it.
+// AdvisoryLock and AdvisoryUnlock take and release a session-level advisory
+// lock keyed by their one integer parameter, blocking until it's granted;
+// a Postgres engine would use pg_advisory_lock and pg_advisory_unlock.
+// ServerTime returns the statements the server has executed in the current
+// database and their total execution time in nanoseconds, both cumulative
+// so that a strategy's share is the difference; a Postgres engine would sum
+// calls and total_exec_time from pg_stat_statements. StatementDigests
+// returns the same per statement digest: its key, a statement text, the
+// executions and their total time in nanoseconds.
+type engine struct {
+	dialect
+	Name             string
+	Driver           string
+	DSN              func(DBConfig) string
+	Setup            func(ctx context.Context, db *sql.DB) error
+	Native           func(ctx context.Context, config DBConfig, opts RunOptions) ([]Result, error)
+	Workloads        []Strategy
+	Info             []infoQuery
+	CloneTable       func(dst, src string) string
+	Classify         func(err error) errorClass
+	Explain          string
+	ExplainAnalyze   string
+	AdvisoryLock     string
+	AdvisoryUnlock   string
+	ServerTime       string
+	StatementDigests string
+}
+
+// errorClass is the engine-neutral kind of a database error.
+type errorClass int
+
+const (
+	errOther         errorClass = iota
+	errDuplicateKey             // unique constraint violation
+	errAlreadyExists            // object (index, table) already exists
+	errConflict                 // deadlock or serialization failure; retry the transaction
+	errAuth                     // the server refused the user or password
+	errPermission               // the user lacks a privilege for the statement
+)
+
+// selectable is what -only, -skip and -order choose from on e: its own
+// Workloads for a native engine, the registered strategies otherwise.
+func (e *engine) selectable() []Strategy {
+	if e.Native != nil {
+		return e.Workloads
+	}
+	return strategies
+}
+
+// classify is errOther for engines that don't classify their errors.
+func (e *engine) classify(err error) errorClass {
+	if err == nil || e == nil || e.Classify == nil {
+		return errOther
+	}
+	return e.Classify(err)
+}
+
+// infoQuery is a named query returning one value.
+type infoQuery struct {
+	Name  string
+	Query string
+}
+
+var engines = map[string]*engine{}
+
+// optionalEngines are supported but need a build tag, usually because their
+// driver requires cgo or client libraries.
+var optionalEngines = map[string]string{
+	"oracle":  "oracle",
+	"duckdb":  "duckdb",
+	"mongodb": "mongodb",
+}
+
+func registerEngine(e *engine) {
+	engines[e.Name] = e
+}
+
+func init() {
+	registerEngine(&engine{
+		Name:       "mysql",
+		Driver:     "mysql",
+		DSN:        mysqlDSN,
+		dialect:    mysqlDialect,
+		CloneTable: mysqlCloneTable,
+		Classify:   mysqlClassify,
+		// EXPLAIN ANALYZE needs MySQL 8.0.18 or later.
+		Explain:          "EXPLAIN FORMAT=TREE",
+		ExplainAnalyze:   "EXPLAIN ANALYZE",
+		AdvisoryLock:     mysqlAdvisoryLock,
+		AdvisoryUnlock:   mysqlAdvisoryUnlock,
+		ServerTime:       mysqlServerTime,
+		StatementDigests: mysqlStatementDigests,
+		Info: []infoQuery{
+			{"version", "SELECT VERSION()"},
+			{"innodb_flush_log_at_trx_commit", "SELECT @@innodb_flush_log_at_trx_commit"},
+			{"sync_binlog", "SELECT @@sync_binlog"},
+		},
+	})
+}
+
+// GET_LOCK takes a name and a timeout; a negative timeout waits forever.
+const (
+	mysqlAdvisoryLock   = "SELECT GET_LOCK(CONCAT('benchmark_lock_', ?), -1)"
+	mysqlAdvisoryUnlock = "SELECT RELEASE_LOCK(CONCAT('benchmark_lock_', ?))"
+)
+
+// mysqlServerTime sums performance_schema's statement digests, whose timers
+// are in picoseconds, leaving out the queries of performance_schema itself
+// such as this one.
+const mysqlServerTime = `SELECT COALESCE(SUM(COUNT_STAR), 0), COALESCE(SUM(SUM_TIMER_WAIT), 0) / 1000
+	FROM performance_schema.events_statements_summary_by_digest
+	WHERE SCHEMA_NAME = DATABASE() AND DIGEST_TEXT NOT LIKE '%performance_schema%'`
+
+const mysqlStatementDigests = `SELECT DIGEST, DIGEST_TEXT, COUNT_STAR, SUM_TIMER_WAIT / 1000
+	FROM performance_schema.events_statements_summary_by_digest
+	WHERE SCHEMA_NAME = DATABASE() AND DIGEST_TEXT IS NOT NULL AND DIGEST_TEXT NOT LIKE '%performance_schema%'`
+
+func mysqlCloneTable(dst, src string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s", dst, src)
+}
+
+func mysqlClassify(err error) errorClass {
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return errOther
+	}
+	switch myErr.Number {
+	case 1062: // ER_DUP_ENTRY
+		return errDuplicateKey
+	case 1061, 1050: // ER_DUP_KEYNAME, ER_TABLE_EXISTS_ERROR
+		return errAlreadyExists
+	case 1213, 1205: // ER_LOCK_DEADLOCK, ER_LOCK_WAIT_TIMEOUT
+		return errConflict
+	case 1045: // ER_ACCESS_DENIED_ERROR
+		return errAuth
+	case 1044, 1142, 1143, 1227: // ER_DBACCESS_DENIED_ERROR, ER_TABLEACCESS_DENIED_ERROR, ER_COLUMNACCESS_DENIED_ERROR, ER_SPECIFIC_ACCESS_DENIED_ERROR
+		return errPermission
+	}
+	return errOther
+}
+
+// cloneTable creates table with the structure of the shared table.
+func (e *engine) cloneTable(ctx context.Context, db *sql.DB, table string) error {
+	if e == nil || e.CloneTable == nil {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, e.CloneTable(table, sharedTable))
+	return err
+}
+
+// mysqlDSN builds a go-sql-driver DSN. Extra DB_PARAMS are appended as-is;
+// the driver sends keys it doesn't recognize as session variables. With
+// DB_PROXY it dials through the proxy, unless an SSH tunnel's local end
+// already leads to the host.
+func mysqlDSN(c DBConfig) string {
+	params := url.Values{}
+	params.Set("parseTime", "true")
+	params.Set("multiStatements", "true")
+	for k, v := range c.Params {
+		params.Set(k, v)
+	}
+	network := "tcp"
+	switch {
+	case socketHost(c.Host):
+		network = "unix"
+	case c.Proxy != nil && c.TunneledHost == "":
+		network = proxyNetwork
+	}
+	return fmt.Sprintf("%s:%s@%s(%s)/%s?%s",
+		c.User, c.Password, network, c.Host, c.Database, params.Encode())
+}
+
+func lookupEngine(name string) (*engine, error) {
+	if name == "" {
+		name = "mysql"
+	}
+	if e, ok := engines[name]; ok {
+		return e, nil
+	}
+	if tag, ok := optionalEngines[name]; ok {
+		return nil, fmt.Errorf("engine %q is not compiled in; rebuild with -tags %s", name, tag)
+	}
+	names := make([]string, 0, len(engines))
+	for n := range engines {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown engine %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// rebind rewrites "?" placeholders into the engine's dialect.
+func (e *engine) rebind(query string) string {
+	if e == nil {
+		return query
+	}
+	return e.dialect.rebind(query)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// maxTxRetries bounds the client-side retry loop for a single transaction.
+const maxTxRetries = 10
+
+func init() {
+	registerEngine(&engine{
+		Name:    "cockroach",
+		Driver:  "pgx",
+		DSN:     postgresDSN,
+		dialect: postgresDialect,
+		CloneTable: func(dst, src string) string {
+			return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING ALL)", dst, src)
+		},
+		Classify:       postgresClassify,
+		Explain:        "EXPLAIN",
+		ExplainAnalyze: "EXPLAIN ANALYZE",
+		// The statistics are the gateway node's, which with one DB_HOST are
+		// the statements the run sent; service_lat_avg, parsing to
+		// execution, is in seconds.
+		ServerTime: `SELECT COALESCE(sum(count), 0)::FLOAT8, COALESCE(sum(count * service_lat_avg), 0) * 1e9
+			FROM crdb_internal.node_statement_statistics
+			WHERE database_name = current_database() AND application_name NOT LIKE '$ internal%'
+				AND key NOT LIKE '%crdb_internal%'`,
+		StatementDigests: `SELECT key, key, sum(count)::FLOAT8, sum(count * service_lat_avg) * 1e9
+			FROM crdb_internal.node_statement_statistics
+			WHERE database_name = current_database() AND application_name NOT LIKE '$ internal%'
+				AND key NOT LIKE '%crdb_internal%'
+			GROUP BY key`,
+		Info: []infoQuery{
+			{"version", "SELECT version()"},
+			{"default_transaction_isolation", "SHOW default_transaction_isolation"},
+		},
+	})
+	strategies = append(strategies, Strategy{
+		Name:        "crdb-retry-tx",
+		Description: "Using CockroachDB retry-aware transactions",
+		Engines:     []string{"cockroach"},
+		Params:      dataParams,
+		Workload:    workloadTxInsert,
+		Run:         insertUsingRetryingTransactions,
+	})
+}
+
+// postgresDSN builds a postgres:// URL for Postgres wire-protocol targets.
+// DB_HOST may carry a port (CockroachDB listens on 26257 by default) and
+// be an IPv6 literal.
+func postgresDSN(c DBConfig) string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   urlHost(c.Host),
+		Path:   "/" + c.Database,
+	}
+	q := url.Values{}
+	q.Set("sslmode", c.SSLMode)
+	for k, v := range c.Params {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// isRetryable reports whether err is a serialization failure that the
+// client is expected to retry (SQLSTATE 40001). CockroachDB runs every
+// transaction at SERIALIZABLE and returns these under contention.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
+
+func postgresClassify(err error) errorClass {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return errOther
+	}
+	switch pgErr.Code {
+	case "23505": // unique_violation
+		return errDuplicateKey
+	case "42P07", "42710": // duplicate_table, duplicate_object
+		return errAlreadyExists
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return errConflict
+	case "28P01", "28000": // invalid_password, invalid_authorization_specification
+		return errAuth
+	case "42501": // insufficient_privilege
+		return errPermission
+	}
+	return errOther
+}
+
+// retryTx runs fn in a transaction, restarting the whole transaction with
+// jittered exponential backoff whenever it fails with a retryable error. It
+// returns how many retries were needed.
+func retryTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) (int, error) {
+	backoff := 10 * time.Millisecond
+	for retries := 0; ; retries++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return retries, fmt.Errorf("begin transaction error: %v", err)
+		}
+		err = fn(tx)
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+		if err == nil || !isRetryable(err) {
+			return retries, err
+		}
+		if retries == maxTxRetries {
+			return retries, fmt.Errorf("giving up after %d retries: %v", retries, err)
+		}
+
+		sleep := backoff/2 + time.Duration(rand.Int63n(int64(backoff)))
+		select {
+		case <-ctx.Done():
+			return retries, ctx.Err()
+		case <-time.After(sleep):
+		}
+		if backoff < time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// insertUsingRetryingTransactions commits BatchSize rows per transaction
+// using the client-side retry loop, and reports how often it had to retry.
+func insertUsingRetryingTransactions(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	start := time.Now()
+	gen := opts.rowGen("Crdb")
+
+	var rec latencyRecorder
+	i, txs, retries := 0, 0, 0
+	for !opts.done(i, start) {
+		n := opts.nextBatch(i)
+
+		// Generate the batch up front so retries insert the same rows.
+		args := make([][2]any, n)
+		for j := range args {
+			args[j][0], args[j][1] = gen.row(i + j)
+		}
+
+		opStart := time.Now()
+		r, err := retryTx(ctx, db, func(tx *sql.Tx) error {
+			for _, a := range args {
+				_, err := tx.ExecContext(ctx, opts.insertSQL(), a[0], a[1])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		retries += r
+		if err != nil {
+			return Result{}, fmt.Errorf("retrying tx error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+		txs++
+		i += n
+	}
+
+	result := rec.result(i, time.Since(start))
+	result.Transactions = txs
+	result.Retries = retries
+	return result, nil
+}
@@ -0,0 +1,148 @@
+//go:build duckdb
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/marcboeker/go-duckdb"
+)
+
+// DuckDB runs embedded in the benchmark process, so it needs cgo and the
+// duckdb build tag. DB_NAME is the database file (empty for in-memory);
+// DB_HOST and credentials are ignored.
+// duckdbTable is shared by the appender and the analytical queries, which
+// read what the appender loaded.
+const duckdbTable = "benchmark_users_duckdb"
+
+func init() {
+	registerEngine(&engine{
+		Name:           "duckdb",
+		Driver:         "duckdb",
+		DSN:            func(c DBConfig) string { return c.Database },
+		dialect:        duckdbDialect,
+		Info:           []infoQuery{{"version", "SELECT version()"}},
+		Explain:        "EXPLAIN",
+		ExplainAnalyze: "EXPLAIN ANALYZE",
+		CloneTable: func(dst, src string) string {
+			return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS SELECT * FROM %s LIMIT 0", dst, src)
+		},
+		Setup: func(ctx context.Context, db *sql.DB) error {
+			_, err := db.ExecContext(ctx,
+				"CREATE TABLE IF NOT EXISTS benchmark_users (id BIGINT, name VARCHAR, email VARCHAR)")
+			return err
+		},
+	})
+	strategies = append(strategies,
+		Strategy{
+			Name:        "duckdb-appender",
+			Description: "Using the DuckDB appender",
+			Engines:     []string{"duckdb"},
+			Table:       duckdbTable,
+			Workload:    workloadBatchInsert,
+			Run:         insertUsingDuckDBAppender,
+		},
+		Strategy{
+			Name:        "duckdb-analytics",
+			Description: "Running DuckDB analytical queries",
+			Engines:     []string{"duckdb"},
+			Read:        true,
+			Table:       duckdbTable,
+			Workload:    workloadAnalytics,
+			Run:         runDuckDBAnalytics,
+		},
+	)
+}
+
+// insertUsingDuckDBAppender streams rows through the appender, DuckDB's
+// bulk-load path, flushing every BatchSize rows. Latency samples are per
+// flushed batch.
+func insertUsingDuckDBAppender(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	start := time.Now()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("get connection error: %v", err)
+	}
+	defer conn.Close()
+
+	var rec latencyRecorder
+	i := 0
+	err = conn.Raw(func(dc any) error {
+		appender, err := duckdb.NewAppenderFromConn(dc.(driver.Conn), "", opts.table())
+		if err != nil {
+			return fmt.Errorf("create appender: %v", err)
+		}
+		defer appender.Close()
+
+		base := time.Now().UnixMicro()
+		for !opts.done(i, start) {
+			n := opts.nextBatch(i)
+			opStart := time.Now()
+			for j := 0; j < n; j++ {
+				err := appender.AppendRow(base+int64(i+j),
+					fmt.Sprintf("UserAppend%d", i+j), fmt.Sprintf("append%d@example.com", i+j))
+				if err != nil {
+					return fmt.Errorf("append error: %v", err)
+				}
+			}
+			if err := appender.Flush(); err != nil {
+				return fmt.Errorf("flush error: %v", err)
+			}
+			rec.observe(time.Since(opStart))
+			i += n
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+// duckdbAnalyticsQueries are scan-and-aggregate queries over the benchmark
+// table (%[1]s), the kind of work DuckDB is built for.
+var duckdbAnalyticsQueries = []string{
+	"SELECT count(*), count(DISTINCT name), approx_count_distinct(email) FROM %[1]s",
+	"SELECT split_part(email, '@', 2) AS domain, count(*) FROM %[1]s GROUP BY domain ORDER BY 2 DESC LIMIT 10",
+	"SELECT length(name) AS len, count(*), min(id), max(id) FROM %[1]s GROUP BY len ORDER BY len",
+	"SELECT name, email FROM %[1]s WHERE email LIKE 'append1%%' ORDER BY id DESC LIMIT 100",
+}
+
+// runDuckDBAnalytics cycles through the analytical queries, draining every
+// result set. Rows counts queries executed.
+func runDuckDBAnalytics(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	plans := opts.planRecorder()
+	for _, query := range duckdbAnalyticsQueries {
+		plans.capture(ctx, db, fmt.Sprintf(query, opts.table()))
+	}
+	start := time.Now()
+
+	var rec latencyRecorder
+	i := 0
+	for ; !opts.done(i, start); i++ {
+		query := fmt.Sprintf(duckdbAnalyticsQueries[i%len(duckdbAnalyticsQueries)], opts.table())
+		opStart := time.Now()
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return Result{}, fmt.Errorf("query error: %v", err)
+		}
+		for rows.Next() {
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return Result{}, fmt.Errorf("read error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+
+	result := rec.result(i, time.Since(start))
+	result.Plans = plans.plans
+	return result, nil
+}
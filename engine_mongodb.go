@@ -0,0 +1,201 @@
+//go:build mongodb
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MongoDB has no database/sql driver, so it runs as a native engine with
+// its own mapping of the workloads: each benchmark_users row becomes a
+// document in the benchmark_users collection of DB_NAME. DB_HOST is
+// host[:port] (or a comma-separated seed list) and DB_PARAMS become URI
+// options such as replicaSet or w.
+func init() {
+	e := &engine{
+		Name:   "mongodb",
+		DSN:    mongoURI,
+		Native: runMongoBenchmark,
+	}
+	for _, wl := range mongoWorkloads {
+		e.Workloads = append(e.Workloads, wl.Strategy)
+	}
+	registerEngine(e)
+}
+
+func mongoURI(c DBConfig) string {
+	hosts := splitHosts(c.Host)
+	for i, h := range hosts {
+		hosts[i] = urlHost(h)
+	}
+	u := url.URL{Scheme: "mongodb", Host: strings.Join(hosts, ","), Path: "/"}
+	if c.User != "" {
+		u.User = url.UserPassword(c.User, c.Password)
+	}
+	q := url.Values{}
+	for k, v := range c.Params {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+type mongoUser struct {
+	ID    int64  `bson:"_id"`
+	Name  string `bson:"name"`
+	Email string `bson:"email"`
+}
+
+// mongoWorkload is the document-store counterpart of a Strategy.
+type mongoWorkload struct {
+	Strategy
+	run func(ctx context.Context, coll *mongo.Collection, w *mongoRun) (Result, error)
+}
+
+// mongoRun is the state shared by the workloads of one run: the id base for
+// inserted documents and how many insert-one wrote, for the read workload.
+type mongoRun struct {
+	opts     RunOptions
+	base     int64
+	inserted int
+}
+
+var mongoWorkloads = []mongoWorkload{
+	{
+		Strategy: Strategy{Name: "mongo-insert-one", Description: "Using MongoDB InsertOne", Workload: workloadSingleInsert},
+		run:      insertUsingMongoInsertOne,
+	},
+	{
+		Strategy: Strategy{Name: "mongo-insert-many", Description: "Using MongoDB InsertMany", Workload: workloadBatchInsert},
+		run:      insertUsingMongoInsertMany,
+	},
+	{
+		Strategy: Strategy{Name: "mongo-find", Description: "Using MongoDB FindOne by indexed email", Read: true, Workload: workloadPointRead},
+		run:      runMongoFind,
+	},
+}
+
+func runMongoBenchmark(ctx context.Context, config DBConfig, opts RunOptions) ([]Result, error) {
+	clientOpts := options.Client().ApplyURI(mongoURI(config)).SetMaxPoolSize(uint64(config.PoolSize))
+	client, err := mongo.Connect(clientOpts)
+	if err != nil {
+		return nil, fmt.Errorf("mongodb connect: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+	log.Println("Database connected successfully")
+
+	coll := client.Database(config.Database).Collection("benchmark_users")
+	_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "email", Value: 1}}})
+	if err != nil {
+		return nil, fmt.Errorf("create email index: %v", err)
+	}
+
+	w := &mongoRun{opts: opts, base: time.Now().UnixMicro() * 1000}
+	var results []Result
+	for _, wl := range mongoWorkloads {
+		if !opts.Selection.selects(wl.Name) {
+			continue
+		}
+		result, err := wl.run(ctx, coll, w)
+		if err != nil {
+			return results, fmt.Errorf("%s failed: %v", wl.Name, err)
+		}
+		result.Strategy, result.Workload = wl.Name, wl.Workload
+		logResult(wl.Strategy, result)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (w *mongoRun) user(prefix string, i int) mongoUser {
+	id := w.base + int64(i)
+	return mongoUser{
+		ID:    id,
+		Name:  fmt.Sprintf("User%s%d", prefix, i),
+		Email: fmt.Sprintf("%s%d@example.com", prefix, id),
+	}
+}
+
+// insertUsingMongoInsertOne inserts one document per round trip, the
+// counterpart of the pool-exec strategy.
+func insertUsingMongoInsertOne(ctx context.Context, coll *mongo.Collection, w *mongoRun) (Result, error) {
+	start := time.Now()
+
+	var rec latencyRecorder
+	i := 0
+	for ; !w.opts.done(i, start); i++ {
+		opStart := time.Now()
+		if _, err := coll.InsertOne(ctx, w.user("one", i)); err != nil {
+			return Result{}, fmt.Errorf("insert error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+	w.inserted = i
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+// insertUsingMongoInsertMany sends BatchSize documents per InsertMany, the
+// counterpart of batch-insert. Latency samples are per batch.
+func insertUsingMongoInsertMany(ctx context.Context, coll *mongo.Collection, w *mongoRun) (Result, error) {
+	start := time.Now()
+	// Keep ids clear of the ones insert-one used.
+	offset := w.inserted
+
+	var rec latencyRecorder
+	i := 0
+	for !w.opts.done(i, start) {
+		n := w.opts.nextBatch(i)
+		docs := make([]mongoUser, n)
+		for j := range docs {
+			docs[j] = w.user("many", offset+i+j)
+		}
+
+		opStart := time.Now()
+		if _, err := coll.InsertMany(ctx, docs); err != nil {
+			return Result{}, fmt.Errorf("insert many error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+		i += n
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+// runMongoFind looks up the documents written by insert-one by email,
+// cycling through them. Rows counts queries executed.
+func runMongoFind(ctx context.Context, coll *mongo.Collection, w *mongoRun) (Result, error) {
+	if w.inserted == 0 {
+		return Result{}, fmt.Errorf("no documents from mongo-insert-one to read")
+	}
+	start := time.Now()
+
+	var rec latencyRecorder
+	i := 0
+	for ; !w.opts.done(i, start); i++ {
+		email := w.user("one", i%w.inserted).Email
+		opStart := time.Now()
+		var doc mongoUser
+		if err := coll.FindOne(ctx, bson.D{{Key: "email", Value: email}}).Decode(&doc); err != nil {
+			return Result{}, fmt.Errorf("find error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
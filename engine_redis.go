@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis runs as a native engine: each benchmark_users row becomes a hash at
+// benchmark_users:<id>. DB_HOST is host:port, DB_USER/DB_PASS are the ACL
+// credentials (user may be empty) and DB_NAME is the logical database
+// number (empty for 0).
+func init() {
+	e := &engine{
+		Name:   "redis",
+		Native: runRedisBenchmark,
+	}
+	for _, wl := range redisWorkloads {
+		e.Workloads = append(e.Workloads, wl.Strategy)
+	}
+	registerEngine(e)
+}
+
+// redisWorkload is the cache counterpart of a Strategy.
+type redisWorkload struct {
+	Strategy
+	run func(ctx context.Context, client *redis.Client, opts RunOptions, base int64) (Result, error)
+}
+
+var redisWorkloads = []redisWorkload{
+	{
+		Strategy: Strategy{Name: "redis-hset", Description: "Using one Redis HSET per row", Workload: workloadSingleInsert},
+		run:      insertUsingRedisHSet,
+	},
+	{
+		Strategy: Strategy{Name: "redis-pipeline", Description: "Using pipelined Redis HSETs", Workload: workloadBatchInsert},
+		run:      insertUsingRedisPipeline,
+	},
+}
+
+func redisOptions(c DBConfig) (*redis.Options, error) {
+	db := 0
+	if c.Database != "" {
+		n, err := strconv.Atoi(c.Database)
+		if err != nil {
+			return nil, fmt.Errorf("redis database must be a number, got %q", c.Database)
+		}
+		db = n
+	}
+	return &redis.Options{
+		Addr:     c.Host,
+		Username: c.User,
+		Password: c.Password,
+		DB:       db,
+		PoolSize: c.PoolSize,
+	}, nil
+}
+
+func runRedisBenchmark(ctx context.Context, config DBConfig, opts RunOptions) ([]Result, error) {
+	redisOpts, err := redisOptions(config)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(redisOpts)
+	defer client.Close()
+
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+	log.Println("Database connected successfully")
+
+	// Each workload gets its own id range so keys never overwrite.
+	base := time.Now().UnixMicro() * 1000
+	var results []Result
+	for _, wl := range redisWorkloads {
+		if !opts.Selection.selects(wl.Name) {
+			continue
+		}
+		result, err := wl.run(ctx, client, opts, base)
+		if err != nil {
+			return results, fmt.Errorf("%s failed: %v", wl.Name, err)
+		}
+		result.Strategy, result.Workload = wl.Name, wl.Workload
+		logResult(wl.Strategy, result)
+		results = append(results, result)
+		base += int64(result.Rows)
+	}
+	return results, nil
+}
+
+func redisUserKey(id int64) string {
+	return "benchmark_users:" + strconv.FormatInt(id, 10)
+}
+
+// insertUsingRedisHSet writes one hash per round trip, the counterpart of
+// the pool-exec strategy.
+func insertUsingRedisHSet(ctx context.Context, client *redis.Client, opts RunOptions, base int64) (Result, error) {
+	start := time.Now()
+
+	var rec latencyRecorder
+	i := 0
+	for ; !opts.done(i, start); i++ {
+		id := base + int64(i)
+		opStart := time.Now()
+		err := client.HSet(ctx, redisUserKey(id),
+			"name", fmt.Sprintf("UserRedis%d", i), "email", fmt.Sprintf("redis%d@example.com", id)).Err()
+		if err != nil {
+			return Result{}, fmt.Errorf("hset error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+// insertUsingRedisPipeline queues BatchSize HSETs per pipeline, the
+// counterpart of batch-insert. Latency samples are per pipeline flush.
+func insertUsingRedisPipeline(ctx context.Context, client *redis.Client, opts RunOptions, base int64) (Result, error) {
+	start := time.Now()
+
+	var rec latencyRecorder
+	i := 0
+	for !opts.done(i, start) {
+		n := opts.nextBatch(i)
+		opStart := time.Now()
+		pipe := client.Pipeline()
+		for j := 0; j < n; j++ {
+			id := base + int64(i+j)
+			pipe.HSet(ctx, redisUserKey(id),
+				"name", fmt.Sprintf("UserPipeline%d", i+j), "email", fmt.Sprintf("pipeline%d@example.com", id))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return Result{}, fmt.Errorf("pipeline exec error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+		i += n
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
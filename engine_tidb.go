@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// regionSampleInterval is how often the TiDB strategy polls region counts.
+const regionSampleInterval = time.Second
+
+// TiDB speaks the MySQL protocol, so it reuses the MySQL driver and DSN.
+// TiDB session variables such as tidb_dml_batch_size or tidb_txn_mode can
+// be set per connection through DB_PARAMS.
+func init() {
+	registerEngine(&engine{
+		Name:   "tidb",
+		Driver: "mysql",
+		DSN:    mysqlDSN,
+		// TiDB parses SKIP LOCKED but doesn't implement it.
+		dialect:        mysqlDialect.without(featureSkipLocked),
+		CloneTable:     mysqlCloneTable,
+		Classify:       mysqlClassify,
+		Explain:        "EXPLAIN",
+		ExplainAnalyze: "EXPLAIN ANALYZE",
+		// GET_LOCK needs TiDB 5.3 or later.
+		AdvisoryLock:   mysqlAdvisoryLock,
+		AdvisoryUnlock: mysqlAdvisoryUnlock,
+		Info: []infoQuery{
+			{"version", "SELECT VERSION()"},
+			{"tidb_txn_mode", "SELECT @@tidb_txn_mode"},
+		},
+	})
+	strategies = append(strategies, Strategy{
+		Name:        "tidb-region-split",
+		Description: "Using multi-row INSERT while tracking TiKV region splits",
+		Engines:     []string{"tidb"},
+		Params:      dataParams,
+		Workload:    workloadBatchInsert,
+		Run:         insertTrackingRegionSplits,
+	})
+}
+
+type regionSample struct {
+	elapsed time.Duration
+	rows    int64
+	regions int
+}
+
+func countRegions(ctx context.Context, db *sql.DB, table string) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.TIKV_REGION_STATUS WHERE DB_NAME = DATABASE() AND TABLE_NAME = ?",
+		table,
+	).Scan(&n)
+	return n, err
+}
+
+// insertTrackingRegionSplits runs sustained multi-row inserts while a
+// sampler records the table's region count. Intervals in which regions
+// split are compared with steady intervals, since splits (and the leader
+// transfers that follow) are what make TiDB ingest throughput sawtooth.
+func insertTrackingRegionSplits(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	startRegions, err := countRegions(ctx, db, opts.table())
+	if err != nil {
+		return Result{}, fmt.Errorf("count regions: %v", err)
+	}
+
+	var (
+		inserted atomic.Int64
+		samples  = []regionSample{{regions: startRegions}}
+		wg       sync.WaitGroup
+	)
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	start := time.Now()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(regionSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sampleCtx.Done():
+				return
+			case <-ticker.C:
+				regions, err := countRegions(sampleCtx, db, opts.table())
+				if err != nil {
+					continue
+				}
+				samples = append(samples, regionSample{time.Since(start), inserted.Load(), regions})
+			}
+		}
+	}()
+
+	gen := opts.rowGen("TiDB")
+	var rec latencyRecorder
+	i := 0
+	for !opts.done(i, start) {
+		n := opts.nextBatch(i)
+		query, args := multiRowInsert(opts.table(), gen, i, n)
+
+		opStart := time.Now()
+		if _, err := db.ExecContext(ctx, query, args...); err != nil {
+			stopSampling()
+			wg.Wait()
+			return Result{}, fmt.Errorf("batch insert error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+		i += n
+		inserted.Store(int64(i))
+	}
+	result := rec.result(i, time.Since(start))
+	stopSampling()
+	wg.Wait()
+
+	result.Metrics = regionSplitMetrics(samples)
+	log.Printf("tidb-region-split: regions %.0f→%.0f (%.0f splits); %s rows/s in split intervals vs %s rows/s in steady intervals",
+		result.Metrics["regions_start"], result.Metrics["regions_end"], result.Metrics["region_splits"],
+		formatRate(result.Metrics["split_interval_rows_per_sec"]), formatRate(result.Metrics["steady_interval_rows_per_sec"]))
+	return result, nil
+}
+
+func regionSplitMetrics(samples []regionSample) map[string]float64 {
+	var splitRows, steadyRows int64
+	var splitTime, steadyTime time.Duration
+	splits := 0
+	for k := 1; k < len(samples); k++ {
+		prev, cur := samples[k-1], samples[k]
+		rows, dt := cur.rows-prev.rows, cur.elapsed-prev.elapsed
+		if cur.regions > prev.regions {
+			splits += cur.regions - prev.regions
+			splitRows, splitTime = splitRows+rows, splitTime+dt
+		} else {
+			steadyRows, steadyTime = steadyRows+rows, steadyTime+dt
+		}
+	}
+
+	metrics := map[string]float64{
+		"regions_start": float64(samples[0].regions),
+		"regions_end":   float64(samples[len(samples)-1].regions),
+		"region_splits": float64(splits),
+	}
+	if splitTime > 0 {
+		metrics["split_interval_rows_per_sec"] = float64(splitRows) / splitTime.Seconds()
+	}
+	if steadyTime > 0 {
+		metrics["steady_interval_rows_per_sec"] = float64(steadyRows) / steadyTime.Seconds()
+	}
+	return metrics
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/des"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// Vitess is reached through vtgate, which speaks the MySQL protocol. The
+// strategies below assume benchmark_users is sharded on id with the
+// standard hash vindex and evenly split shards (-80, 80- for two shards, and
+// so on); set -param vitess.shards to the keyspace's shard count. id must
+// be a BIGINT since explicit, non-sequential ids are inserted. New tables
+// need a VSchema entry, so the per-strategy tables are not created
+// automatically: add them (benchmark_users_vitess_single_shard_tx and
+// benchmark_users_vitess_cross_shard_tx) to the keyspace or run with
+// -shared-table.
+func init() {
+	registerEngine(&engine{
+		Name:   "vitess",
+		Driver: "mysql",
+		DSN:    mysqlDSN,
+		// New tables need a VSchema entry, and savepoints are limited to
+		// single-shard transactions.
+		dialect:  mysqlDialect.without(featureCreateTable | featureSavepoints),
+		Classify: mysqlClassify,
+		Info:     []infoQuery{{"version", "SELECT VERSION()"}},
+	})
+	params := []Param{{Name: "vitess.shards", Default: "2", Description: "number of evenly split shards in the keyspace"}}
+	strategies = append(strategies,
+		Strategy{
+			Name:        "vitess-single-shard-tx",
+			Description: "Using Vitess transactions confined to one shard",
+			Engines:     []string{"vitess"},
+			Params:      params,
+			Workload:    workloadTxInsert,
+			Run: func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+				return insertShardedTransactions(ctx, db, opts, false)
+			},
+		},
+		Strategy{
+			Name:        "vitess-cross-shard-tx",
+			Description: "Using Vitess transactions spanning all shards",
+			Engines:     []string{"vitess"},
+			Params:      params,
+			Workload:    workloadTxInsert,
+			Run: func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+				return insertShardedTransactions(ctx, db, opts, true)
+			},
+		},
+	)
+}
+
+var vitessHashBlock = func() cipher.Block {
+	block, err := des.NewTripleDESCipher(make([]byte, 24))
+	if err != nil {
+		panic(err)
+	}
+	return block
+}()
+
+// vitessShard maps a sharding key to its shard index the way the Vitess
+// hash vindex does: the keyspace ID is the 3DES encryption (all-zero key)
+// of the big-endian key, and evenly split shards own equal keyspace ranges.
+func vitessShard(id uint64, shards int) int {
+	var in, out [8]byte
+	binary.BigEndian.PutUint64(in[:], id)
+	vitessHashBlock.Encrypt(out[:], in[:])
+	hi, _ := bits.Mul64(binary.BigEndian.Uint64(out[:]), uint64(shards))
+	return int(hi)
+}
+
+// shardedIDs hands out unique ids that land on a requested shard. Candidate
+// ids are scanned sequentially and buffered per shard until asked for.
+type shardedIDs struct {
+	next    uint64
+	shards  int
+	pending [][]uint64
+}
+
+func newShardedIDs(shards int) *shardedIDs {
+	// Start from a time-derived base so repeated runs don't collide.
+	return &shardedIDs{next: uint64(time.Now().UnixMicro()) * 1000, shards: shards, pending: make([][]uint64, shards)}
+}
+
+func (g *shardedIDs) nextFor(shard int) uint64 {
+	for len(g.pending[shard]) == 0 {
+		id := g.next
+		g.next++
+		s := vitessShard(id, g.shards)
+		g.pending[s] = append(g.pending[s], id)
+	}
+	id := g.pending[shard][0]
+	g.pending[shard] = g.pending[shard][1:]
+	return id
+}
+
+// insertShardedTransactions commits BatchSize rows per transaction. With
+// crossShard the rows of each transaction are spread round-robin over all
+// shards, forcing a multi-shard commit; otherwise every transaction targets
+// a single shard (rotating between transactions).
+func insertShardedTransactions(ctx context.Context, db *sql.DB, opts RunOptions, crossShard bool) (Result, error) {
+	shards := opts.intParam("vitess.shards", 2)
+	if shards < 1 {
+		return Result{}, fmt.Errorf("vitess.shards must be positive")
+	}
+	ids := newShardedIDs(shards)
+	start := time.Now()
+
+	var rec latencyRecorder
+	i, txs := 0, 0
+	for !opts.done(i, start) {
+		n := opts.nextBatch(i)
+
+		opStart := time.Now()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return Result{}, fmt.Errorf("begin transaction error: %v", err)
+		}
+		for j := 0; j < n; j++ {
+			shard := txs % shards
+			if crossShard {
+				shard = j % shards
+			}
+			id := ids.nextFor(shard)
+			_, err := tx.ExecContext(ctx, "INSERT INTO "+opts.table()+" (id, name, email) VALUES (?, ?, ?)",
+				id, fmt.Sprintf("UserShard%d", id), fmt.Sprintf("shard%d@example.com", id))
+			if err != nil {
+				tx.Rollback()
+				return Result{}, fmt.Errorf("tx exec error: %v", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return Result{}, fmt.Errorf("commit error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+		txs++
+		i += n
+	}
+
+	result := rec.result(i, time.Since(start))
+	result.Transactions = txs
+	shardsPerTx := 1
+	if crossShard {
+		shardsPerTx = min(shards, opts.batchSize())
+	}
+	result.Metrics = map[string]float64{"shards": float64(shards), "shards_per_tx": float64(shardsPerTx)}
+	return result, nil
+}
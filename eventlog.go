@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// eventLog writes the machine-readable side of a run as JSON Lines
+// (-event-log, BENCHMARK_EVENT_LOG): one object per line with a sequence
+// number, the wall-clock time and the monotonic time since the log was
+// opened, so consumers can order events even if the clock steps. Console
+// log lines are copied in as "log" events; runBenchmark adds the
+// strategies' start, result and failure as structured events.
+type eventLog struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	seq    int64
+	opened time.Time
+}
+
+// events is the open event log, if any.
+var events *eventLog
+
+// openEventLog starts the event log at path, replacing any open one. The
+// standard logger's output is copied into it by logOutput.
+func openEventLog(path string) error {
+	if events != nil && events.path == path {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open event log: %v", err)
+	}
+	if events != nil {
+		events.close()
+	}
+	events = &eventLog{path: path, file: file, opened: time.Now()}
+	return nil
+}
+
+// emit writes one event. Fields are added next to the envelope's seq,
+// time, elapsed_ns and event.
+func (l *eventLog) emit(event string, fields map[string]any) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	now := time.Now()
+	// The envelope comes first on every line, ahead of the sorted fields.
+	line := fmt.Sprintf(`{"seq":%d,"time":%q,"elapsed_ns":%d,"event":%q`, l.seq, now.Format(time.RFC3339Nano), now.Sub(l.opened).Nanoseconds(), event)
+	if len(fields) > 0 {
+		data, err := json.Marshal(fields)
+		if err != nil {
+			data = []byte(fmt.Sprintf(`{"marshal_error":%q}`, err.Error()))
+		}
+		line += "," + string(data[1:])
+	} else {
+		line += "}"
+	}
+	if _, err := l.file.WriteString(line + "\n"); err != nil {
+		fmt.Fprintf(logConsole, "Warning: could not write event log: %v\n", err)
+	}
+}
+
+func (l *eventLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.file.Close()
+}
+
+// strategyEvent is the fields of a strategy's result event.
+func strategyEvent(result Result) map[string]any {
+	fields := map[string]any{
+		"strategy":     result.Strategy,
+		"workload":     result.Workload,
+		"rows":         result.Rows,
+		"duration_ns":  result.Duration.Nanoseconds(),
+		"rows_per_sec": result.RowsPerSec(),
+		"latency":      result.Latency,
+	}
+	if len(result.Metrics) > 0 {
+		fields["metrics"] = result.Metrics
+	}
+	return fields
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Explain modes for RunOptions.Explain.
+const (
+	explainOff     = ""
+	explainPlan    = "plan"
+	explainAnalyze = "analyze"
+)
+
+// queryPlan is the plan of one distinct read query, as the engine's
+// EXPLAIN printed it.
+type queryPlan struct {
+	Query    string `json:"query"`
+	Plan     string `json:"plan,omitempty"`
+	Analyzed bool   `json:"analyzed,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// planRecorder explains each distinct query of a strategy once. With
+// explainAnalyze the query is executed again by EXPLAIN ANALYZE, which is
+// why plans are captured only once per query per run.
+type planRecorder struct {
+	mode   string
+	engine *engine
+	seen   map[string]bool
+	plans  []queryPlan
+}
+
+func (o RunOptions) planRecorder() *planRecorder {
+	return &planRecorder{mode: o.Explain, engine: o.Engine, seen: map[string]bool{}}
+}
+
+// capture records the plan of query unless explaining is off, the engine
+// has no EXPLAIN or the query was already explained. Failures are kept in
+// the plan rather than failing the strategy.
+func (p *planRecorder) capture(ctx context.Context, db *sql.DB, query string, args ...any) {
+	if p.mode == explainOff || p.engine == nil || p.engine.Explain == "" || p.seen[query] {
+		return
+	}
+	p.seen[query] = true
+
+	prefix, analyzed := p.engine.Explain, false
+	if p.mode == explainAnalyze && p.engine.ExplainAnalyze != "" {
+		prefix, analyzed = p.engine.ExplainAnalyze, true
+	}
+	plan := queryPlan{Query: query, Analyzed: analyzed}
+	text, err := explainQuery(ctx, db, prefix+" "+query, args...)
+	if err != nil {
+		log.Printf("Warning: explain failed for %q: %v", query, err)
+		plan.Error = err.Error()
+	}
+	plan.Plan = text
+	p.plans = append(p.plans, plan)
+}
+
+// explainQuery returns the EXPLAIN output with columns separated by tabs
+// and rows by newlines.
+func explainQuery(ctx context.Context, db *sql.DB, query string, args ...any) (string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return "", err
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = v.String
+		}
+		lines = append(lines, strings.Join(fields, "\t"))
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+// planChange is a query whose plan differs between baseline and current.
+type planChange struct {
+	Query    string
+	Baseline string
+	Current  string
+}
+
+var planNumberRE = regexp.MustCompile(`\d+(\.\d+)?([eE][-+]?\d+)?`)
+
+// planShape strips the numbers (costs, row estimates, timings) from a plan
+// so that only the chosen operators, access paths and indexes remain.
+func planShape(plan string) string {
+	return strings.TrimSpace(planNumberRE.ReplaceAllString(plan, "#"))
+}
+
+// comparePlans reports the queries explained in both runs whose plan shape
+// changed. Plans that failed to capture are ignored.
+func comparePlans(baseline, current []queryPlan) []planChange {
+	before := map[string]string{}
+	for _, p := range baseline {
+		if p.Error == "" {
+			before[p.Query] = p.Plan
+		}
+	}
+	var changes []planChange
+	for _, p := range current {
+		old, ok := before[p.Query]
+		if !ok || p.Error != "" {
+			continue
+		}
+		if planShape(old) != planShape(p.Plan) {
+			changes = append(changes, planChange{Query: p.Query, Baseline: old, Current: p.Plan})
+		}
+	}
+	return changes
+}
+
+// renderPlanChanges is the Markdown section showing changed plans side by
+// side, or "" when no plan changed.
+func renderPlanChanges(comparisons []comparison) string {
+	var b strings.Builder
+	for _, c := range comparisons {
+		for _, pc := range c.PlanChanges {
+			if b.Len() == 0 {
+				b.WriteString("\n#### :warning: Query plan changes\n")
+			}
+			fmt.Fprintf(&b, "\n<details><summary><code>%s</code>: <code>%s</code></summary>\n\n", c.Strategy, markdownEscaper.Replace(pc.Query))
+			fmt.Fprintf(&b, "Baseline:\n```\n%s\n```\nCurrent:\n```\n%s\n```\n\n</details>\n", pc.Baseline, pc.Current)
+		}
+	}
+	return b.String()
+}
+
+func validateExplain(mode string) error {
+	switch mode {
+	case explainOff, explainPlan, explainAnalyze:
+		return nil
+	}
+	return fmt.Errorf("invalid explain mode %q (expected plan or analyze)", mode)
+}
+
+// renderPlans is the Markdown section listing captured plans, one
+// collapsible block per query.
+func renderPlans(results []Result) string {
+	var b strings.Builder
+	for _, r := range results {
+		for _, p := range r.Plans {
+			if b.Len() == 0 {
+				b.WriteString("\n#### Query plans\n")
+			}
+			kind := "EXPLAIN"
+			if p.Analyzed {
+				kind = "EXPLAIN ANALYZE"
+			}
+			fmt.Fprintf(&b, "\n<details><summary><code>%s</code> %s: <code>%s</code></summary>\n\n", r.Strategy, kind, markdownEscaper.Replace(p.Query))
+			if p.Error != "" {
+				fmt.Fprintf(&b, "> :x: %s\n", strings.ReplaceAll(p.Error, "\n", " "))
+			} else {
+				fmt.Fprintf(&b, "```\n%s\n```\n", p.Plan)
+			}
+			b.WriteString("\n</details>\n")
+		}
+	}
+	return b.String()
+}
+
+var markdownEscaper = strings.NewReplacer("<", "&lt;", ">", "&gt;", "&", "&amp;", "\n", " ")
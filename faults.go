@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Fault kinds: cancel runs the statement with its context already
+// cancelled, so that it fails in the driver without reaching the server;
+// bad-sql sends the server a statement that doesn't parse, so that it fails
+// a round trip later, on the server's error path.
+const (
+	faultCancel = "cancel"
+	faultBadSQL = "bad-sql"
+)
+
+var faultKinds = []string{faultCancel, faultBadSQL}
+
+// badSQLPrefix makes any statement a syntax error on every engine.
+const badSQLPrefix = "BENCHMARK_INDUCED_FAULT "
+
+// faultInjector fails Percent of the statements strategies run with one of
+// Kinds, picked at random, and then runs the statement for real, so that
+// the strategy goes on as if its driver had retried. Each induced failure
+// counts as a retry, and the strategy's result reports how many there
+// were, how many unexpectedly didn't fail and how long they took, which is
+// the error path's overhead added to the operations' latencies. Inside a
+// transaction only cancel is injected, as a failed statement aborts the
+// transaction on some engines.
+type faultInjector struct {
+	Percent float64
+	Kinds   []string
+}
+
+// injectingFaults has the pool's connections wrapped by injectFaults,
+// which inject nothing until activeFaults is set.
+var injectingFaults bool
+
+// activeFaults, while set, is the injection of the strategy running.
+var activeFaults atomic.Pointer[faultRun]
+
+// faultRun counts one strategy's induced failures.
+type faultRun struct {
+	f *faultInjector
+	// injected is the failures induced, escaped those that succeeded
+	// anyway, elapsed the nanoseconds spent in the failed attempts.
+	injected, escaped, elapsed atomic.Int64
+	// skipped counts the bad-sql faults not injected inside transactions.
+	skipped atomic.Int64
+}
+
+func parseFaultKinds(value string) ([]string, error) {
+	var kinds []string
+	for _, k := range strings.Split(value, ",") {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if !containsString(faultKinds, k) {
+			return nil, fmt.Errorf("unknown fault kind %q (available: %s)", k, strings.Join(faultKinds, ", "))
+		}
+		kinds = append(kinds, k)
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no fault kinds given")
+	}
+	return kinds, nil
+}
+
+// begin starts injecting faults into the strategy's statements.
+func (f *faultInjector) begin() *faultRun {
+	if f == nil {
+		return nil
+	}
+	r := &faultRun{f: f}
+	activeFaults.Store(r)
+	return r
+}
+
+// end stops injecting and adds the failures to result.
+func (r *faultRun) end(s Strategy, result *Result) {
+	if r == nil {
+		return
+	}
+	activeFaults.CompareAndSwap(r, nil)
+	injected, escaped := r.injected.Load(), r.escaped.Load()
+	if skipped := r.skipped.Load(); skipped > 0 {
+		log.Printf("Warning: %s: %d bad-sql faults not injected inside transactions", s.Name, skipped)
+	}
+	if escaped > 0 {
+		log.Printf("Warning: %s: %d of %d induced faults didn't fail", s.Name, escaped, injected)
+	}
+	if result.Metrics == nil {
+		result.Metrics = map[string]float64{}
+	}
+	result.Metrics["faults_injected"] = float64(injected)
+	result.Metrics["faults_escaped"] = float64(escaped)
+	failed := injected - escaped
+	result.Retries += int(failed)
+	if failed > 0 {
+		perFault := time.Duration(r.elapsed.Load() / failed)
+		result.Metrics["fault_ms"] = float64(perFault) / float64(time.Millisecond)
+		if result.Duration > 0 {
+			result.Metrics["fault_overhead_pct"] = float64(r.elapsed.Load()) / float64(result.Duration) * 100
+		}
+		log.Printf("%s: %d induced faults retried, %s each on the error path", s.Name, failed, formatDuration(roundLatency(perFault)))
+	}
+}
+
+// draw picks the fault to induce before a statement, if any.
+func (r *faultRun) draw(inTx bool) string {
+	if rand.Float64()*100 >= r.f.Percent {
+		return ""
+	}
+	kind := r.f.Kinds[rand.Intn(len(r.f.Kinds))]
+	if kind == faultBadSQL && inTx {
+		r.skipped.Add(1)
+		return ""
+	}
+	return kind
+}
+
+// record counts an induced attempt that took d. It reports whether the
+// attempt failed as it should; if not, its result stands for the
+// statement's.
+func (r *faultRun) record(d time.Duration, err error) bool {
+	r.injected.Add(1)
+	if err == nil {
+		r.escaped.Add(1)
+		return false
+	}
+	r.elapsed.Add(int64(d))
+	return true
+}
+
+// cancelled is ctx with its cancellation already delivered.
+func cancelled(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	return ctx
+}
+
+// injectFaults wraps c so that while activeFaults is set its connections
+// fail statements before running them, if -faults is set.
+func injectFaults(c driver.Connector) driver.Connector {
+	if !injectingFaults {
+		return c
+	}
+	return faultConnector{c}
+}
+
+type faultConnector struct{ driver.Connector }
+
+func (c faultConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{Conn: conn}, nil
+}
+
+// faultConn induces failures in the statements run on conn. Like echoConn
+// it implements every optional interface database/sql looks for, answering
+// as if the interface were missing where conn lacks it, and an induced
+// failure takes the same call as the statement, so that the statement
+// still runs the way it would without -faults. A call the driver skips
+// counts no fault; database/sql then prepares the statement, and its
+// execution fails with the fault drawn for the call instead of drawing
+// again.
+type faultConn struct {
+	driver.Conn
+	inTx bool
+	// carried is set while pending is the fault, if any, drawn for a
+	// statement the driver skipped and database/sql is about to prepare.
+	carried bool
+	pending string
+}
+
+func (c *faultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	var res driver.Result
+	err := c.run(ctx, query, func(ctx context.Context, query string) (err error) {
+		res, err = execer.ExecContext(ctx, query, args)
+		return err
+	})
+	return res, err
+}
+
+func (c *faultConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	var rows driver.Rows
+	err := c.run(ctx, query, func(ctx context.Context, query string) (err error) {
+		rows, err = queryer.QueryContext(ctx, query, args)
+		return err
+	})
+	return rows, err
+}
+
+// run runs a statement through call, first failing it with the fault
+// drawn, if any, by calling it with its context cancelled or its query
+// invalid. If the driver skips either call, the draw is carried over to
+// the prepared execution that follows.
+func (c *faultConn) run(ctx context.Context, query string, call func(ctx context.Context, query string) error) error {
+	c.carried = false
+	r := activeFaults.Load()
+	if r == nil {
+		return call(ctx, query)
+	}
+	if kind := r.draw(c.inTx); kind != "" {
+		faultCtx, faultQuery := ctx, query
+		if kind == faultCancel {
+			faultCtx = cancelled(ctx)
+		} else {
+			faultQuery = badSQLPrefix + query
+		}
+		start := time.Now()
+		err := call(faultCtx, faultQuery)
+		if err == driver.ErrSkip {
+			c.carried, c.pending = true, kind
+			return err
+		}
+		if !r.record(time.Since(start), err) {
+			return nil
+		}
+	}
+	err := call(ctx, query)
+	if err == driver.ErrSkip {
+		c.carried, c.pending = true, ""
+	}
+	return err
+}
+
+func (c *faultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return faultStmt{stmt, c, query}, nil
+}
+
+// prepareBadSQL is a prepared statement's bad-sql fault: preparing its
+// query made invalid, which fails on the server.
+func (c *faultConn) prepareBadSQL(ctx context.Context, query string) error {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, badSQLPrefix+query)
+	} else {
+		stmt, err = c.Conn.Prepare(badSQLPrefix + query)
+	}
+	if err == nil {
+		stmt.Close()
+	}
+	return err
+}
+
+func (c *faultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return faultTx{tx, c}, nil
+}
+
+func (c *faultConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *faultConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *faultConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *faultConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// faultTx notes on its connection when the transaction ends.
+type faultTx struct {
+	driver.Tx
+	conn *faultConn
+}
+
+func (t faultTx) Commit() error {
+	t.conn.inTx = false
+	return t.Tx.Commit()
+}
+
+func (t faultTx) Rollback() error {
+	t.conn.inTx = false
+	return t.Tx.Rollback()
+}
+
+// faultStmt induces failures in the executions of a prepared statement.
+type faultStmt struct {
+	driver.Stmt
+	conn  *faultConn
+	query string
+}
+
+// induce fails one execution of the statement with kind, through exec for
+// a cancelled one. It reports whether the real execution should follow,
+// which it shouldn't if exec succeeded despite the cancellation.
+func (s faultStmt) induce(ctx context.Context, r *faultRun, kind string, exec func(ctx context.Context) error) bool {
+	if kind == faultCancel {
+		start := time.Now()
+		err := exec(cancelled(ctx))
+		if errors.Is(err, driver.ErrSkip) {
+			return true
+		}
+		return r.record(time.Since(start), err)
+	}
+	// Preparing ran nothing, so the execution follows even if it worked.
+	start := time.Now()
+	err := s.conn.prepareBadSQL(ctx, s.query)
+	r.record(time.Since(start), err)
+	return true
+}
+
+// draw is the fault for an execution, if any, the one carried over from
+// the connection's skipped call if there is one.
+func (s faultStmt) draw(r *faultRun) string {
+	if s.conn.carried {
+		s.conn.carried = false
+		return s.conn.pending
+	}
+	return r.draw(s.conn.inTx)
+}
+
+func (s faultStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	exec := func(ctx context.Context) (driver.Result, error) {
+		if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+			return e.ExecContext(ctx, args)
+		}
+		values, err := namedValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Exec(values)
+	}
+	if r := activeFaults.Load(); r != nil {
+		if kind := s.draw(r); kind != "" {
+			var res driver.Result
+			if !s.induce(ctx, r, kind, func(ctx context.Context) (err error) {
+				res, err = exec(ctx)
+				return err
+			}) {
+				return res, nil
+			}
+		}
+	}
+	return exec(ctx)
+}
+
+func (s faultStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	query := func(ctx context.Context) (driver.Rows, error) {
+		if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			return q.QueryContext(ctx, args)
+		}
+		values, err := namedValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Query(values)
+	}
+	if r := activeFaults.Load(); r != nil {
+		if kind := s.draw(r); kind != "" {
+			var rows driver.Rows
+			if !s.induce(ctx, r, kind, func(ctx context.Context) (err error) {
+				rows, err = query(ctx)
+				return err
+			}) {
+				return rows, nil
+			}
+		}
+	}
+	return query(ctx)
+}
+
+func (s faultStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+func (s faultStmt) ColumnConverter(idx int) driver.ValueConverter {
+	if c, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return c.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
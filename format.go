@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// precision is the number of significant figures durations, rates and
+// sizes are shown with in reports and logs (-precision,
+// BENCHMARK_PRECISION). JSON output keeps the raw values.
+var precision = 3
+
+// figures is precision held to the 1 to 9 figures that -precision
+// accepts, so that formatting can't fail on a value that slipped past
+// validation.
+func figures() int {
+	return min(max(precision, 1), 9)
+}
+
+// significant rounds v to precision significant figures.
+func significant(v float64) float64 {
+	if v == 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return v
+	}
+	scale := math.Pow(10, float64(figures())-math.Ceil(math.Log10(math.Abs(v))))
+	return math.Round(v*scale) / scale
+}
+
+// roundLatency rounds d to precision significant figures, and to the
+// second from a minute up, where time.Duration's String has no fractions
+// of a second worth showing.
+func roundLatency(d time.Duration) time.Duration {
+	if d >= time.Minute || d <= -time.Minute {
+		return d.Round(time.Second)
+	}
+	unit := time.Duration(1)
+	for n := d.Abs() / time.Duration(math.Pow10(figures())); n > 0; n /= 10 {
+		unit *= 10
+	}
+	return d.Round(unit)
+}
+
+// formatDuration is d rounded by roundLatency, e.g. 4.84s or 13.8ms.
+func formatDuration(d time.Duration) string {
+	return roundLatency(d).String()
+}
+
+// formatRate is a per-second rate with an SI suffix, e.g. 207 or 12.3k.
+func formatRate(v float64) string {
+	return formatSI(v, 1000, []string{"", "k", "M", "G"}, "")
+}
+
+// formatBytes is a size in bytes with a binary prefix, e.g. 512 B or
+// 12.3 MB.
+func formatBytes(v float64) string {
+	if math.Abs(v) < 1024 {
+		return fmt.Sprintf("%.0f B", v)
+	}
+	return formatSI(v, 1024, []string{"B", "KB", "MB", "GB", "TB"}, " ")
+}
+
+func formatSI(v, base float64, units []string, sep string) string {
+	i := 0
+	for math.Abs(significant(v)) >= base && i < len(units)-1 {
+		v /= base
+		i++
+	}
+	v = significant(v)
+	// Keep as many decimals as the significant figures leave, so 12.0k
+	// doesn't shrink to 12k next to 12.3k.
+	decimals := 0
+	if v != 0 {
+		decimals = max(figures()-int(math.Floor(math.Log10(math.Abs(v))))-1, 0)
+	}
+	return fmt.Sprintf("%s%s%s", strconv.FormatFloat(v, 'f', decimals, 64), sep, units[i])
+}
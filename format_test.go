@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func withPrecision(t *testing.T, p int) {
+	saved := precision
+	precision = p
+	t.Cleanup(func() { precision = saved })
+}
+
+func TestSignificant(t *testing.T) {
+	withPrecision(t, 3)
+	for _, tc := range []struct{ v, want float64 }{
+		{0, 0},
+		{1234.5, 1230},
+		{0.012345, 0.0123},
+		{-4.567, -4.57},
+		{999.5, 1000},
+		{100, 100},
+	} {
+		if got := significant(tc.v); got != tc.want {
+			t.Errorf("significant(%v) = %v, want %v", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestRoundLatency(t *testing.T) {
+	withPrecision(t, 3)
+	for _, tc := range []struct{ d, want time.Duration }{
+		{0, 0},
+		{999 * time.Nanosecond, 999 * time.Nanosecond},
+		{1234 * time.Nanosecond, 1230 * time.Nanosecond},
+		{13847 * time.Microsecond, 13800 * time.Microsecond},
+		{999500 * time.Nanosecond, time.Millisecond},
+		{4843200 * time.Microsecond, 4840 * time.Millisecond},
+		{-13847 * time.Microsecond, -13800 * time.Microsecond},
+		{time.Hour + 2*time.Minute + 3400*time.Millisecond, time.Hour + 2*time.Minute + 3*time.Second},
+	} {
+		if got := roundLatency(tc.d); got != tc.want {
+			t.Errorf("roundLatency(%v) = %v, want %v", tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestFormatSI(t *testing.T) {
+	withPrecision(t, 3)
+	for _, tc := range []struct {
+		got, want string
+	}{
+		{formatRate(0), "0"},
+		{formatRate(207), "207"},
+		{formatRate(999.4), "999"},
+		{formatRate(999.5), "1.00k"},
+		{formatRate(12000), "12.0k"},
+		{formatRate(12345), "12.3k"},
+		{formatRate(2.5e9), "2.50G"},
+		{formatRate(4e12), "4000G"},
+		{formatBytes(512), "512 B"},
+		{formatBytes(1023.6), "1024 B"},
+		{formatBytes(12.3 * 1024 * 1024), "12.3 MB"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+}
+
+func TestPrecisionOutOfRange(t *testing.T) {
+	for _, tc := range []struct {
+		precision int
+		d, want   time.Duration
+	}{
+		{-1, 13847 * time.Microsecond, 10 * time.Millisecond},
+		{0, 13847 * time.Microsecond, 10 * time.Millisecond},
+		{12, 1234567891 * time.Nanosecond, 1234567890 * time.Nanosecond},
+	} {
+		withPrecision(t, tc.precision)
+		if got := roundLatency(tc.d); got != tc.want {
+			t.Errorf("precision %d: roundLatency(%v) = %v, want %v", tc.precision, tc.d, got, tc.want)
+		}
+		if got := significant(13.847); got == 0 {
+			t.Errorf("precision %d: significant(13.847) = 0", tc.precision)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// recordSampleTimes has latencyRecorder note when each operation finished,
+// as the time since sampleEpoch, which the heatmaps plot latency against
+// (-heatmap).
+var (
+	recordSampleTimes bool
+	sampleEpoch       = time.Now()
+)
+
+// Heatmap layout: time columns by log-latency rows, in SVG pixels.
+const (
+	heatmapColumns = 120
+	heatmapRows    = 40
+	heatmapCell    = 6
+	heatmapLeft    = 70 // room for the latency axis
+	heatmapTop     = 30
+	heatmapBottom  = 40
+)
+
+// writeHeatmaps writes an SVG heatmap of latency over time for each result
+// with timed samples to dir, as <strategy>.svg, numbering the repetitions
+// of a strategy run more than once.
+func writeHeatmaps(dir string, results []Result) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %v", dir, err)
+	}
+	seen := map[string]int{}
+	for _, r := range results {
+		if r.Skipped != "" {
+			continue
+		}
+		if len(r.sampleTimes) == 0 || len(r.sampleTimes) != len(r.samples) {
+			log.Printf("Warning: %s: no timed latency samples for a heatmap", r.Strategy)
+			continue
+		}
+		seen[r.Strategy]++
+		name := r.Strategy
+		if n := seen[r.Strategy]; n > 1 {
+			name = fmt.Sprintf("%s-%d", r.Strategy, n)
+		}
+		path := filepath.Join(dir, name+".svg")
+		if err := os.WriteFile(path, []byte(renderHeatmap(name, r)), 0o644); err != nil {
+			return fmt.Errorf("write %s: %v", path, err)
+		}
+		log.Printf("Latency heatmap for %s written to %s", name, path)
+	}
+	return nil
+}
+
+// renderHeatmap draws r's operations as a grid of time columns and
+// latency rows on a log scale, each cell shaded by how many operations
+// finished in that interval with that latency. Stalls show as columns
+// that are empty or shifted up, bimodal latencies as two bands; dashed
+// lines mark the p50 and p99.
+func renderHeatmap(name string, r Result) string {
+	first, last := r.sampleTimes[0], r.sampleTimes[0]
+	lo, hi := r.samples[0], r.samples[0]
+	for i, at := range r.sampleTimes {
+		first, last = min(first, at), max(last, at)
+		lo, hi = min(lo, r.samples[i]), max(hi, r.samples[i])
+	}
+	lo = max(lo, time.Microsecond)
+	if hi <= lo {
+		hi = lo * 2
+	}
+	span := max(last-first, 1)
+	logLo, logHi := math.Log(float64(lo)), math.Log(float64(hi))
+	row := func(d time.Duration) int {
+		v := (math.Log(math.Max(float64(d), float64(lo))) - logLo) / (logHi - logLo)
+		return min(int(v*heatmapRows), heatmapRows-1)
+	}
+
+	var counts [heatmapColumns][heatmapRows]int
+	peak := 0
+	for i, at := range r.sampleTimes {
+		col := min(int(float64(at-first)/float64(span)*heatmapColumns), heatmapColumns-1)
+		c := &counts[col][row(r.samples[i])]
+		*c++
+		peak = max(peak, *c)
+	}
+
+	width := heatmapLeft + heatmapColumns*heatmapCell + 20
+	height := heatmapTop + heatmapRows*heatmapCell + heatmapBottom
+	plotBottom := heatmapTop + heatmapRows*heatmapCell
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="13">%s: %d operations over %s</text>`+"\n",
+		heatmapLeft, svgEscape(name), len(r.samples), formatDuration(time.Duration(span)))
+	for col := range counts {
+		for rw, n := range counts[col] {
+			if n == 0 {
+				continue
+			}
+			// Shade by log count so that rare slow operations stay visible
+			// next to the bulk.
+			shade := math.Log1p(float64(n)) / math.Log1p(float64(peak))
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%d</title></rect>`+"\n",
+				heatmapLeft+col*heatmapCell, plotBottom-(rw+1)*heatmapCell, heatmapCell, heatmapCell, heatColor(shade), n)
+		}
+	}
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#888"/>`+"\n",
+		heatmapLeft, heatmapTop, heatmapColumns*heatmapCell, heatmapRows*heatmapCell)
+
+	for _, p := range []struct {
+		label string
+		d     time.Duration
+	}{{"p50", r.Latency.P50}, {"p99", r.Latency.P99}} {
+		if p.d <= 0 {
+			continue
+		}
+		y := plotBottom - row(p.d)*heatmapCell - heatmapCell/2
+		fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#d33" stroke-dasharray="4 3"/>`+"\n",
+			heatmapLeft, y, heatmapLeft+heatmapColumns*heatmapCell, y)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#d33">%s</text>`+"\n", heatmapLeft+heatmapColumns*heatmapCell+2, y+4, p.label)
+	}
+	for i := 0; i <= 4; i++ {
+		y := plotBottom - i*heatmapRows*heatmapCell/4
+		d := time.Duration(math.Exp(logLo + float64(i)/4*(logHi-logLo)))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", heatmapLeft-4, y+4, formatDuration(roundLatency(d)))
+		x := heatmapLeft + i*heatmapColumns*heatmapCell/4
+		at := time.Duration(float64(span) * float64(i) / 4)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", x, plotBottom+16, formatDuration(roundLatency(at)))
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">time into the strategy</text>`+"\n", heatmapLeft+heatmapColumns*heatmapCell/2, plotBottom+32)
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// heatColor maps 0..1 from pale yellow through orange to dark red.
+func heatColor(v float64) string {
+	stops := [][3]float64{{255, 255, 204}, {253, 141, 60}, {128, 0, 38}}
+	v = math.Max(0, math.Min(1, v)) * float64(len(stops)-1)
+	i := min(int(v), len(stops)-2)
+	f := v - float64(i)
+	var c [3]int
+	for k := range c {
+		c[k] = int(stops[i][k] + f*(stops[i+1][k]-stops[i][k]))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+}
+
+func svgEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
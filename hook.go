@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timelineInterval is the width of one throughput timeline sample.
+const timelineInterval = time.Second
+
+// timelineMeter, while set, counts the operations of the strategy a
+// measured hook runs during, like activeMeter does for the dashboard,
+// each in the interval the strategy observes it in.
+var timelineMeter atomic.Pointer[liveMeter]
+
+// timelineSample is the throughput of one interval of a strategy's run.
+type timelineSample struct {
+	Offset    time.Duration `json:"offset_ns"`
+	Ops       int           `json:"ops"`
+	OpsPerSec float64       `json:"ops_per_sec"`
+
+	width time.Duration
+}
+
+// timelineEvent marks when something outside the workload ran, as offsets
+// from the strategy's start. Running means it was still going when the
+// strategy finished.
+type timelineEvent struct {
+	Label   string        `json:"label"`
+	Start   time.Duration `json:"start_ns"`
+	End     time.Duration `json:"end_ns"`
+	Running bool          `json:"running,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// measuredHook triggers an external command, such as a backup or a VACUUM
+// job, At into a strategy's run, and records the strategy's throughput
+// timeline with the command's window marked on it so its impact can be
+// read off. End, if set, runs when the strategy finishes, e.g. to stop
+// what Start began; the strategy doesn't wait for Start's command.
+// Maintenance instead names a table maintenance operation of the engine,
+// such as optimize or vacuum, to run on the strategy's table in Start's
+// place, with the table's size before and after it reported where the
+// engine has one (see maintenanceStatements).
+type measuredHook struct {
+	Start       string
+	End         string
+	Maintenance string
+	At          time.Duration
+	Strategy    string // empty for the first strategy that runs
+}
+
+// matches reports whether the hook runs during s, settling on the first
+// strategy when none was named.
+func (h *measuredHook) matches(s Strategy) bool {
+	if h.Strategy == "" {
+		h.Strategy = s.Name
+	}
+	return h.Strategy == s.Name
+}
+
+// hookRun is one measured hook in progress.
+type hookRun struct {
+	hook    *measuredHook
+	label   string // the start command or maintenance statement
+	run     func(ctx context.Context) error
+	meter   *liveMeter
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+	timer   *time.Timer
+
+	mu       sync.Mutex
+	timeline []timelineSample
+	events   []timelineEvent
+	// The table's size around the maintenance, if the engine reports it.
+	sized         bool
+	before, after tableSize
+}
+
+// begin starts recording the timeline and schedules the start command or
+// the maintenance of opts' table.
+func (h *measuredHook) begin(ctx context.Context, s Strategy, db *sql.DB, opts RunOptions) *hookRun {
+	r := &hookRun{hook: h, label: h.Start, meter: &liveMeter{}, started: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+	r.run = func(ctx context.Context) error { return hookCommand(ctx, h.Start, s).Run() }
+	if h.Maintenance != "" {
+		r.label = fmt.Sprintf(maintenanceStatements[opts.Engine.Name][h.Maintenance], opts.table())
+		r.run = func(ctx context.Context) error { return r.maintain(ctx, db, opts) }
+	}
+	timelineMeter.Store(r.meter)
+	go r.sample()
+	r.timer = time.AfterFunc(h.At, func() { r.launch(ctx, s) })
+	return r
+}
+
+func (r *hookRun) sample() {
+	defer close(r.done)
+	ticker := time.NewTicker(timelineInterval)
+	defer ticker.Stop()
+	last, lastAt := 0, r.started
+	record := func(now time.Time) {
+		ops, _ := r.meter.take()
+		if elapsed := now.Sub(lastAt); elapsed > 0 {
+			r.mu.Lock()
+			r.timeline = append(r.timeline, timelineSample{Offset: lastAt.Sub(r.started), Ops: ops - last, OpsPerSec: float64(ops-last) / elapsed.Seconds(), width: elapsed})
+			r.mu.Unlock()
+		}
+		last, lastAt = ops, now
+	}
+	for {
+		select {
+		case <-r.stop:
+			record(time.Now())
+			return
+		case now := <-ticker.C:
+			record(now)
+		}
+	}
+}
+
+// launch runs the start command or maintenance in the background, marking
+// its window.
+func (r *hookRun) launch(ctx context.Context, s Strategy) {
+	r.mu.Lock()
+	i := len(r.events)
+	r.events = append(r.events, timelineEvent{Label: r.label, Start: time.Since(r.started), Running: true})
+	r.mu.Unlock()
+	log.Printf("%s: running hook %q", s.Name, r.label)
+	err := r.run(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A window closed by the strategy finishing stays as it was.
+	if !r.events[i].Running {
+		if err != nil {
+			log.Printf("Warning: hook %q failed after the strategy finished: %v", r.label, err)
+		}
+		return
+	}
+	r.events[i].End, r.events[i].Running = time.Since(r.started), false
+	if err != nil {
+		r.events[i].Error = err.Error()
+		log.Printf("Warning: hook %q failed: %v", r.label, err)
+	}
+}
+
+// maintain runs the maintenance statement, reading the table's size before
+// and after it. Failing to read the size only costs the bloat report.
+func (r *hookRun) maintain(ctx context.Context, db *sql.DB, opts RunOptions) error {
+	before, sized, err := readTableSize(ctx, db, opts.Engine, opts.table())
+	if err != nil {
+		log.Printf("Warning: could not read the size of %s: %v", opts.table(), err)
+	}
+	if err := runMaintenance(ctx, db, r.label); err != nil {
+		return err
+	}
+	if !sized {
+		return nil
+	}
+	after, sized, err := readTableSize(ctx, db, opts.Engine, opts.table())
+	if err != nil {
+		log.Printf("Warning: could not read the size of %s: %v", opts.table(), err)
+	}
+	r.mu.Lock()
+	r.sized, r.before, r.after = sized, before, after
+	r.mu.Unlock()
+	return nil
+}
+
+// end stops the timeline, runs the end command and adds both to result,
+// with the throughput inside and outside the hook windows in Metrics.
+func (r *hookRun) end(ctx context.Context, s Strategy, result *Result) {
+	r.timer.Stop()
+	close(r.stop)
+	<-r.done
+	timelineMeter.CompareAndSwap(r.meter, nil)
+	elapsed := time.Since(r.started)
+
+	r.mu.Lock()
+	for i := range r.events {
+		if r.events[i].Running {
+			r.events[i].End = elapsed
+		}
+	}
+	r.mu.Unlock()
+	if r.hook.End != "" {
+		start := time.Since(r.started)
+		err := hookCommand(ctx, r.hook.End, s).Run()
+		ev := timelineEvent{Label: r.hook.End, Start: start, End: time.Since(r.started)}
+		if err != nil {
+			ev.Error = err.Error()
+			log.Printf("Warning: hook %q failed: %v", r.hook.End, err)
+		}
+		r.mu.Lock()
+		r.events = append(r.events, ev)
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result.Timeline = r.timeline
+	result.Events = append([]timelineEvent(nil), r.events...)
+	var inOps, outOps int
+	var inTime, outTime time.Duration
+	for _, sample := range r.timeline {
+		width := sample.width
+		if r.duringEvent(sample.Offset + width/2) {
+			inOps, inTime = inOps+sample.Ops, inTime+width
+		} else {
+			outOps, outTime = outOps+sample.Ops, outTime+width
+		}
+	}
+	if (inTime > 0 && outTime > 0 || r.sized) && result.Metrics == nil {
+		result.Metrics = map[string]float64{}
+	}
+	if r.sized {
+		addTableSizes(result.Metrics, s.Name, r.before, r.after)
+	}
+	if inTime > 0 && outTime > 0 {
+		in, out := float64(inOps)/inTime.Seconds(), float64(outOps)/outTime.Seconds()
+		result.Metrics["hook_ops_per_sec"] = in
+		result.Metrics["outside_hook_ops_per_sec"] = out
+		log.Printf("%s: %s ops/s while the hook ran, %s ops/s otherwise", s.Name, formatRate(in), formatRate(out))
+	}
+}
+
+// duringEvent reports whether offset falls in the start command's or the
+// maintenance's window.
+func (r *hookRun) duringEvent(offset time.Duration) bool {
+	for _, ev := range r.events {
+		if ev.Label == r.label && offset >= ev.Start && offset < ev.End {
+			return true
+		}
+	}
+	return false
+}
+
+// hookCommand runs command with the shell, its output going to stderr and
+// the strategy named in BENCHMARK_STRATEGY.
+func hookCommand(ctx context.Context, command string, s Strategy) *exec.Cmd {
+	return shellCommand(ctx, command, "BENCHMARK_STRATEGY="+s.Name)
+}
+
+// shellCommand runs command with the platform's shell, its output going to
+// stderr so that it stays apart from reports written to stdout, with env
+// added to ours.
+func shellCommand(ctx context.Context, command string, env ...string) *exec.Cmd {
+	cmd := shellCommandArgs(ctx, command)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	return cmd
+}
+
+func validateHook(h *measuredHook) error {
+	if h.Start != "" && h.Maintenance != "" {
+		return fmt.Errorf("-hook and -maintenance can't be combined")
+	}
+	if h.Start == "" && h.Maintenance == "" && h.End != "" {
+		return fmt.Errorf("-hook-end needs -hook or -maintenance")
+	}
+	if h.Maintenance != "" {
+		known := false
+		for _, ops := range maintenanceStatements {
+			_, ok := ops[h.Maintenance]
+			known = known || ok
+		}
+		if !known {
+			return fmt.Errorf("-maintenance: unknown operation %q (expected optimize, analyze or vacuum)", h.Maintenance)
+		}
+	}
+	if h.At < 0 {
+		return fmt.Errorf("-hook-at must not be negative")
+	}
+	if h.Strategy == "" {
+		return nil
+	}
+	for _, s := range strategies {
+		if s.Name == h.Strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("-hook-strategy: unknown strategy %q", h.Strategy)
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// hostMeter, while set, counts the operations of the strategy whose
+// database host is being sampled, like timelineMeter does for a hook.
+var hostMeter atomic.Pointer[liveMeter]
+
+// wholeDisk matches the block devices whose I/O is counted by default:
+// whole disks, not their partitions, nor loop, RAM or device-mapper
+// devices, which would count the same I/O twice.
+var wholeDisk = regexp.MustCompile(`^(sd[a-z]+|vd[a-z]+|xvd[a-z]+|hd[a-z]+|nvme\d+n\d+|mmcblk\d+)$`)
+
+// hostCounters are a host's cumulative CPU and disk counters at one time.
+type hostCounters struct {
+	CPUTotal, CPUIdle, CPUIOWait float64 // in any unit, as only ratios are used
+	IOs, Flushes                 float64 // completed reads and writes, and cache flushes
+}
+
+// hostSample is the database host's load over one interval of a
+// strategy's run, next to the strategy's throughput.
+type hostSample struct {
+	Offset        time.Duration `json:"offset_ns"`
+	OpsPerSec     float64       `json:"ops_per_sec"`
+	CPUPct        float64       `json:"cpu_pct"`
+	IOWaitPct     float64       `json:"iowait_pct"`
+	IOPS          float64       `json:"iops"`
+	FlushesPerSec float64       `json:"flushes_per_sec"`
+}
+
+// hostMetrics samples the database host's CPU and disks every
+// timelineInterval during each strategy (-host-metrics), from
+//
+//	local                        this host's /proc, for a database on the same machine
+//	http://host:9100/metrics     a node_exporter
+//	ssh://user@host[:port]       /proc read over SSH, authenticated like DB_SSH_HOST
+//
+// Flushes are the block layer's cache flush requests, which is what
+// fsync and O_DSYNC writes turn into on disks with a volatile write
+// cache; they need Linux 5.5 or later.
+type hostMetrics struct {
+	source string
+	disks  map[string]bool // nil for every whole disk
+	read   func(ctx context.Context) (hostCounters, error)
+}
+
+func newHostMetrics(source, disks string) (*hostMetrics, error) {
+	h := &hostMetrics{source: source}
+	if disks != "" {
+		h.disks = map[string]bool{}
+		for _, d := range strings.Split(disks, ",") {
+			h.disks[strings.TrimSpace(d)] = true
+		}
+	}
+	switch {
+	case source == "local" && runtime.GOOS != "linux":
+		return nil, fmt.Errorf("-host-metrics local reads /proc, which %s doesn't have; use a node_exporter URL", runtime.GOOS)
+	case source == "local":
+		h.read = func(context.Context) (hostCounters, error) {
+			var text strings.Builder
+			for _, path := range []string{"/proc/stat", "/proc/diskstats"} {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return hostCounters{}, err
+				}
+				text.Write(data)
+			}
+			return h.parseProc(text.String())
+		}
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		h.read = h.readNodeExporter
+	case strings.HasPrefix(source, "ssh://"):
+		client, err := h.dialSSH(strings.TrimPrefix(source, "ssh://"))
+		if err != nil {
+			return nil, err
+		}
+		h.read = func(context.Context) (hostCounters, error) {
+			session, err := client.NewSession()
+			if err != nil {
+				return hostCounters{}, err
+			}
+			defer session.Close()
+			out, err := session.Output("cat /proc/stat /proc/diskstats")
+			if err != nil {
+				return hostCounters{}, err
+			}
+			return h.parseProc(string(out))
+		}
+	default:
+		return nil, fmt.Errorf("-host-metrics: expected local, a node_exporter URL or ssh://user@host, got %q", source)
+	}
+	if _, err := h.read(context.Background()); err != nil {
+		return nil, fmt.Errorf("-host-metrics %s: %v", source, err)
+	}
+	return h, nil
+}
+
+func (h *hostMetrics) dialSSH(address string) (*ssh.Client, error) {
+	auth, err := sshAuth()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := sshHostKeys()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialSSH(nil, nil, address, auth, hostKeys)
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s: %v", address, err)
+	}
+	return client, nil
+}
+
+func (h *hostMetrics) countsDisk(name string) bool {
+	if h.disks != nil {
+		return h.disks[name]
+	}
+	return wholeDisk.MatchString(name)
+}
+
+// parseProc reads the aggregate cpu line of /proc/stat and the counted
+// disks' lines of /proc/diskstats from text holding both.
+func (h *hostMetrics) parseProc(text string) (hostCounters, error) {
+	var c hostCounters
+	cpu := false
+	for _, line := range strings.Split(text, "\n") {
+		f := strings.Fields(line)
+		switch {
+		case len(f) >= 9 && f[0] == "cpu":
+			// user nice system idle iowait irq softirq steal; guest time is
+			// already part of user.
+			for i := 1; i <= 8; i++ {
+				v, _ := strconv.ParseFloat(f[i], 64)
+				c.CPUTotal += v
+			}
+			c.CPUIdle, _ = strconv.ParseFloat(f[4], 64)
+			c.CPUIOWait, _ = strconv.ParseFloat(f[5], 64)
+			cpu = true
+		case len(f) >= 14 && h.countsDisk(f[2]):
+			reads, _ := strconv.ParseFloat(f[3], 64)
+			writes, _ := strconv.ParseFloat(f[7], 64)
+			c.IOs += reads + writes
+			if len(f) >= 19 {
+				flushes, _ := strconv.ParseFloat(f[18], 64)
+				c.Flushes += flushes
+			}
+		}
+	}
+	if !cpu {
+		return c, fmt.Errorf("no cpu line in /proc/stat")
+	}
+	return c, nil
+}
+
+// readNodeExporter reads the same counters from node_exporter's metrics.
+func (h *hostMetrics) readNodeExporter(ctx context.Context) (hostCounters, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.source, nil)
+	if err != nil {
+		return hostCounters{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return hostCounters{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return hostCounters{}, fmt.Errorf("node_exporter returned %s", resp.Status)
+	}
+	var c hostCounters
+	cpu := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, labels, value, ok := parsePromSample(line)
+		if !ok {
+			continue
+		}
+		switch name {
+		case "node_cpu_seconds_total":
+			c.CPUTotal += value
+			switch labels["mode"] {
+			case "idle":
+				c.CPUIdle += value
+			case "iowait":
+				c.CPUIOWait += value
+			case "guest", "guest_nice":
+				c.CPUTotal -= value // already part of user
+			}
+			cpu = true
+		case "node_disk_reads_completed_total", "node_disk_writes_completed_total":
+			if h.countsDisk(labels["device"]) {
+				c.IOs += value
+			}
+		case "node_disk_flush_requests_total":
+			if h.countsDisk(labels["device"]) {
+				c.Flushes += value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return c, err
+	}
+	if !cpu {
+		return c, fmt.Errorf("%s has no node_cpu_seconds_total", h.source)
+	}
+	return c, nil
+}
+
+// parsePromSample splits a Prometheus text format sample such as
+// node_cpu_seconds_total{cpu="0",mode="idle"} 123.4 into its parts.
+func parsePromSample(line string) (string, map[string]string, float64, bool) {
+	name, rest := line, ""
+	labels := map[string]string{}
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		j := strings.LastIndexByte(line, '}')
+		if j < i {
+			return "", nil, 0, false
+		}
+		name, rest = line[:i], line[j+1:]
+		for _, pair := range strings.Split(line[i+1:j], ",") {
+			if k, v, ok := strings.Cut(pair, "="); ok {
+				labels[strings.TrimSpace(k)] = strings.Trim(v, `"`)
+			}
+		}
+	} else if i := strings.IndexByte(line, ' '); i >= 0 {
+		name, rest = line[:i], line[i:]
+	}
+	f := strings.Fields(rest)
+	if len(f) == 0 {
+		return "", nil, 0, false
+	}
+	value, err := strconv.ParseFloat(f[0], 64)
+	return name, labels, value, err == nil
+}
+
+// hostRun is the sampling of one strategy in progress.
+type hostRun struct {
+	h       *hostMetrics
+	meter   *liveMeter
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	samples []hostSample
+}
+
+// begin starts sampling the host and counting the strategy's operations.
+func (h *hostMetrics) begin(ctx context.Context) *hostRun {
+	if h == nil {
+		return nil
+	}
+	r := &hostRun{h: h, meter: &liveMeter{}, started: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+	hostMeter.Store(r.meter)
+	go r.sample(ctx)
+	return r
+}
+
+func (r *hostRun) sample(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(timelineInterval)
+	defer ticker.Stop()
+	prev, err := r.h.read(ctx)
+	if err != nil {
+		log.Printf("Warning: host metrics: %v", err)
+	}
+	lastOps, lastAt := 0, r.started
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		cur, err := r.h.read(ctx)
+		now := time.Now()
+		ops, _ := r.meter.take()
+		if err != nil {
+			log.Printf("Warning: host metrics: %v", err)
+			continue
+		}
+		elapsed := now.Sub(lastAt).Seconds()
+		s := hostSample{
+			Offset:        lastAt.Sub(r.started),
+			OpsPerSec:     float64(ops-lastOps) / elapsed,
+			IOPS:          (cur.IOs - prev.IOs) / elapsed,
+			FlushesPerSec: (cur.Flushes - prev.Flushes) / elapsed,
+		}
+		if total := cur.CPUTotal - prev.CPUTotal; total > 0 {
+			s.CPUPct = 100 * (1 - (cur.CPUIdle+cur.CPUIOWait-prev.CPUIdle-prev.CPUIOWait)/total)
+			s.IOWaitPct = 100 * (cur.CPUIOWait - prev.CPUIOWait) / total
+		}
+		r.mu.Lock()
+		r.samples = append(r.samples, s)
+		r.mu.Unlock()
+		prev, lastOps, lastAt = cur, ops, now
+	}
+}
+
+// end stops sampling and adds the samples to result, with their means and
+// how closely each follows the throughput in Metrics: host_cpu_pct,
+// host_iowait_pct, host_iops and host_flushes_per_sec, and the Pearson
+// correlation of each with ops/s as host_cpu_corr, host_iowait_corr,
+// host_iops_corr and host_flushes_corr.
+func (r *hostRun) end(s Strategy, result *Result) {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	hostMeter.CompareAndSwap(r.meter, nil)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result.Host = r.samples
+	if len(r.samples) == 0 {
+		return
+	}
+	if result.Metrics == nil {
+		result.Metrics = map[string]float64{}
+	}
+	ops := make([]float64, len(r.samples))
+	for i, sample := range r.samples {
+		ops[i] = sample.OpsPerSec
+	}
+	for _, m := range []struct {
+		mean, corr string
+		value      func(hostSample) float64
+	}{
+		{"host_cpu_pct", "host_cpu_corr", func(s hostSample) float64 { return s.CPUPct }},
+		{"host_iowait_pct", "host_iowait_corr", func(s hostSample) float64 { return s.IOWaitPct }},
+		{"host_iops", "host_iops_corr", func(s hostSample) float64 { return s.IOPS }},
+		{"host_flushes_per_sec", "host_flushes_corr", func(s hostSample) float64 { return s.FlushesPerSec }},
+	} {
+		values := make([]float64, len(r.samples))
+		var sum float64
+		for i, sample := range r.samples {
+			values[i] = m.value(sample)
+			sum += values[i]
+		}
+		result.Metrics[m.mean] = sum / float64(len(values))
+		if corr, ok := pearson(ops, values); ok {
+			result.Metrics[m.corr] = corr
+		}
+	}
+	log.Printf("%s: host CPU %.0f%% (iowait %.0f%%), %s IOPS, %s flushes/s", s.Name, result.Metrics["host_cpu_pct"],
+		result.Metrics["host_iowait_pct"], formatRate(result.Metrics["host_iops"]), formatRate(result.Metrics["host_flushes_per_sec"]))
+}
+
+// pearson is the correlation coefficient of x and y, undefined when
+// either doesn't vary.
+func pearson(x, y []float64) (float64, bool) {
+	n := float64(len(x))
+	if len(x) < 3 {
+		return 0, false
+	}
+	var mx, my float64
+	for i := range x {
+		mx, my = mx+x[i], my+y[i]
+	}
+	mx, my = mx/n, my/n
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy, sxx, syy = sxy+dx*dy, sxx+dx*dx, syy+dy*dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+// renderHostMetrics tabulates the host's load per strategy, with each
+// measure's correlation with throughput, and its per-interval timeline.
+func renderHostMetrics(results []Result) string {
+	var b strings.Builder
+	corr := func(r Result, name string) string {
+		if c, ok := r.Metrics["host_"+name+"_corr"]; ok {
+			return fmt.Sprintf(" (r=%+.2f)", c)
+		}
+		return ""
+	}
+	for _, r := range results {
+		if len(r.Host) == 0 {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("\n#### Database host load\n\nMeans over the strategy; r is the correlation with its throughput per interval.\n\n")
+			b.WriteString("| Strategy | CPU | iowait | IOPS | Flushes/s |\n|---|--:|--:|--:|--:|\n")
+		}
+		fmt.Fprintf(&b, "| `%s` | %.0f%%%s | %.0f%%%s | %.0f%s | %.0f%s |\n", r.Strategy,
+			r.Metrics["host_cpu_pct"], corr(r, "cpu"), r.Metrics["host_iowait_pct"], corr(r, "iowait"),
+			r.Metrics["host_iops"], corr(r, "iops"), r.Metrics["host_flushes_per_sec"], corr(r, "flushes"))
+	}
+	for _, r := range results {
+		if len(r.Host) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n<details><summary><code>%s</code> host timeline</summary>\n\n", r.Strategy)
+		b.WriteString("| Offset | Ops/s | CPU | iowait | IOPS | Flushes/s |\n|--:|--:|--:|--:|--:|--:|\n")
+		for _, s := range r.Host {
+			fmt.Fprintf(&b, "| %v | %s | %.0f%% | %.0f%% | %s | %s |\n", s.Offset.Round(time.Second), formatRate(s.OpsPerSec), s.CPUPct, s.IOWaitPct, formatRate(s.IOPS), formatRate(s.FlushesPerSec))
+		}
+		b.WriteString("\n</details>\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+// Host policies decide which of several comma-separated DB_HOST hosts a
+// new connection tries first (DB_HOST_POLICY). Either way the others are
+// tried in turn if it can't connect.
+const (
+	hostFailover   = "failover"    // the first host, the others only while it's down
+	hostRoundRobin = "round-robin" // each host in turn, spreading connections over them
+)
+
+// splitHosts returns DB_HOST's comma-separated hosts.
+func splitHosts(hosts string) []string {
+	var out []string
+	for _, h := range strings.Split(hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// withDefaultPort returns host as host:port, adding port unless it has
+// one. IPv6 literals may come bracketed or not, e.g. ::1 or [::1]:3306.
+func withDefaultPort(host, port string) string {
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		return net.JoinHostPort(h, p)
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// urlHost brackets an IPv6 literal without a port, as URLs need it so that
+// its colons aren't taken for one.
+func urlHost(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil && ip.To4() == nil {
+		return "[" + strings.Trim(host, "[]") + "]"
+	}
+	return host
+}
+
+// openWithConnector opens a pool like sql.Open whose connections are
+// made by a configConnector, running config.SessionInit on each.
+func openWithConnector(eng *engine, config DBConfig) (*sql.DB, error) {
+	db, err := sql.Open(eng.Driver, eng.DSN(config))
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+	hosts := splitHosts(config.Host)
+	if len(hosts) == 0 {
+		hosts = []string{config.Host}
+	}
+	var c driver.Connector = &configConnector{eng: eng, config: config, hosts: hosts, driver: drv}
+	if len(config.SessionInit) > 0 {
+		c = sessionConnector{c, config.SessionInit}
+	}
+	return sql.OpenDB(injectFaults(echoSQL(c))), nil
+}
+
+// configConnector connects to one of the configured hosts in the order of
+// config.HostPolicy, logging in with config.Secrets' current credentials
+// if it is set and fetching them again once if a server refuses them.
+type configConnector struct {
+	eng    *engine
+	config DBConfig
+	hosts  []string
+	driver driver.Driver
+	next   atomic.Uint64 // the round-robin policy's next first host
+}
+
+func (c *configConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	config := c.config
+	if config.Secrets != nil {
+		creds, err := config.Secrets.get(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		config = withCredentials(config, creds)
+	}
+	first := 0
+	if c.config.HostPolicy == hostRoundRobin {
+		first = int(c.next.Add(1)-1) % len(c.hosts)
+	}
+	var errs []string
+	for i := range c.hosts {
+		config.Host = c.hosts[(first+i)%len(c.hosts)]
+		conn, err := c.connect(ctx, config)
+		if err != nil && config.Secrets != nil && c.eng.classify(err) == errAuth {
+			log.Printf("Authentication failed, fetching the credentials from %s again", config.Secrets)
+			if creds, fetchErr := config.Secrets.get(ctx, true); fetchErr == nil {
+				config = withCredentials(config, creds)
+				conn, err = c.connect(ctx, config)
+			}
+		}
+		if err == nil {
+			return conn, nil
+		}
+		if len(c.hosts) == 1 || ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", config.Host, err))
+	}
+	return nil, fmt.Errorf("no host could be connected to: %s", strings.Join(errs, "; "))
+}
+
+func (c *configConnector) Driver() driver.Driver { return c.driver }
+
+func (c *configConnector) connect(ctx context.Context, config DBConfig) (driver.Conn, error) {
+	dsn := c.eng.DSN(config)
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(dsn)
+}
+
+func withCredentials(config DBConfig, creds credentials) DBConfig {
+	if creds.Username != "" {
+		config.User = creds.Username
+	}
+	config.Password = creds.Password
+	return config
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// paymentsTable is keyed by the client's request ID, like a payments API
+// deduplicating retried requests.
+const paymentsTable = "benchmark_payments"
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "idempotent-insert",
+		Description: "Inserting keyed by request ID, skipping duplicates",
+		Params: []Param{
+			{Name: "idempotency.duplicate_rates", Default: "0/10/50", Description: "slash-separated percentages of requests that replay an earlier request ID, run one after another"},
+			{Name: "idempotency.seed", Default: "1", Description: "seed for choosing which requests are replays"},
+		},
+		Workload: workloadSingleInsert,
+		Table:    paymentsTable,
+		Schema: func(e *engine, table string) string {
+			return e.createTable(table, []column{
+				{Name: "request_id", Type: typeVarchar, Size: 64, NotNull: true},
+				{Name: "amount", Type: typeBigInt, NotNull: true},
+			}, "request_id")
+		},
+		Enabled: func(opts RunOptions) bool { return opts.Engine != nil && opts.Engine.Upsert != upsertNone },
+		Run:     insertWithIdempotencyKeys,
+	})
+}
+
+// insertWithIdempotencyKeys issues INSERT IGNORE (or the engine's
+// equivalent) once per rate in idempotency.duplicate_rates, splitting Rows
+// and Duration between the rates. At rate r, r percent of the requests
+// reuse the ID of an earlier one and must be skipped without an error.
+// Rows counts requests. Metrics report, per rate, the p50 of first writes
+// and of skipped replays, e.g. dup10_new_p50_ns and dup10_replay_p50_ns.
+func insertWithIdempotencyKeys(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	var rates []float64
+	for _, v := range opts.listParam("idempotency.duplicate_rates", "0/10/50") {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 100 {
+			return Result{}, fmt.Errorf("idempotency.duplicate_rates: %q is not a percentage", v)
+		}
+		rates = append(rates, rate)
+	}
+	if len(rates) == 0 {
+		return Result{}, fmt.Errorf("idempotency.duplicate_rates is empty")
+	}
+	insertSQL := opts.bind(opts.Engine.insertIgnore("INSERT INTO "+opts.table()+" (request_id, amount) VALUES (?, ?)", "request_id"))
+	rng := rand.New(rand.NewSource(int64(opts.intParam("idempotency.seed", 1))))
+	// The table outlives the run, so request IDs carry a run-unique base.
+	base := time.Now().UnixMicro()
+	phaseOpts := opts.phase(len(rates))
+
+	var rec latencyRecorder
+	var total time.Duration
+	rows := 0
+	metrics := map[string]float64{}
+	for p, rate := range rates {
+		start := time.Now()
+		var fresh, replays []time.Duration
+		i, inserted := 0, 0
+		for ; !phaseOpts.done(i, start); i++ {
+			id := fmt.Sprintf("req-%d-%d-%d", base, p, inserted)
+			replay := inserted > 0 && rng.Float64()*100 < rate
+			if replay {
+				id = fmt.Sprintf("req-%d-%d-%d", base, p, rng.Intn(inserted))
+			}
+
+			opStart := time.Now()
+			res, err := db.ExecContext(ctx, insertSQL, id, i)
+			if err != nil {
+				return Result{}, fmt.Errorf("insert error: %v", err)
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return Result{}, fmt.Errorf("rows affected: %v", err)
+			}
+			elapsed := time.Since(opStart)
+			rec.observe(elapsed)
+			if n == 0 {
+				replays = append(replays, elapsed)
+			} else {
+				fresh = append(fresh, elapsed)
+				inserted++
+			}
+			if (n == 0) != replay {
+				return Result{}, fmt.Errorf("request %s: %d rows affected, replay %v", id, n, replay)
+			}
+		}
+		elapsed := time.Since(start)
+		rows += i
+		total += elapsed
+
+		key := "dup" + strconv.FormatFloat(rate, 'f', -1, 64) + "_"
+		freshStats, replayStats := summarizeLatency(fresh), summarizeLatency(replays)
+		metrics[key+"new_p50_ns"] = float64(freshStats.P50.Nanoseconds())
+		metrics[key+"replay_p50_ns"] = float64(replayStats.P50.Nanoseconds())
+		metrics[key+"requests_per_sec"] = float64(i) / elapsed.Seconds()
+		log.Printf("idempotent-insert: %g%% duplicates: %d requests, %d skipped (p50 new %s, replay %s)",
+			rate, i, len(replays), formatDuration(freshStats.P50), formatDuration(replayStats.P50))
+	}
+
+	result := rec.result(rows, total)
+	result.Metrics = metrics
+	return result, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "bulk-interference",
+		Description: "Interactive point reads and a bulk load, apart and at the same time",
+		Features:    featureMultiRowValues,
+		Params: append([]Param{
+			{Name: "interference.query_workers", Default: "4", Description: "concurrent workers of the interactive query stream"},
+			{Name: "interference.bulk_workers", Default: "1", Description: "concurrent multi-row inserters of the bulk stream"},
+			{Name: "interference.rows", Default: "10000", Description: "rows in the table before the first phase, for the queries to read"},
+		}, dataParams...),
+		Workload: workloadInterference,
+		Run:      measureBulkInterference,
+	})
+}
+
+// streamStats is what one stream measured in one phase.
+type streamStats struct {
+	ops     int // queries, or rows inserted
+	elapsed time.Duration
+	latency []time.Duration // per query or batch
+}
+
+func (s streamStats) rate() float64 { return float64(s.ops) / s.elapsed.Seconds() }
+
+// measureBulkInterference answers whether a backfill can run during
+// business hours: it runs the interactive stream of point reads alone, the
+// bulk stream of multi-row inserts alone, and then both at once, splitting
+// Rows and Duration between the three phases. In the last phase the bulk
+// stream is bounded like in the second and the queries run for as long as
+// it does. Metrics report each stream alone and mixed, e.g.
+// alone_query_p99_ns against mixed_query_p99_ns, and how much each
+// degraded the other as query_p99_increase_pct and bulk_rate_drop_pct.
+// Rows counts queries and inserted rows together.
+func measureBulkInterference(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	queryWorkers := opts.intParam("interference.query_workers", 4)
+	bulkWorkers := opts.intParam("interference.bulk_workers", 1)
+	seedRows := opts.intParam("interference.rows", 10000)
+	if queryWorkers < 1 || bulkWorkers < 1 || seedRows < 1 {
+		return Result{}, fmt.Errorf("interference.query_workers, interference.bulk_workers and interference.rows must be at least 1")
+	}
+	var have int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+opts.table()).Scan(&have); err != nil {
+		return Result{}, fmt.Errorf("count rows: %v", err)
+	}
+	gen := opts.rowGen("Backfill")
+	for i := have; i < seedRows; {
+		n := min(opts.batchSize(), seedRows-i)
+		query, args := multiRowInsert(opts.table(), gen, i, n)
+		if _, err := db.ExecContext(ctx, opts.bind(query), args...); err != nil {
+			return Result{}, fmt.Errorf("fill table: %v", err)
+		}
+		i += n
+	}
+	var minID, maxID int64
+	if err := db.QueryRowContext(ctx, "SELECT MIN(id), MAX(id) FROM "+opts.table()).Scan(&minID, &maxID); err != nil {
+		return Result{}, fmt.Errorf("read id range: %v", err)
+	}
+	query := opts.bind("SELECT name, email FROM " + opts.table() + " WHERE id = ?")
+	phaseOpts := opts.phase(3)
+	inserted := max(have, seedRows)
+
+	// The mixed phase's streams share rec, so each observes under recMu.
+	var (
+		recMu sync.Mutex
+		rec   latencyRecorder
+	)
+	aloneQuery, err := runQueryStream(ctx, db, phaseOpts, query, minID, maxID, queryWorkers, nil, &recMu, &rec)
+	if err != nil {
+		return Result{}, fmt.Errorf("queries alone: %v", err)
+	}
+	aloneBulk, err := runBulkStream(ctx, db, phaseOpts, gen, inserted, bulkWorkers, &recMu, &rec)
+	if err != nil {
+		return Result{}, fmt.Errorf("bulk load alone: %v", err)
+	}
+	inserted += aloneBulk.ops
+
+	bulkDone := make(chan struct{})
+	var mixedQuery streamStats
+	var queryErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Unbounded but for the bulk stream finishing.
+		unbounded := phaseOpts
+		unbounded.Rows, unbounded.Duration = 0, 0
+		mixedQuery, queryErr = runQueryStream(ctx, db, unbounded, query, minID, maxID, queryWorkers, bulkDone, &recMu, &rec)
+	}()
+	mixedBulk, err := runBulkStream(ctx, db, phaseOpts, gen, inserted, bulkWorkers, &recMu, &rec)
+	close(bulkDone)
+	wg.Wait()
+	if err != nil {
+		return Result{}, fmt.Errorf("bulk load with queries: %v", err)
+	}
+	if queryErr != nil {
+		return Result{}, fmt.Errorf("queries with bulk load: %v", queryErr)
+	}
+
+	ops := 0
+	metrics := map[string]float64{}
+	for _, p := range []struct {
+		key   string
+		stats streamStats
+	}{{"alone_query_", aloneQuery}, {"alone_bulk_", aloneBulk}, {"mixed_query_", mixedQuery}, {"mixed_bulk_", mixedBulk}} {
+		ops += p.stats.ops
+		stats := summarizeLatency(p.stats.latency)
+		metrics[p.key+"rate"] = p.stats.rate()
+		metrics[p.key+"p50_ns"] = float64(stats.P50.Nanoseconds())
+		metrics[p.key+"p99_ns"] = float64(stats.P99.Nanoseconds())
+	}
+	// The mixed phase's streams ran side by side, so it took as long as
+	// its bulk stream.
+	total := aloneQuery.elapsed + aloneBulk.elapsed + mixedBulk.elapsed
+	if a := metrics["alone_query_p99_ns"]; a > 0 {
+		metrics["query_p99_increase_pct"] = 100 * (metrics["mixed_query_p99_ns"] - a) / a
+	}
+	if a := metrics["alone_bulk_rate"]; a > 0 {
+		metrics["bulk_rate_drop_pct"] = 100 * (a - metrics["mixed_bulk_rate"]) / a
+	}
+	log.Printf("bulk-interference: queries %s/s (p99 %s) alone, %s/s (p99 %s) during the bulk load; bulk load %s rows/s alone, %s rows/s during queries",
+		formatRate(aloneQuery.rate()), formatDuration(time.Duration(metrics["alone_query_p99_ns"])), formatRate(mixedQuery.rate()), formatDuration(time.Duration(metrics["mixed_query_p99_ns"])),
+		formatRate(aloneBulk.rate()), formatRate(mixedBulk.rate()))
+
+	result := rec.result(ops, total)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// runQueryStream runs point reads of random ids from workers until opts
+// is done or stop is closed, observing each in rec under recMu.
+func runQueryStream(ctx context.Context, db *sql.DB, opts RunOptions, query string, minID, maxID int64, workers int, stop <-chan struct{}, recMu *sync.Mutex, rec *latencyRecorder) (streamStats, error) {
+	var (
+		claimed atomic.Int64
+		mu      sync.Mutex
+		s       streamStats
+	)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(int64(w)))
+		var local []time.Duration
+		defer func() {
+			mu.Lock()
+			s.latency = append(s.latency, local...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			if opts.done(int(claimed.Add(1))-1, start) {
+				return nil
+			}
+			id := minID + rng.Int63n(maxID-minID+1)
+			opStart := time.Now()
+			rows, err := db.QueryContext(ctx, query, id)
+			if err != nil {
+				return fmt.Errorf("query error: %v", err)
+			}
+			if err := drainRows(rows); err != nil {
+				return fmt.Errorf("query error: %v", err)
+			}
+			d := time.Since(opStart)
+			local = append(local, d)
+			recMu.Lock()
+			rec.observe(d)
+			recMu.Unlock()
+		}
+		return nil
+	})
+	s.elapsed = time.Since(start)
+	s.ops = len(s.latency)
+	return s, err
+}
+
+// runBulkStream inserts generated rows from row first on in multi-row
+// batches from workers until opts is done, observing each batch in rec
+// under recMu.
+func runBulkStream(ctx context.Context, db *sql.DB, opts RunOptions, gen *rowGen, first, workers int, recMu *sync.Mutex, rec *latencyRecorder) (streamStats, error) {
+	var (
+		claimed atomic.Int64
+		mu      sync.Mutex
+		s       streamStats
+	)
+	batch := opts.batchSize()
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		for ctx.Err() == nil {
+			end := int(claimed.Add(int64(batch)))
+			i := end - batch
+			if opts.done(i, start) {
+				return nil
+			}
+			n := batch
+			if opts.Rows > 0 {
+				n = min(n, opts.Rows-i)
+			}
+			mu.Lock()
+			query, args := multiRowInsert(opts.table(), gen, first+i, n)
+			mu.Unlock()
+			opStart := time.Now()
+			if _, err := db.ExecContext(ctx, opts.bind(query), args...); err != nil {
+				return fmt.Errorf("insert error: %v", err)
+			}
+			d := time.Since(opStart)
+			mu.Lock()
+			s.latency = append(s.latency, d)
+			s.ops += n
+			mu.Unlock()
+			recMu.Lock()
+			rec.observe(d)
+			recMu.Unlock()
+		}
+		return nil
+	})
+	s.elapsed = time.Since(start)
+	return s, err
+}
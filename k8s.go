@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// k8sJob describes a benchmark run launched inside a cluster, for targets
+// that are only reachable from there.
+type k8sJob struct {
+	Name         string
+	Namespace    string
+	Image        string
+	Secret       string
+	CPU          string
+	Memory       string
+	NodeSelector map[string]string
+	Args         []string
+	Timeout      time.Duration
+}
+
+var k8sJobTemplate = template.Must(template.New("job").Parse(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{.Name}}
+  namespace: {{.Namespace}}
+  labels:
+    app.kubernetes.io/name: db-benchmark
+spec:
+  backoffLimit: 0
+  activeDeadlineSeconds: {{.DeadlineSeconds}}
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: db-benchmark
+    spec:
+      restartPolicy: Never
+{{- if .NodeSelector}}
+      nodeSelector:
+{{- range $k, $v := .NodeSelector}}
+        {{printf "%q" $k}}: {{printf "%q" $v}}
+{{- end}}
+{{- end}}
+      containers:
+        - name: benchmark
+          image: {{.Image}}
+{{- if .Args}}
+          args:
+{{- range .Args}}
+            - {{printf "%q" .}}
+{{- end}}
+{{- end}}
+{{- if .Secret}}
+          envFrom:
+            - secretRef:
+                name: {{.Secret}}
+{{- end}}
+          resources:
+            requests:
+              cpu: {{printf "%q" .CPU}}
+              memory: {{printf "%q" .Memory}}
+            limits:
+              cpu: {{printf "%q" .CPU}}
+              memory: {{printf "%q" .Memory}}
+`))
+
+func (j k8sJob) render() ([]byte, error) {
+	var buf bytes.Buffer
+	data := struct {
+		k8sJob
+		DeadlineSeconds int
+	}{j, int(j.Timeout.Seconds())}
+	if err := k8sJobTemplate.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render job manifest: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// k8sCommand renders the Job manifest and, unless -render-only is given,
+// applies it with kubectl, waits for completion and copies the pod logs
+// (which carry the benchmark results) back to stdout or -output.
+func k8sCommand(args []string) error {
+	fs := flag.NewFlagSet("k8s", flag.ExitOnError)
+	job := k8sJob{}
+	fs.StringVar(&job.Name, "name", fmt.Sprintf("db-benchmark-%d", time.Now().Unix()), "Job name")
+	fs.StringVar(&job.Namespace, "namespace", getEnv("BENCHMARK_K8S_NAMESPACE", "default"), "namespace to run the Job in")
+	fs.StringVar(&job.Image, "image", getEnv("BENCHMARK_K8S_IMAGE", ""), "container image with the benchmark binary as entrypoint")
+	fs.StringVar(&job.Secret, "secret", getEnv("BENCHMARK_K8S_SECRET", ""), "Secret whose keys (DB_HOST, DB_USER, ...) are exposed as environment variables")
+	fs.StringVar(&job.CPU, "cpu", "1", "CPU request and limit")
+	fs.StringVar(&job.Memory, "memory", "512Mi", "memory request and limit")
+	nodeSelector := fs.String("node-selector", "", "comma-separated key=value node selector")
+	benchArgs := fs.String("args", "run", "space-separated arguments passed to the benchmark in the pod")
+	fs.DurationVar(&job.Timeout, "timeout", 3*time.Hour, "maximum Job runtime")
+	renderOnly := fs.Bool("render-only", false, "print the manifest instead of launching it")
+	output := fs.String("output", "", "file to write collected results to (default stdout)")
+	kubectl := fs.String("kubectl", getEnv("KUBECTL", "kubectl"), "kubectl binary")
+	fs.Parse(args)
+
+	if job.Image == "" {
+		return fmt.Errorf("-image is required")
+	}
+	selector, err := parseKeyValues(*nodeSelector)
+	if err != nil {
+		return fmt.Errorf("invalid -node-selector: %v", err)
+	}
+	job.NodeSelector = selector
+	job.Args = strings.Fields(*benchArgs)
+
+	manifest, err := job.render()
+	if err != nil {
+		return err
+	}
+	if *renderOnly {
+		_, err := os.Stdout.Write(manifest)
+		return err
+	}
+
+	apply := exec.Command(*kubectl, "apply", "-f", "-")
+	apply.Stdin = bytes.NewReader(manifest)
+	apply.Stdout, apply.Stderr = os.Stderr, os.Stderr
+	if err := apply.Run(); err != nil {
+		return fmt.Errorf("kubectl apply: %v", err)
+	}
+	log.Printf("Launched Job %s/%s, waiting up to %v", job.Namespace, job.Name, job.Timeout)
+
+	waitErr := waitForJob(*kubectl, job)
+
+	// Logs are collected even when the Job failed, since they explain why.
+	logs, err := exec.Command(*kubectl, "logs", "-n", job.Namespace, "job/"+job.Name).Output()
+	if err != nil {
+		return fmt.Errorf("kubectl logs: %v", err)
+	}
+	if *output != "" {
+		if err := os.WriteFile(*output, logs, 0o644); err != nil {
+			return fmt.Errorf("write results: %v", err)
+		}
+		log.Printf("Results written to %s", *output)
+	} else {
+		os.Stdout.Write(logs)
+	}
+	if waitErr != nil {
+		return fmt.Errorf("job %s did not complete: %v", job.Name, waitErr)
+	}
+	return nil
+}
+
+// k8sPollInterval is how often waitForJob checks the Job's status.
+const k8sPollInterval = 5 * time.Second
+
+// waitForJob polls the Job's conditions until it completes or fails, or
+// job.Timeout passes. kubectl wait can't be used: it waits for a single
+// condition, and waiting for complete never returns once the Job failed.
+func waitForJob(kubectl string, job k8sJob) error {
+	deadline := time.Now().Add(job.Timeout)
+	for {
+		out, err := exec.Command(kubectl, "get", "-n", job.Namespace, "job/"+job.Name,
+			"-o", `jsonpath={.status.conditions[?(@.status=="True")].type}`).Output()
+		if err != nil {
+			log.Printf("Warning: kubectl get job/%s: %v", job.Name, err)
+		}
+		for _, condition := range strings.Fields(string(out)) {
+			switch condition {
+			case "Complete":
+				return nil
+			case "Failed":
+				return fmt.Errorf("the Job failed")
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v", job.Timeout)
+		}
+		time.Sleep(k8sPollInterval)
+	}
+}
+
+func parseKeyValues(value string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(field, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", field)
+		}
+		pairs[k] = v
+	}
+	return pairs, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// LatencyStats summarizes per-operation latency for one strategy.
+type LatencyStats struct {
+	Mean time.Duration `json:"mean_ns"`
+	P50  time.Duration `json:"p50_ns"`
+	P95  time.Duration `json:"p95_ns"`
+	P99  time.Duration `json:"p99_ns"`
+	Max  time.Duration `json:"max_ns"`
+}
+
+// latencyRecorder collects individual operation latencies. Samples are kept
+// in full so that percentiles are exact.
+type latencyRecorder struct {
+	samples []time.Duration
+	times   []time.Duration
+}
+
+// observe records one operation's latency. It is to be called as the
+// operation finishes, not replayed from a buffer afterwards: the heatmap
+// and the live meters of the dashboard, the hook timeline and the host
+// metrics place each sample at the moment it is observed.
+func (r *latencyRecorder) observe(d time.Duration) {
+	r.samples = append(r.samples, d)
+	if recordSampleTimes {
+		r.times = append(r.times, time.Since(sampleEpoch))
+	}
+	if verbosity >= verbosityVerbose {
+		log.Printf("operation %d: %v", len(r.samples), d)
+	}
+	if m := activeMeter.Load(); m != nil {
+		m.observe(d)
+	}
+	if m := timelineMeter.Load(); m != nil {
+		m.observe(d)
+	}
+	if m := hostMeter.Load(); m != nil {
+		m.observe(d)
+	}
+}
+
+// result builds the strategy Result for rows inserted over duration.
+func (r *latencyRecorder) result(rows int, duration time.Duration) Result {
+	return Result{
+		Rows:        rows,
+		Duration:    duration,
+		Latency:     summarizeLatency(r.samples),
+		samples:     r.samples,
+		sampleTimes: r.times,
+	}
+}
+
+func summarizeLatency(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return LatencyStats{
+		Mean: total / time.Duration(len(sorted)),
+		P50:  percentile(sorted, 0.50),
+		P95:  percentile(sorted, 0.95),
+		P99:  percentile(sorted, 0.99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile of an ascending slice.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
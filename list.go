@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// strategyInfo is a strategy's metadata as the list command shows it.
+type strategyInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Workload    string   `json:"workload,omitempty"`
+	Read        bool     `json:"read,omitempty"`
+	Engines     []string `json:"engines"`
+	Features    []string `json:"features,omitempty"`
+	Requires    string   `json:"requires,omitempty"`
+	Params      []Param  `json:"params,omitempty"`
+}
+
+// listCommand prints the registered strategies, plugins' included, with
+// the engines they run on, the SQL features and configuration they need
+// and their -param knobs with defaults, followed by the native engines'
+// own workloads. -engine limits the list to the strategies one engine runs.
+func listCommand(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	engineName := fs.String("engine", "", "list only the strategies this engine runs (default: all)")
+	markdown := fs.String("markdown", "-", `write the list to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write the list as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+	if *engineName != "" {
+		if _, err := lookupEngine(*engineName); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var infos []strategyInfo
+	for _, s := range strategies {
+		needs := s.Features
+		if s.Schema != nil {
+			needs |= featureCreateTable
+		}
+		info := strategyInfo{Name: s.Name, Description: s.Description, Workload: s.Workload, Read: s.Read,
+			Features: needs.names(), Requires: s.Requires, Params: s.Params}
+		for _, name := range names {
+			if s.runsOn(engines[name]) {
+				info.Engines = append(info.Engines, name)
+			}
+		}
+		if *engineName != "" && !containsString(info.Engines, *engineName) {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	for _, name := range names {
+		if *engineName != "" && name != *engineName {
+			continue
+		}
+		for _, wl := range engines[name].Workloads {
+			infos = append(infos, strategyInfo{Name: wl.Name, Description: wl.Description, Workload: wl.Workload, Read: wl.Read,
+				Engines: []string{name}, Params: wl.Params})
+		}
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, infos); err != nil {
+			return err
+		}
+		if *markdown == "-" && *jsonPath == "-" {
+			return nil
+		}
+	}
+	return writeMarkdown(*markdown, renderStrategyList(infos), false)
+}
+
+// runsOn reports whether the strategy can run on e at all, with whatever
+// Requires asks for configured. Native engines run none of the SQL
+// strategies, only their own Workloads.
+func (s Strategy) runsOn(e *engine) bool {
+	if e.Native != nil || !s.supports(e) {
+		return false
+	}
+	return s.Enabled == nil || s.Requires != "" || s.Enabled(RunOptions{Engine: e})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func renderStrategyList(infos []strategyInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Strategies\n\n%d strategies; select them with -only, -skip and -order.\n\n", len(infos))
+	b.WriteString("| Strategy | Workload | Description | Engines | Needs |\n|---|---|---|---|---|\n")
+	for _, s := range infos {
+		var needs []string
+		needs = append(needs, s.Features...)
+		if s.Requires != "" {
+			needs = append(needs, "`"+s.Requires+"`")
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n", s.Name, orDash(s.Workload), s.Description,
+			orDash(strings.Join(s.Engines, ", ")), orDash(strings.Join(needs, ", ")))
+	}
+	for _, s := range infos {
+		if len(s.Params) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n#### `%s` parameters\n\n| -param | Default | Description |\n|---|---|---|\n", s.Name)
+		for _, p := range s.Params {
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", p.Name, orDash(p.Default), p.Description)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListNativeEngine(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "list.json")
+	if err := listCommand([]string{"-engine", "redis", "-json", jsonPath, "-markdown", filepath.Join(dir, "list.md")}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []strategyInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+		if len(info.Engines) != 1 || info.Engines[0] != "redis" {
+			t.Errorf("%s: engines %v, want [redis]", info.Name, info.Engines)
+		}
+	}
+	if len(names) != 2 || names[0] != "redis-hset" || names[1] != "redis-pipeline" {
+		t.Errorf("listed %v, want [redis-hset redis-pipeline]", names)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// accountsTable holds the hot rows both locking strategies update.
+const accountsTable = "benchmark_accounts"
+
+var lockingParams = []Param{
+	{Name: "lock.rows", Default: "10", Description: "rows the updates are spread over; fewer rows means more contention"},
+	{Name: "lock.workers", Default: "8", Description: "concurrent updaters"},
+	{Name: "lock.max_retries", Default: "10", Description: "retries before an update is aborted"},
+	{Name: "lock.seed", Default: "1", Description: "seed for choosing which row each update targets"},
+}
+
+func init() {
+	strategies = append(strategies,
+		Strategy{
+			Name:        "lock-pessimistic",
+			Description: "Updating hot rows with SELECT ... FOR UPDATE",
+			Features:    featureRowLocks,
+			Params:      lockingParams,
+			Workload:    workloadHotUpdate,
+			Table:       accountsTable,
+			Schema:      accountsSchema,
+			Run:         updateWithPessimisticLocking,
+		},
+		Strategy{
+			Name:        "lock-optimistic",
+			Description: "Updating hot rows with version compare-and-swap",
+			Features:    featureRowLocks,
+			Params:      lockingParams,
+			Workload:    workloadHotUpdate,
+			Table:       accountsTable,
+			Schema:      accountsSchema,
+			Run:         updateWithOptimisticLocking,
+		},
+	)
+}
+
+func accountsSchema(e *engine, table string) string {
+	return e.createTable(table, []column{
+		{Name: "id", Type: typeBigInt, NotNull: true},
+		{Name: "balance", Type: typeBigInt, NotNull: true},
+		{Name: "version", Type: typeBigInt, NotNull: true},
+	}, "id")
+}
+
+// errLostUpdate is a compare-and-swap that matched no row because another
+// updater changed the version first.
+var errLostUpdate = errors.New("version changed concurrently")
+
+// resetAccounts recreates the hot rows so every run starts from the same
+// state.
+func resetAccounts(ctx context.Context, db *sql.DB, opts RunOptions, n int) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM "+opts.table()); err != nil {
+		return fmt.Errorf("reset accounts: %v", err)
+	}
+	for id := 0; id < n; id++ {
+		if _, err := db.ExecContext(ctx, opts.bind("INSERT INTO "+opts.table()+" (id, balance, version) VALUES (?, 0, 0)"), id); err != nil {
+			return fmt.Errorf("insert account: %v", err)
+		}
+	}
+	return nil
+}
+
+// runContendedUpdates runs update from lock.workers goroutines, each
+// picking a random hot row, until the run is done. An update failing with
+// a retryable error is retried up to lock.max_retries times and then
+// counted as aborted. Workers beyond the pool size wait for a connection.
+// Rows counts completed updates; each latency sample covers an update
+// including its retries.
+func runContendedUpdates(ctx context.Context, db *sql.DB, opts RunOptions, update func(ctx context.Context, id int64) error) (Result, error) {
+	hotRows := opts.intParam("lock.rows", 10)
+	workers := opts.intParam("lock.workers", 8)
+	maxRetries := opts.intParam("lock.max_retries", 10)
+	if hotRows < 1 || workers < 1 || maxRetries < 0 {
+		return Result{}, fmt.Errorf("lock.rows and lock.workers must be at least 1 and lock.max_retries at least 0")
+	}
+	if err := resetAccounts(ctx, db, opts, hotRows); err != nil {
+		return Result{}, err
+	}
+	var (
+		attempted, retries, aborts atomic.Int64
+		mu                         sync.Mutex
+		rec                        latencyRecorder
+	)
+	seed := int64(opts.intParam("lock.seed", 1))
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		for ctx.Err() == nil {
+			if opts.done(int(attempted.Add(1))-1, start) {
+				return nil
+			}
+			id := rng.Int63n(int64(hotRows))
+			opStart := time.Now()
+			err := update(ctx, id)
+			for attempt := 0; err != nil && attempt < maxRetries && retryableUpdate(opts, err); attempt++ {
+				retries.Add(1)
+				err = update(ctx, id)
+			}
+			switch {
+			case err == nil:
+				mu.Lock()
+				rec.observe(time.Since(opStart))
+				mu.Unlock()
+			case retryableUpdate(opts, err):
+				aborts.Add(1)
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	updated := len(rec.samples)
+	result := rec.result(updated, time.Since(start))
+	result.Transactions = updated
+	result.Retries = int(retries.Load())
+	result.Metrics = map[string]float64{
+		"aborts":   float64(aborts.Load()),
+		"hot_rows": float64(hotRows),
+		"workers":  float64(workers),
+	}
+	if total := updated + int(aborts.Load()); total > 0 {
+		result.Metrics["abort_rate"] = 100 * float64(aborts.Load()) / float64(total)
+	}
+	log.Printf("%s: %d updates over %d rows from %d workers: %d retries, %d aborted",
+		opts.table(), updated, hotRows, workers, result.Retries, aborts.Load())
+	return result, nil
+}
+
+func retryableUpdate(opts RunOptions, err error) bool {
+	return errors.Is(err, errLostUpdate) || opts.Engine.classify(err) == errConflict
+}
+
+// updateWithPessimisticLocking locks the row with SELECT ... FOR UPDATE
+// before writing it back, so concurrent updaters of the same row queue on
+// the lock; deadlocks and lock wait timeouts are retried.
+func updateWithPessimisticLocking(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	selectSQL := opts.bind("SELECT balance FROM " + opts.table() + " WHERE id = ? FOR UPDATE")
+	updateSQL := opts.bind("UPDATE " + opts.table() + " SET balance = ? WHERE id = ?")
+	return runContendedUpdates(ctx, db, opts, func(ctx context.Context, id int64) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin transaction error: %v", err)
+		}
+		defer tx.Rollback()
+		var balance int64
+		if err := tx.QueryRowContext(ctx, selectSQL, id).Scan(&balance); err != nil {
+			return fmt.Errorf("select for update: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, updateSQL, balance+1, id); err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		return nil
+	})
+}
+
+// updateWithOptimisticLocking reads the row without locking and writes it
+// back only if its version is unchanged; an update that lost the race is
+// retried with a fresh read.
+func updateWithOptimisticLocking(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	selectSQL := opts.bind("SELECT balance, version FROM " + opts.table() + " WHERE id = ?")
+	updateSQL := opts.bind("UPDATE " + opts.table() + " SET balance = ?, version = version + 1 WHERE id = ? AND version = ?")
+	return runContendedUpdates(ctx, db, opts, func(ctx context.Context, id int64) error {
+		var balance, version int64
+		if err := db.QueryRowContext(ctx, selectSQL, id).Scan(&balance, &version); err != nil {
+			return fmt.Errorf("select: %w", err)
+		}
+		res, err := db.ExecContext(ctx, updateSQL, balance+1, id, version)
+		if err != nil {
+			return fmt.Errorf("update: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("rows affected: %v", err)
+		}
+		if n == 0 {
+			return errLostUpdate
+		}
+		return nil
+	})
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// longTxTable holds the rows the workload reads and updates while the
+// long transactions keep their snapshot open and their locks held.
+const longTxTable = "benchmark_longtx"
+
+// historyLengthQueries read the engine's backlog of row versions that
+// open snapshots keep from being purged.
+var historyLengthQueries = map[string]string{
+	"mysql": "SELECT COUNT FROM information_schema.INNODB_METRICS WHERE NAME = 'trx_rseg_history_len'",
+}
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "long-transaction",
+		Description: "Running reads and updates while long transactions stay open",
+		Features:    featureRowLocks,
+		Params: []Param{
+			{Name: "longtx.count", Default: "1", Description: "long-open transactions held during the second phase"},
+			{Name: "longtx.hold", Description: "how long each stays open, e.g. 30s (default: the whole phase)"},
+			{Name: "longtx.lock_rows", Default: "0", Description: "rows each long transaction locks with SELECT ... FOR UPDATE, on top of holding its snapshot"},
+			{Name: "longtx.rows", Default: "1000", Description: "rows the workload reads and updates"},
+			{Name: "longtx.workers", Default: "8", Description: "concurrent workload workers"},
+			{Name: "longtx.read_rate", Default: "50", Description: "percentage of workload operations that are point reads rather than updates"},
+			{Name: "longtx.seed", Default: "1", Description: "seed for choosing rows and operations"},
+		},
+		Workload: workloadHotUpdate,
+		Table:    longTxTable,
+		Schema:   accountsSchema,
+		Run:      runUnderLongTransactions,
+	})
+}
+
+// longTxPhase is what the workload measured in one phase.
+type longTxPhase struct {
+	ops, timeouts int
+	elapsed       time.Duration
+	latency       []time.Duration
+	historyPeak   int64
+}
+
+// runUnderLongTransactions runs the same read/update workload twice,
+// splitting Rows and Duration between the phases: first alone, then while
+// longtx.count transactions hold a snapshot open (and, with
+// longtx.lock_rows, row locks) for longtx.hold. The difference is what one
+// forgotten transaction costs everyone else: purge falls behind and the
+// history list grows, and updates of the locked rows wait. Rows counts
+// workload operations; updates that time out waiting for a lock or
+// deadlock are counted as lock timeouts instead of failing the run.
+// Metrics compare the phases, e.g. held_p95_ns against baseline_p95_ns, and
+// report the history list length on MySQL.
+func runUnderLongTransactions(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	count := opts.intParam("longtx.count", 1)
+	lockRows := opts.intParam("longtx.lock_rows", 0)
+	rows := opts.intParam("longtx.rows", 1000)
+	workers := opts.intParam("longtx.workers", 8)
+	if count < 1 || rows < 1 || workers < 1 || lockRows < 0 || count*lockRows > rows {
+		return Result{}, fmt.Errorf("longtx.count, longtx.rows and longtx.workers must be at least 1 and the locked rows fit in longtx.rows")
+	}
+	if max := db.Stats().MaxOpenConnections; max > 0 && count >= max {
+		return Result{}, fmt.Errorf("longtx.count must be below the pool size (%d) to leave connections for the workload", max)
+	}
+	var hold time.Duration
+	if v := opts.param("longtx.hold", ""); v != "" {
+		var err error
+		if hold, err = time.ParseDuration(v); err != nil || hold <= 0 {
+			return Result{}, fmt.Errorf("longtx.hold: invalid duration %q", v)
+		}
+	}
+	if err := resetAccounts(ctx, db, opts, rows); err != nil {
+		return Result{}, err
+	}
+	phaseOpts := opts.phase(2)
+
+	var rec latencyRecorder
+	baseline, err := runLongTxWorkload(ctx, db, phaseOpts, rows, workers, &rec)
+	if err != nil {
+		return Result{}, fmt.Errorf("baseline: %v", err)
+	}
+
+	// The long transactions hold until the workload is done or hold ends.
+	holdCtx, release := context.WithCancel(ctx)
+	if hold > 0 {
+		holdCtx, release = context.WithTimeout(ctx, hold)
+	}
+	defer release()
+	var wg sync.WaitGroup
+	opened := make(chan error, count)
+	for k := 0; k < count; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			holdLongTransaction(ctx, holdCtx, db, opts, k*lockRows, lockRows, opened)
+		}(k)
+	}
+	for k := 0; k < count; k++ {
+		if err := <-opened; err != nil {
+			release()
+			wg.Wait()
+			return Result{}, fmt.Errorf("open long transaction: %v", err)
+		}
+	}
+	held, err := runLongTxWorkload(ctx, db, phaseOpts, rows, workers, &rec)
+	release()
+	wg.Wait()
+	if err != nil {
+		return Result{}, fmt.Errorf("with long transactions: %v", err)
+	}
+
+	result := rec.result(baseline.ops+held.ops, baseline.elapsed+held.elapsed)
+	metrics := map[string]float64{"long_transactions": float64(count), "locked_rows": float64(count * lockRows)}
+	for _, p := range []struct {
+		key   string
+		phase longTxPhase
+	}{{"baseline_", baseline}, {"held_", held}} {
+		stats := summarizeLatency(p.phase.latency)
+		metrics[p.key+"ops_per_sec"] = float64(len(p.phase.latency)) / p.phase.elapsed.Seconds()
+		metrics[p.key+"p95_ns"] = float64(stats.P95.Nanoseconds())
+		metrics[p.key+"p99_ns"] = float64(stats.P99.Nanoseconds())
+		metrics[p.key+"lock_timeouts"] = float64(p.phase.timeouts)
+		if p.phase.historyPeak >= 0 {
+			metrics[p.key+"history_len_peak"] = float64(p.phase.historyPeak)
+		}
+	}
+	if b := metrics["baseline_ops_per_sec"]; b > 0 {
+		metrics["throughput_drop_pct"] = 100 * (b - metrics["held_ops_per_sec"]) / b
+	}
+	result.Metrics = metrics
+	log.Printf("long-transaction: %d open transactions: %s -> %s ops/s, p99 %s -> %s, %d lock timeouts",
+		count, formatRate(metrics["baseline_ops_per_sec"]), formatRate(metrics["held_ops_per_sec"]),
+		formatDuration(time.Duration(metrics["baseline_p99_ns"])), formatDuration(time.Duration(metrics["held_p99_ns"])), held.timeouts)
+	if held.historyPeak >= 0 {
+		log.Printf("long-transaction: history list length peaked at %d (baseline %d)", held.historyPeak, baseline.historyPeak)
+	}
+	return result, nil
+}
+
+// holdLongTransaction opens a transaction, takes its snapshot by reading
+// the table and locks rows [first, first+n), reports on opened, and keeps
+// it all until hold is done.
+func holdLongTransaction(ctx, hold context.Context, db *sql.DB, opts RunOptions, first, n int, opened chan<- error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		opened <- err
+		return
+	}
+	defer tx.Rollback()
+	var total int64
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+opts.table()).Scan(&total); err != nil {
+		opened <- err
+		return
+	}
+	if n > 0 {
+		lock := opts.bind("SELECT id FROM " + opts.table() + " WHERE id >= ? AND id < ? FOR UPDATE")
+		rows, err := tx.QueryContext(ctx, lock, first, first+n)
+		if err != nil {
+			opened <- err
+			return
+		}
+		rows.Close()
+	}
+	opened <- nil
+	<-hold.Done()
+}
+
+// runLongTxWorkload runs the workers' reads and updates of random rows
+// until opts is done, observing each in rec as it finishes and sampling the
+// history list length as it goes.
+func runLongTxWorkload(ctx context.Context, db *sql.DB, opts RunOptions, rows, workers int, rec *latencyRecorder) (longTxPhase, error) {
+	readRate := opts.floatParam("longtx.read_rate", 50)
+	seed := int64(opts.intParam("longtx.seed", 1))
+	readSQL := opts.bind("SELECT balance FROM " + opts.table() + " WHERE id = ?")
+	updateSQL := opts.bind("UPDATE " + opts.table() + " SET balance = balance + 1, version = version + 1 WHERE id = ?")
+
+	phase := longTxPhase{historyPeak: -1}
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		sampleHistoryLength(sampleCtx, db, opts, &phase.historyPeak)
+	}()
+
+	var (
+		attempted atomic.Int64
+		timeouts  atomic.Int64
+		mu        sync.Mutex
+	)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		var local []time.Duration
+		defer func() {
+			mu.Lock()
+			phase.latency = append(phase.latency, local...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			if opts.done(int(attempted.Add(1))-1, start) {
+				return nil
+			}
+			id := rng.Intn(rows)
+			opStart := time.Now()
+			var err error
+			if rng.Float64()*100 < readRate {
+				var balance int64
+				err = db.QueryRowContext(ctx, readSQL, id).Scan(&balance)
+			} else {
+				_, err = db.ExecContext(ctx, updateSQL, id)
+			}
+			switch {
+			case err == nil:
+				d := time.Since(opStart)
+				local = append(local, d)
+				mu.Lock()
+				rec.observe(d)
+				mu.Unlock()
+			case opts.Engine.classify(err) == errConflict:
+				timeouts.Add(1)
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	phase.elapsed = time.Since(start)
+	stopSampling()
+	<-sampled
+	phase.ops = len(phase.latency)
+	phase.timeouts = int(timeouts.Load())
+	return phase, err
+}
+
+// sampleHistoryLength polls the engine's history list length once a second
+// into peak until ctx is done; peak stays -1 on engines without one.
+func sampleHistoryLength(ctx context.Context, db *sql.DB, opts RunOptions, peak *int64) {
+	query, ok := historyLengthQueries[opts.Engine.Name]
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		var n int64
+		if err := db.QueryRowContext(ctx, query).Scan(&n); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Warning: could not read the history list length: %v", err)
+			}
+			return
+		}
+		if n > *peak {
+			*peak = n
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -7,189 +7,268 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
 )
 
 type DBConfig struct {
+	Engine   string
 	Host     string
 	User     string
 	Password string
 	Database string
 	PoolSize int
+	// SSLMode is passed to Postgres wire-protocol targets.
+	SSLMode string
+	// Params are extra driver DSN parameters (DB_PARAMS=k=v,k=v).
+	Params map[string]string
+	// SessionInit are statements run on every new pooled connection
+	// (DB_SESSION_INIT, separated by semicolons).
+	SessionInit []string
+	// Secrets, if set, supplies User and Password instead (DB_CREDENTIALS).
+	Secrets *secretsProvider
+	// HostPolicy orders the connection attempts when Host lists several
+	// comma-separated hosts (DB_HOST_POLICY): failover or round-robin.
+	HostPolicy string
+	// Proxy, if set, is the SOCKS5 or HTTP proxy MySQL-protocol
+	// connections are dialed through (DB_PROXY).
+	Proxy *proxyDialer
+	// TunneledHost is DB_HOST when Host is the local end of an SSH tunnel
+	// to it (DB_SSH_HOST).
+	TunneledHost string
 }
 
-func loadConfig() DBConfig {
-	err := godotenv.Load()
-	if err != nil {
-		log.Printf("Warning: Could not load .env file (using environment variables directly): %v", err)
+// Target identifies the benchmarked database in summaries and reports.
+func (c DBConfig) Target() string {
+	host := c.Host
+	if c.TunneledHost != "" {
+		host = c.TunneledHost
 	}
-
-	return DBConfig{
-		Host:     getEnv("DB_HOST", "localhost"),
-		User:     getEnv("DB_USER", "berufplattf"),
-		Password: getEnv("DB_PASS", "berufplattf.db.password"),
-		Database: getEnv("DB_NAME", "berufplattform_db"),
-		PoolSize: getEnvAsInt("DB_POOL_SIZE", 5),
+	if c.Engine != "" && c.Engine != "mysql" {
+		return fmt.Sprintf("%s://%s/%s", c.Engine, host, c.Database)
 	}
+	return fmt.Sprintf("%s/%s", host, c.Database)
 }
 
-func createConnectionPool(config DBConfig) (*sql.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true&multiStatements=true",
-		config.User, config.Password, config.Host, config.Database)
-
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("error opening database: %v", err)
+// withParams returns c with extra added to its DSN parameters.
+func (c DBConfig) withParams(extra map[string]string) DBConfig {
+	params := make(map[string]string, len(c.Params)+len(extra))
+	for k, v := range c.Params {
+		params[k] = v
 	}
-
-	db.SetMaxOpenConns(config.PoolSize)
-	db.SetMaxIdleConns(config.PoolSize)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	if err := db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("database ping failed: %v", err)
+	for k, v := range extra {
+		params[k] = v
 	}
-
-	return db, nil
+	c.Params = params
+	return c
 }
 
-func insertUsingPoolQuery(db *sql.DB, n int) error {
-	start := time.Now()
-
-	for i := 0; i < n; i++ {
-		_, err := db.Query(
-			"INSERT INTO benchmark_users (name, email) VALUES (?, ?)",
-			fmt.Sprintf("UserPool%d", i),
-			fmt.Sprintf("pool%d@example.com", i),
-		)
-		if err != nil {
-			return fmt.Errorf("query error: %v", err)
-		}
+func loadConfig() DBConfig {
+	err := godotenv.Load()
+	if err != nil {
+		log.Printf("Warning: Could not load .env file (using environment variables directly): %v", err)
 	}
 
-	duration := time.Since(start)
-	log.Printf("Direct db.Query: Inserted %d rows in %v", n, duration)
-	return nil
-}
-
-func insertUsingGetConnection(db *sql.DB, n int) error {
-	start := time.Now()
+	redactor.addEnv()
 
-	conn, err := db.Conn(context.Background())
+	params, err := parseKeyValues(getEnv("DB_PARAMS", ""))
 	if err != nil {
-		return fmt.Errorf("get connection error: %v", err)
+		log.Printf("Warning: ignoring invalid DB_PARAMS: %v", err)
 	}
-	defer conn.Close()
 
-	for i := 0; i < n; i++ {
-		_, err := conn.ExecContext(
-			context.Background(),
-			"INSERT INTO benchmark_users (name, email) VALUES (?, ?)",
-			fmt.Sprintf("UserConn%d", i),
-			fmt.Sprintf("conn%d@example.com", i),
-		)
-		if err != nil {
-			return fmt.Errorf("exec error: %v", err)
-		}
+	config := DBConfig{
+		Engine:      getEnv("DB_ENGINE", "mysql"),
+		Host:        getEnv("DB_HOST", "localhost"),
+		User:        getEnv("DB_USER", "berufplattf"),
+		Password:    getEnv("DB_PASS", "berufplattf.db.password"),
+		Database:    getEnv("DB_NAME", "berufplattform_db"),
+		PoolSize:    getEnvAsInt("DB_POOL_SIZE", 5),
+		SSLMode:     getEnv("DB_SSLMODE", "prefer"),
+		Params:      params,
+		SessionInit: parseSessionInit(getEnv("DB_SESSION_INIT", "")),
+		HostPolicy:  getEnv("DB_HOST_POLICY", hostFailover),
 	}
-
-	duration := time.Since(start)
-	log.Printf("Using db.Conn.ExecContext: Inserted %d rows in %v", n, duration)
-	return nil
-}
-
-func insertUsingPoolExec(db *sql.DB, n int) error {
-	start := time.Now()
-
-	for i := 0; i < n; i++ {
-		_, err := db.Exec(
-			"INSERT INTO benchmark_users (name, email) VALUES (?, ?)",
-			fmt.Sprintf("UserExec%d", i),
-			fmt.Sprintf("exec%d@example.com", i),
-		)
+	redactor.add(config.Password)
+	if config.HostPolicy != hostFailover && config.HostPolicy != hostRoundRobin {
+		log.Fatalf("Invalid DB_HOST_POLICY %q (expected %s or %s)", config.HostPolicy, hostFailover, hostRoundRobin)
+	}
+	if raw := getEnv("DB_PROXY", ""); raw != "" {
+		proxy, err := newProxyDialer(raw)
 		if err != nil {
-			return fmt.Errorf("exec error: %v", err)
+			log.Fatalf("Invalid DB_PROXY: %v", err)
 		}
+		proxy.registerMySQL()
+		config.Proxy = proxy
 	}
-
-	duration := time.Since(start)
-	log.Printf("Direct db.Exec: Inserted %d rows in %v", n, duration)
-	return nil
+	return config
 }
 
-func insertUsingTransaction(db *sql.DB, n int) error {
-	start := time.Now()
-
-	tx, err := db.Begin()
+// fetchCredentials replaces config's user and password with those from
+// DB_CREDENTIALS, if set.
+func fetchCredentials(config DBConfig) DBConfig {
+	source := getEnv("DB_CREDENTIALS", "")
+	if source == "" {
+		return config
+	}
+	secrets, err := newSecretsProvider(source, getEnvAsDuration("DB_CREDENTIALS_TTL", 0))
 	if err != nil {
-		return fmt.Errorf("begin transaction error: %v", err)
+		log.Fatalf("Invalid DB_CREDENTIALS: %v", err)
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	for i := 0; i < n; i++ {
-		_, err := tx.Exec(
-			"INSERT INTO benchmark_users (name, email) VALUES (?, ?)",
-			fmt.Sprintf("UserTx%d", i),
-			fmt.Sprintf("tx%d@example.com", i),
-		)
-		if err != nil {
-			return fmt.Errorf("tx exec error: %v", err)
-		}
+	creds, err := secrets.get(context.Background(), false)
+	if err != nil {
+		log.Fatalf("Benchmark failed: %v", err)
 	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit error: %v", err)
+	if creds.Username != "" {
+		config.User = creds.Username
 	}
-
-	duration := time.Since(start)
-	log.Printf("Using transaction: Inserted %d rows in %v", n, duration)
-	return nil
+	config.Password, config.Secrets = creds.Password, secrets
+	return config
 }
 
-func runBenchmark(db *sql.DB, n int) error {
-	log.Println("Starting benchmark...\n")
+// offlineCommands don't connect to the database, so they run without
+// fetching credentials, opening the SSH tunnel or loading plugins.
+var offlineCommands = map[string]bool{"k8s": true, "keygen": true, "verify": true, "list": true}
 
-	if err := insertUsingPoolQuery(db, n); err != nil {
-		return err
-	}
+// defaultConnMaxLifetime is how long pooled connections are reused before
+// being replaced.
+const defaultConnMaxLifetime = 5 * time.Minute
 
-	if err := insertUsingGetConnection(db, n); err != nil {
-		return err
+func createConnectionPool(config DBConfig) (*sql.DB, error) {
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return nil, err
+	}
+	if eng.Driver == "" {
+		return nil, fmt.Errorf("engine %q has no SQL driver; only run, record-baseline and assert support it", eng.Name)
 	}
 
-	if err := insertUsingPoolExec(db, n); err != nil {
-		return err
+	var db *sql.DB
+	if config.Secrets != nil || len(splitHosts(config.Host)) > 1 {
+		db, err = openWithConnector(eng, config)
+	} else if len(config.SessionInit) > 0 || verbosity >= verbosityDebug || injectingFaults {
+		db, err = openWithSessionInit(eng.Driver, eng.DSN(config), config.SessionInit)
+	} else {
+		db, err = sql.Open(eng.Driver, eng.DSN(config))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
 	}
 
-	if err := insertUsingTransaction(db, n); err != nil {
-		return err
+	db.SetMaxOpenConns(config.PoolSize)
+	db.SetMaxIdleConns(config.PoolSize)
+	db.SetConnMaxLifetime(defaultConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database ping failed: %v", err)
+	}
+	if eng.Setup != nil {
+		if err := eng.Setup(ctx, db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s setup failed: %v", eng.Name, err)
+		}
 	}
 
-	log.Println("\nBenchmark completed.")
-	return nil
+	return db, nil
 }
 
 func main() {
-	config := loadConfig()
-	db, err := createConnectionPool(config)
-	if err != nil {
-		log.Fatalf("Failed to create connection pool: %v", err)
+	log.SetOutput(logOutput{})
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-	defer db.Close()
-
-	log.Println("Database connected successfully")
 
-	insertCount := getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000)
-	if err := runBenchmark(db, insertCount); err != nil {
+	config := loadConfig()
+	online := !offlineCommands[command]
+	if online {
+		var closeTunnel func()
+		var err error
+		config, closeTunnel, err = openTunnel(fetchCredentials(config))
+		if err != nil {
+			log.Fatalf("Benchmark failed: %v", err)
+		}
+		defer closeTunnel()
+	}
+	precision = getEnvAsInt("BENCHMARK_PRECISION", precision)
+	if precision < 1 || precision > 9 {
+		log.Fatalf("Benchmark failed: BENCHMARK_PRECISION must be between 1 and 9")
+	}
+	verbosity = getEnvAsInt("BENCHMARK_VERBOSITY", verbosity)
+	if path := getEnv("BENCHMARK_EVENT_LOG", ""); path != "" {
+		if err := openEventLog(path); err != nil {
+			log.Fatalf("Benchmark failed: %v", err)
+		}
+	}
+	if online {
+		if err := loadPlugins(config, getEnv("BENCHMARK_PLUGINS", "")); err != nil {
+			log.Fatalf("Benchmark failed: %v", err)
+		}
+	}
+	var err error
+	switch command {
+	case "run":
+		err = runCommand(config, args)
+	case "sweep":
+		err = sweepCommand(config, args)
+	case "k8s":
+		err = k8sCommand(args)
+	case "batch":
+		err = batchCommand(config, args)
+	case "record-baseline":
+		err = recordBaselineCommand(config, args)
+	case "assert":
+		err = assertCommand(config, args)
+	case "compare":
+		err = compareCommand(config, args)
+	case "seed":
+		err = seedCommand(config, args)
+	case "replay":
+		err = replayCommand(config, args)
+	case "capture":
+		err = captureCommand(config, args)
+	case "shard":
+		err = shardCommand(config, args)
+	case "split":
+		err = splitCommand(config, args)
+	case "regions":
+		err = regionsCommand(config, args)
+	case "max-connections":
+		err = maxConnectionsCommand(config, args)
+	case "stmt-cache":
+		err = stmtCacheCommand(config, args)
+	case "protocol":
+		err = protocolCommand(config, args)
+	case "timestamps":
+		err = timestampsCommand(config, args)
+	case "drivers":
+		err = driversCommand(config, args)
+	case "tls":
+		err = tlsCommand(config, args)
+	case "overhead":
+		err = overheadCommand(config, args)
+	case "connect-breakdown":
+		err = connectBreakdownCommand(config, args)
+	case "dns-failover":
+		err = dnsFailoverCommand(config, args)
+	case "serve":
+		err = serveCommand(config, args)
+	case "daemon":
+		err = daemonCommand(config, args)
+	case "keygen":
+		err = keygenCommand(args)
+	case "verify":
+		err = verifyCommand(args)
+	case "list":
+		err = listCommand(args)
+	default:
+		log.Fatalf("Unknown command %q (expected run, sweep, k8s, batch, record-baseline, assert, compare, seed, replay, capture, shard, split, regions, max-connections, stmt-cache, protocol, drivers, timestamps, tls, overhead, connect-breakdown, dns-failover, serve, daemon, keygen, verify or list)", command)
+	}
+	if err != nil {
 		log.Fatalf("Benchmark failed: %v", err)
 	}
 }
@@ -209,3 +288,49 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func parseIntList(value string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid list value %q", field)
+		}
+		values = append(values, n)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("empty list %q", value)
+	}
+	return values, nil
+}
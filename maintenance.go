@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// maintenanceStatements are the table maintenance operations -maintenance
+// can run during a strategy, per engine, with %s for the strategy's table.
+// Engines with automatic MVCC garbage collection have nothing to vacuum.
+var maintenanceStatements = map[string]map[string]string{
+	"mysql":     {"optimize": "OPTIMIZE TABLE %s", "analyze": "ANALYZE TABLE %s"},
+	"tidb":      {"analyze": "ANALYZE TABLE %s"},
+	"cockroach": {"analyze": "ANALYZE %s"},
+	"duckdb":    {"vacuum": "VACUUM ANALYZE %s", "analyze": "ANALYZE %s"},
+}
+
+// tableSizeQuery reads a table's data, index and free (reclaimable) bytes,
+// with the table name as argument, after Session on the same connection.
+type tableSizeQuery struct {
+	Session string
+	Query   string
+}
+
+// tableSizeQueries are the engines whose table bloat -maintenance reports.
+// MySQL 8 caches information_schema statistics for a day unless told not
+// to; older servers reject the setting, which is then ignored.
+var tableSizeQueries = map[string]tableSizeQuery{
+	"mysql": {
+		Session: "SET SESSION information_schema_stats_expiry = 0",
+		Query:   "SELECT DATA_LENGTH, INDEX_LENGTH, DATA_FREE FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+	},
+	"tidb": {
+		Query: "SELECT DATA_LENGTH, INDEX_LENGTH, DATA_FREE FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+	},
+}
+
+// tableSize is a table's footprint as the engine reports it.
+type tableSize struct {
+	Data, Index, Free int64
+}
+
+// maintenanceOps lists the operations engine supports, for error messages.
+func maintenanceOps(e *engine) string {
+	var ops []string
+	for op := range maintenanceStatements[e.Name] {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	if len(ops) == 0 {
+		return "none"
+	}
+	return strings.Join(ops, ", ")
+}
+
+// validateMaintenance checks that the engine supports the -maintenance
+// operation, if any.
+func validateMaintenance(h *measuredHook, e *engine) error {
+	if h == nil || h.Maintenance == "" {
+		return nil
+	}
+	if _, ok := maintenanceStatements[e.Name][h.Maintenance]; !ok {
+		return fmt.Errorf("-maintenance %q is not supported on engine %s (supported: %s)", h.Maintenance, e.Name, maintenanceOps(e))
+	}
+	return nil
+}
+
+// runMaintenance runs statement, which may return a status result set.
+func runMaintenance(ctx context.Context, db *sql.DB, statement string) error {
+	rows, err := db.QueryContext(ctx, statement)
+	if err != nil {
+		return err
+	}
+	return drainRows(rows)
+}
+
+// readTableSize returns table's size, or false if the engine doesn't
+// report it.
+func readTableSize(ctx context.Context, db *sql.DB, e *engine, table string) (tableSize, bool, error) {
+	q, ok := tableSizeQueries[e.Name]
+	if !ok {
+		return tableSize{}, false, nil
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return tableSize{}, false, err
+	}
+	defer conn.Close()
+	if q.Session != "" {
+		conn.ExecContext(ctx, q.Session)
+	}
+	var size tableSize
+	var data, index, free sql.NullInt64
+	if err := conn.QueryRowContext(ctx, e.rebind(q.Query), table).Scan(&data, &index, &free); err != nil {
+		return tableSize{}, false, err
+	}
+	size.Data, size.Index, size.Free = data.Int64, index.Int64, free.Int64
+	return size, true, nil
+}
+
+// addTableSizes records the sizes before and after maintenance in metrics
+// and logs the change.
+func addTableSizes(metrics map[string]float64, name string, before, after tableSize) {
+	for _, m := range []struct {
+		key           string
+		before, after int64
+	}{{"table_data_bytes", before.Data, after.Data}, {"table_index_bytes", before.Index, after.Index}, {"table_free_bytes", before.Free, after.Free}} {
+		metrics[m.key+"_before"] = float64(m.before)
+		metrics[m.key+"_after"] = float64(m.after)
+	}
+	log.Printf("%s: table size before/after maintenance: data %d/%d bytes, indexes %d/%d bytes, free %d/%d bytes",
+		name, before.Data, after.Data, before.Index, after.Index, before.Free, after.Free)
+}
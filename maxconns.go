@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// connLimitQueries read the server's configured connection limit and the
+// connections already open, per engine.
+var connLimitQueries = map[string]struct{ limit, open string }{
+	"mysql":     {"SELECT @@max_connections", "SELECT COUNT(*) FROM information_schema.PROCESSLIST"},
+	"tidb":      {"SELECT @@max_connections", "SELECT COUNT(*) FROM information_schema.PROCESSLIST"},
+	"cockroach": {"SHOW CLUSTER SETTING server.max_connections_per_gateway", "SELECT COUNT(*) FROM [SHOW SESSIONS]"},
+}
+
+// Reasons a connection probe stopped.
+const (
+	stoppedByServer  = "server"  // the server rejected a connection
+	stoppedByClient  = "client"  // this process ran out of file descriptors
+	stoppedByTimeout = "timeout" // a connection took longer than -timeout
+	stoppedByMax     = "max"     // -max connections were open
+)
+
+// connStep is the establishment latency of connections From+1 to To.
+type connStep struct {
+	From    int          `json:"from"`
+	To      int          `json:"to"`
+	Connect LatencyStats `json:"connect"`
+}
+
+// connCeiling is the outcome of a connection saturation probe.
+type connCeiling struct {
+	// Configured is the server's limit, such as max_connections, and
+	// OpenBefore the connections other clients held when the probe started;
+	// both are -1 where the engine doesn't expose them.
+	Configured int        `json:"configured"`
+	OpenBefore int        `json:"open_before"`
+	Opened     int        `json:"opened"`
+	StoppedBy  string     `json:"stopped_by"`
+	Error      string     `json:"error,omitempty"`
+	Steps      []connStep `json:"steps"`
+}
+
+// maxConnectionsCommand opens connections one at a time and holds them
+// until the server refuses another, measuring how long each takes to
+// establish as the limit draws near; servers tend to slow down well before
+// they refuse. The connections opened, plus those other clients held, are
+// the practical ceiling, which may sit below the configured limit (memory,
+// thread or file limits) or above it (MySQL keeps one for SUPER users).
+// Run it against a server nobody else needs: while it holds the
+// connections, other clients are turned away.
+func maxConnectionsCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("max-connections", flag.ExitOnError)
+	limit := fs.Int("max", getEnvAsInt("BENCHMARK_MAX_CONNECTIONS", 10000), "stop after this many open connections")
+	step := fs.Int("step", 50, "connections per row of the latency table")
+	timeout := fs.Duration("timeout", 10*time.Second, "give up on a connection that takes longer than this")
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the report to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write the probe as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+	if *limit < 1 || *step < 1 {
+		return fmt.Errorf("-max and -step must be at least 1")
+	}
+
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	// Unlimited, so every Conn opens a new connection; nothing is idle
+	// while the probe holds them all.
+	config.PoolSize = 0
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	c := probeConnectionCeiling(ctx, db, eng, *limit, *step, *timeout)
+	switch c.StoppedBy {
+	case stoppedByMax:
+		log.Printf("Opened %d connections without reaching the limit", c.Opened)
+	default:
+		log.Printf("Opened %d connections before the %s refused more: %s", c.Opened, c.StoppedBy, c.Error)
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, c); err != nil {
+			return err
+		}
+	}
+	return writeMarkdown(*markdown, renderConnCeiling(config.Target(), c), false)
+}
+
+// probeConnectionCeiling opens and pings connections on db until one
+// fails or limit are open, then closes them all.
+func probeConnectionCeiling(ctx context.Context, db *sql.DB, eng *engine, limit, step int, timeout time.Duration) connCeiling {
+	c := connCeiling{Configured: -1, OpenBefore: -1, StoppedBy: stoppedByMax}
+	if q, ok := connLimitQueries[eng.Name]; ok {
+		if err := db.QueryRowContext(ctx, q.limit).Scan(&c.Configured); err != nil {
+			log.Printf("Warning: could not read the connection limit: %v", err)
+		}
+		if err := db.QueryRowContext(ctx, q.open).Scan(&c.OpenBefore); err != nil {
+			log.Printf("Warning: could not count open connections: %v", err)
+		}
+	}
+
+	var held []*sql.Conn
+	defer func() {
+		for _, conn := range held {
+			conn.Close()
+		}
+	}()
+	var window []time.Duration
+	flush := func() {
+		if len(window) > 0 {
+			c.Steps = append(c.Steps, connStep{From: len(held) - len(window), To: len(held), Connect: summarizeLatency(window)})
+			window = nil
+		}
+	}
+	for len(held) < limit {
+		connCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		conn, err := db.Conn(connCtx)
+		if err == nil {
+			if err = conn.PingContext(connCtx); err != nil {
+				conn.Close()
+			}
+		}
+		elapsed := time.Since(start)
+		cancel()
+		if err != nil {
+			c.StoppedBy, c.Error = connStopReason(connCtx, err), err.Error()
+			break
+		}
+		held = append(held, conn)
+		window = append(window, elapsed)
+		if len(window) == step {
+			flush()
+			s := c.Steps[len(c.Steps)-1]
+			log.Printf("%d connections open (p50 %s, max %s)", s.To, formatDuration(s.Connect.P50), formatDuration(s.Connect.Max))
+		}
+	}
+	flush()
+	c.Opened = len(held)
+	return c
+}
+
+func connStopReason(ctx context.Context, err error) string {
+	switch {
+	case tooManyOpenFiles(err):
+		return stoppedByClient
+	case ctx.Err() != nil:
+		return stoppedByTimeout
+	}
+	return stoppedByServer
+}
+
+func renderConnCeiling(target string, c connCeiling) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Connection ceiling of %s\n\n", target)
+	ceiling := fmt.Sprintf("%d", c.Opened)
+	if c.OpenBefore >= 0 {
+		ceiling = fmt.Sprintf("%d (%d opened + %d already open)", c.Opened+c.OpenBefore, c.Opened, c.OpenBefore)
+	}
+	switch c.StoppedBy {
+	case stoppedByMax:
+		fmt.Fprintf(&b, "No limit reached at %s connections.\n", ceiling)
+	case stoppedByServer:
+		fmt.Fprintf(&b, "Practical ceiling: **%s** connections; the server then refused: `%s`\n", ceiling, c.Error)
+	default:
+		fmt.Fprintf(&b, "Stopped by the %s at %s connections, before the server's limit: `%s`\n", c.StoppedBy, ceiling, c.Error)
+	}
+	if c.Configured >= 0 {
+		fmt.Fprintf(&b, "\nConfigured limit: %d\n", c.Configured)
+	}
+	b.WriteString("\n| connections | connect p50 | p95 | max |\n|---|---:|---:|---:|\n")
+	for _, s := range c.Steps {
+		fmt.Fprintf(&b, "| %d-%d | %v | %v | %v |\n", s.From+1, s.To, roundLatency(s.Connect.P50), roundLatency(s.Connect.P95), roundLatency(s.Connect.Max))
+	}
+	return b.String()
+}
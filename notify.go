@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webhookPayload is posted when a run finishes. Text alone is what Slack
+// incoming webhooks understand; the "json" format adds the structured
+// fields for generic receivers.
+type webhookPayload struct {
+	Text    string   `json:"text"`
+	Status  string   `json:"status,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Results []Result `json:"results,omitempty"`
+}
+
+// summarizeRun builds the notification for a finished run. Baseline
+// regressions, when comparisons are given, turn it into an alert.
+func summarizeRun(target string, results []Result, comparisons []comparison, runErr error) webhookPayload {
+	var b strings.Builder
+	payload := webhookPayload{Status: "ok"}
+	// The latency samples are for later significance tests, not for
+	// whoever receives the notification.
+	for _, r := range results {
+		r.LatencySample = nil
+		payload.Results = append(payload.Results, r)
+	}
+	switch n := regressions(comparisons); {
+	case runErr != nil:
+		payload.Status = "error"
+		payload.Error = redact(runErr.Error())
+		fmt.Fprintf(&b, ":x: Benchmark on %s failed: %v\n", target, runErr)
+	case n > 0:
+		payload.Status = "regression"
+		fmt.Fprintf(&b, ":rotating_light: Benchmark on %s: %d of %d strategies regressed\n", target, n, len(comparisons))
+	default:
+		fmt.Fprintf(&b, ":white_check_mark: Benchmark on %s completed\n", target)
+	}
+	for _, r := range results {
+		if r.Skipped != "" {
+			fmt.Fprintf(&b, "• %s: skipped: %s\n", r.Strategy, r.Skipped)
+			continue
+		}
+		fmt.Fprintf(&b, "• %s: %d rows in %s (%s rows/s)\n", r.Strategy, r.Rows, formatDuration(r.Duration), formatRate(r.RowsPerSec()))
+	}
+	for _, c := range comparisons {
+		if c.Regressed {
+			fmt.Fprintf(&b, "• %s regressed: %s\n", c.Strategy, c.Reason)
+		}
+	}
+	payload.Text = redact(strings.TrimRight(b.String(), "\n"))
+	return payload
+}
+
+// notifyWebhook posts the run summary to url. Failures are logged rather
+// than returned so a broken webhook never fails an otherwise good run.
+func notifyWebhook(url, format string, payload webhookPayload) {
+	if url == "" {
+		return
+	}
+	if format == "slack" {
+		payload = webhookPayload{Text: payload.Text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Warning: could not encode webhook payload: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Warning: invalid webhook URL: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Warning: webhook notification failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Warning: webhook returned %s", resp.Status)
+		return
+	}
+	log.Println("Webhook notification sent")
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+)
+
+// overheadToggle switches a server feature on and off with SQL.
+type overheadToggle struct{ On, Off string }
+
+// overheadPresets are the built-in toggles of the overhead command per
+// engine. The general log records every statement; audit-log is Percona
+// Server's audit plugin, which must already be installed, logging all
+// events or none.
+var overheadPresets = map[string]map[string]overheadToggle{
+	"general-log": {
+		"mysql": {On: "SET GLOBAL general_log = 'ON'", Off: "SET GLOBAL general_log = 'OFF'"},
+		"tidb":  {On: "SET GLOBAL tidb_general_log = 1", Off: "SET GLOBAL tidb_general_log = 0"},
+	},
+	"audit-log": {
+		"mysql": {On: "SET GLOBAL audit_log_policy = 'ALL'", Off: "SET GLOBAL audit_log_policy = 'NONE'"},
+	},
+}
+
+// overheadReport is the overhead command's JSON output.
+type overheadReport struct {
+	Label  string          `json:"label"`
+	Target string          `json:"target"`
+	Off    []Result        `json:"off"`
+	On     []Result        `json:"on"`
+	Deltas []overheadDelta `json:"deltas"`
+}
+
+// overheadDelta is one strategy's change from the feature being off to on.
+type overheadDelta struct {
+	Strategy         string        `json:"strategy"`
+	ThroughputChange float64       `json:"throughput_change_pct"` // positive = faster
+	LatencyChange    float64       `json:"p95_change_pct"`        // positive = slower
+	Significance     *significance `json:"significance,omitempty"`
+}
+
+// overheadCommand measures the cost of a server feature such as audit
+// logging: it runs the strategy sequence with the feature off, then on,
+// and reports each strategy's change in throughput and p95 latency. The
+// feature is toggled by a -preset's SQL or by the -enable and -disable
+// shell commands, which get BENCHMARK_TARGET, BENCHMARK_ENGINE and
+// BENCHMARK_OVERHEAD (on or off) in their environment, and is switched off
+// again when the command ends, whether or not it succeeded.
+func overheadCommand(config DBConfig, args []string) error {
+	f := newRunFlags("overhead")
+	label := f.fs.String("label", getEnv("BENCHMARK_OVERHEAD_LABEL", ""), "name of the feature measured, for the report (default: the preset)")
+	preset := f.fs.String("preset", getEnv("BENCHMARK_OVERHEAD_PRESET", ""), "built-in toggle: general-log or audit-log")
+	enable := f.fs.String("enable", getEnv("BENCHMARK_OVERHEAD_ENABLE", ""), "shell command switching the feature on")
+	disable := f.fs.String("disable", getEnv("BENCHMARK_OVERHEAD_DISABLE", ""), "shell command switching the feature off")
+	jsonPath := f.fs.String("json", "", `write both runs and the deltas as JSON to this file ("-" for stdout)`)
+	f.fs.Parse(args)
+	opts, err := f.options(config)
+	if err != nil {
+		return err
+	}
+	if f.soak || f.count != 1 {
+		return fmt.Errorf("overhead does not support soak mode or -count")
+	}
+
+	var toggle func(ctx context.Context, on bool) error
+	switch {
+	case *preset != "" && (*enable != "" || *disable != ""):
+		return fmt.Errorf("-preset can't be combined with -enable and -disable")
+	case *preset != "":
+		t, ok := overheadPresets[*preset][opts.Engine.Name]
+		if !ok {
+			return fmt.Errorf("no %s preset for engine %s; use -enable and -disable", *preset, opts.Engine.Name)
+		}
+		if *label == "" {
+			*label = *preset
+		}
+		toggle = func(ctx context.Context, on bool) error { return toggleWithSQL(ctx, config, t, on) }
+	case *enable != "" && *disable != "":
+		toggle = func(ctx context.Context, on bool) error {
+			command, state := *disable, "off"
+			if on {
+				command, state = *enable, "on"
+			}
+			return shellCommand(ctx, command, "BENCHMARK_TARGET="+config.Target(),
+				"BENCHMARK_ENGINE="+opts.Engine.Name, "BENCHMARK_OVERHEAD="+state).Run()
+		}
+	default:
+		return fmt.Errorf("either -preset or both -enable and -disable are required")
+	}
+	if *label == "" {
+		*label = "feature"
+	}
+
+	ctx := context.Background()
+	report := overheadReport{Label: *label, Target: config.Target()}
+	defer func() {
+		if err := toggle(ctx, false); err != nil {
+			log.Printf("Warning: could not switch %s off again: %v", *label, err)
+		}
+	}()
+	for _, on := range []bool{false, true} {
+		state := map[bool]string{false: "off", true: "on"}[on]
+		if err := toggle(ctx, on); err != nil {
+			return fmt.Errorf("switch %s %s: %v", *label, state, err)
+		}
+		log.Printf("Benchmarking with %s %s", *label, state)
+		results, err := benchmarkTarget(config, opts, 1)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", *label, state, err)
+		}
+		if on {
+			report.On = results
+		} else {
+			report.Off = results
+		}
+	}
+
+	// Nothing counts as a regression; the deltas are the point.
+	limits := Thresholds{MaxThroughputDrop: math.Inf(1), MaxLatencyRise: math.Inf(1)}
+	for _, c := range compareToBaseline(report.Off, report.On, limits) {
+		if c.Baseline == nil || c.Current == nil {
+			continue
+		}
+		d := overheadDelta{Strategy: c.Strategy, ThroughputChange: c.ThroughputChange, LatencyChange: c.LatencyChange, Significance: c.Significance}
+		log.Printf("%s: %+.1f%% throughput, %+.1f%% p95 latency with %s on", d.Strategy, d.ThroughputChange, d.LatencyChange, *label)
+		report.Deltas = append(report.Deltas, d)
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, report); err != nil {
+			return err
+		}
+	}
+	if f.markdown == "" && !f.githubSummary {
+		f.markdown = "-"
+	}
+	return publishMarkdown(f.markdown, f.githubSummary, renderOverhead(report))
+}
+
+// toggleWithSQL runs t's statement for on over a connection of its own.
+func toggleWithSQL(ctx context.Context, config DBConfig, t overheadToggle, on bool) error {
+	config.PoolSize = 1
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+	stmt := t.Off
+	if on {
+		stmt = t.On
+	}
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("%s: %v", stmt, err)
+	}
+	return nil
+}
+
+// renderOverhead tabulates each strategy with the feature off and on.
+func renderOverhead(r overheadReport) string {
+	off, on := map[string]Result{}, map[string]Result{}
+	for _, res := range r.Off {
+		off[res.Strategy] = res
+	}
+	for _, res := range r.On {
+		on[res.Strategy] = res
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s overhead on `%s`\n\n", r.Label, r.Target)
+	b.WriteString("| Strategy | Rows/s off | Rows/s on | Throughput | p95 off | p95 on | p95 | Latencies |\n|---|--:|--:|--:|--:|--:|--:|---|\n")
+	for _, d := range r.Deltas {
+		before, after := off[d.Strategy], on[d.Strategy]
+		significance := "–"
+		if d.Significance != nil {
+			significance = d.Significance.String()
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %+.1f%% | %s | %s | %+.1f%% | %s |\n", d.Strategy,
+			formatRate(before.RowsPerSec()), formatRate(after.RowsPerSec()), d.ThroughputChange,
+			formatDuration(before.Latency.P95), formatDuration(after.Latency.P95), d.LatencyChange, significance)
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Param documents a strategy-specific knob. Values are supplied with
+// -param name=value[,name=value]; strategies read them through the typed
+// helpers below, which fall back to the documented default.
+type Param struct {
+	Name        string `json:"name"`
+	Default     string `json:"default"`
+	Description string `json:"description"`
+}
+
+func (o RunOptions) param(name, def string) string {
+	if v, ok := o.Params[name]; ok {
+		return v
+	}
+	return def
+}
+
+// listParam splits a slash-separated list, since -param values can't
+// contain commas.
+func (o RunOptions) listParam(name, def string) []string {
+	var values []string
+	for _, v := range strings.Split(o.param(name, def), "/") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func (o RunOptions) intParam(name string, def int) int {
+	v, ok := o.Params[name]
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Warning: invalid integer for -param %s=%q, using %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+func (o RunOptions) floatParam(name string, def float64) float64 {
+	v, ok := o.Params[name]
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("Warning: invalid number for -param %s=%q, using %g", name, v, def)
+		return def
+	}
+	return f
+}
+
+func (o RunOptions) durationParam(name string, def time.Duration) time.Duration {
+	v, ok := o.Params[name]
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Warning: invalid duration for -param %s=%q, using %v", name, v, def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// phaseHooks are shell commands run around the phases of a benchmark run,
+// for clearing caches, taking snapshots or capturing external metrics
+// without changing the tool. Each gets the run's context in BENCHMARK_*
+// environment variables: BENCHMARK_PHASE, BENCHMARK_TARGET,
+// BENCHMARK_ENGINE and BENCHMARK_REPETITION always, BENCHMARK_STRATEGY,
+// BENCHMARK_WORKLOAD and BENCHMARK_TABLE around a strategy, and after one
+// its outcome in BENCHMARK_RESULT_ROWS, BENCHMARK_RESULT_DURATION_NS,
+// BENCHMARK_RESULT_P95_NS and BENCHMARK_RESULT_P99_NS, or BENCHMARK_ERROR.
+//
+// A failing before hook fails the run, since what it prepares can't be
+// relied on; a failing after hook is only reported.
+type phaseHooks struct {
+	BeforeSetup    string // before a strategy creates or resets its table
+	BeforeStrategy string // after setup, right before the strategy runs
+	AfterStrategy  string
+	AfterRun       string // once the strategy sequence has finished
+
+	// Target and Repetition describe the run in progress.
+	Target     string
+	Repetition int
+}
+
+const (
+	phaseBeforeSetup    = "before-setup"
+	phaseBeforeStrategy = "before-strategy"
+	phaseAfterStrategy  = "after-strategy"
+	phaseAfterRun       = "after-run"
+)
+
+func (h *phaseHooks) empty() bool {
+	return h.BeforeSetup == "" && h.BeforeStrategy == "" && h.AfterStrategy == "" && h.AfterRun == ""
+}
+
+// command is the hook configured for phase.
+func (h *phaseHooks) command(phase string) string {
+	switch phase {
+	case phaseBeforeSetup:
+		return h.BeforeSetup
+	case phaseBeforeStrategy:
+		return h.BeforeStrategy
+	case phaseAfterStrategy:
+		return h.AfterStrategy
+	case phaseAfterRun:
+		return h.AfterRun
+	}
+	return ""
+}
+
+// run runs phase's hook, if there is one, with the run's context and env
+// added to its environment.
+func (h *phaseHooks) run(ctx context.Context, phase string, opts RunOptions, env ...string) error {
+	if h == nil {
+		return nil
+	}
+	command := h.command(phase)
+	if command == "" {
+		return nil
+	}
+	engine := "mysql"
+	if opts.Engine != nil {
+		engine = opts.Engine.Name
+	}
+	env = append([]string{
+		"BENCHMARK_PHASE=" + phase,
+		"BENCHMARK_TARGET=" + h.Target,
+		"BENCHMARK_ENGINE=" + engine,
+		"BENCHMARK_REPETITION=" + strconv.Itoa(h.Repetition),
+	}, env...)
+	if err := shellCommand(ctx, command, env...).Run(); err != nil {
+		return fmt.Errorf("%s hook: %v", phase, err)
+	}
+	return nil
+}
+
+// before runs a before hook for s, failing the strategy if it fails.
+func (h *phaseHooks) before(ctx context.Context, phase string, s Strategy, opts RunOptions) error {
+	return h.run(ctx, phase, opts, strategyEnv(s, opts)...)
+}
+
+// afterStrategy runs the after-strategy hook with s's outcome.
+func (h *phaseHooks) afterStrategy(ctx context.Context, s Strategy, opts RunOptions, result Result, runErr error) {
+	env := strategyEnv(s, opts)
+	if runErr != nil {
+		env = append(env, "BENCHMARK_ERROR="+runErr.Error())
+	} else {
+		env = append(env,
+			"BENCHMARK_RESULT_ROWS="+strconv.Itoa(result.Rows),
+			"BENCHMARK_RESULT_DURATION_NS="+strconv.FormatInt(result.Duration.Nanoseconds(), 10),
+			"BENCHMARK_RESULT_P95_NS="+strconv.FormatInt(result.Latency.P95.Nanoseconds(), 10),
+			"BENCHMARK_RESULT_P99_NS="+strconv.FormatInt(result.Latency.P99.Nanoseconds(), 10))
+	}
+	if err := h.run(ctx, phaseAfterStrategy, opts, env...); err != nil {
+		log.Printf("Warning: %s: %v", s.Name, err)
+	}
+}
+
+// afterRun runs the after-run hook with the number of results and the
+// run's error, if any.
+func (h *phaseHooks) afterRun(ctx context.Context, opts RunOptions, results []Result, runErr error) {
+	env := []string{"BENCHMARK_RESULTS=" + strconv.Itoa(len(results))}
+	if runErr != nil {
+		env = append(env, "BENCHMARK_ERROR="+runErr.Error())
+	}
+	if err := h.run(ctx, phaseAfterRun, opts, env...); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+func strategyEnv(s Strategy, opts RunOptions) []string {
+	return []string{
+		"BENCHMARK_STRATEGY=" + s.Name,
+		"BENCHMARK_WORKLOAD=" + s.Workload,
+		"BENCHMARK_TABLE=" + s.tableFor(opts),
+	}
+}
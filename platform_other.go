@@ -0,0 +1,93 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// stopSignals end a long-running command such as schedule cleanly.
+var stopSignals = []os.Signal{os.Interrupt}
+
+// shellCommandArgs is how shellCommand hands a command line to the shell,
+// cmd.exe on Windows.
+func shellCommandArgs(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
+
+// controlFilePoll is how often the control file is checked for changes
+// where there is no SIGHUP to ask for a reload.
+const controlFilePoll = time.Second
+
+// reloadRequests delivers a value whenever the file at path is modified
+// until the returned stop function is called, and says how to ask for a
+// reload.
+func reloadRequests(path string) (<-chan struct{}, string, func()) {
+	requests := make(chan struct{})
+	done := make(chan struct{})
+	modTime := func() time.Time {
+		if fi, err := os.Stat(path); err == nil {
+			return fi.ModTime()
+		}
+		return time.Time{}
+	}
+	go func() {
+		defer close(requests)
+		last := modTime()
+		ticker := time.NewTicker(controlFilePoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if m := modTime(); !m.Equal(last) {
+				last = m
+				select {
+				case requests <- struct{}{}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	hint := fmt.Sprintf("Save changes to %s to apply them", path)
+	return requests, hint, func() { close(done) }
+}
+
+// Windows Sockets errors for running out of sockets or buffer space.
+const (
+	wsaEMFILE  = syscall.Errno(10024)
+	wsaENOBUFS = syscall.Errno(10055)
+)
+
+// tooManyOpenFiles reports whether err is the client running out of
+// sockets.
+func tooManyOpenFiles(err error) bool {
+	return errors.Is(err, wsaEMFILE) || errors.Is(err, wsaENOBUFS)
+}
+
+// socketHost reports whether host is the path of a Unix domain socket;
+// MySQL has none on Windows, where it listens on named pipes instead.
+func socketHost(string) bool { return false }
+
+// openSSHAgentPipe is the named pipe of the OpenSSH agent service.
+const openSSHAgentPipe = `\\.\pipe\openssh-ssh-agent`
+
+// dialSSHAgent connects to the SSH agent at SSH_AUTH_SOCK or, by default,
+// the named pipe of Windows' OpenSSH agent.
+func dialSSHAgent() (io.ReadWriter, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		sock = openSSHAgentPipe
+	}
+	return os.OpenFile(sock, os.O_RDWR, 0)
+}
@@ -0,0 +1,74 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// stopSignals end a long-running command such as schedule cleanly.
+var stopSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// shellCommandArgs is how shellCommand hands a command line to the shell.
+func shellCommandArgs(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// reloadRequests delivers a value on every SIGHUP until the returned stop
+// function is called, and says how to ask for a reload.
+func reloadRequests(path string) (<-chan struct{}, string, func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	requests := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(requests)
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				select {
+				case requests <- struct{}{}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	hint := fmt.Sprintf("Send SIGHUP to process %d to apply changes to %s", os.Getpid(), path)
+	return requests, hint, func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// tooManyOpenFiles reports whether err is the client running out of file
+// descriptors.
+func tooManyOpenFiles(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// socketHost reports whether host is the path of a Unix domain socket,
+// which the MySQL driver dials on the unix network.
+func socketHost(host string) bool {
+	return strings.HasPrefix(host, "/")
+}
+
+// dialSSHAgent connects to the SSH agent at SSH_AUTH_SOCK.
+func dialSSHAgent() (io.ReadWriter, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+	return net.Dial("unix", sock)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// External strategies live in plugin executables listed in
+// BENCHMARK_PLUGINS (comma-separated), in any language, so that teams can
+// benchmark their own access patterns without forking the repository. The
+// protocol is JSON over stdin/stdout:
+//
+//   - "<plugin> describe" prints a pluginDescription listing the
+//     strategies the plugin implements.
+//   - "<plugin> run" reads one pluginRequest from stdin, connects to the
+//     target itself and prints one pluginMessage per line: a latency_ns for
+//     every operation as it completes, optional log lines, and finally a
+//     result or an error.
+//
+// Whatever the plugin writes to stderr is passed through. The process is
+// killed if the strategy is skipped or the run aborted.
+type pluginDescription struct {
+	Strategies []pluginStrategy `json:"strategies"`
+}
+
+type pluginStrategy struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Engines     []string `json:"engines,omitempty"`
+	Workload    string   `json:"workload,omitempty"`
+	Read        bool     `json:"read,omitempty"`
+	Params      []struct {
+		Name        string `json:"name"`
+		Default     string `json:"default"`
+		Description string `json:"description"`
+	} `json:"params,omitempty"`
+	// Schema is the DDL creating the strategy's table, with {table} for
+	// its name; without one the table is a copy of benchmark_users.
+	Schema string `json:"schema,omitempty"`
+}
+
+type pluginRequest struct {
+	Strategy  string            `json:"strategy"`
+	Engine    string            `json:"engine"`
+	Driver    string            `json:"driver"`
+	DSN       string            `json:"dsn"`
+	Table     string            `json:"table"`
+	Rows      int               `json:"rows"`
+	Duration  time.Duration     `json:"duration_ns"`
+	BatchSize int               `json:"batch_size"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+type pluginMessage struct {
+	Latency *time.Duration `json:"latency_ns,omitempty"`
+	Log     string         `json:"log,omitempty"`
+	Result  *struct {
+		Rows         int                `json:"rows"`
+		Duration     time.Duration      `json:"duration_ns"`
+		Transactions int                `json:"transactions"`
+		Retries      int                `json:"retries"`
+		Metrics      map[string]float64 `json:"metrics"`
+	} `json:"result,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// loadPlugins registers the strategies of every plugin in paths after the
+// built-in ones.
+func loadPlugins(config DBConfig, paths string) error {
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		desc, err := describePlugin(path)
+		if err != nil {
+			return fmt.Errorf("plugin %s: %v", path, err)
+		}
+		for _, ps := range desc.Strategies {
+			s, err := ps.strategy(config, path)
+			if err != nil {
+				return fmt.Errorf("plugin %s: %v", path, err)
+			}
+			strategies = append(strategies, s)
+		}
+		log.Printf("Loaded %d strategies from plugin %s", len(desc.Strategies), filepath.Base(path))
+	}
+	return nil
+}
+
+func describePlugin(path string) (pluginDescription, error) {
+	var desc pluginDescription
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "describe")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return desc, fmt.Errorf("describe: %v", err)
+	}
+	if err := json.Unmarshal(out, &desc); err != nil {
+		return desc, fmt.Errorf("parse description: %v", err)
+	}
+	return desc, nil
+}
+
+func (ps pluginStrategy) strategy(config DBConfig, path string) (Strategy, error) {
+	if ps.Name == "" {
+		return Strategy{}, fmt.Errorf("strategy without a name")
+	}
+	for _, s := range strategies {
+		if s.Name == ps.Name {
+			return Strategy{}, fmt.Errorf("strategy %s is already defined", ps.Name)
+		}
+	}
+	s := Strategy{
+		Name:        ps.Name,
+		Description: ps.Description,
+		Engines:     ps.Engines,
+		Read:        ps.Read,
+		Workload:    ps.Workload,
+		Run: func(ctx context.Context, _ *sql.DB, opts RunOptions) (Result, error) {
+			return runPlugin(ctx, path, pluginRequest{
+				Strategy:  ps.Name,
+				Engine:    opts.Engine.Name,
+				Driver:    opts.Engine.Driver,
+				DSN:       opts.Engine.DSN(config),
+				Table:     opts.table(),
+				Rows:      opts.Rows,
+				Duration:  opts.Duration,
+				BatchSize: opts.batchSize(),
+				Params:    opts.Params,
+			})
+		},
+	}
+	if s.Description == "" {
+		s.Description = ps.Name
+	}
+	for _, p := range ps.Params {
+		s.Params = append(s.Params, Param{Name: p.Name, Default: p.Default, Description: p.Description})
+	}
+	if ps.Schema != "" {
+		s.Schema = func(_ *engine, table string) string {
+			return strings.ReplaceAll(ps.Schema, "{table}", table)
+		}
+	}
+	return s, nil
+}
+
+// runPlugin runs one strategy of the plugin at path, recording the
+// latencies it reports as they arrive so that they show up live.
+func runPlugin(ctx context.Context, path string, req pluginRequest) (Result, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return Result{}, err
+	}
+	cmd := exec.CommandContext(ctx, path, "run")
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return Result{}, err
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return Result{}, fmt.Errorf("start plugin: %v", err)
+	}
+
+	var rec latencyRecorder
+	var final *pluginMessage
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var msg pluginMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return Result{}, fmt.Errorf("invalid plugin output %q: %v", scanner.Text(), err)
+		}
+		switch {
+		case msg.Latency != nil:
+			rec.observe(*msg.Latency)
+		case msg.Log != "":
+			log.Printf("%s: %s", req.Strategy, msg.Log)
+		case msg.Result != nil || msg.Error != "":
+			final = &msg
+		}
+	}
+	elapsed := time.Since(start)
+	if err := scanner.Err(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return Result{}, fmt.Errorf("read plugin output: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		if final != nil && final.Error != "" {
+			return Result{}, fmt.Errorf("%s", final.Error)
+		}
+		return Result{}, fmt.Errorf("plugin exited: %v", err)
+	}
+	switch {
+	case final == nil:
+		return Result{}, fmt.Errorf("plugin exited without a result")
+	case final.Error != "":
+		return Result{}, fmt.Errorf("%s", final.Error)
+	}
+	if final.Result.Duration > 0 {
+		elapsed = final.Result.Duration
+	}
+	result := rec.result(final.Result.Rows, elapsed)
+	result.Transactions, result.Retries = final.Result.Transactions, final.Result.Retries
+	result.Metrics = final.Result.Metrics
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// privilege is one grant the run needs on the benchmark database, and the
+// statement that exercises it.
+type privilege struct {
+	Name  string
+	check func(ctx context.Context, db *sql.DB, e *engine) error
+}
+
+// requiredPrivileges are checked in order; DROP drops the table CREATE
+// made, so it is only checked when CREATE succeeded.
+var requiredPrivileges = []privilege{
+	{"SELECT", func(ctx context.Context, db *sql.DB, e *engine) error {
+		rows, err := db.QueryContext(ctx, "SELECT id FROM "+sharedTable+" "+e.limit(1))
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	}},
+	{"INSERT", func(ctx context.Context, db *sql.DB, e *engine) error {
+		return inRolledBackTx(ctx, db, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, e.rebind(insertUserSQL), "preflight", "preflight@example.com")
+			return err
+		})
+	}},
+	{"CREATE", func(ctx context.Context, db *sql.DB, e *engine) error {
+		if e.CloneTable != nil {
+			return e.cloneTable(ctx, db, probeTable)
+		}
+		cols := []column{{Name: "id", Type: typeBigInt, NotNull: true}}
+		_, err := db.ExecContext(ctx, e.createTable(probeTable, cols, "id"))
+		return err
+	}},
+	{"DROP", func(ctx context.Context, db *sql.DB, e *engine) error {
+		_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+probeTable)
+		return err
+	}},
+}
+
+// preflight checks before any work starts that the configured user holds
+// the privileges the run needs on the benchmark database, by running a
+// harmless statement for each, and names every one it lacks. Failures the
+// engine doesn't classify as a missing privilege, such as benchmark_users
+// not existing, are reported apart, with the statement's error, as the run
+// would fail on them too. Engines that can't create tables are only checked
+// for SELECT and INSERT.
+func preflight(ctx context.Context, db *sql.DB, config DBConfig, e *engine) error {
+	user := config.User
+	if user == "" {
+		user = "the configured user"
+	}
+	var granted, missing, failed, details []string
+	created := false
+	for _, p := range requiredPrivileges {
+		if (p.Name == "CREATE" || p.Name == "DROP") && e.CloneTable == nil && e.Features&featureCreateTable == 0 {
+			continue
+		}
+		if p.Name == "DROP" && !created {
+			details = append(details, "DROP: not checked without the table CREATE makes")
+			continue
+		}
+		err := p.check(ctx, db, e)
+		switch {
+		case err == nil:
+			granted = append(granted, p.Name)
+			created = created || p.Name == "CREATE"
+			continue
+		case e.classify(err) == errPermission:
+			missing = append(missing, p.Name)
+		default:
+			failed = append(failed, p.Name)
+		}
+		details = append(details, p.Name+": "+err.Error())
+	}
+	if len(missing) == 0 && len(failed) == 0 {
+		log.Printf("Preflight: %s has %s on %s", user, strings.Join(granted, ", "), config.Database)
+		return nil
+	}
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("%s lacks %s on %s", user, strings.Join(missing, ", "), config.Database))
+	}
+	if len(failed) > 0 {
+		problems = append(problems, fmt.Sprintf("the %s checks failed", strings.Join(failed, ", ")))
+	}
+	return fmt.Errorf("preflight: %s (%s); fix them or rerun with -preflight=false",
+		strings.Join(problems, " and "), strings.Join(details, "; "))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// previewSampleTime bounds each strategy's calibration sample, whatever
+// its rows.
+const previewSampleTime = 2 * time.Second
+
+// errRunDeclined is returned when the user answers no at the preview.
+var errRunDeclined = errors.New("run declined at the preview")
+
+// preview runs a small calibration sample of each strategy before the run,
+// estimates the total run time and rows from the samples' throughput and
+// asks the user to confirm, so that a run taking hours is never a
+// surprise. The samples write to the strategies' tables like the run does.
+type preview struct {
+	SampleRows int
+	// Confirm asks before running; without it the estimate is only
+	// printed.
+	Confirm bool
+	in      io.Reader
+}
+
+// strategyEstimate is the predicted size of one strategy's run, or why
+// there is none.
+type strategyEstimate struct {
+	Strategy string
+	Rows     int
+	Duration time.Duration
+	Unknown  string
+}
+
+// confirm calibrates, prints the estimate and, with Confirm, waits for a
+// yes, returning errRunDeclined for anything else.
+func (p *preview) confirm(ctx context.Context, db *sql.DB, opts RunOptions, count int) error {
+	log.Printf("Calibrating with %d rows per strategy to estimate the run...", p.SampleRows)
+	var estimates []strategyEstimate
+	var total time.Duration
+	rows, unknown := 0, 0
+	for _, s := range opts.Selection.ordered() {
+		if !s.runsWith(opts) || opts.Capabilities.unsupported(ctx, db, s, opts) != "" {
+			continue
+		}
+		e := p.estimate(ctx, db, s, opts)
+		estimates = append(estimates, e)
+		if e.Unknown != "" {
+			unknown++
+			continue
+		}
+		total += e.Duration
+		rows += e.Rows
+	}
+	total *= time.Duration(count)
+	rows *= count
+
+	for _, e := range estimates {
+		if e.Unknown != "" {
+			log.Printf("Estimate: %s: unknown (%s)", e.Strategy, e.Unknown)
+		} else {
+			log.Printf("Estimate: %s: %s rows in %s", e.Strategy, formatRate(float64(e.Rows)), formatDuration(e.Duration))
+		}
+	}
+	summary := fmt.Sprintf("Estimated run: %s and %s rows", formatDuration(total), formatRate(float64(rows)))
+	if count > 1 {
+		summary += fmt.Sprintf(" over %d repetitions", count)
+	}
+	if unknown > 0 {
+		summary += fmt.Sprintf(", plus %d strategies that can't be estimated", unknown)
+	}
+	if opts.Cost != nil {
+		summary += fmt.Sprintf(", about $%s of instance time", strconv.FormatFloat(significant(opts.Cost.Type.HourlyUSD*total.Hours()), 'f', -1, 64))
+	}
+	if opts.MaxRuntime > 0 && total > opts.MaxRuntime {
+		summary += fmt.Sprintf("; -max-runtime stops it after %s", formatDuration(opts.MaxRuntime))
+	}
+	log.Print(summary)
+	if !p.Confirm {
+		return nil
+	}
+
+	fmt.Fprint(os.Stderr, "Start the run? [y/N] ")
+	answer, err := bufio.NewReader(p.in).ReadString('\n')
+	if err != nil && answer == "" {
+		return errRunDeclined
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errRunDeclined
+}
+
+// estimate runs a sample of s bounded by SampleRows and previewSampleTime
+// and scales its throughput to the run's -n and -duration.
+func (p *preview) estimate(ctx context.Context, db *sql.DB, s Strategy, opts RunOptions) strategyEstimate {
+	e := strategyEstimate{Strategy: s.Name}
+	if opts.Auto != nil {
+		e.Unknown = "sized while it runs by -auto"
+		return e
+	}
+	if opts.Rows <= 0 && opts.Duration <= 0 {
+		e.Unknown = "unbounded without -n or -duration"
+		return e
+	}
+	sOpts, err := s.prepare(ctx, db, opts)
+	if err != nil {
+		e.Unknown = err.Error()
+		return e
+	}
+	sOpts.Rows, sOpts.Duration = p.SampleRows, previewSampleTime
+	sample, err := s.Run(ctx, db, sOpts)
+	if err != nil {
+		e.Unknown = "sample failed: " + err.Error()
+		return e
+	}
+	rate := sample.RowsPerSec()
+	if rate <= 0 {
+		e.Unknown = "the sample completed no rows"
+		return e
+	}
+	e.Rows = opts.Rows
+	e.Duration = time.Duration(float64(opts.Rows) / rate * float64(time.Second))
+	if opts.Duration > 0 && (opts.Rows <= 0 || e.Duration > opts.Duration) {
+		e.Rows = int(rate * opts.Duration.Seconds())
+		e.Duration = opts.Duration
+	}
+	return e
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile is a named, pre-tuned parameter set selectable with -profile.
+// Duration is the budget for the whole run and is split evenly across the
+// strategies; Rows caps each strategy (0 = bounded by time only). Soak
+// profiles instead cycle through the strategies for the full Duration with
+// leak detection enabled, inserting Rows rows per strategy per round.
+type Profile struct {
+	Name        string
+	Description string
+	Rows        int
+	Duration    time.Duration
+	Soak        bool
+}
+
+var profiles = map[string]Profile{
+	"smoke": {
+		Name:        "smoke",
+		Description: "quick sanity check: small row counts, about 30s",
+		Rows:        100,
+		Duration:    30 * time.Second,
+	},
+	"standard": {
+		Name:        "standard",
+		Description: "regular comparison run, about 5 minutes",
+		Duration:    5 * time.Minute,
+	},
+	"soak": {
+		Name:        "soak",
+		Description: "long-duration run with leak detection, about 2 hours",
+		Rows:        1000,
+		Duration:    2 * time.Hour,
+		Soak:        true,
+	},
+}
+
+func lookupProfile(name string) (Profile, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
+
+// apply fills opts from the profile, leaving alone anything the user set
+// explicitly (keyed by flag name, see explicitFlags).
+func (p Profile) apply(opts RunOptions, set map[string]bool, strategyCount int) RunOptions {
+	if !set["n"] {
+		opts.Rows = p.Rows
+	}
+	if !set["duration"] {
+		opts.Duration = p.Duration
+		if !p.Soak && strategyCount > 0 {
+			opts.Duration /= time.Duration(strategyCount)
+		}
+	}
+	return opts
+}
+
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// protocolTable receives the inserts of the protocol command.
+const protocolTable = "benchmark_users_protocol"
+
+// protocolMode is one way a driver can send the same statement, selected
+// with DSN parameters.
+type protocolMode struct {
+	Name   string
+	Params map[string]string
+}
+
+// protocolModes are the text and binary protocol modes per SQL driver. The
+// MySQL driver interpolates arguments client-side into a plain text query,
+// or prepares and executes the statement with binary arguments, which costs
+// extra round trips unless the prepared statement is reused; pgx sends the
+// simple (text) or extended (binary) query protocol.
+var protocolModes = map[string][]protocolMode{
+	"mysql": {
+		{"text", map[string]string{"interpolateParams": "true"}},
+		{"binary", map[string]string{"interpolateParams": "false"}},
+	},
+	"pgx": {
+		{"text", map[string]string{"default_query_exec_mode": "simple_protocol"}},
+		{"binary", map[string]string{"default_query_exec_mode": "cache_statement"}},
+	},
+}
+
+// protocolStatement is one statement executed identically in every mode.
+type protocolStatement struct {
+	Name  string
+	Query string
+	Read  bool
+}
+
+// protocolPoint is one statement's throughput in one mode.
+type protocolPoint struct {
+	Mode      string       `json:"mode"`
+	Prepared  bool         `json:"prepared,omitempty"`
+	Statement string       `json:"statement"`
+	Ops       int          `json:"ops"`
+	OpsPerSec float64      `json:"ops_per_sec"`
+	Latency   LatencyStats `json:"latency"`
+}
+
+// protocolCommand runs the same statements through each protocol mode the
+// engine's driver offers, and in binary mode also through a reused
+// prepared statement, to show what the wire format and its round trips
+// cost per statement. Reads return the shared table's rows, so seed it
+// first for the range read to return any.
+func protocolCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("protocol", flag.ExitOnError)
+	n := fs.Int("n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000), "executions per statement and mode")
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the comparison to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write the measurements as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+	if *n < 1 {
+		return fmt.Errorf("-n must be at least 1")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	modes, ok := protocolModes[eng.Driver]
+	if !ok {
+		return fmt.Errorf("engine %s's driver has no protocol choice; protocol supports MySQL and pgx engines", eng.Name)
+	}
+	statements := []protocolStatement{
+		{"point read", eng.rebind("SELECT name, email FROM " + sharedTable + " WHERE id = ?"), true},
+		{"range read", eng.rebind("SELECT id, name, email FROM " + sharedTable + " WHERE id > ? ORDER BY id " + eng.limit(100)), true},
+		{"insert", eng.rebind("INSERT INTO " + protocolTable + " (name, email) VALUES (?, ?)"), false},
+	}
+
+	ctx := context.Background()
+	var points []protocolPoint
+	for _, mode := range modes {
+		db, err := createConnectionPool(config.withParams(mode.Params))
+		if err != nil {
+			return fmt.Errorf("%s: failed to create connection pool: %v", mode.Name, err)
+		}
+		if err := eng.cloneTable(ctx, db, protocolTable); err != nil {
+			db.Close()
+			return fmt.Errorf("create table %s: %v", protocolTable, err)
+		}
+		// Only the binary protocol has prepared statements to reuse.
+		passes := []bool{false}
+		if mode.Name == "binary" {
+			passes = append(passes, true)
+		}
+		for _, prepared := range passes {
+			for _, s := range statements {
+				p, err := runProtocolStatement(ctx, db, s, *n, prepared)
+				if err != nil {
+					db.Close()
+					return fmt.Errorf("%s: %s: %v", mode.Name, s.Name, err)
+				}
+				p.Mode = mode.Name
+				log.Printf("%s%s: %s: %s ops/s (p50 %s)", mode.Name, preparedLabel(prepared), s.Name, formatRate(p.OpsPerSec), formatDuration(p.Latency.P50))
+				points = append(points, p)
+			}
+		}
+		db.Close()
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, points); err != nil {
+			return err
+		}
+	}
+	return writeMarkdown(*markdown, renderProtocolComparison("Protocol comparison", config.Target(), statements, points), false)
+}
+
+func preparedLabel(prepared bool) string {
+	if prepared {
+		return " (prepared)"
+	}
+	return ""
+}
+
+// runProtocolStatement executes s n times, through one prepared statement
+// if prepared is set.
+func runProtocolStatement(ctx context.Context, db *sql.DB, s protocolStatement, n int, prepared bool) (protocolPoint, error) {
+	query := db.QueryContext
+	execute := db.ExecContext
+	if prepared {
+		stmt, err := db.PrepareContext(ctx, s.Query)
+		if err != nil {
+			return protocolPoint{}, fmt.Errorf("prepare: %v", err)
+		}
+		defer stmt.Close()
+		query = func(ctx context.Context, _ string, args ...any) (*sql.Rows, error) {
+			return stmt.QueryContext(ctx, args...)
+		}
+		execute = func(ctx context.Context, _ string, args ...any) (sql.Result, error) {
+			return stmt.ExecContext(ctx, args...)
+		}
+	}
+	exec := func(ctx context.Context, i int) error {
+		if s.Read {
+			rows, err := query(ctx, s.Query, i)
+			if err != nil {
+				return err
+			}
+			return drainRows(rows)
+		}
+		_, err := execute(ctx, s.Query, fmt.Sprintf("UserProtocol%d", i), fmt.Sprintf("protocol%d@example.com", i))
+		return err
+	}
+
+	var rec latencyRecorder
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		opStart := time.Now()
+		if err := exec(ctx, i); err != nil {
+			return protocolPoint{}, err
+		}
+		rec.observe(time.Since(opStart))
+	}
+	r := rec.result(n, time.Since(start))
+	return protocolPoint{Prepared: prepared, Statement: s.Name, Ops: n, OpsPerSec: r.RowsPerSec(), Latency: r.Latency}, nil
+}
+
+// drainRows reads and closes rows, returning the first error.
+func drainRows(rows *sql.Rows) error {
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// renderProtocolComparison tabulates statements against modes, with the
+// difference of each mode's p50 from the first mode's.
+func renderProtocolComparison(title, target string, statements []protocolStatement, points []protocolPoint) string {
+	var columns []string
+	for _, p := range points {
+		label := p.Mode + preparedLabel(p.Prepared)
+		if len(columns) == 0 || columns[len(columns)-1] != label {
+			columns = append(columns, label)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s on %s\n\np50 latency and ops/s per statement; the difference is against %s.\n\n", title, target, columns[0])
+	fmt.Fprintf(&b, "| statement | %s |\n|---|%s\n", strings.Join(columns, " | "), strings.Repeat("---:|", len(columns)))
+	for _, s := range statements {
+		cells := make([]string, len(columns))
+		var base time.Duration
+		for i, label := range columns {
+			cells[i] = "-"
+			for _, p := range points {
+				if p.Statement != s.Name || p.Mode+preparedLabel(p.Prepared) != label {
+					continue
+				}
+				cells[i] = fmt.Sprintf("%v, %s/s", roundLatency(p.Latency.P50), formatRate(p.OpsPerSec))
+				if i == 0 {
+					base = p.Latency.P50
+				} else if base > 0 {
+					cells[i] += fmt.Sprintf(" (%+.0f%%)", 100*(float64(p.Latency.P50)/float64(base)-1))
+				}
+			}
+		}
+		fmt.Fprintf(&b, "| %s | %s |\n", s.Name, strings.Join(cells, " | "))
+	}
+	return b.String()
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// provenance records what produced a result file: the run configuration,
+// hashed so that two files can be checked for having been measured the
+// same way, and a fingerprint of the environment it ran in.
+type provenance struct {
+	ConfigHash  string      `json:"config_hash"`
+	Config      runConfig   `json:"config"`
+	Environment environment `json:"environment"`
+}
+
+// runConfig is everything that decides what a run measures.
+type runConfig struct {
+	Target      string            `json:"target"`
+	Engine      string            `json:"engine"`
+	Rows        int               `json:"rows"`
+	Duration    time.Duration     `json:"duration_ns"`
+	BatchSize   int               `json:"batch_size"`
+	Params      map[string]string `json:"params,omitempty"`
+	SharedTable bool              `json:"shared_table,omitempty"`
+	Explain     string            `json:"explain,omitempty"`
+	Count       int               `json:"count"`
+	PoolSize    int               `json:"pool_size"`
+	SessionInit []string          `json:"session_init,omitempty"`
+	Strategies  []string          `json:"strategies"`
+}
+
+type environment struct {
+	Tool          string `json:"tool"`
+	GoVersion     string `json:"go_version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	CPUs          int    `json:"cpus"`
+	Hostname      string `json:"hostname,omitempty"`
+	ServerVersion string `json:"server_version,omitempty"`
+}
+
+func newProvenance(config DBConfig, opts RunOptions, count int) *provenance {
+	p := &provenance{Config: runConfig{
+		Target:      config.Target(),
+		Engine:      config.Engine,
+		Rows:        opts.Rows,
+		Duration:    opts.Duration,
+		BatchSize:   opts.batchSize(),
+		Params:      opts.Params,
+		SharedTable: opts.SharedTable,
+		Explain:     opts.Explain,
+		Count:       count,
+		PoolSize:    config.PoolSize,
+		SessionInit: config.SessionInit,
+		Strategies:  []string{},
+	}}
+	if opts.Engine != nil {
+		for _, s := range opts.Selection.ordered() {
+			if s.runsWith(opts) {
+				p.Config.Strategies = append(p.Config.Strategies, s.Name)
+			}
+		}
+	}
+	p.ConfigHash = p.Config.hash()
+
+	p.Environment = environment{
+		Tool:      toolVersion(),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+	}
+	p.Environment.Hostname, _ = os.Hostname()
+	if opts.Engine != nil && opts.Engine.Native == nil {
+		for _, q := range opts.Engine.Info {
+			if q.Name != "version" {
+				continue
+			}
+			if db, err := createConnectionPool(config); err == nil {
+				p.Environment.ServerVersion, _ = queryInfo(db, q.Query)
+				db.Close()
+			}
+		}
+	}
+	return p
+}
+
+func (c runConfig) hash() string {
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// toolVersion identifies the benchmark binary by module version and, for
+// builds from a checkout, the VCS revision.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision":
+			version += " " + s.Value
+		case s.Key == "vcs.modified" && s.Value == "true":
+			version += " (modified)"
+		}
+	}
+	return version
+}
+
+// fileSignature is the detached signature written next to a signed
+// result file as <file>.sig. It covers the file's exact bytes, which
+// include the provenance.
+type fileSignature struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// signFile signs path with the Ed25519 private key in keyPath.
+func signFile(keyPath, path string) error {
+	key, err := loadSigningKey(keyPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %v", path, err)
+	}
+	sum := sha256.Sum256(data)
+	sig := fileSignature{
+		Algorithm: "ed25519",
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+	}
+	return writeJSON(path+".sig", sig)
+}
+
+// verifyFile checks path against its .sig with the given public key.
+func verifyFile(pub ed25519.PublicKey, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %v", path, err)
+	}
+	raw, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		return fmt.Errorf("read signature: %v", err)
+	}
+	var sig fileSignature
+	if err := json.Unmarshal(raw, &sig); err != nil {
+		return fmt.Errorf("parse signature: %v", err)
+	}
+	if sig.Algorithm != "ed25519" {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("parse signature: %v", err)
+	}
+	if !ed25519.Verify(pub, data, signature) {
+		return fmt.Errorf("signature does not match: the file was modified or signed with another key")
+	}
+	return nil
+}
+
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return ed, nil
+}
+
+func loadVerifyKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	ed, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+	}
+	return ed, nil
+}
+
+func readPEM(path, kind string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != kind {
+		return nil, fmt.Errorf("%s has no PEM %s block", path, kind)
+	}
+	return block.Bytes, nil
+}
+
+// keygenCommand writes a new Ed25519 key pair for -sign-key: <out>.key,
+// readable only by its owner, and <out>.pub to hand to verifiers.
+func keygenCommand(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "benchmark-signing", "path prefix of the key files")
+	fs.Parse(args)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate key: %v", err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("encode private key: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("encode public key: %v", err)
+	}
+	if err := os.WriteFile(*out+".key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600); err != nil {
+		return fmt.Errorf("write private key: %v", err)
+	}
+	if err := os.WriteFile(*out+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644); err != nil {
+		return fmt.Errorf("write public key: %v", err)
+	}
+	log.Printf("Wrote %s.key and %s.pub", *out, *out)
+	return nil
+}
+
+// verifyCommand checks signed result files against a public key and
+// prints the provenance they carry, so a performance claim can be traced
+// to the configuration and environment that produced it.
+func verifyCommand(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyPath := fs.String("key", getEnv("BENCHMARK_VERIFY_KEY", "benchmark-signing.pub"), "Ed25519 public key (PEM)")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: verify [-key file.pub] result.json...")
+	}
+	pub, err := loadVerifyKey(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		if err := verifyFile(pub, path); err != nil {
+			log.Printf("%s: FAILED: %v", path, err)
+			failed++
+			continue
+		}
+		var file struct {
+			Provenance *provenance `json:"provenance"`
+		}
+		data, _ := os.ReadFile(path)
+		if err := json.Unmarshal(data, &file); err != nil || file.Provenance == nil {
+			log.Printf("%s: signature ok, no provenance recorded", path)
+			continue
+		}
+		p := file.Provenance
+		if p.Config.hash() != p.ConfigHash {
+			log.Printf("%s: FAILED: config hash %s does not match the recorded config", path, p.ConfigHash)
+			failed++
+			continue
+		}
+		e := p.Environment
+		log.Printf("%s: signature ok, config %.12s (%s, %s, %d strategies), built %s with %s on %s/%s, %d CPUs, host %s, server %s",
+			path, p.ConfigHash, p.Config.Target, p.Config.Engine, len(p.Config.Strategies),
+			e.Tool, e.GoVersion, e.OS, e.Arch, e.CPUs, orDash(e.Hostname), orDash(e.ServerVersion))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, fs.NArg())
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// proxyNetwork is the network MySQL DSNs name to dial through DB_PROXY.
+const proxyNetwork = "proxy"
+
+// proxyDialer opens TCP connections through a SOCKS5 or HTTP CONNECT
+// proxy, for networks where only the proxy may reach the database subnet:
+//
+//	socks5://[user:password@]host:1080   resolving the database's name locally
+//	socks5h://[user:password@]host:1080  letting the proxy resolve it
+//	http://[user:password@]host:3128     tunneling with CONNECT
+//
+// MySQL-protocol engines dial through it, and so does the SSH tunnel's
+// first hop when one is configured.
+type proxyDialer struct {
+	url    *url.URL
+	dialer net.Dialer
+}
+
+func newProxyDialer(raw string) (*proxyDialer, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (expected socks5, socks5h or http)", u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("proxy %s has no port", u.Host)
+	}
+	if password, ok := u.User.Password(); ok {
+		redactor.add(password)
+	}
+	return &proxyDialer{url: u, dialer: net.Dialer{Timeout: 10 * time.Second}}, nil
+}
+
+// registerMySQL makes the proxy network dial through p. The driver only
+// adds the default port to tcp addresses.
+func (p *proxyDialer) registerMySQL() {
+	mysql.RegisterDialContext(proxyNetwork, func(ctx context.Context, addr string) (net.Conn, error) {
+		return p.DialContext(ctx, "tcp", withDefaultPort(addr, defaultPorts["mysql"]))
+	})
+}
+
+// DialContext connects to addr through the proxy.
+func (p *proxyDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := p.dialer.DialContext(ctx, "tcp", p.url.Host)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy %s: %v", p.url.Host, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(p.dialer.Timeout)
+	}
+	conn.SetDeadline(deadline)
+	if p.url.Scheme == "http" {
+		conn, err = p.connect(conn, addr)
+	} else {
+		err = p.socks5(ctx, conn, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s to %s: %v", p.url.Host, addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// connect asks an HTTP proxy for a tunnel to addr. The returned connection
+// first yields what the proxy sent after its response, since servers such
+// as MySQL speak first.
+func (p *proxyDialer) connect(conn net.Conn, addr string) (net.Conn, error) {
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: http.Header{}}
+	if u := p.url.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		return conn, err
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return conn, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return conn, fmt.Errorf("CONNECT: %s", resp.Status)
+	}
+	return bufferedConn{conn, r}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// socks5 runs the SOCKS5 handshake (RFC 1928), with username and password
+// authentication (RFC 1929) if the proxy URL has them.
+func (p *proxyDialer) socks5(ctx context.Context, conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+
+	methods := []byte{0x00}
+	if p.url.User != nil {
+		methods = []byte{0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	switch {
+	case reply[0] != 0x05:
+		return fmt.Errorf("not a SOCKS5 proxy")
+	case reply[1] == 0x02 && p.url.User != nil:
+		user := p.url.User.Username()
+		password, _ := p.url.User.Password()
+		auth := append([]byte{0x01, byte(len(user))}, user...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return fmt.Errorf("SOCKS5 authentication failed")
+		}
+	case reply[1] != 0x00:
+		return fmt.Errorf("SOCKS5 proxy accepts none of the offered authentication methods")
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	ip := net.ParseIP(host)
+	if ip == nil && p.url.Scheme == "socks5" {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return err
+		}
+		ip = ips[0]
+	}
+	switch {
+	case ip == nil:
+		req = append(append(req, 0x03, byte(len(host))), host...)
+	case ip.To4() != nil:
+		req = append(append(req, 0x01), ip.To4()...)
+	default:
+		req = append(append(req, 0x04), ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("SOCKS5 connect failed with code %d", head[1])
+	}
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("SOCKS5 reply has unknown address type %d", head[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
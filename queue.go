@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// jobsTable is the queue both producers and consumers work on.
+const jobsTable = "benchmark_jobs"
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "skip-locked-queue",
+		Description: "Dequeuing jobs with SELECT ... FOR UPDATE SKIP LOCKED",
+		Features:    featureSkipLocked,
+		Params: []Param{
+			{Name: "queue.consumers", Default: "1/4/16", Description: "slash-separated consumer counts, run one after another"},
+			{Name: "queue.producers", Default: "2", Description: "concurrent enqueuers"},
+			{Name: "queue.batch", Default: "1", Description: "jobs claimed per dequeue"},
+		},
+		Workload: workloadQueue,
+		Table:    jobsTable,
+		Schema:   jobsSchema,
+		Run:      dequeueUsingSkipLocked,
+	})
+}
+
+func jobsSchema(e *engine, table string) string {
+	return e.createTable(table, []column{
+		{Name: "id", Type: typeBigInt, NotNull: true},
+		{Name: "payload", Type: typeVarchar, Size: 255},
+		{Name: "enqueued_at", Type: typeBigInt, NotNull: true},
+	}, "id")
+}
+
+// queuePhase is the outcome of running one consumer count.
+type queuePhase struct {
+	dequeued   int
+	elapsed    time.Duration
+	emptyPolls int64
+	latency    []time.Duration // per dequeue transaction
+	waits      []time.Duration // per job, enqueue to dequeue
+}
+
+// dequeueUsingSkipLocked runs the jobs table as a queue once per count in
+// queue.consumers, splitting Rows and Duration evenly between the phases.
+// Producers insert jobs while consumers claim the oldest unlocked ones,
+// delete them and commit. Rows counts jobs dequeued; latency samples are
+// dequeue transactions. Metrics report throughput, dequeue p95 and the
+// time jobs waited in the queue for each consumer count, e.g. c4_jobs_per_sec.
+func dequeueUsingSkipLocked(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	counts, err := parseIntList(strings.Join(opts.listParam("queue.consumers", "1/4/16"), ","))
+	if err != nil {
+		return Result{}, fmt.Errorf("queue.consumers: %v", err)
+	}
+	producers := opts.intParam("queue.producers", 2)
+	batch := opts.intParam("queue.batch", 1)
+	if producers < 1 || batch < 1 {
+		return Result{}, fmt.Errorf("queue.producers and queue.batch must be at least 1")
+	}
+	phaseOpts := opts.phase(len(counts))
+
+	var rec latencyRecorder
+	var total time.Duration
+	var emptyPolls int64
+	var waits []time.Duration
+	rows := 0
+	metrics := map[string]float64{}
+	for _, consumers := range counts {
+		p, err := runQueuePhase(ctx, db, phaseOpts, consumers, producers, batch, &rec)
+		if err != nil {
+			return Result{}, fmt.Errorf("%d consumers: %v", consumers, err)
+		}
+		rows += p.dequeued
+		total += p.elapsed
+		emptyPolls += p.emptyPolls
+		waits = append(waits, p.waits...)
+
+		key := fmt.Sprintf("c%d_", consumers)
+		jobsPerSec := float64(p.dequeued) / p.elapsed.Seconds()
+		dequeue, wait := summarizeLatency(p.latency), summarizeLatency(p.waits)
+		metrics[key+"jobs_per_sec"] = jobsPerSec
+		metrics[key+"dequeue_p95_ns"] = float64(dequeue.P95.Nanoseconds())
+		metrics[key+"queue_wait_p50_ns"] = float64(wait.P50.Nanoseconds())
+		log.Printf("skip-locked-queue: %d consumers dequeued %d jobs (%s jobs/s, dequeue p95 %s, queue wait p50 %s, %d empty polls)",
+			consumers, p.dequeued, formatRate(jobsPerSec), formatDuration(dequeue.P95), formatDuration(wait.P50), p.emptyPolls)
+	}
+
+	result := rec.result(rows, total)
+	metrics["empty_polls"] = float64(emptyPolls)
+	metrics["queue_wait_p95_ns"] = float64(summarizeLatency(waits).P95.Nanoseconds())
+	result.Metrics = metrics
+	return result, nil
+}
+
+func runQueuePhase(ctx context.Context, db *sql.DB, opts RunOptions, consumers, producers, batch int, rec *latencyRecorder) (queuePhase, error) {
+	table := opts.table()
+	if _, err := db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+		return queuePhase{}, fmt.Errorf("empty queue: %v", err)
+	}
+	enqueueSQL := opts.bind("INSERT INTO " + table + " (id, payload, enqueued_at) VALUES (?, ?, ?)")
+	claimSQL := opts.bind(fmt.Sprintf("SELECT id, enqueued_at FROM %s ORDER BY id %s FOR UPDATE SKIP LOCKED", table, opts.Engine.limit(batch)))
+
+	var p queuePhase
+	var (
+		produced, dequeued, emptyPolls atomic.Int64
+		consumersLeft, producersLeft   atomic.Int64
+		mu                             sync.Mutex
+	)
+	consumersLeft.Store(int64(consumers))
+	producersLeft.Store(int64(producers))
+	start := time.Now()
+	err := runWorkers(ctx, consumers+producers, func(ctx context.Context, w int) error {
+		if w >= consumers {
+			defer producersLeft.Add(-1)
+			for ctx.Err() == nil && consumersLeft.Load() > 0 {
+				id := produced.Add(1)
+				if opts.Rows > 0 && id > int64(opts.Rows) {
+					return nil
+				}
+				if _, err := db.ExecContext(ctx, enqueueSQL, id, fmt.Sprintf("job-%d", id), time.Now().UnixNano()); err != nil {
+					return fmt.Errorf("enqueue error: %v", err)
+				}
+			}
+			return nil
+		}
+
+		defer consumersLeft.Add(-1)
+		for ctx.Err() == nil && !opts.done(int(dequeued.Load()), start) {
+			opStart := time.Now()
+			ids, enqueued, err := claimJobs(ctx, db, claimSQL, table, opts)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				// Nothing more is coming once the producers are done.
+				if producersLeft.Load() == 0 {
+					return nil
+				}
+				emptyPolls.Add(1)
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			now := time.Now()
+			dequeued.Add(int64(len(ids)))
+			mu.Lock()
+			p.latency = append(p.latency, now.Sub(opStart))
+			rec.observe(now.Sub(opStart))
+			for _, e := range enqueued {
+				p.waits = append(p.waits, now.Sub(time.Unix(0, e)))
+			}
+			mu.Unlock()
+		}
+		return nil
+	})
+	p.elapsed = time.Since(start)
+	p.dequeued = int(dequeued.Load())
+	p.emptyPolls = emptyPolls.Load()
+	return p, err
+}
+
+// claimJobs locks up to a batch of jobs other consumers haven't locked,
+// deletes them and commits, returning their ids and enqueue times.
+func claimJobs(ctx context.Context, db *sql.DB, claimSQL, table string, opts RunOptions) ([]any, []int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin transaction error: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, claimSQL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("claim error: %v", err)
+	}
+	var ids []any
+	var enqueued []int64
+	for rows.Next() {
+		var id, at int64
+		if err := rows.Scan(&id, &at); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan job: %v", err)
+		}
+		ids = append(ids, id)
+		enqueued = append(enqueued, at)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("claim error: %v", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil, tx.Commit()
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	if _, err := tx.ExecContext(ctx, opts.bind("DELETE FROM "+table+" WHERE id IN ("+placeholders+")"), ids...); err != nil {
+		return nil, nil, fmt.Errorf("delete jobs: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("commit error: %v", err)
+	}
+	return ids, enqueued, nil
+}
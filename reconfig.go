@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// liveConfig is what may be changed while a run is in progress, for
+// exploring capacity without restarting: the target rate and the pool's
+// connection limit, which caps how many operations run concurrently.
+// Fields left out stay as they are.
+type liveConfig struct {
+	// Rate is the target operations per second across every worker, where
+	// a batch counts as one; 0 lifts the limit.
+	Rate *float64 `json:"rate,omitempty"`
+	// Connections is the pool's maximum open connections.
+	Connections *int `json:"connections,omitempty"`
+}
+
+func (c liveConfig) validate() error {
+	if c.Rate != nil && *c.Rate < 0 {
+		return fmt.Errorf("rate must not be negative")
+	}
+	if c.Connections != nil && *c.Connections < 1 {
+		return fmt.Errorf("connections must be at least 1")
+	}
+	return nil
+}
+
+// liveRun is the run in progress as far as reconfiguration goes. Runs
+// share it like they share the latency meters, so only one at a time may
+// be reconfigured.
+var liveRun reconfigurable
+
+type reconfigurable struct {
+	mu       sync.Mutex
+	pool     *sql.DB
+	interval time.Duration // between admitted operations; 0 for no limit
+	next     time.Time
+	changed  chan struct{} // closed when interval changes, waking waiters
+}
+
+// start attaches the run's pool, nil for native engines, and sets the
+// initial rate.
+func (r *reconfigurable) start(pool *sql.DB, rate float64) {
+	r.mu.Lock()
+	r.pool = pool
+	r.mu.Unlock()
+	r.setRate(rate)
+}
+
+// stop detaches the pool and lifts the rate limit once the run is over.
+func (r *reconfigurable) stop() {
+	r.mu.Lock()
+	r.pool = nil
+	r.mu.Unlock()
+	r.setRate(0)
+}
+
+func (r *reconfigurable) setRate(rate float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interval = 0
+	if rate > 0 {
+		r.interval = time.Duration(float64(time.Second) / rate)
+	}
+	r.next = time.Time{}
+	if r.changed != nil {
+		close(r.changed)
+	}
+	r.changed = make(chan struct{})
+}
+
+// apply changes the run in progress to c.
+func (r *reconfigurable) apply(c liveConfig) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if c.Connections != nil {
+		r.mu.Lock()
+		pool := r.pool
+		r.mu.Unlock()
+		if pool == nil {
+			return fmt.Errorf("no connection pool to resize")
+		}
+		pool.SetMaxOpenConns(*c.Connections)
+		pool.SetMaxIdleConns(*c.Connections)
+		log.Printf("Reconfigured: pool limited to %d connections", *c.Connections)
+	}
+	if c.Rate != nil {
+		r.setRate(*c.Rate)
+		if *c.Rate > 0 {
+			log.Printf("Reconfigured: target rate %g ops/s", *c.Rate)
+		} else {
+			log.Printf("Reconfigured: rate limit lifted")
+		}
+	}
+	return nil
+}
+
+// wait blocks until the target rate admits another operation, starting
+// over if the rate is changed meanwhile.
+func (r *reconfigurable) wait() {
+	for {
+		r.mu.Lock()
+		if r.interval == 0 {
+			r.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		if r.next.Before(now) {
+			r.next = now
+		}
+		at, changed := r.next, r.changed
+		r.next = r.next.Add(r.interval)
+		r.mu.Unlock()
+		if at.Equal(now) {
+			return
+		}
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-timer.C:
+			return
+		case <-changed:
+			timer.Stop()
+		}
+	}
+}
+
+// watchControlFile applies the liveConfig JSON in path every time a reload
+// is requested, by SIGHUP or, where there are no signals, by saving the
+// file, until the returned function is called.
+func watchControlFile(path string) func() {
+	if path == "" {
+		return func() {}
+	}
+	requests, hint, stop := reloadRequests(path)
+	go func() {
+		for range requests {
+			if err := applyControlFile(path); err != nil {
+				log.Printf("Warning: could not reconfigure from %s: %v", path, err)
+			}
+		}
+	}()
+	log.Print(hint)
+	return stop
+}
+
+func applyControlFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var c liveConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("parse: %v", err)
+	}
+	return liveRun.apply(c)
+}
+
+// reconfigureLive applies the JSON liveConfig in the request body to the
+// run in progress.
+func (s *server) reconfigureLive(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	live := s.live
+	s.mu.Unlock()
+	if live == nil {
+		http.Error(w, "no run in progress", http.StatusConflict)
+		return
+	}
+	var c liveConfig
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, fmt.Sprintf("invalid config: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := liveRun.apply(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
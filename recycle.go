@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "conn-recycling",
+		Description: "Inserting under different connection lifetime and idle time limits",
+		Params: append([]Param{
+			{Name: "recycle.lifetimes", Default: "0/1m/1s/100ms", Description: "slash-separated SetConnMaxLifetime values to sweep (0 = connections are never recycled for age)"},
+			{Name: "recycle.idle_times", Default: "0", Description: "slash-separated SetConnMaxIdleTime values, each combined with every lifetime"},
+			{Name: "recycle.workers", Default: "4", Description: "concurrent inserters; fewer than the pool size leaves idle connections for the idle time to close"},
+		}, dataParams...),
+		Workload: workloadSingleInsert,
+		Run:      insertUnderRecycling,
+	})
+}
+
+// recyclePolicy is one combination of the pool's recycling limits.
+type recyclePolicy struct {
+	lifetime, idleTime time.Duration
+}
+
+// key names the policy in metrics, e.g. life1s_idle0_.
+func (p recyclePolicy) key() string {
+	return "life" + metricDuration(p.lifetime) + "_idle" + metricDuration(p.idleTime) + "_"
+}
+
+func metricDuration(d time.Duration) string {
+	if d == 0 {
+		return "0"
+	}
+	return d.String()
+}
+
+// insertUnderRecycling runs the same steady insert workload once per
+// combination of recycle.lifetimes and recycle.idle_times, splitting Rows
+// and Duration between them, with the pool's SetConnMaxLifetime and
+// SetConnMaxIdleTime set accordingly. These limits tend to be copied from
+// elsewhere rather than measured; aggressive ones trade throughput and
+// tail latency for reconnects. Metrics report per policy the throughput,
+// p50 and p99 and the connections the pool closed for age or idleness,
+// e.g. life1s_idle0_ops_per_sec and life1s_idle0_reconnects. The pool gets
+// createConnectionPool's limits back afterwards.
+func insertUnderRecycling(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	lifetimes, err := durationList(opts.listParam("recycle.lifetimes", "0/1m/1s/100ms"))
+	if err != nil {
+		return Result{}, fmt.Errorf("recycle.lifetimes: %v", err)
+	}
+	idleTimes, err := durationList(opts.listParam("recycle.idle_times", "0"))
+	if err != nil {
+		return Result{}, fmt.Errorf("recycle.idle_times: %v", err)
+	}
+	if len(lifetimes) == 0 || len(idleTimes) == 0 {
+		return Result{}, fmt.Errorf("recycle.lifetimes and recycle.idle_times must not be empty")
+	}
+	workers := opts.intParam("recycle.workers", 4)
+	if workers < 1 {
+		return Result{}, fmt.Errorf("recycle.workers must be at least 1")
+	}
+	var policies []recyclePolicy
+	for _, l := range lifetimes {
+		for _, i := range idleTimes {
+			policies = append(policies, recyclePolicy{l, i})
+		}
+	}
+	defer func() {
+		db.SetConnMaxLifetime(defaultConnMaxLifetime)
+		db.SetConnMaxIdleTime(0)
+	}()
+	phaseOpts := opts.phase(len(policies))
+
+	var rec latencyRecorder
+	var total time.Duration
+	rows := 0
+	metrics := map[string]float64{}
+	for _, p := range policies {
+		db.SetConnMaxLifetime(p.lifetime)
+		db.SetConnMaxIdleTime(p.idleTime)
+		before := db.Stats()
+		latency, elapsed, err := runRecyclePhase(ctx, db, phaseOpts, workers, rows, &rec)
+		if err != nil {
+			return Result{}, fmt.Errorf("lifetime %v, idle time %v: %v", p.lifetime, p.idleTime, err)
+		}
+		after := db.Stats()
+		rows += len(latency)
+		total += elapsed
+
+		stats := summarizeLatency(latency)
+		rate := float64(len(latency)) / elapsed.Seconds()
+		reconnects := (after.MaxLifetimeClosed - before.MaxLifetimeClosed) + (after.MaxIdleTimeClosed - before.MaxIdleTimeClosed)
+		metrics[p.key()+"ops_per_sec"] = rate
+		metrics[p.key()+"p50_ns"] = float64(stats.P50.Nanoseconds())
+		metrics[p.key()+"p99_ns"] = float64(stats.P99.Nanoseconds())
+		metrics[p.key()+"reconnects"] = float64(reconnects)
+		log.Printf("conn-recycling: lifetime %s, idle time %s: %s inserts/s, p50 %s, p99 %s, %d connections recycled",
+			metricDuration(p.lifetime), metricDuration(p.idleTime), formatRate(rate), formatDuration(stats.P50), formatDuration(stats.P99), reconnects)
+	}
+
+	result := rec.result(rows, total)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// runRecyclePhase inserts from workers until opts is done, first offsetting
+// the generated rows past earlier phases', observing each insert in rec as
+// it finishes.
+func runRecyclePhase(ctx context.Context, db *sql.DB, opts RunOptions, workers, first int, rec *latencyRecorder) ([]time.Duration, time.Duration, error) {
+	var (
+		claimed atomic.Int64
+		mu      sync.Mutex
+		latency []time.Duration
+	)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		gen := opts.rowGen("Recycle")
+		var local []time.Duration
+		defer func() {
+			mu.Lock()
+			latency = append(latency, local...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			i := int(claimed.Add(1)) - 1
+			if opts.done(i, start) {
+				return nil
+			}
+			name, email := gen.row(first + i)
+			opStart := time.Now()
+			if _, err := db.ExecContext(ctx, opts.insertSQL(), name, email); err != nil {
+				return fmt.Errorf("insert error: %v", err)
+			}
+			d := time.Since(opStart)
+			local = append(local, d)
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+		}
+		return nil
+	})
+	return latency, time.Since(start), err
+}
+
+// durationList parses list parameter values as durations.
+func durationList(values []string) ([]time.Duration, error) {
+	var out []time.Duration
+	for _, v := range values {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration %q", v)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
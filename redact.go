@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redactedSecret replaces credentials in output.
+const redactedSecret = "****"
+
+// redactor masks credentials in everything the tool prints or saves: log
+// lines, reports, notifications and stored run errors. It replaces the
+// secrets it has been told about, wherever they appear, and the password
+// part of anything shaped like a DSN, for credentials it never saw such as
+// a driver echoing a connection string back in an error.
+var redactor = &secretRedactor{}
+
+// minSecretLength keeps a trivially short password from masking every
+// occurrence of a common substring; the DSN patterns still cover it.
+const minSecretLength = 4
+
+// Credentials embedded in connection strings: URL userinfo
+// (postgres://user:pw@host), MySQL DSNs (user:pw@tcp(host)/db) and
+// key=value parameters (password=pw, as in libpq and JDBC-style strings).
+var dsnSecrets = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`(://[^:/@\s]*:)[^@\s]+@`), "${1}" + redactedSecret + "@"},
+	{regexp.MustCompile(`([\w.+-]+:)[^@\s/]+@([a-z][a-z0-9+-]*)\(`), "${1}" + redactedSecret + "@${2}("},
+	{regexp.MustCompile(`(?i)\b(password|passwd|pwd|token|secret)=('[^']*'|[^\s&;,)"']+)`), "${1}=" + redactedSecret},
+}
+
+type secretRedactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// add registers secrets to mask from now on.
+func (r *secretRedactor) add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range secrets {
+		if len(s) < minSecretLength {
+			continue
+		}
+		known := false
+		for _, k := range r.secrets {
+			known = known || k == s
+		}
+		if !known {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+}
+
+// addEnv registers the values of the environment variables that hold
+// credentials.
+func (r *secretRedactor) addEnv() {
+	for _, name := range []string{"DB_PASS", "DB_SSH_PASSPHRASE", "VAULT_TOKEN", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		r.add(os.Getenv(name))
+	}
+}
+
+// redact returns s with its credentials masked.
+func (r *secretRedactor) redact(s string) string {
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redactedSecret)
+	}
+	r.mu.RUnlock()
+	for _, d := range dsnSecrets {
+		s = d.pattern.ReplaceAllString(s, d.replace)
+	}
+	return s
+}
+
+// redact masks credentials in s with the shared redactor.
+func redact(s string) string { return redactor.redact(s) }
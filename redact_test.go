@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSecret = "s3cret-pass-7Q"
+
+func TestBatchErrorRedacted(t *testing.T) {
+	// The password is registered as a secret and then shows up in the
+	// error about the unknown engine.
+	config := `{"db": {"password": "` + testSecret + `", "engine": "` + testSecret + `"}}`
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	runErr := batchCommand(DBConfig{}, []string{"-config", config})
+	os.Stdout = stdout
+	w.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runErr == nil {
+		t.Fatal("batch run with an unknown engine succeeded")
+	}
+	var out batchOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("decode batch output: %v", err)
+	}
+	if out.Status != "error" || out.Error == "" {
+		t.Fatalf("status %q, error %q, want an error", out.Status, out.Error)
+	}
+	if strings.Contains(out.Error, testSecret) {
+		t.Errorf("batch output error leaks the secret: %s", out.Error)
+	}
+}
+
+func TestStrategyFailedEventRedacted(t *testing.T) {
+	redactor.add(testSecret)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := openEventLog(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		events.close()
+		events = nil
+	}()
+	saved := strategies
+	defer func() { strategies = saved }()
+	strategies = []Strategy{{
+		Name:  "failing",
+		Table: sharedTable,
+		Run: func(context.Context, *sql.DB, RunOptions) (Result, error) {
+			return Result{}, errors.New("connect as bench:" + testSecret + " refused")
+		},
+	}}
+
+	eng, err := lookupEngine("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runBenchmark(context.Background(), nil, RunOptions{Rows: 1, Engine: eng}); err == nil {
+		t.Fatal("failing strategy succeeded")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"strategy_failed"`) {
+		t.Fatalf("no strategy_failed event in %s", data)
+	}
+	if strings.Contains(string(data), testSecret) {
+		t.Errorf("event log leaks the secret: %s", data)
+	}
+}
+
+func TestBaselineRedacted(t *testing.T) {
+	redactor.add(testSecret)
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := saveBaseline(path, baselineFile{Target: "bench:" + testSecret + "@db:3306"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), testSecret) {
+		t.Errorf("baseline leaks the secret: %s", data)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// regionProbe is what one client region measured against one endpoint.
+type regionProbe struct {
+	Endpoint   string       `json:"endpoint"`
+	Host       string       `json:"host"`
+	Connect    LatencyStats `json:"connect"`
+	RoundTrip  LatencyStats `json:"round_trip"`
+	Insert     LatencyStats `json:"insert"`
+	InsertsSec float64      `json:"inserts_per_sec"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// regionRun is the probes of all endpoints from one client region, the
+// unit that -merge combines into the matrix.
+type regionRun struct {
+	From   string        `json:"from"`
+	At     time.Time     `json:"at"`
+	Probes []regionProbe `json:"probes"`
+}
+
+// regionsCommand probes regional endpoints of the same database with a
+// light workload: fresh connections, SELECT 1 round trips and single-row
+// inserts, one at a time so that the numbers reflect network distance
+// rather than load. Run it from each client region with -from and -json,
+// then combine the files with -merge into a region × endpoint matrix to
+// choose where the primary should live.
+func regionsCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("regions", flag.ExitOnError)
+	endpoints := fs.String("endpoints", getEnv("BENCHMARK_REGION_ENDPOINTS", ""), "comma-separated name=host[:port] endpoints")
+	from := fs.String("from", getEnv("BENCHMARK_REGION", "local"), "name of the region this client runs in")
+	probes := fs.Int("n", 50, "probes of each kind per endpoint")
+	readOnly := fs.Bool("read-only", false, "skip the insert probe")
+	merge := fs.String("merge", "", "comma-separated -json files from earlier runs to combine instead of probing")
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the matrix to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write this run's probes as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+
+	if *merge != "" {
+		runs, err := loadRegionRuns(strings.Split(*merge, ","))
+		if err != nil {
+			return err
+		}
+		return writeMarkdown(*markdown, renderRegionMatrix(runs), false)
+	}
+
+	targets, err := parseKeyValues(*endpoints)
+	if err != nil {
+		return fmt.Errorf("invalid -endpoints: %v", err)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("-endpoints is required")
+	}
+	if *probes < 1 {
+		return fmt.Errorf("-n must be at least 1")
+	}
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	run := regionRun{From: *from, At: time.Now().UTC()}
+	for _, name := range names {
+		endpointConfig := config
+		endpointConfig.Host = targets[name]
+		log.Printf("Probing %s (%s) from %s", name, targets[name], *from)
+		p := probeEndpoint(endpointConfig, *probes, *readOnly)
+		p.Endpoint = name
+		if p.Error != "" {
+			log.Printf("Warning: %s: %s", name, p.Error)
+		}
+		run.Probes = append(run.Probes, p)
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, run); err != nil {
+			return err
+		}
+	}
+	return writeMarkdown(*markdown, renderRegionMatrix([]regionRun{run}), false)
+}
+
+// probeEndpoint measures one endpoint. Each connect probe opens and pings
+// a new single-connection pool, which includes the TCP and TLS handshakes
+// and authentication; the other probes reuse one connection.
+func probeEndpoint(config DBConfig, n int, readOnly bool) regionProbe {
+	p := regionProbe{Host: config.Host}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	config.PoolSize = 1
+
+	var connects []time.Duration
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		db, err := createConnectionPool(config)
+		if err != nil {
+			p.Error = err.Error()
+			return p
+		}
+		connects = append(connects, time.Since(start))
+		db.Close()
+	}
+	p.Connect = summarizeLatency(connects)
+
+	db, err := createConnectionPool(config)
+	if err != nil {
+		p.Error = err.Error()
+		return p
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	var trips []time.Duration
+	for i := 0; i < n; i++ {
+		var one int
+		start := time.Now()
+		if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+			p.Error = fmt.Sprintf("round trip: %v", err)
+			return p
+		}
+		trips = append(trips, time.Since(start))
+	}
+	p.RoundTrip = summarizeLatency(trips)
+	if readOnly {
+		return p
+	}
+
+	opts := RunOptions{Rows: n, Engine: eng}
+	var rec latencyRecorder
+	base := time.Now().UnixMicro()
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		opStart := time.Now()
+		if _, err := db.ExecContext(ctx, opts.insertSQL(), fmt.Sprintf("UserRegion%d", i), fmt.Sprintf("region%d-%d@example.com", base, i)); err != nil {
+			p.Error = fmt.Sprintf("insert: %v", err)
+			return p
+		}
+		rec.observe(time.Since(opStart))
+	}
+	result := rec.result(n, time.Since(start))
+	p.Insert = result.Latency
+	p.InsertsSec = result.RowsPerSec()
+	return p
+}
+
+func loadRegionRuns(paths []string) ([]regionRun, error) {
+	var runs []regionRun
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %v", path, err)
+		}
+		var run regionRun
+		if err := json.Unmarshal(raw, &run); err != nil {
+			return nil, fmt.Errorf("parse %s: %v", path, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// renderRegionMatrix tabulates client regions against endpoints, one
+// table per measurement, so the best placement is the endpoint column
+// with the lowest values across the regions that matter.
+func renderRegionMatrix(runs []regionRun) string {
+	var endpoints []string
+	seen := map[string]bool{}
+	for _, run := range runs {
+		for _, p := range run.Probes {
+			if !seen[p.Endpoint] {
+				seen[p.Endpoint] = true
+				endpoints = append(endpoints, p.Endpoint)
+			}
+		}
+	}
+	sort.Strings(endpoints)
+
+	var b strings.Builder
+	b.WriteString("### Region latency matrix\n")
+	tables := []struct {
+		title string
+		cell  func(regionProbe) string
+	}{
+		{"Round trip p50 / p95 (SELECT 1)", func(p regionProbe) string {
+			return fmt.Sprintf("%v / %v", roundLatency(p.RoundTrip.P50), roundLatency(p.RoundTrip.P95))
+		}},
+		{"Connect p50", func(p regionProbe) string { return roundLatency(p.Connect.P50).String() }},
+		{"Insert p50 / p95", func(p regionProbe) string {
+			if p.InsertsSec == 0 {
+				return "-"
+			}
+			return fmt.Sprintf("%v / %v", roundLatency(p.Insert.P50), roundLatency(p.Insert.P95))
+		}},
+		{"Sequential inserts/s", func(p regionProbe) string {
+			if p.InsertsSec == 0 {
+				return "-"
+			}
+			return fmt.Sprintf("%.0f", p.InsertsSec)
+		}},
+	}
+	for _, t := range tables {
+		fmt.Fprintf(&b, "\n#### %s\n\n| from \\ to | %s |\n|---|%s\n", t.title, strings.Join(endpoints, " | "), strings.Repeat("---:|", len(endpoints)))
+		for _, run := range runs {
+			cells := make([]string, len(endpoints))
+			for i, e := range endpoints {
+				cells[i] = "-"
+				for _, p := range run.Probes {
+					if p.Endpoint != e {
+						continue
+					}
+					if p.Error != "" {
+						cells[i] = ":x:"
+					} else {
+						cells[i] = t.cell(p)
+					}
+				}
+			}
+			fmt.Fprintf(&b, "| %s | %s |\n", run.From, strings.Join(cells, " | "))
+		}
+	}
+	return b.String()
+}
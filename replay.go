@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayEvent is one statement taken from a MySQL log.
+type replayEvent struct {
+	At    time.Time
+	Query string
+}
+
+// replayStatement is a replayEvent prepared for execution.
+type replayStatement struct {
+	at          time.Duration // offset from the first event
+	query       string
+	args        []any
+	fingerprint string
+	read        bool
+}
+
+// replayClass aggregates the replayed statements sharing a fingerprint.
+type replayClass struct {
+	Fingerprint string       `json:"fingerprint"`
+	Count       int          `json:"count"`
+	Errors      int          `json:"errors"`
+	Total       int64        `json:"total_ns"`
+	Latency     LatencyStats `json:"latency"`
+	FirstError  string       `json:"first_error,omitempty"`
+
+	samples []time.Duration
+}
+
+// replayCommand replays the statements of a MySQL slow query log or general
+// log against the target, at the original pacing scaled by -speed. String
+// literals can be anonymized and all literals sent as bind parameters;
+// statements are grouped by fingerprint (literals replaced with ?) for the
+// report. Only reads are replayed unless -writes is given.
+func replayCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := fs.String("file", getEnv("BENCHMARK_REPLAY_FILE", ""), "slow query log or general log to replay")
+	format := fs.String("format", "", "log format: slow or general (default: detected)")
+	speed := fs.Float64("speed", 1, "pacing multiplier: 1 = original timing, 2 = twice as fast, 0 = as fast as possible")
+	workers := fs.Int("workers", getEnvAsInt("BENCHMARK_REPLAY_WORKERS", 8), "statements that may run concurrently")
+	anonymize := fs.Bool("anonymize", false, "replace string literals with salted hashes of the same length")
+	salt := fs.String("salt", getEnv("BENCHMARK_REPLAY_SALT", ""), "salt for -anonymize")
+	bind := fs.Bool("bind", false, "send literals as bind parameters instead of inline")
+	writes := fs.Bool("writes", false, "also replay statements that modify data")
+	limit := fs.Int("limit", 0, "replay at most this many statements (0 = all)")
+	jsonPath := fs.String("json", "", `write per-fingerprint statistics as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+	if *speed < 0 {
+		return fmt.Errorf("-speed must not be negative")
+	}
+	if *workers < 1 {
+		return fmt.Errorf("-workers must be at least 1")
+	}
+
+	events, err := readReplayLog(*file, *format)
+	if err != nil {
+		return err
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+
+	// Statements are paced from the first one with a timestamp; those the
+	// log gives none can't be placed on the schedule and are left out.
+	var origin time.Time
+	for _, ev := range events {
+		if !ev.At.IsZero() {
+			origin = ev.At
+			break
+		}
+	}
+	if *speed > 0 && origin.IsZero() {
+		return fmt.Errorf("%s has no timestamps to pace the replay by (use -speed 0)", *file)
+	}
+
+	var stmts []replayStatement
+	skipped, untimed := 0, 0
+	for _, ev := range events {
+		if *speed > 0 && ev.At.IsZero() {
+			untimed++
+			continue
+		}
+		s := prepareReplay(ev, origin, *anonymize, *bind, *salt)
+		if !s.read && !*writes {
+			skipped++
+			continue
+		}
+		s.query = eng.rebind(s.query)
+		stmts = append(stmts, s)
+		if *limit > 0 && len(stmts) == *limit {
+			break
+		}
+	}
+	if untimed > 0 {
+		log.Printf("Warning: skipped %d statements without a timestamp, which can't be paced", untimed)
+	}
+	if len(stmts) == 0 {
+		return fmt.Errorf("no statements to replay (%d skipped as writes)", skipped)
+	}
+	log.Printf("Replaying %d statements from %s (%d writes skipped), speed %gx", len(stmts), *file, skipped, *speed)
+
+	if *workers > config.PoolSize {
+		config.PoolSize = *workers
+	}
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+
+	latencies := make([]time.Duration, len(stmts))
+	lags := make([]time.Duration, len(stmts))
+	errs := make([]error, len(stmts))
+	start := time.Now()
+	elapsed, err := runConcurrent(context.Background(), *workers, len(stmts), func(ctx context.Context, i int) error {
+		s := stmts[i]
+		if *speed > 0 {
+			due := start.Add(time.Duration(float64(s.at) / *speed))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+			lags[i] = time.Since(due)
+		}
+		opStart := time.Now()
+		errs[i] = execReplay(ctx, db, s)
+		latencies[i] = time.Since(opStart)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	classes := summarizeReplay(stmts, latencies, errs)
+	reportReplay(classes, len(stmts), elapsed, summarizeLatency(latencies), summarizeLatency(lags), *speed > 0)
+	if *jsonPath != "" {
+		return writeJSON(*jsonPath, classes)
+	}
+	return nil
+}
+
+func execReplay(ctx context.Context, db *sql.DB, s replayStatement) error {
+	if !s.read {
+		_, err := db.ExecContext(ctx, s.query, s.args...)
+		return err
+	}
+	rows, err := db.QueryContext(ctx, s.query, s.args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+	}
+	err = rows.Err()
+	rows.Close()
+	return err
+}
+
+func summarizeReplay(stmts []replayStatement, latencies []time.Duration, errs []error) []*replayClass {
+	byFingerprint := map[string]*replayClass{}
+	var classes []*replayClass
+	for i, s := range stmts {
+		c := byFingerprint[s.fingerprint]
+		if c == nil {
+			c = &replayClass{Fingerprint: s.fingerprint}
+			byFingerprint[s.fingerprint] = c
+			classes = append(classes, c)
+		}
+		c.Count++
+		c.Total += latencies[i].Nanoseconds()
+		c.samples = append(c.samples, latencies[i])
+		if errs[i] != nil {
+			c.Errors++
+			if c.FirstError == "" {
+				c.FirstError = errs[i].Error()
+			}
+		}
+	}
+	for _, c := range classes {
+		c.Latency = summarizeLatency(c.samples)
+	}
+	sort.SliceStable(classes, func(i, j int) bool { return classes[i].Total > classes[j].Total })
+	return classes
+}
+
+// replayTopClasses is how many fingerprints the log report lists.
+const replayTopClasses = 10
+
+func reportReplay(classes []*replayClass, n int, elapsed time.Duration, latency, lag LatencyStats, paced bool) {
+	failures := 0
+	for _, c := range classes {
+		failures += c.Errors
+	}
+	log.Printf("Replay: %d statements (%d errors, %d fingerprints) in %s, %s statements/s (p50 %s, p95 %s)",
+		n, failures, len(classes), formatDuration(elapsed), formatRate(float64(n)/elapsed.Seconds()), formatDuration(latency.P50), formatDuration(latency.P95))
+	if paced {
+		log.Printf("Replay: start lag behind the original schedule p50 %s, p95 %s, max %s", formatDuration(lag.P50), formatDuration(lag.P95), formatDuration(lag.Max))
+	}
+	for i, c := range classes {
+		if i == replayTopClasses {
+			log.Printf("... %d more fingerprints", len(classes)-replayTopClasses)
+			break
+		}
+		fp := c.Fingerprint
+		if len(fp) > 100 {
+			fp = fp[:97] + "..."
+		}
+		log.Printf("  %6d× total %s p95 %s errors %d  %s", c.Count, formatDuration(time.Duration(c.Total)),
+			formatDuration(c.Latency.P95), c.Errors, fp)
+		if c.FirstError != "" {
+			log.Printf("          first error: %s", c.FirstError)
+		}
+	}
+}
+
+// readOnlyVerbs start statements that don't modify data.
+var readOnlyVerbs = []string{"select", "show", "explain", "describe", "desc", "with"}
+
+func isReadStatement(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	verb := strings.ToLower(strings.TrimLeft(fields[0], "("))
+	for _, v := range readOnlyVerbs {
+		if verb == v {
+			return true
+		}
+	}
+	return false
+}
+
+func prepareReplay(ev replayEvent, origin time.Time, anonymize, bind bool, salt string) replayStatement {
+	s := replayStatement{at: ev.At.Sub(origin)}
+	s.fingerprint = fingerprint(ev.Query)
+	s.read = isReadStatement(s.fingerprint)
+	s.query = rewriteLiterals(ev.Query, func(lit sqlLiteral) string {
+		value := lit.value
+		if lit.quoted && anonymize {
+			value = anonymizeString(value, salt)
+		}
+		if bind {
+			if lit.quoted {
+				s.args = append(s.args, value)
+			} else if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				s.args = append(s.args, n)
+			} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+				s.args = append(s.args, f)
+			} else {
+				s.args = append(s.args, value)
+			}
+			return "?"
+		}
+		if lit.quoted {
+			return "'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(value) + "'"
+		}
+		return value
+	})
+	return s
+}
+
+// anonymizeString maps value to a salted hex hash of the same length, so
+// equal values stay equal and column widths stay realistic.
+func anonymizeString(value, salt string) string {
+	if value == "" {
+		return ""
+	}
+	var b strings.Builder
+	for counter := 0; b.Len() < len(value); counter++ {
+		sum := sha256.Sum256([]byte(salt + "\x00" + strconv.Itoa(counter) + "\x00" + value))
+		b.WriteString(hex.EncodeToString(sum[:]))
+	}
+	return b.String()[:len(value)]
+}
+
+var whitespaceRE = regexp.MustCompile(`\s+`)
+
+// fingerprint normalizes a statement for grouping: literals become ?,
+// whitespace is collapsed and the text lowercased.
+func fingerprint(query string) string {
+	fp := rewriteLiterals(query, func(sqlLiteral) string { return "?" })
+	return strings.ToLower(strings.TrimSpace(whitespaceRE.ReplaceAllString(fp, " ")))
+}
+
+// sqlLiteral is a string or numeric literal found in a statement.
+type sqlLiteral struct {
+	value  string // unescaped string contents, or the number as written
+	quoted bool
+}
+
+var numberRE = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// rewriteLiterals replaces every literal in a MySQL statement with the
+// output of fn. Quoted strings follow MySQL rules (backslash escapes,
+// doubled quotes, "..." as a string); identifiers in backticks and
+// comments are left alone.
+func rewriteLiterals(query string, fn func(sqlLiteral) string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '`':
+			j := strings.IndexByte(query[i+1:], '`')
+			if j < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+j+2])
+			i += j + 2
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+j+4])
+			i += j + 4
+		case c == '\'' || c == '"':
+			var value strings.Builder
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\\' && j+1 < len(query) {
+					value.WriteByte(query[j+1])
+					j += 2
+					continue
+				}
+				if query[j] == c {
+					if j+1 < len(query) && query[j+1] == c {
+						value.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				value.WriteByte(query[j])
+				j++
+			}
+			b.WriteString(fn(sqlLiteral{value: value.String(), quoted: true}))
+			i = j + 1
+		case isIdentByte(c) && (i == 0 || !isIdentByte(query[i-1]) && query[i-1] != '.'):
+			j := i
+			for j < len(query) && (isIdentByte(query[j]) || query[j] == '.' ||
+				(query[j] == '-' || query[j] == '+') && (query[j-1] == 'e' || query[j-1] == 'E') && numberRE.MatchString(query[i:j-1])) {
+				j++
+			}
+			if word := query[i:j]; numberRE.MatchString(word) {
+				b.WriteString(fn(sqlLiteral{value: word}))
+			} else {
+				b.WriteString(word)
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+var generalLogRE = regexp.MustCompile(`^(\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(?:\.\d+)?(?:Z|[+-]\d\d:\d\d)?)\s+\d+\s+(\w+(?: \w+)?)\t?(.*)$`)
+
+func readReplayLog(path, format string) ([]replayEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open replay log: %v", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 1<<20)
+	if format == "" {
+		head, _ := r.Peek(64 << 10)
+		format = "general"
+		if strings.Contains(string(head), "# Query_time:") || strings.Contains(string(head), "# Time:") {
+			format = "slow"
+		}
+	}
+	var events []replayEvent
+	switch format {
+	case "slow":
+		events, err = parseSlowLog(r)
+	case "general":
+		events, err = parseGeneralLog(r)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (expected slow or general)", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %v", path, err)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no statements found in %s", path)
+	}
+	return events, nil
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 64<<20)
+	return sc
+}
+
+// isLogPreamble matches the server banner lines that start each log file
+// and are repeated on restart.
+func isLogPreamble(line string) bool {
+	return strings.Contains(line, ", Version: ") || strings.HasPrefix(line, "Tcp port:") ||
+		strings.HasPrefix(line, "Time ") && strings.Contains(line, "Command")
+}
+
+// parseSlowLog reads the MySQL slow query log format: "# " header lines,
+// SET timestamp/use statements, then the statement terminated by ";".
+// An entry's SET timestamp stands in for a "# Time:" line that is missing
+// or in a format without a date we parse, such as MySQL 5.6's and
+// MariaDB's "# Time: 160908 10:11:12"; entries with neither inherit the
+// previous entry's time.
+func parseSlowLog(r io.Reader) ([]replayEvent, error) {
+	var events []replayEvent
+	var at time.Time
+	timed := false // whether the current entry's "# Time:" line parsed
+	var stmt strings.Builder
+	sc := newLineScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "# Time: "):
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(line[len("# Time: "):])); err == nil {
+				at, timed = t, true
+			}
+			continue
+		case strings.HasPrefix(line, "#") || isLogPreamble(line):
+			continue
+		case stmt.Len() == 0 && strings.HasPrefix(line, "SET timestamp="):
+			if secs, err := strconv.ParseInt(strings.TrimSuffix(line[len("SET timestamp="):], ";"), 10, 64); err == nil && !timed {
+				at = time.Unix(secs, 0)
+			}
+			continue
+		case stmt.Len() == 0 && strings.HasPrefix(strings.ToLower(line), "use "):
+			continue
+		}
+		if stmt.Len() > 0 {
+			stmt.WriteByte('\n')
+		}
+		stmt.WriteString(line)
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			query := strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";")
+			events = append(events, replayEvent{At: at, Query: query})
+			stmt.Reset()
+			timed = false
+		}
+	}
+	return events, sc.Err()
+}
+
+// parseGeneralLog reads the MySQL general query log, keeping Query and
+// Execute commands; lines without a timestamp continue the previous one.
+func parseGeneralLog(r io.Reader) ([]replayEvent, error) {
+	var events []replayEvent
+	inQuery := false
+	sc := newLineScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if isLogPreamble(line) {
+			continue
+		}
+		m := generalLogRE.FindStringSubmatch(line)
+		if m == nil {
+			if inQuery {
+				events[len(events)-1].Query += "\n" + line
+			}
+			continue
+		}
+		inQuery = m[2] == "Query" || m[2] == "Execute"
+		if !inQuery {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339Nano, m[1])
+		if err != nil {
+			at, _ = time.Parse("2006-01-02T15:04:05.999999999", m[1])
+		}
+		events = append(events, replayEvent{At: at, Query: m[3]})
+	}
+	return events, sc.Err()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// renderMarkdown produces a compact summary table suitable for PR comments
+// and the GitHub Actions job summary. When comparisons are given (assert),
+// a regression status column is added.
+func renderMarkdown(target string, results []Result, comparisons []comparison, runErr error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Database benchmark: `%s`\n\n", target)
+	if runErr != nil {
+		fmt.Fprintf(&b, "> :x: **Run failed:** %s\n\n", strings.ReplaceAll(runErr.Error(), "\n", " "))
+	}
+	if comparisons != nil {
+		if n := regressions(comparisons); n > 0 {
+			fmt.Fprintf(&b, "> :rotating_light: **%d of %d strategies regressed against the baseline.**\n\n", n, len(comparisons))
+		} else {
+			b.WriteString("> :white_check_mark: All strategies within baseline thresholds.\n\n")
+		}
+	}
+	var skipped []Result
+	for _, r := range results {
+		if r.Skipped != "" {
+			skipped = append(skipped, r)
+		}
+	}
+	if len(results) == len(skipped) {
+		b.WriteString("_No strategies completed._\n")
+		b.WriteString(renderSkipped(skipped))
+		return b.String()
+	}
+
+	status := map[string]string{}
+	for _, c := range comparisons {
+		switch {
+		case c.Regressed:
+			status[c.Strategy] = ":x: " + c.Reason
+		case c.Reason != "":
+			status[c.Strategy] = ":new: " + c.Reason
+		default:
+			status[c.Strategy] = fmt.Sprintf(":white_check_mark: %+.1f%% rows/s, %+.1f%% p95", c.ThroughputChange, c.LatencyChange)
+			if c.Significance != nil {
+				status[c.Strategy] += ", " + c.Significance.String()
+			}
+		}
+		if n := len(c.PlanChanges); n > 0 {
+			status[c.Strategy] += fmt.Sprintf(", :warning: %d plan changes", n)
+		}
+	}
+
+	retries := false
+	for _, r := range results {
+		retries = retries || r.Transactions > 0
+	}
+
+	b.WriteString("| Strategy | Rows | Duration | Rows/s | p50 | p95 |")
+	if retries {
+		b.WriteString(" Retries/tx |")
+	}
+	if comparisons != nil {
+		b.WriteString(" vs. baseline |")
+	}
+	b.WriteString("\n|---|--:|--:|--:|--:|--:|")
+	if retries {
+		b.WriteString("--:|")
+	}
+	if comparisons != nil {
+		b.WriteString("---|")
+	}
+	b.WriteString("\n")
+	for _, r := range results {
+		if r.Skipped != "" {
+			continue
+		}
+		fmt.Fprintf(&b, "| `%s` | %d | %s | %s | %s | %s |", r.Strategy, r.Rows, formatDuration(r.Duration),
+			formatRate(r.RowsPerSec()), formatDuration(r.Latency.P50), formatDuration(r.Latency.P95))
+		if retries {
+			fmt.Fprintf(&b, " %.2f |", r.RetryRate())
+		}
+		if comparisons != nil {
+			fmt.Fprintf(&b, " %s |", status[r.Strategy])
+		}
+		b.WriteString("\n")
+	}
+	for _, c := range comparisons {
+		if c.Current == nil {
+			fmt.Fprintf(&b, "| `%s` | – | – | – | – | – |", c.Strategy)
+			if retries {
+				b.WriteString(" – |")
+			}
+			fmt.Fprintf(&b, " :x: %s |\n", c.Reason)
+		}
+	}
+	b.WriteString(renderSkipped(skipped))
+	b.WriteString(renderSignificance(results))
+	b.WriteString(renderPlanChanges(comparisons))
+	b.WriteString(renderPlans(results))
+	b.WriteString(renderServerTimes(results))
+	b.WriteString(renderTopStatements(results))
+	b.WriteString(renderHostMetrics(results))
+	b.WriteString(renderCosts(results))
+	return b.String()
+}
+
+// renderSkipped lists the strategies skipped as the target can't run them.
+func renderSkipped(skipped []Result) string {
+	if len(skipped) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\nSkipped, as the target can't run them:\n\n")
+	for _, r := range skipped {
+		fmt.Fprintf(&b, "- `%s`: %s\n", r.Strategy, strings.ReplaceAll(r.Skipped, "\n", " "))
+	}
+	return b.String()
+}
+
+// writeMarkdown writes md to path, where "-" means stdout. The GitHub step
+// summary file is shared by every step in a job, so it is appended to.
+func writeMarkdown(path, md string, appendTo bool) error {
+	md = redact(md)
+	if path == "-" {
+		_, err := fmt.Print(md)
+		return err
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendTo {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(md + "\n"); err != nil {
+		return fmt.Errorf("write %s: %v", path, err)
+	}
+	return nil
+}
+
+// writeJSON writes v as indented JSON to path, where "-" means stdout.
+func writeJSON(path string, v any) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode %s: %v", path, err)
+	}
+	out = append([]byte(redact(string(out))), '\n')
+	if path == "-" {
+		_, err := os.Stdout.Write(out)
+		return err
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		return fmt.Errorf("write %s: %v", path, err)
+	}
+	return nil
+}
+
+// publishMarkdown emits the summary wherever the user asked for it.
+func publishMarkdown(markdownPath string, githubSummary bool, md string) error {
+	if markdownPath != "" {
+		if err := writeMarkdown(markdownPath, md, false); err != nil {
+			return err
+		}
+	}
+	if githubSummary {
+		path := os.Getenv("GITHUB_STEP_SUMMARY")
+		if path == "" {
+			return fmt.Errorf("-github-summary set but GITHUB_STEP_SUMMARY is not defined")
+		}
+		if err := writeMarkdown(path, md, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "retention",
+		Description: "Inserting while a retention job deletes old rows in batches",
+		Params: []Param{
+			{Name: "retention.keep", Default: "5s", Description: "age after which rows are purged"},
+			{Name: "retention.every", Default: "1s", Description: "pause between two purge passes"},
+			{Name: "retention.batch", Default: "1000", Description: "rows each DELETE removes at most"},
+			{Name: "retention.workers", Default: "4", Description: "concurrent inserters"},
+		},
+		Workload: workloadRetention,
+		Table:    "benchmark_events",
+		Schema: func(e *engine, table string) string {
+			return e.createTable(table, []column{
+				{Name: "id", Type: typeBigInt, NotNull: true},
+				{Name: "created_at", Type: typeBigInt, NotNull: true},
+				{Name: "payload", Type: typeVarchar, Size: 255, NotNull: true},
+			}, "id")
+		},
+		Run: insertUnderRetention,
+	})
+}
+
+// retentionPurge is what the purge job did.
+type retentionPurge struct {
+	passes, deleted int
+	latency         []time.Duration // per DELETE
+}
+
+// insertUnderRetention inserts events from retention.workers while a purge
+// job wakes every retention.every and deletes the events older than
+// retention.keep, retention.batch rows per statement by primary key range
+// until none are left: the usual way to bound both the table and the
+// length of the delete transactions. Deleting leaves the engine garbage to
+// collect (InnoDB purge, Postgres vacuum) while it keeps taking writes,
+// and that interaction is what is measured: Metrics compare the insert
+// p99 while a pass is running against the rest as purging_p99_ns and
+// idle_p99_ns, and report the rows deleted and the DELETE latency. Rows
+// counts inserted events; created_at is Unix milliseconds.
+func insertUnderRetention(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	workers := opts.intParam("retention.workers", 4)
+	batch := opts.intParam("retention.batch", 1000)
+	if workers < 1 || batch < 1 {
+		return Result{}, fmt.Errorf("retention.workers and retention.batch must be at least 1")
+	}
+	var keep, every time.Duration
+	for _, p := range []struct {
+		name, def string
+		d         *time.Duration
+	}{{"retention.keep", "5s", &keep}, {"retention.every", "1s", &every}} {
+		d, err := time.ParseDuration(opts.param(p.name, p.def))
+		if err != nil || d <= 0 {
+			return Result{}, fmt.Errorf("%s: invalid duration %q", p.name, opts.param(p.name, p.def))
+		}
+		*p.d = d
+	}
+	// Some engines return no row rather than NULL for an empty table.
+	var last sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT MAX(id) FROM "+opts.table()).Scan(&last); err != nil && err != sql.ErrNoRows {
+		return Result{}, fmt.Errorf("find last id: %v", err)
+	}
+
+	var purging atomic.Bool
+	purgeCtx, stopPurge := context.WithCancel(ctx)
+	defer stopPurge()
+	var purge retentionPurge
+	var purgeErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		purge, purgeErr = runRetentionPurge(purgeCtx, db, opts, keep, every, batch, &purging)
+	}()
+
+	insert := opts.bind("INSERT INTO " + opts.table() + " (id, created_at, payload) VALUES (?, ?, ?)")
+	var (
+		claimed      atomic.Int64
+		mu           sync.Mutex
+		idle, during []time.Duration
+		rec          latencyRecorder
+	)
+	claimed.Store(last.Int64)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		var localIdle, localDuring []time.Duration
+		defer func() {
+			mu.Lock()
+			idle, during = append(idle, localIdle...), append(during, localDuring...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			id := claimed.Add(1)
+			if opts.done(int(id-last.Int64)-1, start) {
+				return nil
+			}
+			wasPurging := purging.Load()
+			opStart := time.Now()
+			if _, err := db.ExecContext(ctx, insert, id, opStart.UnixMilli(), fmt.Sprintf("event %d", id)); err != nil {
+				return fmt.Errorf("insert error: %v", err)
+			}
+			d := time.Since(opStart)
+			if wasPurging || purging.Load() {
+				localDuring = append(localDuring, d)
+			} else {
+				localIdle = append(localIdle, d)
+			}
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+		}
+		return nil
+	})
+	elapsed := time.Since(start)
+	stopPurge()
+	wg.Wait()
+	if err != nil {
+		return Result{}, err
+	}
+	if purgeErr != nil {
+		return Result{}, fmt.Errorf("purge: %v", purgeErr)
+	}
+
+	result := rec.result(len(idle)+len(during), elapsed)
+	deletes := summarizeLatency(purge.latency)
+	result.Metrics = map[string]float64{
+		"purge_passes":    float64(purge.passes),
+		"deleted_rows":    float64(purge.deleted),
+		"delete_p50_ns":   float64(deletes.P50.Nanoseconds()),
+		"delete_p99_ns":   float64(deletes.P99.Nanoseconds()),
+		"purging_inserts": float64(len(during)),
+		"idle_p99_ns":     float64(summarizeLatency(idle).P99.Nanoseconds()),
+		"purging_p99_ns":  float64(summarizeLatency(during).P99.Nanoseconds()),
+	}
+	log.Printf("retention: %d purge passes deleted %d rows (DELETE p50 %s, p99 %s); insert p99 %s while purging, %s otherwise",
+		purge.passes, purge.deleted, formatDuration(deletes.P50), formatDuration(deletes.P99), formatDuration(summarizeLatency(during).P99), formatDuration(summarizeLatency(idle).P99))
+	return result, nil
+}
+
+// runRetentionPurge runs a purge pass every every until ctx ends, setting
+// purging while one runs. A pass deletes the rows older than keep from
+// the lowest id up, batch ids at a time, until the oldest row left is
+// younger.
+func runRetentionPurge(ctx context.Context, db *sql.DB, opts RunOptions, keep, every time.Duration, batch int, purging *atomic.Bool) (retentionPurge, error) {
+	var p retentionPurge
+	// Ids grow with created_at, so the oldest row is the lowest id, which
+	// the primary key finds without scanning.
+	oldest := opts.bind("SELECT id, created_at FROM " + opts.table() + " ORDER BY id " + opts.Engine.limit(1))
+	del := opts.bind("DELETE FROM " + opts.table() + " WHERE id >= ? AND id < ? AND created_at < ?")
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return p, nil
+		case <-ticker.C:
+		}
+		purging.Store(true)
+		p.passes++
+		cutoff := time.Now().Add(-keep).UnixMilli()
+		for ctx.Err() == nil {
+			var from, created int64
+			err := db.QueryRowContext(ctx, oldest).Scan(&from, &created)
+			if err == sql.ErrNoRows || err == nil && created >= cutoff {
+				break
+			}
+			if err != nil {
+				purging.Store(false)
+				return p, ignoreCanceled(ctx, fmt.Errorf("find oldest row: %v", err))
+			}
+			opStart := time.Now()
+			res, err := db.ExecContext(ctx, del, from, from+int64(batch), cutoff)
+			if err != nil {
+				purging.Store(false)
+				return p, ignoreCanceled(ctx, fmt.Errorf("delete error: %v", err))
+			}
+			p.latency = append(p.latency, time.Since(opStart))
+			n, _ := res.RowsAffected()
+			p.deleted += int(n)
+		}
+		purging.Store(false)
+	}
+}
+
+// ignoreCanceled drops err if ctx ended, which interrupts the statement
+// running at the time.
+func ignoreCanceled(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "tx-rollback",
+		Description: "Using concurrent transactions of which a fraction roll back",
+		Params: append([]Param{
+			{Name: "rollback.rates", Default: "0/10/50", Description: "slash-separated percentages of transactions that roll back instead of committing, run one after another"},
+			{Name: "rollback.tx_rows", Default: "10", Description: "rows inserted per transaction"},
+			{Name: "rollback.workers", Default: "4", Description: "concurrent transactions"},
+			{Name: "rollback.seed", Default: "1", Description: "seed for choosing which transactions roll back"},
+		}, dataParams...),
+		Workload: workloadTxInsert,
+		Run:      insertWithRollbacks,
+	})
+}
+
+// rollbackPhase is the outcome of running one rollback rate.
+type rollbackPhase struct {
+	rows, committedRows int
+	elapsed             time.Duration
+	latency             []time.Duration // per transaction
+	commits, rollbacks  []time.Duration // the final COMMIT or ROLLBACK
+}
+
+// insertWithRollbacks runs rollback.workers workers inserting
+// rollback.tx_rows rows per transaction, once per rate in rollback.rates,
+// splitting Rows and Duration between the rates. At rate r, r percent of
+// the transactions roll back after their inserts, like requests failing
+// validation late. Rows counts attempted inserts; latency samples are
+// whole transactions. Metrics report per rate the committed rows per
+// second, which is what rollbacks cost everyone else, and the p50 of
+// COMMIT and ROLLBACK themselves, e.g. rb10_committed_rows_per_sec and
+// rb10_rollback_p50_ns.
+func insertWithRollbacks(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	var rates []float64
+	for _, v := range opts.listParam("rollback.rates", "0/10/50") {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 100 {
+			return Result{}, fmt.Errorf("rollback.rates: %q is not a percentage", v)
+		}
+		rates = append(rates, rate)
+	}
+	if len(rates) == 0 {
+		return Result{}, fmt.Errorf("rollback.rates is empty")
+	}
+	txRows := opts.intParam("rollback.tx_rows", 10)
+	workers := opts.intParam("rollback.workers", 4)
+	if txRows < 1 || workers < 1 {
+		return Result{}, fmt.Errorf("rollback.tx_rows and rollback.workers must be at least 1")
+	}
+	seed := int64(opts.intParam("rollback.seed", 1))
+	phaseOpts := opts.phase(len(rates))
+
+	var rec latencyRecorder
+	var total time.Duration
+	rows, txs, rollbacks := 0, 0, 0
+	metrics := map[string]float64{}
+	first := 0
+	for _, rate := range rates {
+		p, err := runRollbackPhase(ctx, db, phaseOpts, rate, txRows, workers, seed, first, &rec)
+		if err != nil {
+			return Result{}, fmt.Errorf("%g%% rollbacks: %v", rate, err)
+		}
+		first += p.rows
+		rows += p.rows
+		total += p.elapsed
+		txs += len(p.latency)
+		rollbacks += len(p.rollbacks)
+
+		key := "rb" + strconv.FormatFloat(rate, 'f', -1, 64) + "_"
+		commitStats, rollbackStats := summarizeLatency(p.commits), summarizeLatency(p.rollbacks)
+		committedPerSec := float64(p.committedRows) / p.elapsed.Seconds()
+		metrics[key+"committed_rows_per_sec"] = committedPerSec
+		metrics[key+"tx_per_sec"] = float64(len(p.latency)) / p.elapsed.Seconds()
+		metrics[key+"commit_p50_ns"] = float64(commitStats.P50.Nanoseconds())
+		metrics[key+"rollback_p50_ns"] = float64(rollbackStats.P50.Nanoseconds())
+		log.Printf("tx-rollback: %g%% rollbacks: %d transactions, %d rolled back, %s committed rows/s (p50 commit %s, rollback %s)",
+			rate, len(p.latency), len(p.rollbacks), formatRate(committedPerSec), formatDuration(commitStats.P50), formatDuration(rollbackStats.P50))
+	}
+
+	result := rec.result(rows, total)
+	result.Transactions = txs
+	metrics["rollbacks"] = float64(rollbacks)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// runRollbackPhase runs transactions from workers until opts is done,
+// rolling back rate percent of them and observing each in rec as it
+// finishes.
+func runRollbackPhase(ctx context.Context, db *sql.DB, opts RunOptions, rate float64, txRows, workers int, seed int64, first int, rec *latencyRecorder) (rollbackPhase, error) {
+	var claimed, committed int64
+	var mu sync.Mutex
+	perWorker := make([]rollbackPhase, workers)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		gen := opts.rowGen("Rollback")
+		p := &perWorker[w]
+		for {
+			n := txRows
+			from := int(atomic.AddInt64(&claimed, int64(n))) - n
+			if opts.Rows > 0 && from+n > opts.Rows {
+				n = opts.Rows - from
+			}
+			if n <= 0 || (opts.Duration > 0 && time.Since(start) >= opts.Duration) {
+				return nil
+			}
+			rollback := rng.Float64()*100 < rate
+			txStart := time.Now()
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return fmt.Errorf("begin transaction error: %v", err)
+			}
+			for i := from; i < from+n; i++ {
+				name, email := gen.row(first + i)
+				if _, err := tx.ExecContext(ctx, opts.insertSQL(), name, email); err != nil {
+					tx.Rollback()
+					return fmt.Errorf("tx exec error: %v", err)
+				}
+			}
+			finish := time.Now()
+			if rollback {
+				if err := tx.Rollback(); err != nil {
+					return fmt.Errorf("rollback error: %v", err)
+				}
+				p.rollbacks = append(p.rollbacks, time.Since(finish))
+			} else {
+				if err := tx.Commit(); err != nil {
+					return fmt.Errorf("commit error: %v", err)
+				}
+				p.commits = append(p.commits, time.Since(finish))
+				atomic.AddInt64(&committed, int64(n))
+			}
+			d := time.Since(txStart)
+			p.latency = append(p.latency, d)
+			p.rows += n
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+		}
+	})
+	phase := rollbackPhase{elapsed: time.Since(start), committedRows: int(committed)}
+	for _, p := range perWorker {
+		phase.rows += p.rows
+		phase.latency = append(phase.latency, p.latency...)
+		phase.commits = append(phase.commits, p.commits...)
+		phase.rollbacks = append(phase.rollbacks, p.rollbacks...)
+	}
+	return phase, err
+}
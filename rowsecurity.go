@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rowSecurityTable holds the rows of the tenants the row-security strategy
+// reads, some of them owned by the benchmark's own user.
+const rowSecurityTable = "benchmark_tenant_rows"
+
+// rowSecuritySQL is how one engine restricts reads to the connected user's
+// rows. Statements take %[1]s for the table.
+type rowSecuritySQL struct {
+	User     string   // selecting the tenant name of the connected user
+	Setup    []string // securing the table
+	Teardown []string // undoing Setup
+	Secured  string   // the relation the secured reads select from
+}
+
+// rowSecurityDialects are the engines with a way to filter rows by user.
+// MySQL has no row-level security, so the usual substitute is an invoker's
+// view filtering on CURRENT_USER(); CockroachDB has PostgreSQL-style
+// policies, forced so that they apply to the table's owner too.
+var rowSecurityDialects = map[string]rowSecuritySQL{
+	"mysql": mysqlRowSecurity,
+	"tidb":  mysqlRowSecurity,
+	"cockroach": {
+		User: "SELECT current_user",
+		Setup: []string{
+			"DROP POLICY IF EXISTS benchmark_tenant ON %[1]s",
+			"CREATE POLICY benchmark_tenant ON %[1]s USING (tenant = current_user)",
+			"ALTER TABLE %[1]s ENABLE ROW LEVEL SECURITY",
+			"ALTER TABLE %[1]s FORCE ROW LEVEL SECURITY",
+		},
+		Teardown: []string{
+			"ALTER TABLE %[1]s NO FORCE ROW LEVEL SECURITY",
+			"ALTER TABLE %[1]s DISABLE ROW LEVEL SECURITY",
+			"DROP POLICY IF EXISTS benchmark_tenant ON %[1]s",
+		},
+		Secured: "%[1]s",
+	},
+}
+
+var mysqlRowSecurity = rowSecuritySQL{
+	User: "SELECT SUBSTRING_INDEX(CURRENT_USER(), '@', 1)",
+	Setup: []string{
+		"CREATE OR REPLACE SQL SECURITY INVOKER VIEW %[1]s_secured AS " +
+			"SELECT id, tenant, payload FROM %[1]s WHERE tenant = SUBSTRING_INDEX(CURRENT_USER(), '@', 1)",
+	},
+	Teardown: []string{"DROP VIEW IF EXISTS %[1]s_secured"},
+	Secured:  "%[1]s_secured",
+}
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "row-security",
+		Description: "Point reads filtered by tenant in the query, then by a view or row-level security policy",
+		Engines:     []string{"mysql", "tidb", "cockroach"},
+		Params: []Param{
+			{Name: "rls.rows", Default: "10000", Description: "rows in the table"},
+			{Name: "rls.tenants", Default: "10", Description: "tenants the rows are spread over; one of them is the connected user"},
+			{Name: "rls.workers", Default: "8", Description: "concurrent workers"},
+			{Name: "rls.seed", Default: "1", Description: "seed for choosing rows"},
+		},
+		Read:     true,
+		Workload: workloadPointRead,
+		Table:    rowSecurityTable,
+		Schema: func(e *engine, table string) string {
+			return e.createTable(table, []column{
+				{Name: "id", Type: typeBigInt, NotNull: true},
+				{Name: "tenant", Type: typeVarchar, Size: 64, NotNull: true},
+				{Name: "payload", Type: typeVarchar, Size: 255},
+			}, "id")
+		},
+		Run: compareRowSecurity,
+	})
+}
+
+// compareRowSecurity runs the same point reads of random rows twice,
+// splitting Rows and Duration between the phases: first with the tenant
+// filter in every query, as an application enforcing authorization itself
+// would, then without it through the engine's row filtering (see
+// rowSecurityDialects), which the phase sets up and tears down again. The
+// rows are spread over rls.tenants tenants, so most reads find another
+// tenant's row and return nothing either way. Metrics report both phases'
+// throughput, p50 and p99 and the secured phase's p99 overhead. If every
+// secured read found its row the filtering isn't in effect for the user,
+// e.g. because it is an admin that bypasses policies, and the run fails.
+// Rows counts reads.
+func compareRowSecurity(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	rs := rowSecurityDialects[opts.Engine.Name]
+	n := opts.intParam("rls.rows", 10000)
+	tenants := opts.intParam("rls.tenants", 10)
+	workers := opts.intParam("rls.workers", 8)
+	if n < 1 || tenants < 1 || workers < 1 {
+		return Result{}, fmt.Errorf("rls.rows, rls.tenants and rls.workers must be at least 1")
+	}
+	var user string
+	if err := db.QueryRowContext(ctx, rs.User).Scan(&user); err != nil {
+		return Result{}, fmt.Errorf("read current user: %v", err)
+	}
+	if err := fillTenantRows(ctx, db, opts, user, n, tenants); err != nil {
+		return Result{}, err
+	}
+	phaseOpts := opts.phase(2)
+
+	var rec latencyRecorder
+	plans := opts.planRecorder()
+	filtered, err := runTenantReads(ctx, db, phaseOpts,
+		opts.bind("SELECT payload FROM "+opts.table()+" WHERE tenant = ? AND id = ?"), []any{user}, n, workers, &rec, plans)
+	if err != nil {
+		return Result{}, fmt.Errorf("filtered reads: %v", err)
+	}
+	if err := execRowSecurity(ctx, db, opts, rs.Setup); err != nil {
+		execRowSecurity(ctx, db, opts, rs.Teardown)
+		return Result{}, fmt.Errorf("set up row security: %v", err)
+	}
+	secured, err := runTenantReads(ctx, db, phaseOpts,
+		opts.bind("SELECT payload FROM "+fmt.Sprintf(rs.Secured, opts.table())+" WHERE id = ?"), nil, n, workers, &rec, plans)
+	if tErr := execRowSecurity(ctx, db, opts, rs.Teardown); tErr != nil {
+		log.Printf("Warning: row-security: could not tear down row security on %s: %v", opts.table(), tErr)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("secured reads: %v", err)
+	}
+	if tenants > 1 && secured.reads > 0 && secured.matched == secured.reads {
+		return Result{}, fmt.Errorf("secured reads returned every row; %s bypasses the row security of %s", user, opts.table())
+	}
+
+	result := rec.result(filtered.reads+secured.reads, filtered.elapsed+secured.elapsed)
+	result.Plans = plans.plans
+	f, s := summarizeLatency(filtered.latency), summarizeLatency(secured.latency)
+	result.Metrics = map[string]float64{
+		"filtered_ops_per_sec": float64(filtered.reads) / filtered.elapsed.Seconds(),
+		"secured_ops_per_sec":  float64(secured.reads) / secured.elapsed.Seconds(),
+		"filtered_p50_ns":      float64(f.P50.Nanoseconds()),
+		"secured_p50_ns":       float64(s.P50.Nanoseconds()),
+		"filtered_p99_ns":      float64(f.P99.Nanoseconds()),
+		"secured_p99_ns":       float64(s.P99.Nanoseconds()),
+	}
+	if f.P99 > 0 {
+		result.Metrics["secured_p99_increase_pct"] = 100 * float64(s.P99-f.P99) / float64(f.P99)
+	}
+	log.Printf("row-security: %s reads/s (p50 %s) filtered in the query, %s reads/s (p50 %s) filtered by the engine",
+		formatRate(result.Metrics["filtered_ops_per_sec"]), formatDuration(f.P50), formatRate(result.Metrics["secured_ops_per_sec"]), formatDuration(s.P50))
+	return result, nil
+}
+
+// tenantReads is what one phase of the row security comparison measured.
+type tenantReads struct {
+	reads, matched int
+	elapsed        time.Duration
+	latency        []time.Duration
+}
+
+// fillTenantRows replaces the table's rows with n rows, every tenants-th
+// one owned by user and the others by made-up tenants.
+func fillTenantRows(ctx context.Context, db *sql.DB, opts RunOptions, user string, n, tenants int) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM "+opts.table()); err != nil {
+		return fmt.Errorf("reset %s: %v", opts.table(), err)
+	}
+	for i := 0; i < n; {
+		end := min(i+opts.batchSize(), n)
+		var args []any
+		for ; i < end; i++ {
+			tenant := user
+			if k := i % tenants; k > 0 {
+				tenant = fmt.Sprintf("tenant_%d", k)
+			}
+			args = append(args, i, tenant, fmt.Sprintf("payload %d", i))
+		}
+		query := "INSERT INTO " + opts.table() + " (id, tenant, payload) VALUES " +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", len(args)/3), ", ")
+		if _, err := db.ExecContext(ctx, opts.bind(query), args...); err != nil {
+			return fmt.Errorf("insert error: %v", err)
+		}
+	}
+	return nil
+}
+
+// runTenantReads reads random rows with query until opts is done, passing
+// filter's arguments before the id and observing each read in rec as it
+// finishes. The query's plan is captured in plans first.
+func runTenantReads(ctx context.Context, db *sql.DB, opts RunOptions, query string, filter []any, n, workers int, rec *latencyRecorder, plans *planRecorder) (tenantReads, error) {
+	seed := int64(opts.intParam("rls.seed", 1))
+	plans.capture(ctx, db, query, append(filter[:len(filter):len(filter)], 0)...)
+	var (
+		claimed atomic.Int64
+		mu      sync.Mutex
+		p       tenantReads
+	)
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		var local tenantReads
+		defer func() {
+			mu.Lock()
+			p.reads += local.reads
+			p.matched += local.matched
+			p.latency = append(p.latency, local.latency...)
+			mu.Unlock()
+		}()
+		for ctx.Err() == nil {
+			if opts.done(int(claimed.Add(1))-1, start) {
+				return nil
+			}
+			opStart := time.Now()
+			m, err := countRows(ctx, db, query, append(filter[:len(filter):len(filter)], rng.Intn(n))...)
+			if err != nil {
+				return fmt.Errorf("read error: %v", err)
+			}
+			d := time.Since(opStart)
+			local.latency = append(local.latency, d)
+			local.reads++
+			mu.Lock()
+			rec.observe(d)
+			mu.Unlock()
+			local.matched += m
+		}
+		return nil
+	})
+	p.elapsed = time.Since(start)
+	return p, err
+}
+
+// execRowSecurity runs the statements against the table, stopping at the
+// first error.
+func execRowSecurity(ctx context.Context, db *sql.DB, opts RunOptions, statements []string) error {
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(stmt, opts.table())); err != nil {
+			return fmt.Errorf("%s: %v", fmt.Sprintf(stmt, opts.table()), err)
+		}
+	}
+	return nil
+}
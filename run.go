@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// runFlags are the options shared by every command that executes the
+// strategy sequence (run, record-baseline, assert).
+type runFlags struct {
+	fs *flag.FlagSet
+
+	profile       string
+	rows          int
+	duration      time.Duration
+	soak          bool
+	soakInterval  time.Duration
+	webhook       string
+	webhookFormat string
+	markdown      string
+	githubSummary bool
+	benchstat     string
+	count         int
+	batchSize     int
+	params        string
+	sharedTable   bool
+	explain       string
+	resultsDir    string
+	signKey       string
+	hook          measuredHook
+	hooks         phaseHooks
+	coldCache     bool
+	coldCommand   string
+	rate          float64
+	controlFile   string
+	serverTime    bool
+	topStatements int
+	hostMetrics   string
+	hostDisks     string
+	eventLog      string
+	maxRuntime    time.Duration
+	only          string
+	skip          string
+	order         string
+	quiet         bool
+	verbose       bool
+	debug         bool
+	instanceType  string
+	pricing       string
+	hourlyCost    float64
+	watts         float64
+	probe         bool
+	preflight     bool
+	heatmap       string
+	trace         string
+	faults        float64
+	faultKinds    string
+	auto          autoIterations
+	autoEnabled   bool
+	// extraParams are set by callers without a command line, such as
+	// batch, over those of -param.
+	extraParams map[string]string
+}
+
+func newRunFlags(name string) *runFlags {
+	f := &runFlags{fs: flag.NewFlagSet(name, flag.ExitOnError)}
+	fs := f.fs
+	fs.StringVar(&f.profile, "profile", getEnv("BENCHMARK_PROFILE", ""), "named run profile: smoke, standard or soak")
+	fs.IntVar(&f.rows, "n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000), "rows to insert per strategy (0 = bounded by -duration only)")
+	fs.DurationVar(&f.duration, "duration", getEnvAsDuration("BENCHMARK_DURATION", 0), "maximum time per strategy, or total time with -soak (0 = unbounded)")
+	fs.BoolVar(&f.soak, "soak", getEnvAsBool("BENCHMARK_SOAK", false), "cycle through strategies for -duration with leak detection")
+	fs.DurationVar(&f.soakInterval, "soak-interval", getEnvAsDuration("BENCHMARK_SOAK_INTERVAL", time.Minute), "resource sampling interval in soak mode")
+	fs.StringVar(&f.webhook, "webhook", getEnv("BENCHMARK_WEBHOOK_URL", ""), "URL to POST a run summary to when the run finishes")
+	fs.StringVar(&f.webhookFormat, "webhook-format", getEnv("BENCHMARK_WEBHOOK_FORMAT", "slack"), "webhook payload format: slack (text only) or json")
+	fs.StringVar(&f.markdown, "markdown", getEnv("BENCHMARK_MARKDOWN", ""), `write a Markdown summary table to this file ("-" for stdout)`)
+	fs.BoolVar(&f.githubSummary, "github-summary", getEnvAsBool("BENCHMARK_GITHUB_SUMMARY", false), "append the Markdown summary to $GITHUB_STEP_SUMMARY")
+	fs.StringVar(&f.benchstat, "benchstat", getEnv("BENCHMARK_BENCHSTAT", ""), `write results in Go benchmark format for benchstat to this file ("-" for stdout)`)
+	fs.DurationVar(&f.maxRuntime, "max-runtime", getEnvAsDuration("BENCHMARK_MAX_RUNTIME", 0), "stop the whole run after this long and report the strategies that completed (0 = unbounded)")
+	fs.StringVar(&f.only, "only", getEnv("BENCHMARK_ONLY", ""), "comma-separated strategies to run, by name or pattern such as pool-* (default: all)")
+	fs.StringVar(&f.skip, "skip", getEnv("BENCHMARK_SKIP", ""), "comma-separated strategies not to run, by name or pattern")
+	fs.StringVar(&f.order, "order", getEnv("BENCHMARK_ORDER", ""), "comma-separated strategies to run first, in this order, ahead of the rest")
+	fs.BoolVar(&f.preflight, "preflight", getEnvAsBool("BENCHMARK_PREFLIGHT", true), "check before any work starts that the user has SELECT, INSERT, CREATE and DROP on the database, naming those missing")
+	fs.BoolVar(&f.probe, "probe", getEnvAsBool("BENCHMARK_PROBE", true), "probe the target's version and features first and skip the strategies it can't run instead of failing on them")
+	fs.BoolVar(&f.autoEnabled, "auto", getEnvAsBool("BENCHMARK_AUTO", false), "size each strategy's rows like go test sizes b.N, growing them until a run lasts -auto-time and meets -auto-ci, instead of a fixed -n")
+	fs.DurationVar(&f.auto.MinTime, "auto-time", getEnvAsDuration("BENCHMARK_AUTO_TIME", time.Second), "with -auto, how long each strategy's measured run must last at least")
+	fs.Float64Var(&f.auto.CI, "auto-ci", getEnvAsFloat("BENCHMARK_AUTO_CI", 0), "with -auto, the 95% confidence interval of the mean latency each run must reach, in percent of the mean (0 = duration only)")
+	fs.IntVar(&f.auto.MaxRows, "auto-max-rows", getEnvAsInt("BENCHMARK_AUTO_MAX_ROWS", 10000000), "with -auto, the most rows a strategy is grown to")
+	fs.IntVar(&f.count, "count", getEnvAsInt("BENCHMARK_COUNT", 1), "repeat the strategy sequence this many times")
+	fs.IntVar(&f.batchSize, "batch-size", getEnvAsInt("BENCHMARK_BATCH_SIZE", defaultBatchSize), "rows per round trip for batching strategies")
+	fs.StringVar(&f.params, "param", getEnv("BENCHMARK_PARAMS", ""), "comma-separated strategy parameters, name=value")
+	fs.StringVar(&f.explain, "explain", getEnv("BENCHMARK_EXPLAIN", ""), "capture query plans of read strategies: plan (EXPLAIN) or analyze (EXPLAIN ANALYZE)")
+	fs.StringVar(&f.resultsDir, "results-dir", getEnv("BENCHMARK_RESULTS_DIR", ""), "also save the run to the results store in this directory, as browsed by serve")
+	fs.StringVar(&f.signKey, "sign-key", getEnv("BENCHMARK_SIGN_KEY", ""), "Ed25519 private key (from keygen) to sign saved result files with")
+	fs.StringVar(&f.hook.Start, "hook", getEnv("BENCHMARK_HOOK", ""), "shell command to start during a strategy, e.g. a backup, with its window marked on the strategy's throughput timeline")
+	fs.StringVar(&f.hook.End, "hook-end", getEnv("BENCHMARK_HOOK_END", ""), "shell command to run when that strategy finishes, e.g. to stop what -hook started")
+	fs.StringVar(&f.hook.Maintenance, "maintenance", getEnv("BENCHMARK_MAINTENANCE", ""), "table maintenance to run on a strategy's table instead of -hook, with its window on the timeline and the table size before and after: optimize, analyze or vacuum")
+	fs.DurationVar(&f.hook.At, "hook-at", getEnvAsDuration("BENCHMARK_HOOK_AT", 0), "how far into the strategy to start -hook or -maintenance")
+	fs.StringVar(&f.hook.Strategy, "hook-strategy", getEnv("BENCHMARK_HOOK_STRATEGY", ""), "strategy to run -hook or -maintenance during (default: the first that runs)")
+	fs.StringVar(&f.hooks.BeforeSetup, "before-setup", getEnv("BENCHMARK_BEFORE_SETUP", ""), "shell command to run before each strategy creates or resets its table")
+	fs.StringVar(&f.hooks.BeforeStrategy, "before-strategy", getEnv("BENCHMARK_BEFORE_STRATEGY", ""), "shell command to run right before each strategy, e.g. to clear caches")
+	fs.StringVar(&f.hooks.AfterStrategy, "after-strategy", getEnv("BENCHMARK_AFTER_STRATEGY", ""), "shell command to run after each strategy, with its result in BENCHMARK_RESULT_*")
+	fs.StringVar(&f.hooks.AfterRun, "after-run", getEnv("BENCHMARK_AFTER_RUN", ""), "shell command to run once the strategy sequence has finished")
+	fs.BoolVar(&f.coldCache, "cold-cache", getEnvAsBool("BENCHMARK_COLD_CACHE", false), "run read strategies twice and report the first, cold-cache pass apart from the warm one")
+	fs.StringVar(&f.coldCommand, "cold-command", getEnv("BENCHMARK_COLD_COMMAND", ""), "shell command emptying the caches before each cold pass, e.g. restarting the server; implies -cold-cache")
+	fs.Float64Var(&f.rate, "rate", getEnvAsFloat("BENCHMARK_RATE", 0), "target operations per second across a strategy's workers (0 = unlimited)")
+	fs.StringVar(&f.controlFile, "control-file", getEnv("BENCHMARK_CONTROL_FILE", ""), `JSON file applied on SIGHUP to change a run in progress, e.g. {"rate": 500, "connections": 16}`)
+	fs.BoolVar(&f.serverTime, "server-time", getEnvAsBool("BENCHMARK_SERVER_TIME", false), "report how much of each strategy's latency the server spent executing statements, from performance_schema or the engine's statement statistics")
+	fs.IntVar(&f.topStatements, "top-statements", getEnvAsInt("BENCHMARK_TOP_STATEMENTS", 0), "report the N statement digests the server spent most time on during each strategy")
+	fs.StringVar(&f.hostMetrics, "host-metrics", getEnv("BENCHMARK_HOST_METRICS", ""), "sample the database host's CPU, IOPS and flushes during each strategy from local, a node_exporter URL or ssh://user@host")
+	fs.StringVar(&f.hostDisks, "host-disks", getEnv("BENCHMARK_HOST_DISKS", ""), "comma-separated block devices -host-metrics counts (default: every whole disk)")
+	fs.BoolVar(&f.quiet, "q", false, "quiet: log only warnings and errors, leaving the summary")
+	fs.BoolVar(&f.verbose, "v", false, "verbose: also log every operation's latency")
+	fs.BoolVar(&f.debug, "vv", false, "debug: also echo every SQL statement with its arguments")
+	fs.StringVar(&f.heatmap, "heatmap", getEnv("BENCHMARK_HEATMAP", ""), "write an SVG heatmap of latency over time per strategy to this directory, showing stalls and bimodal latencies")
+	fs.StringVar(&f.trace, "trace", getEnv("BENCHMARK_TRACE", ""), "record a Go execution trace of each strategy to this directory, showing the driver's scheduling and blocking in go tool trace")
+	fs.Float64Var(&f.faults, "faults", getEnvAsFloat("BENCHMARK_FAULTS", 0), "fail this percent of each strategy's statements with an induced fault before running them, reporting the error path's overhead")
+	fs.StringVar(&f.faultKinds, "fault-kinds", getEnv("BENCHMARK_FAULT_KINDS", strings.Join(faultKinds, ",")), "comma-separated faults -faults induces: cancel (a cancelled context) and bad-sql (a statement the server rejects)")
+	fs.StringVar(&f.eventLog, "event-log", getEnv("BENCHMARK_EVENT_LOG", ""), "also write the run's log and each strategy's start and result as JSON Lines to this file")
+	fs.StringVar(&f.instanceType, "instance-type", getEnv("BENCHMARK_INSTANCE_TYPE", ""), "estimate each strategy's cost and energy per million rows on this instance type, e.g. db.r6g.large")
+	fs.StringVar(&f.pricing, "pricing", getEnv("BENCHMARK_PRICING", ""), "JSON file of instance types to hourly_usd, vcpus and memory_gb, overriding the built-in prices")
+	fs.Float64Var(&f.hourlyCost, "hourly-cost", getEnvAsFloat("BENCHMARK_HOURLY_COST", 0), "the instance's price per hour in USD, instead of the pricing table's")
+	fs.Float64Var(&f.watts, "watts", getEnvAsFloat("BENCHMARK_WATTS", 0), "the instance's power draw in watts, instead of the estimate from its vCPUs and memory")
+	fs.Float64Var(&significanceLevel, "alpha", getEnvAsFloat("BENCHMARK_ALPHA", significanceLevel), "p-value below which a latency difference between strategies or against the baseline is reported as significant")
+	fs.IntVar(&precision, "precision", getEnvAsInt("BENCHMARK_PRECISION", precision), "significant figures of the durations, rates and sizes in reports and logs")
+	fs.BoolVar(&f.sharedTable, "shared-table", getEnvAsBool("BENCHMARK_SHARED_TABLE", false), "insert every strategy into benchmark_users instead of a dedicated table per strategy")
+	return f
+}
+
+// options resolves the parsed flags, config's engine and the selected
+// profile into the per-strategy bounds, splitting a profile's duration
+// between the strategies that run.
+func (f *runFlags) options(config DBConfig) (RunOptions, error) {
+	opts := RunOptions{Rows: f.rows, Duration: f.duration, MaxRuntime: f.maxRuntime, BatchSize: f.batchSize, SharedTable: f.sharedTable, Explain: f.explain, Rate: f.rate, ServerTime: f.serverTime, TopStatements: f.topStatements, Preflight: f.preflight, Probe: f.probe}
+	params, err := parseKeyValues(f.params)
+	if err != nil {
+		return opts, fmt.Errorf("invalid -param: %v", err)
+	}
+	for k, v := range f.extraParams {
+		params[k] = v
+	}
+	opts.Params = params
+	if opts.Engine, err = lookupEngine(config.Engine); err != nil {
+		return opts, err
+	}
+	if err := validateExplain(opts.Explain); err != nil {
+		return opts, err
+	}
+	switch {
+	case f.debug:
+		verbosity = verbosityDebug
+	case f.verbose:
+		verbosity = verbosityVerbose
+	case f.quiet:
+		verbosity = verbosityQuiet
+	}
+	if f.eventLog != "" {
+		if err := openEventLog(f.eventLog); err != nil {
+			return opts, err
+		}
+	}
+	if precision < 1 || precision > 9 {
+		return opts, fmt.Errorf("-precision must be between 1 and 9")
+	}
+	recordSampleTimes = f.heatmap != ""
+	if f.trace != "" {
+		if err := os.MkdirAll(f.trace, 0o755); err != nil {
+			return opts, fmt.Errorf("create -trace directory: %v", err)
+		}
+		opts.Trace = &executionTrace{Dir: f.trace}
+	}
+	if f.faults < 0 || f.faults > 100 {
+		return opts, fmt.Errorf("-faults must be a percentage between 0 and 100")
+	}
+	if f.faults > 0 {
+		kinds, err := parseFaultKinds(f.faultKinds)
+		if err != nil {
+			return opts, fmt.Errorf("invalid -fault-kinds: %v", err)
+		}
+		opts.Faults = &faultInjector{Percent: f.faults, Kinds: kinds}
+	}
+	injectingFaults = opts.Faults != nil
+	if f.autoEnabled {
+		if f.auto.MinTime <= 0 || f.auto.CI < 0 || f.auto.MaxRows < 1 {
+			return opts, fmt.Errorf("-auto needs a positive -auto-time and -auto-max-rows and a non-negative -auto-ci")
+		}
+		auto := f.auto
+		opts.Auto = &auto
+	}
+	if f.instanceType != "" || f.hourlyCost > 0 {
+		if opts.Cost, err = newCostModel(f.instanceType, f.pricing, f.hourlyCost, f.watts); err != nil {
+			return opts, err
+		}
+	}
+	if f.hostMetrics != "" {
+		if opts.HostMetrics, err = newHostMetrics(f.hostMetrics, f.hostDisks); err != nil {
+			return opts, err
+		}
+	}
+	if f.only != "" || f.skip != "" || f.order != "" {
+		candidates := opts.Engine.selectable()
+		if f.order != "" && opts.Engine.Native != nil {
+			return opts, fmt.Errorf("-order is not supported with engine %s", opts.Engine.Name)
+		}
+		var sel strategySelection
+		if sel.Only, err = parseStrategyList("only", f.only, candidates); err != nil {
+			return opts, err
+		}
+		if sel.Skip, err = parseStrategyList("skip", f.skip, candidates); err != nil {
+			return opts, err
+		}
+		if sel.Order, err = parseStrategyList("order", f.order, candidates); err != nil {
+			return opts, err
+		}
+		if sel.count(candidates) == 0 {
+			return opts, fmt.Errorf("-only and -skip leave no strategies to run")
+		}
+		opts.Selection = &sel
+	}
+	if err := validateHook(&f.hook); err != nil {
+		return opts, err
+	}
+	if f.hook.Start != "" || f.hook.Maintenance != "" {
+		hook := f.hook
+		opts.Hook = &hook
+	}
+	if !f.hooks.empty() {
+		opts.Hooks = &f.hooks
+	}
+	if f.coldCache || f.coldCommand != "" {
+		opts.ColdCache = &coldCache{Command: f.coldCommand}
+	}
+	if f.profile != "" {
+		profile, err := lookupProfile(f.profile)
+		if err != nil {
+			return opts, err
+		}
+		set := explicitFlags(f.fs)
+		opts = profile.apply(opts, set, opts.runnableCount())
+		if !set["soak"] {
+			f.soak = profile.Soak
+		}
+		log.Printf("Using profile %s: %s", profile.Name, profile.Description)
+	}
+	if f.soak && opts.Duration <= 0 {
+		return opts, fmt.Errorf("soak mode requires a positive -duration")
+	}
+	if opts.Rows <= 0 && opts.Duration <= 0 {
+		return opts, fmt.Errorf("either -n or -duration must be positive")
+	}
+	if f.count < 1 {
+		return opts, fmt.Errorf("-count must be at least 1")
+	}
+	if opts.Rate < 0 {
+		return opts, fmt.Errorf("-rate must not be negative")
+	}
+	return opts, nil
+}
+
+// publish sends the finished run to the configured webhook, Markdown and
+// results store destinations. comparisons is nil unless the run was
+// checked against a baseline.
+func (f *runFlags) publish(config DBConfig, opts RunOptions, results []Result, comparisons []comparison, runErr error) {
+	notifyWebhook(f.webhook, f.webhookFormat, summarizeRun(config.Target(), results, comparisons, runErr))
+	md := renderMarkdown(config.Target(), results, comparisons, runErr)
+	if err := publishMarkdown(f.markdown, f.githubSummary, md); err != nil {
+		log.Printf("Warning: could not write Markdown summary: %v", err)
+	}
+	if f.benchstat != "" {
+		if err := writeBenchstat(f.benchstat, config.Target(), results); err != nil {
+			log.Printf("Warning: could not write benchstat output: %v", err)
+		}
+	}
+	if f.heatmap != "" {
+		if err := writeHeatmaps(f.heatmap, results); err != nil {
+			log.Printf("Warning: could not write latency heatmaps: %v", err)
+		}
+	}
+	if f.resultsDir != "" {
+		run := storedRun{Target: config.Target(), Results: results, Provenance: newProvenance(config, opts, f.count)}
+		if runErr != nil {
+			run.Error = redact(runErr.Error())
+		}
+		if _, err := f.store().save(run); err != nil {
+			log.Printf("Warning: could not save run to the results store: %v", err)
+		}
+	}
+}
+
+// store is the results store the run is saved to.
+func (f *runFlags) store() resultsStore {
+	return resultsStore{dir: f.resultsDir, signKey: f.signKey}
+}
+
+func runCommand(config DBConfig, args []string) error {
+	f := newRunFlags("run")
+	tui := f.fs.Bool("tui", getEnvAsBool("BENCHMARK_TUI", false), "show a live terminal dashboard; s skips the running strategy, q aborts")
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	showPreview := f.fs.Bool("preview", getEnvAsBool("BENCHMARK_PREVIEW", interactive), "calibrate each strategy on a small sample first and print the estimated run time and rows (default: when stdin is a terminal)")
+	previewRows := f.fs.Int("preview-rows", getEnvAsInt("BENCHMARK_PREVIEW_ROWS", 20), "rows in each strategy's calibration sample")
+	yes := f.fs.Bool("yes", getEnvAsBool("BENCHMARK_YES", false), "start the run after the preview without asking for confirmation")
+	f.fs.Parse(args)
+	opts, err := f.options(config)
+	if err != nil {
+		return err
+	}
+	if *showPreview && !*tui && !f.soak {
+		if !*yes && !interactive {
+			return fmt.Errorf("-preview asks for confirmation on a terminal; pass -yes to run without asking")
+		}
+		opts.Preview = &preview{SampleRows: *previewRows, Confirm: !*yes, in: os.Stdin}
+	}
+
+	if err := validateMaintenance(opts.Hook, opts.Engine); err != nil {
+		return err
+	}
+	defer watchControlFile(f.controlFile)()
+
+	if f.soak {
+		db, err := createConnectionPool(config)
+		if err != nil {
+			return fmt.Errorf("failed to create connection pool: %v", err)
+		}
+		defer db.Close()
+		log.Println("Database connected successfully")
+		liveRun.start(db, opts.Rate)
+		defer liveRun.stop()
+		return runSoak(context.Background(), db, opts, opts.Duration, f.soakInterval)
+	}
+
+	if *tui {
+		if opts.Engine.Native != nil {
+			return fmt.Errorf("-tui is not supported with engine %s", opts.Engine.Name)
+		}
+		if opts.Dashboard, err = openDashboard(config.Target()); err != nil {
+			return err
+		}
+	}
+	results, err := benchmarkTarget(config, opts, f.count)
+	if opts.Dashboard != nil {
+		opts.Dashboard.close()
+	}
+	if errors.Is(err, errRunDeclined) {
+		log.Println("Run cancelled.")
+		return nil
+	}
+	f.publish(config, opts, results, nil, err)
+	return err
+}
+
+// benchmarkTarget connects to the target and runs the strategy sequence
+// count times, returning the results of every repetition in order. Past
+// opts.MaxRuntime it stops, returning the results so far with an error.
+func benchmarkTarget(config DBConfig, opts RunOptions, count int) ([]Result, error) {
+	if err := validateServerTime(opts); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if opts.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.MaxRuntime)
+		defer cancel()
+	}
+	var run func() ([]Result, error)
+	if opts.Engine != nil && opts.Engine.Native != nil {
+		liveRun.start(nil, opts.Rate)
+		run = func() ([]Result, error) { return opts.Engine.Native(ctx, config, opts) }
+	} else {
+		db, err := createConnectionPool(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create connection pool: %v", err)
+		}
+		defer db.Close()
+		log.Println("Database connected successfully")
+		if opts.Preflight {
+			if err := preflight(ctx, db, config, opts.Engine); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Probe {
+			opts.Capabilities = probeCapabilities(ctx, db, opts.Engine)
+		}
+		liveRun.start(db, opts.Rate)
+		if opts.Preview != nil {
+			if err := opts.Preview.confirm(ctx, db, opts, count); err != nil {
+				liveRun.stop()
+				return nil, err
+			}
+		}
+		run = func() ([]Result, error) { return runBenchmark(ctx, db, opts) }
+	}
+	defer liveRun.stop()
+
+	var all []Result
+	for i := 0; i < count; i++ {
+		if count > 1 {
+			log.Printf("Repetition %d of %d", i+1, count)
+		}
+		if opts.Hooks != nil {
+			opts.Hooks.Target, opts.Hooks.Repetition = config.Target(), i+1
+		}
+		results, err := run()
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("-max-runtime of %v exceeded (%d completed): %v", opts.MaxRuntime, len(all)+len(results), err)
+		}
+		// The after-run hook still runs once the deadline has passed.
+		opts.Hooks.afterRun(context.WithoutCancel(ctx), opts, results, err)
+		all = append(all, results...)
+		if err != nil {
+			return all, err
+		}
+	}
+	return all, nil
+}
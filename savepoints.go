@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "savepoint",
+		Description: "Using SAVEPOINT per row inside long transactions",
+		Features:    featureSavepoints,
+		Params: append([]Param{
+			{Name: "savepoint.tx_rows", Default: "100", Description: "rows per transaction, each under its own savepoint"},
+			{Name: "savepoint.rollback_rate", Default: "10", Description: "percentage of rows rolled back to their savepoint (0-100)"},
+			{Name: "savepoint.seed", Default: "1", Description: "seed for choosing which rows roll back"},
+		}, dataParams...),
+		Workload: workloadTxInsert,
+		Run:      insertUsingSavepoints,
+	})
+}
+
+// insertUsingSavepoints wraps every insert in SAVEPOINT / RELEASE SAVEPOINT
+// the way ORMs do for nested transactions, and rolls back to the savepoint
+// for savepoint.rollback_rate percent of the rows. Rows counts attempted
+// inserts; each latency sample covers savepoint, insert and release or
+// rollback, and Metrics splits them into kept and rolled back rows.
+func insertUsingSavepoints(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	txRows := opts.intParam("savepoint.tx_rows", 100)
+	if txRows < 1 {
+		return Result{}, fmt.Errorf("savepoint.tx_rows must be at least 1, got %d", txRows)
+	}
+	rate := opts.floatParam("savepoint.rollback_rate", 10)
+	if rate < 0 || rate > 100 {
+		return Result{}, fmt.Errorf("savepoint.rollback_rate must be between 0 and 100, got %g", rate)
+	}
+	rng := rand.New(rand.NewSource(int64(opts.intParam("savepoint.seed", 1))))
+	gen := opts.rowGen("Savepoint")
+	start := time.Now()
+
+	var rec latencyRecorder
+	var kept, rolledBack []time.Duration
+	i, txs := 0, 0
+	for !opts.done(i, start) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return Result{}, fmt.Errorf("begin transaction error: %v", err)
+		}
+		for j := 0; j < txRows && !opts.done(i, start); j, i = j+1, i+1 {
+			rollback := rng.Float64()*100 < rate
+			elapsed, err := savepointInsert(ctx, tx, opts, gen, i, rollback)
+			if err != nil {
+				tx.Rollback()
+				return Result{}, err
+			}
+			rec.observe(elapsed)
+			if rollback {
+				rolledBack = append(rolledBack, elapsed)
+			} else {
+				kept = append(kept, elapsed)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return Result{}, fmt.Errorf("commit error: %v", err)
+		}
+		txs++
+	}
+
+	result := rec.result(i, time.Since(start))
+	result.Transactions = txs
+	keptStats, rolledBackStats := summarizeLatency(kept), summarizeLatency(rolledBack)
+	result.Metrics = map[string]float64{
+		"rollbacks":            float64(len(rolledBack)),
+		"rollback_rate_target": rate,
+		"kept_p50_ns":          float64(keptStats.P50.Nanoseconds()),
+		"rolled_back_p50_ns":   float64(rolledBackStats.P50.Nanoseconds()),
+	}
+	log.Printf("savepoint: %d of %d rows rolled back to their savepoint (p50 kept %s, rolled back %s)",
+		len(rolledBack), i, formatDuration(keptStats.P50), formatDuration(rolledBackStats.P50))
+	return result, nil
+}
+
+func savepointInsert(ctx context.Context, tx *sql.Tx, opts RunOptions, gen *rowGen, i int, rollback bool) (time.Duration, error) {
+	name, email := gen.row(i)
+	opStart := time.Now()
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT row_sp"); err != nil {
+		return 0, fmt.Errorf("savepoint error: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, opts.insertSQL(), name, email); err != nil {
+		return 0, fmt.Errorf("tx exec error: %v", err)
+	}
+	end := "RELEASE SAVEPOINT row_sp"
+	if rollback {
+		end = "ROLLBACK TO SAVEPOINT row_sp"
+	}
+	if _, err := tx.ExecContext(ctx, end); err != nil {
+		return 0, fmt.Errorf("%s error: %v", end, err)
+	}
+	return time.Since(opStart), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// bufferPoolQueries read the size in bytes of the engine's page cache,
+// which a scale factor is relative to.
+var bufferPoolQueries = map[string]string{
+	"mysql": "SELECT @@innodb_buffer_pool_size",
+}
+
+// scaleChunkRows is how many rows the scale-factor seed inserts between
+// two checks of the table's size.
+const scaleChunkRows = 50000
+
+// estimatedRowBytes is the assumed footprint of a benchmark_users row,
+// indexes included, on engines that don't report table sizes.
+const estimatedRowBytes = 100
+
+// generatedSource yields generated benchmark_users rows from row number n
+// on, without end.
+type generatedSource struct {
+	gen *rowGen
+	n   int
+}
+
+func (s *generatedSource) columns() []string { return []string{"name", "email"} }
+
+func (s *generatedSource) next() ([]any, error) {
+	name, email := s.gen.row(s.n)
+	s.n++
+	return []any{name, email}, nil
+}
+
+func (s *generatedSource) Close() error { return nil }
+
+// seedToScale fills table with generated rows until its data and indexes
+// are factor times the buffer pool, so that reads of it are disk-bound on
+// purpose. poolBytes overrides the server's buffer pool size. The table's
+// size is re-read every scaleChunkRows rows, after refreshing its
+// statistics where the engine supports it; engines that don't report it
+// get rows of estimatedRowBytes.
+func seedToScale(ctx context.Context, db *sql.DB, eng *engine, table string, factor float64, poolBytes int64, batchSize int) error {
+	if poolBytes <= 0 {
+		q, ok := bufferPoolQueries[eng.Name]
+		if !ok {
+			return fmt.Errorf("engine %s's buffer pool size is unknown; pass it with -buffer-pool", eng.Name)
+		}
+		if err := db.QueryRowContext(ctx, q).Scan(&poolBytes); err != nil {
+			return fmt.Errorf("read buffer pool size: %v", err)
+		}
+	}
+	target := int64(factor * float64(poolBytes))
+	var have int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&have); err != nil {
+		return fmt.Errorf("count rows: %v", err)
+	}
+	_, sized := tableSizeQueries[eng.Name]
+	if !sized {
+		log.Printf("Warning: engine %s doesn't report table sizes; assuming %d bytes per row", eng.Name, estimatedRowBytes)
+	}
+	log.Printf("Seeding %s to %.1fx the buffer pool of %d MB: %d MB", table, factor, poolBytes>>20, target>>20)
+
+	src := &generatedSource{gen: RunOptions{}.rowGen("Scale"), n: have}
+	start := time.Now()
+	seeded := 0
+	for {
+		size := int64(have+seeded) * estimatedRowBytes
+		if sized {
+			if analyze, ok := maintenanceStatements[eng.Name]["analyze"]; ok {
+				if err := runMaintenance(ctx, db, fmt.Sprintf(analyze, table)); err != nil {
+					log.Printf("Warning: could not refresh the statistics of %s: %v", table, err)
+				}
+			}
+			s, _, err := readTableSize(ctx, db, eng, table)
+			if err != nil {
+				return fmt.Errorf("read table size: %v", err)
+			}
+			size = s.Data + s.Index
+		}
+		if size >= target {
+			log.Printf("Seeded %d rows into %s in %s; it now takes %s, %.1fx the buffer pool", seeded, table,
+				formatDuration(time.Since(start)), formatBytes(float64(size)), float64(size)/float64(poolBytes))
+			return nil
+		}
+		if seeded > 0 {
+			log.Printf("Seeded %d rows, %s takes %d of %d MB", seeded, table, size>>20, target>>20)
+		}
+		rows, _, err := loadSeed(ctx, db, eng, src, table, src.columns(), batchSize, scaleChunkRows)
+		seeded += rows
+		if err != nil {
+			return fmt.Errorf("seed after %d rows: %v", seeded, err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// scanTable holds the wide rows the scan strategy reads.
+const scanTable = "benchmark_wide"
+
+// wideIntColumns and wideStringColumns are the integer and string columns
+// of scanTable besides id.
+const wideIntColumns, wideStringColumns = 8, 8
+
+// scanMethods are the ways of scanning a row that scan.methods selects.
+var scanMethods = []string{"typed", "bytes", "rawbytes", "struct"}
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "scan-methods",
+		Description: "Scanning wide rows into typed fields, []byte, RawBytes and sqlx structs",
+		Features:    featureMultiRowValues,
+		Params: []Param{
+			{Name: "scan.methods", Default: strings.Join(scanMethods, "/"), Description: "slash-separated scan methods to compare: typed (rows.Scan into int64/string), bytes ([]byte copies), rawbytes (sql.RawBytes, no copy) and struct (sqlx StructScan)"},
+			{Name: "scan.rows", Default: "1000", Description: "rows in the table"},
+			{Name: "scan.batch", Default: "200", Description: "rows each query returns"},
+		},
+		Read:     true,
+		Workload: workloadScan,
+		Table:    scanTable,
+		Schema:   wideSchema,
+		Run:      compareScanMethods,
+	})
+}
+
+func wideSchema(e *engine, table string) string {
+	cols := []column{{Name: "id", Type: typeBigInt, NotNull: true}}
+	for i := 1; i <= wideIntColumns; i++ {
+		cols = append(cols, column{Name: fmt.Sprintf("n%d", i), Type: typeBigInt, NotNull: true})
+	}
+	for i := 1; i <= wideStringColumns; i++ {
+		cols = append(cols, column{Name: fmt.Sprintf("s%d", i), Type: typeVarchar, Size: 64, NotNull: true})
+	}
+	return e.createTable(table, cols, "id")
+}
+
+// wideRow is one row of scanTable.
+type wideRow struct {
+	ID int64  `db:"id"`
+	N1 int64  `db:"n1"`
+	N2 int64  `db:"n2"`
+	N3 int64  `db:"n3"`
+	N4 int64  `db:"n4"`
+	N5 int64  `db:"n5"`
+	N6 int64  `db:"n6"`
+	N7 int64  `db:"n7"`
+	N8 int64  `db:"n8"`
+	S1 string `db:"s1"`
+	S2 string `db:"s2"`
+	S3 string `db:"s3"`
+	S4 string `db:"s4"`
+	S5 string `db:"s5"`
+	S6 string `db:"s6"`
+	S7 string `db:"s7"`
+	S8 string `db:"s8"`
+}
+
+// fields are the destinations of r's columns in order.
+func (r *wideRow) fields() []any {
+	return []any{&r.ID, &r.N1, &r.N2, &r.N3, &r.N4, &r.N5, &r.N6, &r.N7, &r.N8,
+		&r.S1, &r.S2, &r.S3, &r.S4, &r.S5, &r.S6, &r.S7, &r.S8}
+}
+
+func wideColumnList() string {
+	names := []string{"id"}
+	for i := 1; i <= wideIntColumns; i++ {
+		names = append(names, fmt.Sprintf("n%d", i))
+	}
+	for i := 1; i <= wideStringColumns; i++ {
+		names = append(names, fmt.Sprintf("s%d", i))
+	}
+	return strings.Join(names, ", ")
+}
+
+// scanPhase is what scanning with one method cost the client.
+type scanPhase struct {
+	queries, rows int
+	elapsed       time.Duration
+	latency       []time.Duration
+	allocs, bytes uint64
+	cpu           time.Duration
+	cpuOK         bool
+}
+
+// compareScanMethods reads the same wide rows with each method in
+// scan.methods, splitting Rows (queries) and Duration between them. The
+// server does the same work every time, so the differences are the
+// client's deserialization cost: Metrics report per method the rows
+// scanned per second and the heap allocations, bytes and CPU time per
+// row, e.g. rawbytes_allocs_per_row against typed_allocs_per_row. The
+// methods run one at a time on a single goroutine so that the process's
+// allocation and CPU counters measure them alone.
+func compareScanMethods(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	methods := opts.listParam("scan.methods", strings.Join(scanMethods, "/"))
+	if len(methods) == 0 {
+		return Result{}, fmt.Errorf("scan.methods is empty")
+	}
+	for _, m := range methods {
+		known := false
+		for _, k := range scanMethods {
+			known = known || m == k
+		}
+		if !known {
+			return Result{}, fmt.Errorf("scan.methods: unknown method %q (expected %s)", m, strings.Join(scanMethods, ", "))
+		}
+	}
+	rows := opts.intParam("scan.rows", 1000)
+	batch := opts.intParam("scan.batch", 200)
+	if rows < 1 || batch < 1 {
+		return Result{}, fmt.Errorf("scan.rows and scan.batch must be at least 1")
+	}
+	if err := fillWideTable(ctx, db, opts, rows); err != nil {
+		return Result{}, err
+	}
+	query := opts.bind("SELECT " + wideColumnList() + " FROM " + opts.table() + " WHERE id >= ? ORDER BY id " + opts.Engine.limit(batch))
+	xdb := sqlx.NewDb(db, opts.Engine.Driver)
+	phaseOpts := opts.phase(len(methods))
+
+	// The plan is the same for every method and captured outside the
+	// phases' allocation counts.
+	plans := opts.planRecorder()
+	plans.capture(ctx, db, query, 0)
+	var rec latencyRecorder
+	var total time.Duration
+	queries := 0
+	metrics := map[string]float64{}
+	for _, m := range methods {
+		p, err := runScanPhase(ctx, xdb, phaseOpts, query, m, rows, batch, &rec)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %v", m, err)
+		}
+		queries += p.queries
+		total += p.elapsed
+
+		rowsPerSec := float64(p.rows) / p.elapsed.Seconds()
+		allocsPerRow := float64(p.allocs) / float64(max(p.rows, 1))
+		bytesPerRow := float64(p.bytes) / float64(max(p.rows, 1))
+		metrics[m+"_rows_per_sec"] = rowsPerSec
+		metrics[m+"_allocs_per_row"] = allocsPerRow
+		metrics[m+"_bytes_per_row"] = bytesPerRow
+		cpu := "n/a"
+		if p.cpuOK {
+			perRow := float64(p.cpu.Nanoseconds()) / float64(max(p.rows, 1))
+			metrics[m+"_cpu_ns_per_row"] = perRow
+			cpu = formatDuration(time.Duration(perRow))
+		}
+		log.Printf("scan-methods: %s: %s rows/s, %.1f allocs and %s per row, %s CPU per row",
+			m, formatRate(rowsPerSec), allocsPerRow, formatBytes(bytesPerRow), cpu)
+	}
+
+	result := rec.result(queries, total)
+	result.Plans = plans.plans
+	result.Metrics = metrics
+	return result, nil
+}
+
+// fillWideTable tops the table up to n rows with ids 0 to n-1.
+func fillWideTable(ctx context.Context, db *sql.DB, opts RunOptions, n int) error {
+	var have int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+opts.table()).Scan(&have); err != nil {
+		return fmt.Errorf("count rows: %v", err)
+	}
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", 1+wideIntColumns+wideStringColumns), ", ") + ")"
+	for i := have; i < n; {
+		batch := min(opts.batchSize(), n-i)
+		var b strings.Builder
+		b.WriteString("INSERT INTO " + opts.table() + " (" + wideColumnList() + ") VALUES ")
+		var args []any
+		for j := 0; j < batch; j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(placeholders)
+			id := i + j
+			args = append(args, id)
+			for c := 1; c <= wideIntColumns; c++ {
+				args = append(args, int64(id)*int64(c))
+			}
+			for c := 1; c <= wideStringColumns; c++ {
+				args = append(args, fmt.Sprintf("value %d of row %d, padded to be realistic", c, id))
+			}
+		}
+		if _, err := db.ExecContext(ctx, opts.bind(b.String()), args...); err != nil {
+			return fmt.Errorf("fill table: %v", err)
+		}
+		i += batch
+	}
+	return nil
+}
+
+// runScanPhase queries consecutive windows of the table until opts is
+// done, scanning every row with method and observing each query in rec.
+func runScanPhase(ctx context.Context, db *sqlx.DB, opts RunOptions, query, method string, tableRows, batch int, rec *latencyRecorder) (scanPhase, error) {
+	var p scanPhase
+	var row wideRow
+	raw := make([]sql.RawBytes, 1+wideIntColumns+wideStringColumns)
+	copies := make([][]byte, len(raw))
+	rawDest, copyDest := make([]any, len(raw)), make([]any, len(raw))
+	for i := range raw {
+		rawDest[i], copyDest[i] = &raw[i], &copies[i]
+	}
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	cpuBefore, cpuOK := processCPUTime()
+	start := time.Now()
+	for ; !opts.done(p.queries, start); p.queries++ {
+		from := (p.queries * batch) % tableRows
+		opStart := time.Now()
+		rows, err := db.QueryxContext(ctx, query, from)
+		if err != nil {
+			return p, fmt.Errorf("query error: %v", err)
+		}
+		for rows.Next() {
+			switch method {
+			case "typed":
+				err = rows.Scan(row.fields()...)
+			case "bytes":
+				err = rows.Scan(copyDest...)
+			case "rawbytes":
+				err = rows.Scan(rawDest...)
+			case "struct":
+				err = rows.StructScan(&row)
+			}
+			if err != nil {
+				rows.Close()
+				return p, fmt.Errorf("scan error: %v", err)
+			}
+			p.rows++
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return p, fmt.Errorf("query error: %v", err)
+		}
+		rows.Close()
+		d := time.Since(opStart)
+		p.latency = append(p.latency, d)
+		rec.observe(d)
+	}
+	p.elapsed = time.Since(start)
+	cpuAfter, _ := processCPUTime()
+	runtime.ReadMemStats(&after)
+	p.allocs, p.bytes = after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc
+	p.cpu, p.cpuOK = cpuAfter-cpuBefore, cpuOK
+	return p, nil
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const workloadScenario = "scenario"
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "scenario",
+		Description: "Running stateful scenarios per virtual user session",
+		Params: []Param{
+			{Name: "scenario.file", Description: "scenario definition file; the strategy runs only when set"},
+			{Name: "scenario.users", Default: "4", Description: "virtual users, each running one scenario after another"},
+			{Name: "scenario.seed", Default: "1", Description: "seed for the scenario choice and the template generators"},
+		},
+		Workload: workloadScenario,
+		// The steps name their own tables; don't create a dedicated one.
+		Table:    sharedTable,
+		Enabled:  func(opts RunOptions) bool { return opts.param("scenario.file", "") != "" },
+		Requires: "-param scenario.file",
+		Run:      runScenarios,
+	})
+}
+
+// scenarioFile defines entity lifecycles as ordered steps, e.g. insert an
+// order, read it back, update it and delete it. Each step is a statement
+// template (see workloadgen.go) whose step() generators refer to results
+// of the steps before it in the same iteration, so a scenario works on the
+// rows it created rather than on independent random ones.
+type scenarioFile struct {
+	Session   scenarioSession `json:"session"`
+	Scenarios []scenario      `json:"scenarios"`
+}
+
+// scenarioSession models what a virtual user's session costs beyond its
+// statements. Each user holds one connection for the session's lifetime:
+// it runs the login-like Setup steps and sets Variables when the session
+// starts, and when Lifetime or Iterations is reached it discards the
+// connection and logs in again on a fresh one. Setup step results stay
+// visible to step() for the whole session, e.g. step(login.user_id).
+type scenarioSession struct {
+	Setup []scenarioStep `json:"setup"`
+	// Variables are set with SET name = value, value as written.
+	Variables map[string]string `json:"variables"`
+	// Lifetime (e.g. "30s") and Iterations bound a session; zero leaves
+	// it open for the whole run.
+	Lifetime   string `json:"lifetime"`
+	Iterations int    `json:"iterations"`
+
+	lifetime time.Duration
+}
+
+// sqlExecer is what steps run on: the pool or a session's connection.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+type scenario struct {
+	Name string `json:"name"`
+	// Weight is the scenario's share of the iterations (default 1).
+	Weight float64        `json:"weight"`
+	Steps  []scenarioStep `json:"steps"`
+}
+
+// scenarioStep is one statement of a scenario. A step that reads records
+// "rows" and the columns of its first row; any other step records
+// "affected" and, where the driver reports one, the generated "id".
+type scenarioStep struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+	// Read overrides whether the step returns rows, for statements such
+	// as INSERT ... RETURNING id.
+	Read *bool `json:"read,omitempty"`
+
+	template paramTemplate
+	read     bool
+}
+
+func loadScenarios(path string) (scenarioFile, error) {
+	var f scenarioFile
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return f, fmt.Errorf("read scenarios: %v", err)
+	}
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return f, fmt.Errorf("parse scenarios %s: %v", path, err)
+	}
+	if len(f.Scenarios) == 0 {
+		return f, fmt.Errorf("%s defines no scenarios", path)
+	}
+	if f.Session.Lifetime != "" {
+		if f.Session.lifetime, err = time.ParseDuration(f.Session.Lifetime); err != nil || f.Session.lifetime < 0 {
+			return f, fmt.Errorf("%s: invalid session lifetime %q", path, f.Session.Lifetime)
+		}
+	}
+	if f.Session.Iterations < 0 {
+		return f, fmt.Errorf("%s: negative session iterations", path)
+	}
+	if err := compileSteps("session setup", f.Session.Setup); err != nil {
+		return f, err
+	}
+	for i := range f.Scenarios {
+		sc := &f.Scenarios[i]
+		if sc.Name == "" {
+			sc.Name = fmt.Sprintf("scenario%d", i+1)
+		}
+		if sc.Weight == 0 {
+			sc.Weight = 1
+		}
+		if sc.Weight < 0 || len(sc.Steps) == 0 {
+			return f, fmt.Errorf("scenario %s needs steps and a non-negative weight", sc.Name)
+		}
+		if err := compileSteps("scenario "+sc.Name, sc.Steps); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+func compileSteps(where string, steps []scenarioStep) error {
+	for j := range steps {
+		step := &steps[j]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step%d", j+1)
+		}
+		var err error
+		if step.template, err = compileTemplate(step.Template); err != nil {
+			return fmt.Errorf("%s, step %s: %v", where, step.Name, err)
+		}
+		step.read = isReadStatement(step.Template)
+		if step.Read != nil {
+			step.read = *step.Read
+		}
+	}
+	return nil
+}
+
+// scenarioUser is what one virtual user measured.
+type scenarioUser struct {
+	iterations []time.Duration
+	steps      map[string][]time.Duration // by scenario/step
+	statements int
+	sessions   []time.Duration // connect, setup and variables
+}
+
+// runScenarios runs scenario.users virtual users, each repeatedly picking
+// a scenario by weight and executing its steps in order until Rows
+// iterations in total have completed or Duration has elapsed. Rows counts
+// iterations and latency samples are whole iterations; the per-step
+// latencies are logged. Metrics report the sessions established and what
+// establishing one took.
+func runScenarios(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	file, err := loadScenarios(opts.param("scenario.file", ""))
+	if err != nil {
+		return Result{}, err
+	}
+	scenarios := file.Scenarios
+	users := opts.intParam("scenario.users", 4)
+	if users < 1 {
+		return Result{}, fmt.Errorf("scenario.users must be at least 1")
+	}
+	cumulative := make([]float64, len(scenarios))
+	sum := 0.0
+	for i, sc := range scenarios {
+		sum += sc.Weight
+		cumulative[i] = sum
+	}
+	seed := int64(opts.intParam("scenario.seed", 1))
+	shared := newWorkloadState()
+
+	var claimed int64
+	measured := make([]scenarioUser, users)
+	start := time.Now()
+	err = runWorkers(ctx, users, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		u := &measured[w]
+		u.steps = map[string][]time.Duration{}
+		var sess *userSession
+		defer func() {
+			if sess != nil {
+				sess.end(false)
+			}
+		}()
+		for {
+			n := atomic.AddInt64(&claimed, 1)
+			if (opts.Rows > 0 && int(n) > opts.Rows) || (opts.Duration > 0 && time.Since(start) >= opts.Duration) {
+				return nil
+			}
+			if sess != nil && sess.expired(file.Session) {
+				sess.end(true)
+				sess = nil
+			}
+			if sess == nil {
+				var err error
+				if sess, err = startSession(ctx, db, opts, file.Session, rng, shared, u); err != nil {
+					return err
+				}
+			}
+			k := sort.SearchFloat64s(cumulative, rng.Float64()*sum)
+			if k == len(scenarios) {
+				k--
+			}
+			iterStart := time.Now()
+			if err := runScenario(ctx, sess, opts, scenarios[k], rng, u); err != nil {
+				return err
+			}
+			u.iterations = append(u.iterations, time.Since(iterStart))
+			sess.iterations++
+		}
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var rec latencyRecorder
+	steps := map[string][]time.Duration{}
+	var sessions []time.Duration
+	statements := 0
+	for _, u := range measured {
+		rec.samples = append(rec.samples, u.iterations...)
+		sessions = append(sessions, u.sessions...)
+		for name, d := range u.steps {
+			steps[name] = append(steps[name], d...)
+		}
+		statements += u.statements
+	}
+	for _, sc := range scenarios {
+		for _, step := range sc.Steps {
+			name := sc.Name + "/" + step.Name
+			if d := steps[name]; len(d) > 0 {
+				stats := summarizeLatency(d)
+				log.Printf("scenario: %s: %d executions (p50 %s, p95 %s)", name, len(d), formatDuration(stats.P50), formatDuration(stats.P95))
+			}
+		}
+	}
+	setup := summarizeLatency(sessions)
+	log.Printf("scenario: %d sessions for %d users (setup p50 %s, p95 %s)", len(sessions), users, formatDuration(setup.P50), formatDuration(setup.P95))
+	result := rec.result(len(rec.samples), elapsed)
+	result.Metrics = map[string]float64{
+		"statements":           float64(statements),
+		"users":                float64(users),
+		"sessions":             float64(len(sessions)),
+		"session_setup_p50_ns": float64(setup.P50.Nanoseconds()),
+		"session_setup_p95_ns": float64(setup.P95.Nanoseconds()),
+	}
+	return result, nil
+}
+
+// userSession is a virtual user's session: its connection and the results
+// of its setup steps.
+type userSession struct {
+	conn       *sql.Conn
+	state      *workloadState
+	setup      map[string]map[string]any
+	started    time.Time
+	iterations int
+}
+
+// startSession takes a connection, sets the session variables and runs
+// the setup steps, recording how long that took.
+func startSession(ctx context.Context, db *sql.DB, opts RunOptions, cfg scenarioSession, rng *rand.Rand, shared *workloadState, u *scenarioUser) (*userSession, error) {
+	start := time.Now()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start session: %v", err)
+	}
+	sess := &userSession{conn: conn, state: shared.session(), started: start}
+	names := make([]string, 0, len(cfg.Variables))
+	for name := range cfg.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET %s = %s", name, cfg.Variables[name])); err != nil {
+			sess.end(true)
+			return nil, fmt.Errorf("session variable %s: %v", name, err)
+		}
+	}
+	for _, step := range cfg.Setup {
+		if err := runStep(ctx, sess, opts, step, rng); err != nil {
+			sess.end(true)
+			return nil, fmt.Errorf("session setup, step %s: %v", step.Name, err)
+		}
+	}
+	sess.setup = maps.Clone(sess.state.steps)
+	u.sessions = append(u.sessions, time.Since(start))
+	return sess, nil
+}
+
+func (s *userSession) expired(cfg scenarioSession) bool {
+	return (cfg.lifetime > 0 && time.Since(s.started) >= cfg.lifetime) ||
+		(cfg.Iterations > 0 && s.iterations >= cfg.Iterations)
+}
+
+// end returns the session's connection to the pool, or with discard closes
+// it so that the next session has to log in on a new one.
+func (s *userSession) end(discard bool) {
+	if discard {
+		s.conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	s.conn.Close()
+}
+
+// runScenario executes one iteration of sc in a virtual user's session.
+func runScenario(ctx context.Context, sess *userSession, opts RunOptions, sc scenario, rng *rand.Rand, u *scenarioUser) error {
+	clear(sess.state.steps)
+	maps.Copy(sess.state.steps, sess.setup)
+	for _, step := range sc.Steps {
+		opStart := time.Now()
+		if err := runStep(ctx, sess, opts, step, rng); err != nil {
+			return fmt.Errorf("scenario %s, step %s: %v", sc.Name, step.Name, err)
+		}
+		name := sc.Name + "/" + step.Name
+		u.steps[name] = append(u.steps[name], time.Since(opStart))
+		u.statements++
+	}
+	return nil
+}
+
+// runStep executes step on the session's connection and records its
+// results for the steps after it.
+func runStep(ctx context.Context, sess *userSession, opts RunOptions, step scenarioStep, rng *rand.Rand) error {
+	args, err := step.template.args(rng, sess.state)
+	if err != nil {
+		return err
+	}
+	query := opts.bind(step.template.query)
+	var values map[string]any
+	if step.read {
+		values, err = queryStep(ctx, sess.conn, query, args)
+	} else {
+		values, err = execStep(ctx, sess.conn, query, args)
+	}
+	if err != nil {
+		return err
+	}
+	sess.state.steps[step.Name] = values
+	return nil
+}
+
+func execStep(ctx context.Context, db sqlExecer, query string, args []any) (map[string]any, error) {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	if n, err := res.RowsAffected(); err == nil {
+		values["affected"] = n
+	}
+	if id, err := res.LastInsertId(); err == nil {
+		values["id"] = id
+	}
+	return values, nil
+}
+
+// queryStep reads all rows and keeps the first one's columns, by
+// lower-cased name.
+func queryStep(ctx context.Context, db sqlExecer, query string, args []any) (map[string]any, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	n := 0
+	for rows.Next() {
+		n++
+		if n > 1 {
+			continue
+		}
+		row := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, c := range cols {
+			v := row[i]
+			// Text protocol values arrive as []byte the driver reuses.
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			values[strings.ToLower(c)] = v
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	values["rows"] = int64(n)
+	return values, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression: the standard five fields
+// (minute hour day-of-month month day-of-week) with *, lists, ranges and
+// steps, or one of @hourly, @daily, @weekly, @monthly, @yearly and
+// @every <duration>.
+type cronSchedule struct {
+	every                         time.Duration
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseCron(expr string) (cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every < time.Minute {
+			return cronSchedule{}, fmt.Errorf("invalid schedule %q: @every needs a duration of at least 1m", expr)
+		}
+		return cronSchedule{every: every}, nil
+	}
+	if std, ok := cronDescriptors[expr]; ok {
+		expr = std
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("invalid schedule %q: want 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+	var s cronSchedule
+	bounds := []struct {
+		set      *uint64
+		min, max int
+	}{{&s.minute, 0, 59}, {&s.hour, 0, 23}, {&s.dom, 1, 31}, {&s.month, 1, 12}, {&s.dow, 0, 7}}
+	for i, b := range bounds {
+		set, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("invalid schedule %q: %v", expr, err)
+		}
+		*b.set = set
+	}
+	// 7 is Sunday as well as 0.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domRestricted, s.dowRestricted = fields[2] != "*", fields[4] != "*"
+	return s, nil
+}
+
+// parseCronField returns the values one field matches as a bit set.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// next returns the first time after t that the schedule fires.
+func (s cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Truncate(s.every).Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every valid schedule fires within five years (29 February at the
+	// latest); stop there rather than loop on a date that never comes.
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay follows cron: when both day fields are restricted a day
+// matching either one fires.
+func (s cronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// daemonCommand runs the strategy sequence on a cron schedule until it is
+// interrupted, turning the tool into a continuous performance monitor.
+// Every run is saved to the results store and compared against -baseline,
+// or when none is given against the previous successful run in the store;
+// regressions go out through the run webhook like assert's. A failed run
+// is reported and the schedule carries on.
+func daemonCommand(config DBConfig, args []string) error {
+	f := newRunFlags("daemon")
+	schedule := f.fs.String("schedule", getEnv("BENCHMARK_SCHEDULE", "@hourly"), "cron expression (5 fields, @hourly, @daily, @every 30m, ...) for when to run")
+	baselinePath := f.fs.String("baseline", getEnv("BENCHMARK_BASELINE", ""), "baseline file to compare against (default: the previous run in the results store)")
+	t := thresholdFlags(f.fs)
+	f.fs.Parse(args)
+	sched, err := parseCron(*schedule)
+	if err != nil {
+		return err
+	}
+	opts, err := f.options(config)
+	if err != nil {
+		return err
+	}
+	if f.soak {
+		return fmt.Errorf("daemon does not support soak mode")
+	}
+	if f.resultsDir == "" {
+		f.resultsDir = "benchmark-results"
+	}
+	store := f.store()
+
+	ctx, stop := signal.NotifyContext(context.Background(), stopSignals...)
+	defer stop()
+	log.Printf("Benchmarking %s on schedule %q, results in %s", config.Target(), *schedule, store.dir)
+	for {
+		at := sched.next(time.Now())
+		if at.IsZero() {
+			return fmt.Errorf("schedule %q never fires", *schedule)
+		}
+		log.Printf("Next run at %s", at.Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping the schedule")
+			return nil
+		case <-time.After(time.Until(at)):
+		}
+
+		baseline, source, err := daemonBaseline(store, *baselinePath)
+		if err != nil {
+			log.Printf("Warning: no baseline to compare against: %v", err)
+		}
+		results, runErr := benchmarkTarget(config, opts, f.count)
+		var comparisons []comparison
+		if runErr == nil && baseline != nil {
+			comparisons = compareToBaseline(baseline, results, *t)
+			logComparisons(comparisons)
+			if n := regressions(comparisons); n > 0 {
+				log.Printf("%d of %d strategies regressed against %s", n, len(comparisons), source)
+			}
+		}
+		if runErr != nil {
+			log.Printf("Scheduled run failed: %v", runErr)
+		}
+		f.publish(config, opts, results, comparisons, runErr)
+	}
+}
+
+// daemonBaseline returns the results to compare the next run against and
+// where they came from: the baseline file if one is configured, otherwise
+// the latest successful run in the store (nil before the first one).
+func daemonBaseline(store resultsStore, path string) ([]Result, string, error) {
+	if path != "" {
+		b, err := loadBaseline(path)
+		if err != nil {
+			return nil, "", err
+		}
+		return b.Results, path, nil
+	}
+	runs, err := store.list()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, run := range runs {
+		if run.Error == "" && len(run.Results) > 0 {
+			return run.Results, "run " + run.ID, nil
+		}
+	}
+	return nil, "", nil
+}
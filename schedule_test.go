@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tc := range []struct {
+		expr, from, want string // want is empty for a schedule that never fires
+	}{
+		{"10/5 * * * *", "2026-10-14 12:00", "2026-10-14 12:10"},
+		{"10/5 * * * *", "2026-10-14 12:10", "2026-10-14 12:15"},
+		{"10/5 * * * *", "2026-10-14 12:56", "2026-10-14 13:10"},
+		{"*/15 * * * *", "2026-10-14 12:14", "2026-10-14 12:15"},
+		{"*/15 * * * *", "2026-10-14 12:45", "2026-10-14 13:00"},
+		{"0 9-17/4 * * *", "2026-10-14 13:00", "2026-10-14 17:00"},
+		// 2026-10-14 is a Wednesday; 7 and 0 are both Sunday.
+		{"0 9 * * 7", "2026-10-14 12:00", "2026-10-18 09:00"},
+		{"0 9 * * 0", "2026-10-14 12:00", "2026-10-18 09:00"},
+		{"0 9 * * 5-7", "2026-10-17 10:00", "2026-10-18 09:00"},
+		// With both day fields restricted either fires: the 1st, a
+		// Sunday, comes before the next Monday.
+		{"0 0 1 * 1", "2026-10-28 12:00", "2026-11-01 00:00"},
+		{"0 0 1 * 1", "2026-11-01 12:00", "2026-11-02 00:00"},
+		// With one restricted only that one counts.
+		{"0 0 * * 1", "2026-10-28 12:00", "2026-11-02 00:00"},
+		{"0 0 1 * *", "2026-10-28 12:00", "2026-11-01 00:00"},
+		// November has no 31st; the year rolls over to January.
+		{"30 23 31 * *", "2026-11-01 00:00", "2026-12-31 23:30"},
+		{"0 0 1 1 *", "2026-10-14 12:00", "2027-01-01 00:00"},
+		{"@monthly", "2026-12-31 23:59", "2027-01-01 00:00"},
+		// 29 February is the furthest a schedule can be, and 30 February
+		// is past the five years next looks ahead.
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 30 2 *", "2026-10-14 12:00", ""},
+		{"@every 90m", "2026-10-14 12:00", "2026-10-14 13:30"},
+	} {
+		s, err := parseCron(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		got := s.next(at(tc.from))
+		if tc.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%s from %s: next %s, want never", tc.expr, tc.from, got)
+			}
+			continue
+		}
+		if want := at(tc.want); !got.Equal(want) {
+			t.Errorf("%s from %s: next %s, want %s", tc.expr, tc.from, got, want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 30s",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q parsed", expr)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentials are a database user and password as stored in a secret.
+// The field names are the ones AWS Secrets Manager's RDS secrets, Vault's
+// database secrets engine and most KV secrets use.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// secretsProvider fetches the database credentials from where
+// DB_CREDENTIALS points instead of DB_USER and DB_PASS:
+//
+//	file:/run/secrets/db.json   a JSON file, e.g. rendered by an agent
+//	vault:secret/data/bench     a Vault secret, read with VAULT_ADDR and VAULT_TOKEN
+//	aws:prod/bench/db           an AWS Secrets Manager secret, read with the aws CLI
+//
+// The credentials are cached until DB_CREDENTIALS_TTL passes or, for
+// Vault, two thirds of their lease, and fetched again whenever a new
+// connection is refused with an authentication error, so that a run
+// outlasts a rotation. Established connections stay open.
+type secretsProvider struct {
+	source string
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	cached  credentials
+	expires time.Time // zero: cached until an authentication error
+}
+
+func newSecretsProvider(source string, ttl time.Duration) (*secretsProvider, error) {
+	kind, _, _ := strings.Cut(source, ":")
+	switch kind {
+	case "file", "vault", "aws":
+		return &secretsProvider{source: source, ttl: ttl}, nil
+	}
+	return nil, fmt.Errorf("unknown credentials source %q (expected file:, vault: or aws:)", source)
+}
+
+func (p *secretsProvider) String() string { return p.source }
+
+// get returns the cached credentials, fetching them first if there are
+// none, they expired or refresh is set.
+func (p *secretsProvider) get(ctx context.Context, refresh bool) (credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !refresh && p.cached.Password != "" && (p.expires.IsZero() || time.Now().Before(p.expires)) {
+		return p.cached, nil
+	}
+	kind, location, _ := strings.Cut(p.source, ":")
+	var (
+		c     credentials
+		lease time.Duration
+		err   error
+	)
+	switch kind {
+	case "file":
+		c, err = readCredentialsFile(location)
+	case "vault":
+		c, lease, err = readVaultSecret(ctx, location)
+	case "aws":
+		c, err = readAWSSecret(ctx, location)
+	}
+	if err != nil {
+		return credentials{}, fmt.Errorf("fetch credentials from %s: %v", p.source, err)
+	}
+	if c.Password == "" {
+		return credentials{}, fmt.Errorf("credentials from %s have no password", p.source)
+	}
+	redactor.add(c.Password)
+	p.cached, p.expires = c, time.Time{}
+	if ttl := p.ttl; ttl > 0 || lease > 0 {
+		if lease > 0 && (ttl <= 0 || lease*2/3 < ttl) {
+			ttl = lease * 2 / 3
+		}
+		p.expires = time.Now().Add(ttl)
+	}
+	return c, nil
+}
+
+func readCredentialsFile(path string) (credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return credentials{}, err
+	}
+	var c credentials
+	if err := json.Unmarshal(data, &c); err != nil {
+		return credentials{}, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// readVaultSecret reads path over Vault's HTTP API. KV version 2 nests
+// the secret in a second data object; KV version 1 and the database
+// secrets engine don't, and the latter's dynamic credentials come with a
+// lease.
+func readVaultSecret(ctx context.Context, path string) (credentials, time.Duration, error) {
+	addr := strings.TrimSuffix(getEnv("VAULT_ADDR", "http://127.0.0.1:8200"), "/")
+	token := getEnv("VAULT_TOKEN", "")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if token == "" {
+		return credentials{}, 0, fmt.Errorf("VAULT_TOKEN is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return credentials{}, 0, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := getEnv("VAULT_NAMESPACE", ""); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return credentials{}, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return credentials{}, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return credentials{}, 0, fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var secret struct {
+		LeaseDuration int             `json:"lease_duration"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return credentials{}, 0, fmt.Errorf("parse vault response: %v", err)
+	}
+	var kv2 struct {
+		Data *credentials `json:"data"`
+	}
+	var c credentials
+	if err := json.Unmarshal(secret.Data, &kv2); err == nil && kv2.Data != nil {
+		c = *kv2.Data
+	} else if err := json.Unmarshal(secret.Data, &c); err != nil {
+		return credentials{}, 0, fmt.Errorf("parse vault secret: %v", err)
+	}
+	return c, time.Duration(secret.LeaseDuration) * time.Second, nil
+}
+
+// readAWSSecret reads a JSON secret string with the aws CLI, which takes
+// the region and credentials from its usual environment and profiles.
+func readAWSSecret(ctx context.Context, id string) (credentials, error) {
+	cmd := shellCommand(ctx, `"$AWS_CLI" secretsmanager get-secret-value --secret-id "$SECRET_ID" --query SecretString --output text`,
+		"AWS_CLI="+getEnv("AWS_CLI", "aws"), "SECRET_ID="+id)
+	cmd.Stdout = nil
+	out, err := cmd.Output()
+	if err != nil {
+		return credentials{}, err
+	}
+	var c credentials
+	if err := json.Unmarshal(out, &c); err != nil {
+		return credentials{}, fmt.Errorf("parse secret %s: %v", id, err)
+	}
+	return c, nil
+}
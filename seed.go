@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// seedSource yields the rows of a seed file. next returns io.EOF after the
+// last row; nil values are inserted as NULL.
+type seedSource interface {
+	columns() []string
+	next() ([]any, error)
+	Close() error
+}
+
+var identifierRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// seedCommand loads a CSV or Parquet file into the benchmark table with
+// multi-row INSERTs, so that strategies run against production-shaped data
+// instead of an empty or synthetic table. Column names come from the CSV
+// header or Parquet schema unless -columns renames them. With
+// -scale-factor it generates benchmark_users rows instead, until the table
+// outgrows the buffer pool by that factor (see seedToScale).
+func seedCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	file := fs.String("file", getEnv("BENCHMARK_SEED_FILE", ""), "CSV or Parquet file to load")
+	format := fs.String("format", "", "file format: csv or parquet (default: from the file extension)")
+	table := fs.String("table", getEnv("BENCHMARK_SEED_TABLE", sharedTable), "table to load into")
+	columns := fs.String("columns", "", "comma-separated target column names, overriding the file's own")
+	batchSize := fs.Int("batch-size", getEnvAsInt("BENCHMARK_BATCH_SIZE", defaultBatchSize), "rows per INSERT")
+	limit := fs.Int("limit", 0, "load at most this many rows (0 = all)")
+	csvNull := fs.String("csv-null", `\N`, "CSV field value loaded as NULL")
+	scaleFactor := fs.Float64("scale-factor", getEnvAsFloat("BENCHMARK_SCALE_FACTOR", 0), "instead of loading -file, generate rows until the table is this many times the buffer pool, e.g. 4 for disk-bound reads")
+	bufferPool := fs.Int64("buffer-pool", 0, "buffer pool size in bytes for -scale-factor (default: read from the server)")
+	fs.Parse(args)
+
+	if *batchSize < 1 {
+		return fmt.Errorf("-batch-size must be at least 1")
+	}
+	if !identifierRE.MatchString(*table) {
+		return fmt.Errorf("invalid table name %q", *table)
+	}
+	if *scaleFactor < 0 {
+		return fmt.Errorf("-scale-factor must not be negative")
+	}
+	if *scaleFactor > 0 {
+		if *file != "" {
+			return fmt.Errorf("-scale-factor generates rows and can't be combined with -file")
+		}
+		eng, err := lookupEngine(config.Engine)
+		if err != nil {
+			return err
+		}
+		db, err := createConnectionPool(config)
+		if err != nil {
+			return fmt.Errorf("failed to create connection pool: %v", err)
+		}
+		defer db.Close()
+		return seedToScale(context.Background(), db, eng, *table, *scaleFactor, *bufferPool, *batchSize)
+	}
+	if *file == "" {
+		return fmt.Errorf("-file or -scale-factor is required")
+	}
+
+	src, err := openSeedSource(*file, *format, *csvNull)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	cols := src.columns()
+	if *columns != "" {
+		renamed := strings.Split(*columns, ",")
+		if len(renamed) != len(cols) {
+			return fmt.Errorf("-columns names %d columns but the file has %d", len(renamed), len(cols))
+		}
+		cols = renamed
+	}
+	for i, c := range cols {
+		cols[i] = strings.TrimSpace(c)
+		if !identifierRE.MatchString(cols[i]) {
+			return fmt.Errorf("invalid column name %q", c)
+		}
+	}
+
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+
+	rows, elapsed, err := loadSeed(context.Background(), db, eng, src, *table, cols, *batchSize, *limit)
+	if err != nil {
+		return fmt.Errorf("seed %s after %d rows: %v", *file, rows, err)
+	}
+	log.Printf("Seeded %d rows into %s in %s (%s rows/s)", rows, *table, formatDuration(elapsed),
+		formatRate(float64(rows)/elapsed.Seconds()))
+	return nil
+}
+
+func openSeedSource(path, format, csvNull string) (seedSource, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open seed file: %v", err)
+	}
+	var src seedSource
+	switch format {
+	case "csv":
+		src, err = newCSVSource(f, csvNull)
+	case "parquet":
+		src, err = newParquetSource(f)
+	default:
+		err = fmt.Errorf("unknown seed format %q (expected csv or parquet)", format)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+func loadSeed(ctx context.Context, db *sql.DB, eng *engine, src seedSource, table string, cols []string, batchSize, limit int) (int, time.Duration, error) {
+	start := time.Now()
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = eng.quote(c)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, strings.Join(quoted, ", "))
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+
+	rows := 0
+	lastLog := start
+	batch := make([]any, 0, batchSize*len(cols))
+	flush := func() error {
+		n := len(batch) / len(cols)
+		if n == 0 {
+			return nil
+		}
+		query := prefix + strings.TrimSuffix(strings.Repeat(tuple+", ", n), ", ")
+		if _, err := db.ExecContext(ctx, eng.rebind(query), batch...); err != nil {
+			return fmt.Errorf("insert error: %v", err)
+		}
+		rows += n
+		batch = batch[:0]
+		if time.Since(lastLog) >= 10*time.Second {
+			log.Printf("Seeded %d rows...", rows)
+			lastLog = time.Now()
+		}
+		return nil
+	}
+
+	for limit <= 0 || rows+len(batch)/len(cols) < limit {
+		values, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, time.Since(start), err
+		}
+		if len(values) != len(cols) {
+			return rows, time.Since(start), fmt.Errorf("row %d has %d values, expected %d", rows+len(batch)/len(cols)+1, len(values), len(cols))
+		}
+		batch = append(batch, values...)
+		if len(batch) == batchSize*len(cols) {
+			if err := flush(); err != nil {
+				return rows, time.Since(start), err
+			}
+		}
+	}
+	err := flush()
+	return rows, time.Since(start), err
+}
+
+type csvSource struct {
+	f      *os.File
+	r      *csv.Reader
+	header []string
+	null   string
+}
+
+func newCSVSource(f *os.File, null string) (*csvSource, error) {
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %v", err)
+	}
+	return &csvSource{f: f, r: r, header: append([]string(nil), header...), null: null}, nil
+}
+
+func (s *csvSource) columns() []string { return append([]string(nil), s.header...) }
+
+func (s *csvSource) next() ([]any, error) {
+	record, err := s.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(record))
+	for i, field := range record {
+		if field != s.null {
+			values[i] = field
+		}
+	}
+	return values, nil
+}
+
+func (s *csvSource) Close() error { return s.f.Close() }
+
+// parquetSource reads flat Parquet files; nested schemas are rejected.
+type parquetSource struct {
+	f    *os.File
+	r    *parquet.Reader
+	cols []string
+	buf  []parquet.Row
+	pos  int
+}
+
+func newParquetSource(f *os.File) (*parquetSource, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("open Parquet file: %v", err)
+	}
+	var cols []string
+	for _, path := range pf.Schema().Columns() {
+		if len(path) != 1 {
+			return nil, fmt.Errorf("nested Parquet column %s is not supported", strings.Join(path, "."))
+		}
+		cols = append(cols, path[0])
+	}
+	return &parquetSource{f: f, r: parquet.NewReader(pf), cols: cols}, nil
+}
+
+func (s *parquetSource) columns() []string { return append([]string(nil), s.cols...) }
+
+func (s *parquetSource) next() ([]any, error) {
+	if s.pos == len(s.buf) {
+		if s.buf == nil {
+			s.buf = make([]parquet.Row, 256)
+		}
+		n, err := s.r.ReadRows(s.buf[:cap(s.buf)])
+		if n == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		s.buf, s.pos = s.buf[:n], 0
+	}
+	row := s.buf[s.pos]
+	s.pos++
+
+	values := make([]any, len(s.cols))
+	for _, v := range row {
+		if c := v.Column(); c >= 0 && c < len(values) {
+			values[c] = parquetValue(v)
+		}
+	}
+	return values, nil
+}
+
+// parquetValue converts a physical Parquet value; logical types such as
+// timestamps arrive as their underlying integers.
+func parquetValue(v parquet.Value) any {
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return int64(v.Int32())
+	case parquet.Int64:
+		return v.Int64()
+	case parquet.Float:
+		return float64(v.Float())
+	case parquet.Double:
+		return v.Double()
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return string(v.ByteArray())
+	default:
+		return v.String()
+	}
+}
+
+func (s *parquetSource) Close() error {
+	s.r.Close()
+	return s.f.Close()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// strategySelection narrows and reorders the strategy sequence (-only,
+// -skip, -order). Entries are strategy names or path.Match patterns such
+// as pool-*.
+type strategySelection struct {
+	Only  []string
+	Skip  []string
+	Order []string
+}
+
+// parseStrategyList splits a comma-separated list of strategy names or
+// patterns, each of which must match one of candidates.
+func parseStrategyList(flagName, list string, candidates []Strategy) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("-%s: bad pattern %q: %v", flagName, p, err)
+		}
+		matched := false
+		for _, s := range candidates {
+			matched = matched || matchStrategy(p, s.Name)
+		}
+		if !matched {
+			return nil, fmt.Errorf("-%s: no strategy matches %q", flagName, p)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+func matchStrategy(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchStrategy(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selects reports whether the selection keeps the strategy named name.
+func (sel *strategySelection) selects(name string) bool {
+	if sel == nil {
+		return true
+	}
+	return (len(sel.Only) == 0 || matchesAny(sel.Only, name)) && !matchesAny(sel.Skip, name)
+}
+
+// count is how many of candidates the selection keeps.
+func (sel *strategySelection) count(candidates []Strategy) int {
+	n := 0
+	for _, s := range candidates {
+		if sel.selects(s.Name) {
+			n++
+		}
+	}
+	return n
+}
+
+// ordered returns the strategies in the order they run: those -order
+// names first, in its order, then the rest in the registered order.
+func (sel *strategySelection) ordered() []Strategy {
+	if sel == nil || len(sel.Order) == 0 {
+		return strategies
+	}
+	ordered := make([]Strategy, 0, len(strategies))
+	placed := make([]bool, len(strategies))
+	for _, p := range sel.Order {
+		for i, s := range strategies {
+			if !placed[i] && matchStrategy(p, s.Name) {
+				ordered, placed[i] = append(ordered, s), true
+			}
+		}
+	}
+	for i, s := range strategies {
+		if !placed[i] {
+			ordered = append(ordered, s)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// server is the serve command's state: the store it lists and the run it
+// is executing, if any. Runs share the process-wide latency meter, so only
+// one executes at a time.
+type server struct {
+	config DBConfig
+	store  resultsStore
+
+	mu   sync.Mutex
+	live *dashboard
+}
+
+// serveCommand hosts a small web UI for triggering benchmark runs against
+// the configured target, watching the running one, and browsing the runs
+// in the results store. Runs started elsewhere with -results-dir pointing
+// at the same directory show up too.
+func serveCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", getEnv("BENCHMARK_SERVE_ADDR", "localhost:8080"), "address to listen on")
+	dir := fs.String("results-dir", getEnv("BENCHMARK_RESULTS_DIR", "benchmark-results"), "results store directory")
+	fs.Parse(args)
+
+	s := &server{config: config, store: resultsStore{dir: *dir}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, serveIndexHTML)
+	})
+	mux.HandleFunc("GET /api/runs", s.listRuns)
+	mux.HandleFunc("GET /api/runs/{id}", s.getRun)
+	mux.HandleFunc("POST /api/runs", sameOrigin(s.startRun))
+	mux.HandleFunc("GET /api/live", s.getLive)
+	mux.HandleFunc("POST /api/live/skip", sameOrigin(s.controlLive((*dashboard).skip)))
+	mux.HandleFunc("POST /api/live/abort", sameOrigin(s.controlLive((*dashboard).abort)))
+	mux.HandleFunc("POST /api/live/config", sameOrigin(s.reconfigureLive))
+
+	log.Printf("Serving the benchmark dashboard for %s on http://%s (results in %s)", config.Target(), *addr, *dir)
+	return http.ListenAndServe(*addr, mux)
+}
+
+// sameOrigin refuses requests a browser sends on behalf of another site,
+// so that a page the operator visits can't start or abort runs with a
+// cross-origin form post. Browsers mark those with Sec-Fetch-Site, or
+// failing that an Origin other than the server's; clients such as curl
+// send neither and are let through.
+func sameOrigin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+			http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Host != r.Host {
+				http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+func (s *server) listRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.store.list()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveJSON(w, runs)
+}
+
+func (s *server) getRun(w http.ResponseWriter, r *http.Request) {
+	run, err := s.store.load(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	serveJSON(w, run)
+}
+
+// runFormFlags are the run flags the web UI's form may set.
+var runFormFlags = []string{"profile", "n", "duration", "count", "batch-size", "param", "shared-table", "explain", "rate"}
+
+// startRun parses the form as run flags and starts the run in the
+// background; its progress is polled from /api/live. Parsing the flags
+// sets process-wide settings such as precision and verbosity, so it only
+// happens under s.mu with no run in progress.
+func (s *server) startRun(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.live != nil {
+		http.Error(w, "a run is already in progress", http.StatusConflict)
+		return
+	}
+	var args []string
+	for _, name := range runFormFlags {
+		if v := r.FormValue(name); v != "" {
+			args = append(args, "-"+name+"="+v)
+		}
+	}
+	f := newRunFlags("run")
+	f.fs.Init("run", flag.ContinueOnError)
+	f.fs.SetOutput(io.Discard)
+	if err := f.fs.Parse(args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := f.options(s.config)
+	if err == nil && f.soak {
+		err = errors.New("soak mode is not supported from the web UI")
+	}
+	if err == nil && opts.Engine.Native != nil {
+		err = fmt.Errorf("live progress is not supported with engine %s", opts.Engine.Name)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts.Dashboard = newDashboard(s.config.Target())
+	go opts.Dashboard.refresh()
+	s.live = opts.Dashboard
+	f.resultsDir = s.store.dir
+	go func() {
+		log.Printf("Run started from the web UI: %v", args)
+		results, err := benchmarkTarget(s.config, opts, f.count)
+		opts.Dashboard.close()
+		f.publish(s.config, opts, results, nil, err)
+		if err != nil {
+			log.Printf("Run from the web UI failed: %v", err)
+		}
+		s.mu.Lock()
+		s.live = nil
+		s.mu.Unlock()
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// getLive returns the running run's status, or null when idle.
+func (s *server) getLive(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	live := s.live
+	s.mu.Unlock()
+	if live == nil {
+		serveJSON(w, nil)
+		return
+	}
+	serveJSON(w, live.status())
+}
+
+func (s *server) controlLive(control func(*dashboard)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		live := s.live
+		s.mu.Unlock()
+		if live == nil {
+			http.Error(w, "no run in progress", http.StatusConflict)
+			return
+		}
+		control(live)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func serveJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: could not write response: %v", err)
+	}
+}
+
+const serveIndexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>runBenchmark</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 0.5em 0 1.5em; }
+th, td { padding: 0.25em 0.75em; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+form input { width: 7em; margin-right: 1em; }
+form input[name=param] { width: 20em; }
+.error { color: #b00; }
+.spark { font-family: monospace; text-align: left; color: #36c; }
+tr.run { cursor: pointer; }
+tr.run:hover { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>runBenchmark</h1>
+<form id="start">
+<label>Profile <input name="profile" placeholder="smoke"></label>
+<label>Rows <input name="n" placeholder="1000"></label>
+<label>Duration <input name="duration" placeholder="30s"></label>
+<label>Params <input name="param" placeholder="name=value,..."></label>
+<button>Start run</button> <span id="start-error" class="error"></span>
+</form>
+
+<h2>Live</h2>
+<div id="live">No run in progress.</div>
+
+<h2>Past runs</h2>
+<table id="runs"><thead><tr><th>Run</th><th>Target</th><th>Strategies</th><th>Outcome</th></tr></thead><tbody></tbody></table>
+<div id="run"></div>
+
+<script>
+const bars = "▁▂▃▄▅▆▇█";
+const ms = ns => ns >= 1e7 ? (ns / 1e6).toFixed(0) + "ms" : (ns / 1e6).toFixed(2) + "ms";
+const esc = s => String(s).replace(/[&<>"]/g, c => ({"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c]));
+
+function spark(values) {
+  const last = (values || []).slice(-60), most = Math.max(0, ...last);
+  return last.map(v => bars[most > 0 ? Math.floor(v / most * (bars.length - 1)) : 0]).join("");
+}
+
+async function refreshLive() {
+  const live = await (await fetch("api/live")).json();
+  const el = document.getElementById("live");
+  if (!live) { el.textContent = "No run in progress."; return false; }
+  let html = "<p>" + esc(live.target) + ", " + Math.round(live.elapsed_ns / 1e9) + "s " +
+    '<button onclick="control(\'skip\')">Skip strategy</button> <button onclick="control(\'abort\')">Abort run</button></p>' +
+    "<table><tr><th>Strategy</th><th>Status</th><th>Ops</th><th>Ops/s</th><th>p50</th><th>p95</th><th>p99</th><th>Retries</th><th>Throughput</th></tr>";
+  for (const s of live.strategies || []) {
+    html += "<tr><td>" + esc(s.name) + "</td><td>" + esc(s.status) + (s.error ? ' <span class="error">' + esc(s.error) + "</span>" : "") +
+      "</td><td>" + s.ops + "</td><td>" + s.ops_per_sec.toFixed(0) + "</td><td>" + ms(s.latency.p50_ns) + "</td><td>" +
+      ms(s.latency.p95_ns) + "</td><td>" + ms(s.latency.p99_ns) + "</td><td>" + s.retries + '</td><td class="spark">' + spark(s.history) + "</td></tr>";
+  }
+  html += "</table>";
+  if (live.pool) {
+    const p = live.pool;
+    html += "<p>Pool: " + p.OpenConnections + " open (" + p.InUse + " in use, " + p.Idle + " idle), max " + p.MaxOpenConnections +
+      ", waited " + p.WaitCount + " times for " + ms(p.WaitDuration) + "</p>";
+  }
+  el.innerHTML = html;
+  return true;
+}
+
+async function refreshRuns() {
+  const runs = await (await fetch("api/runs")).json();
+  document.querySelector("#runs tbody").innerHTML = runs.map(r =>
+    '<tr class="run" onclick="showRun(\'' + esc(r.id) + '\')"><td>' + esc(new Date(r.at).toLocaleString()) + "</td><td>" + esc(r.target) +
+    "</td><td>" + (r.results || []).length + "</td><td>" + (r.error ? '<span class="error">' + esc(r.error) + "</span>" : "ok") + "</td></tr>").join("");
+}
+
+async function showRun(id) {
+  const run = await (await fetch("api/runs/" + encodeURIComponent(id))).json();
+  let html = "<h3>" + esc(new Date(run.at).toLocaleString()) + " on " + esc(run.target) + "</h3>" +
+    "<table><tr><th>Strategy</th><th>Workload</th><th>Rows</th><th>Rows/s</th><th>p50</th><th>p95</th><th>p99</th></tr>";
+  for (const r of run.results || []) {
+    if (r.skipped) {
+      html += "<tr><td>" + esc(r.strategy) + "</td><td>" + esc(r.workload || "") + '</td><td colspan="5">skipped: ' + esc(r.skipped) + "</td></tr>";
+      continue;
+    }
+    html += "<tr><td>" + esc(r.strategy) + "</td><td>" + esc(r.workload || "") + "</td><td>" + r.rows + "</td><td>" +
+      r.rows_per_sec.toFixed(0) + "</td><td>" + ms(r.latency.p50_ns) + "</td><td>" + ms(r.latency.p95_ns) + "</td><td>" + ms(r.latency.p99_ns) + "</td></tr>";
+  }
+  document.getElementById("run").innerHTML = html + "</table>";
+}
+
+async function control(action) {
+  await fetch("api/live/" + action, {method: "POST"});
+}
+
+document.getElementById("start").addEventListener("submit", async e => {
+  e.preventDefault();
+  const resp = await fetch("api/runs", {method: "POST", body: new URLSearchParams(new FormData(e.target))});
+  document.getElementById("start-error").textContent = resp.ok ? "" : await resp.text();
+});
+
+let wasLive = false;
+async function tick() {
+  const live = await refreshLive().catch(() => false);
+  if (wasLive && !live) refreshRuns();
+  wasLive = live;
+}
+refreshRuns();
+tick();
+setInterval(tick, 1000);
+</script>
+</body>
+</html>
+`
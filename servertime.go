@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serverTime is a snapshot of the engine's cumulative statement counters.
+type serverTime struct {
+	Statements float64
+	Exec       time.Duration
+}
+
+func readServerTime(ctx context.Context, db *sql.DB, eng *engine) (serverTime, error) {
+	var t serverTime
+	var ns float64
+	if err := db.QueryRowContext(ctx, eng.ServerTime).Scan(&t.Statements, &ns); err != nil {
+		return t, fmt.Errorf("read server statement statistics: %v", err)
+	}
+	t.Exec = time.Duration(ns)
+	return t, nil
+}
+
+// validateServerTime checks that the engine reports server execution time
+// and statement digests when -server-time and -top-statements ask for them.
+func validateServerTime(opts RunOptions) error {
+	name := "this engine"
+	if opts.Engine != nil {
+		name = opts.Engine.Name
+	}
+	if opts.ServerTime && (opts.Engine == nil || opts.Engine.ServerTime == "") {
+		return fmt.Errorf("-server-time is not supported with %s", name)
+	}
+	if opts.TopStatements > 0 && (opts.Engine == nil || opts.Engine.StatementDigests == "") {
+		return fmt.Errorf("-top-statements is not supported with %s", name)
+	}
+	return nil
+}
+
+// measureServerTime wraps a strategy's Run to read the server's statement
+// counters before and after it, reporting in Metrics how much of the
+// client-observed latency the server spent executing statements and how
+// much went to the network, the driver and waiting for a connection:
+// server_statements, server_statements_per_op, server_time_per_statement_ns,
+// server_time_per_op_ns, network_time_per_op_ns and server_time_pct. The
+// counters cover every session in the database, so other clients' traffic
+// counts too.
+func measureServerTime(s Strategy, eng *engine) func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	return func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+		before, err := readServerTime(ctx, db, eng)
+		if err != nil {
+			return Result{}, err
+		}
+		result, err := s.Run(ctx, db, opts)
+		if err != nil {
+			return result, err
+		}
+		after, err := readServerTime(ctx, db, eng)
+		if err != nil {
+			return result, err
+		}
+		ops := len(result.samples)
+		statements, exec := after.Statements-before.Statements, after.Exec-before.Exec
+		if ops == 0 || statements <= 0 {
+			log.Printf("Warning: %s: no server statement statistics recorded", s.Name)
+			return result, nil
+		}
+		if result.Metrics == nil {
+			result.Metrics = map[string]float64{}
+		}
+		client := result.Latency.Mean
+		server := exec / time.Duration(ops)
+		result.Metrics["server_statements"] = statements
+		result.Metrics["server_statements_per_op"] = statements / float64(ops)
+		result.Metrics["server_time_per_statement_ns"] = float64(exec.Nanoseconds()) / statements
+		result.Metrics["server_time_per_op_ns"] = float64(server.Nanoseconds())
+		result.Metrics["network_time_per_op_ns"] = float64((client - server).Nanoseconds())
+		if client > 0 {
+			result.Metrics["server_time_pct"] = 100 * float64(server) / float64(client)
+		}
+		log.Printf("%s: server time %v of %v per op (%.0f%%) over %.1f statements per op", s.Name,
+			roundLatency(server), roundLatency(client), result.Metrics["server_time_pct"], result.Metrics["server_statements_per_op"])
+		return result, nil
+	}
+}
+
+// renderServerTimes tabulates the -server-time split of the strategies
+// that have one.
+func renderServerTimes(results []Result) string {
+	var b strings.Builder
+	for _, r := range results {
+		server, ok := r.Metrics["server_time_per_op_ns"]
+		if !ok {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("\n#### Server vs. client time per operation\n\n")
+			b.WriteString("| Strategy | Client | Server | Network and client | Server share | Statements/op |\n|---|--:|--:|--:|--:|--:|\n")
+		}
+		fmt.Fprintf(&b, "| `%s` | %v | %v | %v | %.0f%% | %.1f |\n", r.Strategy, roundLatency(r.Latency.Mean),
+			roundLatency(time.Duration(server)), roundLatency(time.Duration(r.Metrics["network_time_per_op_ns"])),
+			r.Metrics["server_time_pct"], r.Metrics["server_statements_per_op"])
+	}
+	return b.String()
+}
+
+// statementDigest is one normalized statement's executions during a
+// strategy, from the server's statement statistics.
+type statementDigest struct {
+	Digest string        `json:"digest"`
+	Text   string        `json:"text"`
+	Calls  float64       `json:"calls"`
+	Total  time.Duration `json:"total_ns"`
+	Mean   time.Duration `json:"mean_ns"`
+	// Share is the percentage of all the digests' time during the strategy.
+	Share float64 `json:"share_pct"`
+}
+
+func readStatementDigests(ctx context.Context, db *sql.DB, eng *engine) (map[string]statementDigest, error) {
+	rows, err := db.QueryContext(ctx, eng.StatementDigests)
+	if err != nil {
+		return nil, fmt.Errorf("read statement digests: %v", err)
+	}
+	defer rows.Close()
+	digests := map[string]statementDigest{}
+	for rows.Next() {
+		var d statementDigest
+		var ns float64
+		if err := rows.Scan(&d.Digest, &d.Text, &d.Calls, &ns); err != nil {
+			return nil, fmt.Errorf("scan statement digest: %v", err)
+		}
+		d.Total = time.Duration(ns)
+		digests[d.Digest] = d
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read statement digests: %v", err)
+	}
+	return digests, nil
+}
+
+// captureTopStatements wraps a strategy's Run to snapshot the server's
+// statement digests before and after it and keep in Result.Statements the
+// top ones by the time spent on them in between. Like measureServerTime's
+// counters, the digests cover every session in the database.
+func captureTopStatements(s Strategy, eng *engine, top int) func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	return func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+		before, err := readStatementDigests(ctx, db, eng)
+		if err != nil {
+			return Result{}, err
+		}
+		result, err := s.Run(ctx, db, opts)
+		if err != nil {
+			return result, err
+		}
+		after, err := readStatementDigests(ctx, db, eng)
+		if err != nil {
+			return result, err
+		}
+		var (
+			digests []statementDigest
+			total   time.Duration
+		)
+		for key, d := range after {
+			prev := before[key]
+			d.Calls -= prev.Calls
+			d.Total -= prev.Total
+			if d.Calls <= 0 {
+				continue
+			}
+			d.Mean = time.Duration(float64(d.Total) / d.Calls)
+			total += d.Total
+			digests = append(digests, d)
+		}
+		sort.Slice(digests, func(i, j int) bool { return digests[i].Total > digests[j].Total })
+		if len(digests) > top {
+			digests = digests[:top]
+		}
+		for i := range digests {
+			if total > 0 {
+				digests[i].Share = 100 * float64(digests[i].Total) / float64(total)
+			}
+		}
+		result.Statements = digests
+		return result, nil
+	}
+}
+
+// renderTopStatements lists each strategy's top statement digests.
+func renderTopStatements(results []Result) string {
+	var b strings.Builder
+	for _, r := range results {
+		for _, d := range r.Statements {
+			if b.Len() == 0 {
+				b.WriteString("\n#### Top statements by server time\n\n")
+				b.WriteString("| Strategy | Statement | Calls | Total | Mean | Share |\n|---|---|--:|--:|--:|--:|\n")
+			}
+			text := d.Text
+			if len(text) > 80 {
+				text = text[:77] + "..."
+			}
+			fmt.Fprintf(&b, "| `%s` | <code>%s</code> | %.0f | %v | %v | %.0f%% |\n", r.Strategy, strings.ReplaceAll(markdownEscaper.Replace(text), "|", "\\|"),
+				d.Calls, formatDuration(d.Total), roundLatency(d.Mean), d.Share)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// parseSessionInit splits DB_SESSION_INIT into its semicolon-separated
+// statements.
+func parseSessionInit(value string) []string {
+	var statements []string
+	for _, s := range strings.Split(value, ";") {
+		if s = strings.TrimSpace(s); s != "" {
+			statements = append(statements, s)
+		}
+	}
+	return statements
+}
+
+// openWithSessionInit opens a pool like sql.Open whose connections run
+// statements when they are established, before the pool hands them out,
+// so that every connection carries the same session settings as the
+// application's, e.g. SET time_zone or SET SESSION sql_mode.
+func openWithSessionInit(driverName, dsn string, statements []string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+	var base driver.Connector = dsnConnector{dsn, drv}
+	if dc, ok := drv.(driver.DriverContext); ok {
+		if base, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(injectFaults(echoSQL(sessionConnector{base, statements}))), nil
+}
+
+// dsnConnector is the driver.Connector of drivers that don't provide one.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+// sessionConnector runs its statements on every new connection.
+type sessionConnector struct {
+	driver.Connector
+	statements []string
+}
+
+func (c sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range c.statements {
+		if err := execDriverConn(ctx, conn, s); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("session init %q: %v", s, err)
+		}
+	}
+	return conn, nil
+}
+
+// execDriverConn executes query on a connection outside database/sql,
+// preparing it where the driver can't execute directly.
+func execDriverConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		if _, err := execer.ExecContext(ctx, query, nil); err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if s, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = s.ExecContext(ctx, nil)
+		return err
+	}
+	_, err = stmt.Exec(nil)
+	return err
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shardStats is one shard's share of a sharded run.
+type shardStats struct {
+	Database string       `json:"database"`
+	Rows     int          `json:"rows"`
+	Share    float64      `json:"share"`
+	Latency  LatencyStats `json:"latency"`
+}
+
+// shardReport is the outcome of a sharded run. Imbalance is the busiest
+// shard's row count over the mean, 1 for a perfectly even spread; CV is
+// the coefficient of variation of the per-shard row counts.
+type shardReport struct {
+	Shards     []shardStats  `json:"shards"`
+	Rows       int           `json:"rows"`
+	Duration   time.Duration `json:"duration_ns"`
+	RowsPerSec float64       `json:"rows_per_sec"`
+	Latency    LatencyStats  `json:"latency"`
+	Imbalance  float64       `json:"imbalance"`
+	CV         float64       `json:"cv"`
+}
+
+// shardCommand spreads single-row inserts over several databases of the
+// target, routing each row by a hash of its email the way an application
+// shards by key, to see what app-level sharding buys before adopting it.
+// Each shard gets its own connection pool; every shard database needs the
+// benchmark_users table, which -create sets up by cloning the one in
+// DB_NAME.
+func shardCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("shard", flag.ExitOnError)
+	databases := fs.String("databases", getEnv("BENCHMARK_SHARD_DATABASES", ""), "comma-separated shard databases (default: DB_NAME_shard0 ... for -shards)")
+	shards := fs.Int("shards", 4, "number of shards when -databases is not given")
+	create := fs.Bool("create", false, "create missing shard databases and tables")
+	workers := fs.Int("workers", 8, "concurrent inserters across all shards")
+	rows := fs.Int("n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000), "rows to insert across all shards (0 = bounded by -duration only)")
+	duration := fs.Duration("duration", 0, "stop after this long")
+	jsonPath := fs.String("json", "", `write the per-shard report as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+
+	names := shardDatabases(*databases, config.Database, *shards)
+	if len(names) < 2 {
+		return fmt.Errorf("sharding needs at least two databases, got %d", len(names))
+	}
+	for _, name := range names {
+		if !identifierRE.MatchString(name) {
+			return fmt.Errorf("invalid shard database name %q", name)
+		}
+	}
+	if *workers < 1 {
+		return fmt.Errorf("-workers must be at least 1")
+	}
+	if *rows <= 0 && *duration <= 0 {
+		return fmt.Errorf("either -n or -duration must be set")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	if *create {
+		if err := createShards(config, eng, names); err != nil {
+			return err
+		}
+	}
+
+	pools := make([]*sql.DB, len(names))
+	for i, name := range names {
+		shardConfig := config
+		shardConfig.Database = name
+		if pools[i], err = createConnectionPool(shardConfig); err != nil {
+			return fmt.Errorf("shard %s: failed to create connection pool: %v", name, err)
+		}
+		defer pools[i].Close()
+	}
+
+	log.Printf("Sharding inserts over %d databases (%s) with %d workers", len(names), strings.Join(names, ", "), *workers)
+	opts := RunOptions{Rows: *rows, Duration: *duration, Engine: eng}
+	report, err := runSharded(context.Background(), pools, names, opts, *workers)
+	if err != nil {
+		return err
+	}
+	reportShards(report)
+	if *jsonPath != "" {
+		return writeJSON(*jsonPath, report)
+	}
+	return nil
+}
+
+func shardDatabases(list, base string, n int) []string {
+	if list != "" {
+		var names []string
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s_shard%d", base, i)
+	}
+	return names
+}
+
+// createShards creates each shard database and clones benchmark_users from
+// DB_NAME into it.
+func createShards(config DBConfig, eng *engine, names []string) error {
+	if eng.CloneTable == nil {
+		return fmt.Errorf("engine %q can't clone tables; create the shard databases in advance", eng.Name)
+	}
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	for _, name := range names {
+		if _, err := db.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+name); err != nil {
+			return fmt.Errorf("create database %s: %v", name, err)
+		}
+		if _, err := db.ExecContext(ctx, eng.CloneTable(name+"."+sharedTable, config.Database+"."+sharedTable)); err != nil {
+			return fmt.Errorf("create table in %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// shardFor maps a key to its shard with FNV-1a.
+func shardFor(key string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
+
+func runSharded(ctx context.Context, pools []*sql.DB, names []string, opts RunOptions, workers int) (shardReport, error) {
+	insertSQL := opts.insertSQL()
+	recs := make([]latencyRecorder, len(pools))
+	locks := make([]sync.Mutex, len(pools))
+	var next atomic.Int64
+	// The tables outlive the run, so emails carry a run-unique base.
+	base := time.Now().UnixMicro()
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, _ int) error {
+		for ctx.Err() == nil {
+			i := int(next.Add(1)) - 1
+			if opts.done(i, start) {
+				return nil
+			}
+			email := fmt.Sprintf("shard%d-%d@example.com", base, i)
+			s := shardFor(email, len(pools))
+			opStart := time.Now()
+			if _, err := pools[s].ExecContext(ctx, insertSQL, fmt.Sprintf("UserShard%d", i), email); err != nil {
+				return fmt.Errorf("shard %s: insert error: %v", names[s], err)
+			}
+			locks[s].Lock()
+			recs[s].observe(time.Since(opStart))
+			locks[s].Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return shardReport{}, err
+	}
+
+	report := shardReport{Duration: time.Since(start)}
+	var all []time.Duration
+	for s, name := range names {
+		samples := recs[s].samples
+		report.Shards = append(report.Shards, shardStats{Database: name, Rows: len(samples), Latency: summarizeLatency(samples)})
+		report.Rows += len(samples)
+		all = append(all, samples...)
+	}
+	report.RowsPerSec = float64(report.Rows) / report.Duration.Seconds()
+	report.Latency = summarizeLatency(all)
+
+	mean := float64(report.Rows) / float64(len(names))
+	var most, variance float64
+	for i := range report.Shards {
+		n := float64(report.Shards[i].Rows)
+		if report.Rows > 0 {
+			report.Shards[i].Share = n / float64(report.Rows)
+		}
+		most = max(most, n)
+		variance += (n - mean) * (n - mean)
+	}
+	if mean > 0 {
+		report.Imbalance = most / mean
+		report.CV = math.Sqrt(variance/float64(len(names))) / mean
+	}
+	return report, nil
+}
+
+func reportShards(r shardReport) {
+	log.Printf("Sharded: %d rows in %s, %s rows/s (p50 %s, p95 %s)", r.Rows, formatDuration(r.Duration), formatRate(r.RowsPerSec),
+		formatDuration(r.Latency.P50), formatDuration(r.Latency.P95))
+	for _, s := range r.Shards {
+		log.Printf("  %-24s %8d rows (%5.1f%%)  p50 %s  p95 %s", s.Database, s.Rows, 100*s.Share, formatDuration(s.Latency.P50), formatDuration(s.Latency.P95))
+	}
+	log.Printf("Sharded: busiest shard %.2fx the mean, coefficient of variation %.3f", r.Imbalance, r.CV)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// significanceLevel is the p-value below which a latency difference counts
+// as significant (-alpha).
+var significanceLevel = 0.05
+
+// storedLatencySamples is how many operation latencies a result keeps in
+// LatencySample for later runs to be tested against.
+const storedLatencySamples = 1000
+
+// significance is the outcome of testing whether two latency samples come
+// from the same distribution: the two-sided p-values of the Mann-Whitney U
+// test, which makes no assumption about the shape of the distribution and
+// so suits long-tailed latencies, and of Welch's t-test on the means. The
+// difference is significant when the Mann-Whitney p-value is below
+// significanceLevel.
+type significance struct {
+	MannWhitneyP float64 `json:"mann_whitney_p"`
+	WelchP       float64 `json:"welch_p"`
+}
+
+func (s *significance) significant() bool {
+	return s != nil && s.MannWhitneyP < significanceLevel
+}
+
+// String is e.g. "significant (p=0.003)".
+func (s *significance) String() string {
+	word := "not significant"
+	if s.significant() {
+		word = "significant"
+	}
+	return fmt.Sprintf("%s (p=%s)", word, formatPValue(s.MannWhitneyP))
+}
+
+func formatPValue(p float64) string {
+	if p < 0.001 {
+		return "<0.001"
+	}
+	return fmt.Sprintf("%.3f", p)
+}
+
+// latencies are the operation latencies to test r with: all of them for a
+// result of this run, the stored subset for one loaded from a file.
+func (r Result) latencies() []time.Duration {
+	if len(r.samples) > 0 {
+		return r.samples
+	}
+	return r.LatencySample
+}
+
+// sampleLatencies returns at most n of samples, evenly spaced across the
+// run so that warm-up and later phases are both represented.
+func sampleLatencies(samples []time.Duration, n int) []time.Duration {
+	if len(samples) <= n {
+		return append([]time.Duration(nil), samples...)
+	}
+	out := make([]time.Duration, n)
+	for i := range out {
+		out[i] = samples[i*len(samples)/n]
+	}
+	return out
+}
+
+// testSignificance compares the latencies of a and b, or returns nil if
+// either has fewer than two.
+func testSignificance(a, b Result) *significance {
+	x, y := a.latencies(), b.latencies()
+	if len(x) < 2 || len(y) < 2 {
+		return nil
+	}
+	return &significance{MannWhitneyP: mannWhitneyP(x, y), WelchP: welchP(x, y)}
+}
+
+// mannWhitneyP is the two-sided p-value of the Mann-Whitney U test, by the
+// normal approximation with tie and continuity corrections, which is close
+// for the sample sizes of a benchmark.
+func mannWhitneyP(x, y []time.Duration) float64 {
+	type obs struct {
+		v     time.Duration
+		fromX bool
+	}
+	all := make([]obs, 0, len(x)+len(y))
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	var rankSumX, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		// Tied values share the average of their ranks, i+1 to j.
+		rank := float64(i+1+j) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromX {
+				rankSumX += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	n1, n2 := float64(len(x)), float64(len(y))
+	n := n1 + n2
+	u := rankSumX - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := math.Max(math.Abs(u-mean)-0.5, 0) / math.Sqrt(variance)
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// welchP is the two-sided p-value of Welch's t-test for equal means.
+func welchP(x, y []time.Duration) float64 {
+	m1, v1 := meanVariance(x)
+	m2, v2 := meanVariance(y)
+	n1, n2 := float64(len(x)), float64(len(y))
+	se2 := v1/n1 + v2/n2
+	if se2 == 0 {
+		if m1 == m2 {
+			return 1
+		}
+		return 0
+	}
+	t := (m1 - m2) / math.Sqrt(se2)
+	df := se2 * se2 / ((v1/n1)*(v1/n1)/(n1-1) + (v2/n2)*(v2/n2)/(n2-1))
+	return regularizedBeta(df/(df+t*t), df/2, 0.5)
+}
+
+func meanVariance(samples []time.Duration) (mean, variance float64) {
+	for _, d := range samples {
+		mean += float64(d)
+	}
+	mean /= float64(len(samples))
+	for _, d := range samples {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	return mean, variance / float64(len(samples)-1)
+}
+
+// regularizedBeta is the regularized incomplete beta function I_x(a, b),
+// by its continued fraction (Numerical Recipes' betacf), which converges
+// fast for x below (a+1)/(a+b+2) and is mirrored above it.
+func regularizedBeta(x, a, b float64) float64 {
+	switch {
+	case x <= 0:
+		return 0
+	case x >= 1:
+		return 1
+	case x > (a+1)/(a+b+2):
+		return 1 - regularizedBeta(1-x, b, a)
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(a*math.Log(x) + b*math.Log(1-x) - (la + lb - lab))
+
+	const tiny = 1e-300
+	clamp := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	c, d := 1.0, 1/clamp(1-(a+b)*x/(a+1))
+	h := d
+	for m := 1.0; m <= 300; m++ {
+		even := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 / clamp(1+even*d)
+		c = clamp(1 + even/c)
+		h *= d * c
+		odd := -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 / clamp(1+odd*d)
+		c = clamp(1 + odd/c)
+		step := d * c
+		h *= step
+		if math.Abs(step-1) < 1e-12 {
+			break
+		}
+	}
+	return front * h / a
+}
+
+// renderSignificance tests each strategy against the fastest one of the
+// same workload in the run, so that a table ordering that is only noise
+// isn't read as a ranking.
+func renderSignificance(results []Result) string {
+	fastest := map[string]Result{}
+	for _, r := range results {
+		if r.Skipped != "" || len(r.latencies()) < 2 {
+			continue
+		}
+		w := workloadOf(r)
+		if best, ok := fastest[w]; !ok || r.RowsPerSec() > best.RowsPerSec() {
+			fastest[w] = r
+		}
+	}
+	var b strings.Builder
+	for _, r := range results {
+		if r.Skipped != "" || len(r.latencies()) < 2 {
+			continue
+		}
+		best := fastest[workloadOf(r)]
+		if best.Strategy == r.Strategy {
+			continue
+		}
+		s := testSignificance(best, r)
+		if s == nil {
+			continue
+		}
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "\n#### Significance\n\nEach strategy's latencies against the fastest strategy of its workload; differences with a Mann-Whitney p-value below %g are significant.\n\n", significanceLevel)
+			b.WriteString("| Strategy | vs. | p50 change | Mann-Whitney p | Welch p | |\n|---|---|--:|--:|--:|---|\n")
+		}
+		verdict := ":grey_question: not significant"
+		if s.significant() {
+			verdict = ":heavy_check_mark: significant"
+		}
+		fmt.Fprintf(&b, "| `%s` | `%s` | %+.1f%% | %s | %s | %s |\n", r.Strategy, best.Strategy,
+			percentChange(float64(best.Latency.P50), float64(r.Latency.P50)), formatPValue(s.MannWhitneyP), formatPValue(s.WelchP), verdict)
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// millis is the samples vs in milliseconds.
+func millis(vs ...int) []time.Duration {
+	out := make([]time.Duration, len(vs))
+	for i, v := range vs {
+		out[i] = time.Duration(v) * time.Millisecond
+	}
+	return out
+}
+
+// span is the samples from to to milliseconds, each repeated times.
+func span(from, to, times int) []time.Duration {
+	var out []time.Duration
+	for v := from; v <= to; v++ {
+		for i := 0; i < times; i++ {
+			out = append(out, time.Duration(v)*time.Millisecond)
+		}
+	}
+	return out
+}
+
+var significanceCases = []struct {
+	name string
+	x, y []time.Duration
+	// The p-values of both tests are expected in [low, high].
+	low, high float64
+}{
+	{"identical", span(1, 30, 1), span(1, 30, 1), 1, 1},
+	{"all equal", span(5, 5, 20), span(5, 5, 20), 1, 1},
+	{"shifted", span(1, 30, 1), span(101, 130, 1), 0, 0.001},
+	{"heavy ties, same", span(1, 3, 10), span(1, 3, 10), 1, 1},
+	{"heavy ties, shifted", span(1, 3, 10), span(3, 5, 10), 0, 0.001},
+	{"n=2", millis(1, 2), millis(3, 4), 0.05, 1},
+}
+
+func TestMannWhitneyP(t *testing.T) {
+	for _, tc := range significanceCases {
+		if p := mannWhitneyP(tc.x, tc.y); p < tc.low || p > tc.high || math.IsNaN(p) {
+			t.Errorf("%s: p = %v, want it in [%v, %v]", tc.name, p, tc.low, tc.high)
+		}
+	}
+}
+
+func TestWelchP(t *testing.T) {
+	for _, tc := range significanceCases {
+		if p := welchP(tc.x, tc.y); p < tc.low || p > tc.high || math.IsNaN(p) {
+			t.Errorf("%s: p = %v, want it in [%v, %v]", tc.name, p, tc.low, tc.high)
+		}
+	}
+	// Equal variances of 0.5 and t = -2√2 on 2 degrees of freedom, where
+	// the two-sided p-value is 1 - |t|/√(t²+2).
+	if p, want := welchP(millis(1, 2), millis(3, 4)), 1-math.Sqrt(8)/math.Sqrt(10); math.Abs(p-want) > 1e-9 {
+		t.Errorf("n=2: p = %v, want %v", p, want)
+	}
+	if p := welchP(span(5, 5, 10), span(6, 6, 10)); p != 0 {
+		t.Errorf("constant, different: p = %v, want 0", p)
+	}
+}
+
+func TestRegularizedBeta(t *testing.T) {
+	for _, tc := range []struct{ x, a, b, want float64 }{
+		{0, 2, 3, 0},
+		{1, 2, 3, 1},
+		{0.3, 1, 1, 0.3},              // I_x(1, 1) = x
+		{0.5, 3, 1, 0.125},            // I_x(a, 1) = x^a
+		{0.2, 1, 3, 1 - 0.8*0.8*0.8},  // I_x(1, b) = 1 - (1-x)^b
+		{0.5, 2.5, 2.5, 0.5},          // symmetric
+		{0.9, 2, 2, 3*0.81 - 2*0.729}, // I_x(2, 2) = 3x² - 2x³, mirrored
+		{0.01, 50, 0.5, 0},            // vanishing tail
+	} {
+		if got := regularizedBeta(tc.x, tc.a, tc.b); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("I_%v(%v, %v) = %v, want %v", tc.x, tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// soakSample is one periodic snapshot of client-side resource usage taken
+// during a soak run.
+type soakSample struct {
+	Elapsed    time.Duration
+	Goroutines int
+	OpenConns  int
+	InUseConns int
+	HeapBytes  uint64
+	Ops        int64
+	Errors     int64
+	ErrorRate  float64 // errors / attempts within the sample interval
+}
+
+type soakCounters struct {
+	ops    atomic.Int64
+	errors atomic.Int64
+}
+
+// runSoak cycles through every strategy in rounds of rowsPerRound inserts
+// until total has elapsed, sampling resources every interval. Unlike a
+// normal run, strategy errors are counted rather than aborting the run so
+// that error rates can be tracked over hours.
+func runSoak(ctx context.Context, db *sql.DB, opts RunOptions, total, interval time.Duration) error {
+	rowsPerRound := opts.Rows
+	if rowsPerRound <= 0 {
+		rowsPerRound = 1000
+	}
+	log.Printf("Starting soak run for %v (%d rows per strategy per round, sampling every %v)", total, rowsPerRound, interval)
+
+	roundOpts := opts
+	roundOpts.Rows, roundOpts.Duration = rowsPerRound, 0
+
+	ctx, cancel := context.WithTimeout(ctx, total)
+	defer cancel()
+
+	var counters soakCounters
+	var samples []soakSample
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var prev soakSample
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sample := takeSoakSample(db, &counters, start, prev)
+				log.Printf("Soak t=%v goroutines=%d open_conns=%d in_use=%d heap=%.1fMB ops=%d errors=%d (interval error rate %.2f%%)",
+					sample.Elapsed.Round(time.Second), sample.Goroutines, sample.OpenConns, sample.InUseConns,
+					float64(sample.HeapBytes)/(1<<20), sample.Ops, sample.Errors, sample.ErrorRate*100)
+				samples = append(samples, sample)
+				prev = sample
+			}
+		}
+	}()
+
+	for round := 1; ctx.Err() == nil; round++ {
+		for _, s := range opts.Selection.ordered() {
+			if ctx.Err() != nil {
+				break
+			}
+			if !s.runsWith(opts) {
+				continue
+			}
+			sOpts, err := s.prepare(ctx, db, roundOpts)
+			if err != nil {
+				counters.errors.Add(1)
+				log.Printf("Soak round %d: %s failed: %v", round, s.Name, err)
+				continue
+			}
+			result, err := s.Run(ctx, db, sOpts)
+			counters.ops.Add(int64(result.Rows))
+			if err != nil && ctx.Err() == nil {
+				counters.errors.Add(1)
+				log.Printf("Soak round %d: %s failed: %v", round, s.Name, err)
+			}
+		}
+	}
+	wg.Wait()
+
+	log.Printf("Soak run completed after %v: %d ops, %d errors", time.Since(start).Round(time.Second), counters.ops.Load(), counters.errors.Load())
+	reportLeaks(samples)
+	return nil
+}
+
+func takeSoakSample(db *sql.DB, counters *soakCounters, start time.Time, prev soakSample) soakSample {
+	// A forced GC makes HeapAlloc reflect live memory rather than garbage
+	// that simply hasn't been collected yet; once per interval is cheap.
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := db.Stats()
+
+	sample := soakSample{
+		Elapsed:    time.Since(start),
+		Goroutines: runtime.NumGoroutine(),
+		OpenConns:  stats.OpenConnections,
+		InUseConns: stats.InUse,
+		HeapBytes:  mem.HeapAlloc,
+		Ops:        counters.ops.Load(),
+		Errors:     counters.errors.Load(),
+	}
+	if attempts := sample.Ops - prev.Ops + sample.Errors - prev.Errors; attempts > 0 {
+		sample.ErrorRate = float64(sample.Errors-prev.Errors) / float64(attempts)
+	}
+	return sample
+}
+
+// reportLeaks flags every tracked series that grew (near) monotonically over
+// the run as a probable leak.
+func reportLeaks(samples []soakSample) {
+	if len(samples) < minLeakSamples {
+		log.Printf("Leak detection: only %d samples collected, need at least %d", len(samples), minLeakSamples)
+		return
+	}
+
+	series := []struct {
+		name  string
+		value func(soakSample) float64
+	}{
+		{"goroutines", func(s soakSample) float64 { return float64(s.Goroutines) }},
+		{"open connections", func(s soakSample) float64 { return float64(s.OpenConns) }},
+		{"in-use connections", func(s soakSample) float64 { return float64(s.InUseConns) }},
+		{"heap bytes", func(s soakSample) float64 { return float64(s.HeapBytes) }},
+		{"error rate", func(s soakSample) float64 { return s.ErrorRate }},
+	}
+	leaks := 0
+	for _, ser := range series {
+		values := make([]float64, len(samples))
+		for i, s := range samples {
+			values[i] = ser.value(s)
+		}
+		if growing(values) {
+			leaks++
+			log.Printf("Probable leak: %s grew monotonically from %s to %s over %v",
+				ser.name, formatLeakValue(ser.name, values[0]), formatLeakValue(ser.name, values[len(values)-1]),
+				samples[len(samples)-1].Elapsed.Round(time.Second))
+		}
+	}
+	if leaks == 0 {
+		log.Printf("Leak detection: no monotonic growth across %d samples", len(samples))
+	}
+}
+
+const (
+	minLeakSamples = 5
+	// A series counts as growing when at least this fraction of steps is
+	// non-decreasing and the overall increase exceeds minLeakGrowth.
+	leakMonotonicity = 0.8
+	minLeakGrowth    = 0.10
+)
+
+func growing(values []float64) bool {
+	if len(values) < minLeakSamples {
+		return false
+	}
+	nonDecreasing := 0
+	for i := 1; i < len(values); i++ {
+		if values[i] >= values[i-1] {
+			nonDecreasing++
+		}
+	}
+	first, last := values[0], values[len(values)-1]
+	if last <= first {
+		return false
+	}
+	if first > 0 && (last-first)/first < minLeakGrowth {
+		return false
+	}
+	return float64(nonDecreasing)/float64(len(values)-1) >= leakMonotonicity
+}
+
+func formatLeakValue(name string, v float64) string {
+	switch name {
+	case "heap bytes":
+		return formatBytes(v)
+	case "error rate":
+		return fmt.Sprintf("%.2f%%", v*100)
+	default:
+		return fmt.Sprintf("%.0f", v)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// spatialTable holds the points the spatial strategy queries.
+const spatialTable = "benchmark_places"
+
+// metersPerDegree is the length of a degree of latitude, and of longitude
+// at the equator.
+const metersPerDegree = 111320.0
+
+// spatialSQL is one engine's spatial dialect. Points are WKT with the
+// longitude first, e.g. POINT(13.405 52.52); queries find the points within
+// a radius in meters of a center point.
+type spatialSQL struct {
+	Schema string // DDL with %s for the table: id, location and a spatial index
+	Insert string // with id and location
+	Radius string // selecting the ids near a center
+	// RadiusArgs are the arguments of Radius; bbox is the WKT polygon
+	// bounding the circle.
+	RadiusArgs func(center, bbox string, meters float64) []any
+}
+
+// spatialDialects are the engines with geospatial support. MySQL 8 only
+// uses the spatial index for MBR predicates, so the distance filter is
+// preceded by a bounding box; CockroachDB's PostGIS-compatible ST_DWithin
+// on GEOGRAPHY uses its inverted index itself.
+var spatialDialects = map[string]spatialSQL{
+	"mysql": {
+		Schema: "CREATE TABLE IF NOT EXISTS %s (id BIGINT NOT NULL PRIMARY KEY, location POINT NOT NULL SRID 4326, SPATIAL INDEX (location))",
+		Insert: "INSERT INTO %s (id, location) VALUES (?, ST_PointFromText(?, 4326, 'axis-order=long-lat'))",
+		Radius: "SELECT id FROM %s WHERE MBRContains(ST_PolyFromText(?, 4326, 'axis-order=long-lat'), location) " +
+			"AND ST_Distance_Sphere(location, ST_PointFromText(?, 4326, 'axis-order=long-lat')) <= ?",
+		RadiusArgs: func(center, bbox string, meters float64) []any { return []any{bbox, center, meters} },
+	},
+	"cockroach": {
+		Schema:     "CREATE TABLE IF NOT EXISTS %s (id BIGINT NOT NULL PRIMARY KEY, location GEOGRAPHY(POINT, 4326) NOT NULL, INVERTED INDEX (location))",
+		Insert:     "INSERT INTO %s (id, location) VALUES ($1, ST_GeogFromText($2))",
+		Radius:     "SELECT id FROM %s WHERE ST_DWithin(location, ST_GeogFromText($1), $2)",
+		RadiusArgs: func(center, _ string, meters float64) []any { return []any{center, meters} },
+	},
+}
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "spatial",
+		Description: "Radius queries on indexed POINT locations",
+		Engines:     []string{"mysql", "cockroach"},
+		Params: []Param{
+			{Name: "spatial.enabled", Default: "false", Description: "run the strategy; it needs MySQL 8 or CockroachDB geospatial support"},
+			{Name: "spatial.points", Default: "10000", Description: "points in the table, spread over a square around spatial.center"},
+			{Name: "spatial.center", Default: "13.405/52.52", Description: "longitude/latitude of the area's center"},
+			{Name: "spatial.area_km", Default: "50", Description: "side of the square the points and query centers lie in"},
+			{Name: "spatial.radius_m", Default: "1000", Description: "radius of each query in meters"},
+		},
+		Read:     true,
+		Workload: workloadRadius,
+		Table:    spatialTable,
+		Schema:   spatialSchema,
+		// The spatial index and functions need MySQL 8 or a recent
+		// CockroachDB.
+		Probe: probeSchema(spatialSchema, func(e *engine, table string) (string, []any) {
+			sq := spatialDialects[e.Name]
+			return fmt.Sprintf(sq.Radius, table), sq.RadiusArgs("POINT(0 0)", "POLYGON((-1 -1, 1 -1, 1 1, -1 1, -1 -1))", 1)
+		}),
+		Enabled:  func(opts RunOptions) bool { return opts.param("spatial.enabled", "false") == "true" },
+		Requires: "-param spatial.enabled=true",
+		Run:      runRadiusQueries,
+	})
+}
+
+func spatialSchema(e *engine, table string) string {
+	return fmt.Sprintf(spatialDialects[e.Name].Schema, table)
+}
+
+// spatialArea is the square points and query centers are drawn from.
+type spatialArea struct {
+	lng, lat   float64
+	dLng, dLat float64 // the square's side in degrees
+}
+
+// point returns a random point of the area.
+func (a spatialArea) point(rng *rand.Rand) (lng, lat float64) {
+	return a.lng + (rng.Float64()-0.5)*a.dLng, a.lat + (rng.Float64()-0.5)*a.dLat
+}
+
+// runRadiusQueries tops the table up to spatial.points locations, then
+// queries the points within spatial.radius_m of random centers until opts
+// is done, the way "what's near me" features do. Rows counts queries.
+// Metrics report the insert rate of the top-up, which includes the spatial
+// index's maintenance, and the average points a query matched; pick the
+// radius and density so that it matches the feature being modeled.
+func runRadiusQueries(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	sq := spatialDialects[opts.Engine.Name]
+	center := opts.listParam("spatial.center", "13.405/52.52")
+	if len(center) != 2 {
+		return Result{}, fmt.Errorf("spatial.center must be longitude/latitude")
+	}
+	var area spatialArea
+	if _, err := fmt.Sscan(center[0]+" "+center[1], &area.lng, &area.lat); err != nil || math.Abs(area.lat) > 85 {
+		return Result{}, fmt.Errorf("spatial.center: invalid longitude/latitude %s/%s", center[0], center[1])
+	}
+	km := opts.floatParam("spatial.area_km", 50)
+	radius := opts.floatParam("spatial.radius_m", 1000)
+	points := opts.intParam("spatial.points", 10000)
+	if km <= 0 || radius <= 0 || points < 1 {
+		return Result{}, fmt.Errorf("spatial.area_km, spatial.radius_m and spatial.points must be positive")
+	}
+	cos := math.Cos(area.lat * math.Pi / 180)
+	area.dLat = km * 1000 / metersPerDegree
+	area.dLng = area.dLat / cos
+
+	metrics := map[string]float64{}
+	inserted, insertTime, err := fillSpatialTable(ctx, db, opts, sq, area, points)
+	if err != nil {
+		return Result{}, err
+	}
+	if inserted > 0 {
+		metrics["insert_rows_per_sec"] = float64(inserted) / insertTime.Seconds()
+		log.Printf("spatial: inserted %d points at %s rows/s", inserted, formatRate(metrics["insert_rows_per_sec"]))
+	}
+
+	query := fmt.Sprintf(sq.Radius, opts.table())
+	rng := rand.New(rand.NewSource(1))
+	rDLat := radius / metersPerDegree
+	rDLng := rDLat / cos
+	nextArgs := func() []any {
+		lng, lat := area.point(rng)
+		bbox := fmt.Sprintf("POLYGON((%[1]f %[3]f, %[2]f %[3]f, %[2]f %[4]f, %[1]f %[4]f, %[1]f %[3]f))", lng-rDLng, lng+rDLng, lat-rDLat, lat+rDLat)
+		return sq.RadiusArgs(fmt.Sprintf("POINT(%f %f)", lng, lat), bbox, radius)
+	}
+	var rec latencyRecorder
+	plans := opts.planRecorder()
+	plans.capture(ctx, db, query, nextArgs()...)
+	matched := 0
+	start := time.Now()
+	queries := 0
+	for ; !opts.done(queries, start); queries++ {
+		args := nextArgs()
+		opStart := time.Now()
+		n, err := countRows(ctx, db, query, args...)
+		if err != nil {
+			return Result{}, fmt.Errorf("radius query error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+		matched += n
+	}
+	result := rec.result(queries, time.Since(start))
+	result.Plans = plans.plans
+	metrics["avg_matches"] = float64(matched) / float64(max(queries, 1))
+	log.Printf("spatial: %.1f points within %gm per query", metrics["avg_matches"], radius)
+	result.Metrics = metrics
+	return result, nil
+}
+
+// fillSpatialTable inserts random points of area until the table has n,
+// a transaction per batch, returning how many it inserted and how long
+// that took.
+func fillSpatialTable(ctx context.Context, db *sql.DB, opts RunOptions, sq spatialSQL, area spatialArea, n int) (int, time.Duration, error) {
+	var have int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+opts.table()).Scan(&have); err != nil {
+		return 0, 0, fmt.Errorf("count rows: %v", err)
+	}
+	insert := fmt.Sprintf(sq.Insert, opts.table())
+	rng := rand.New(rand.NewSource(int64(have)))
+	start := time.Now()
+	for i := have; i < n; {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, 0, fmt.Errorf("begin: %v", err)
+		}
+		end := min(i+opts.batchSize(), n)
+		for ; i < end; i++ {
+			lng, lat := area.point(rng)
+			if _, err := tx.ExecContext(ctx, insert, i, fmt.Sprintf("POINT(%f %f)", lng, lat)); err != nil {
+				tx.Rollback()
+				return 0, 0, fmt.Errorf("insert error: %v", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, 0, fmt.Errorf("commit: %v", err)
+		}
+	}
+	return max(n-have, 0), time.Since(start), nil
+}
+
+// countRows runs query and returns how many rows it returned.
+func countRows(ctx context.Context, db *sql.DB, query string, args ...any) (int, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n, rows.Err()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// splitEndpoint is the traffic one endpoint of a read/write split served.
+type splitEndpoint struct {
+	Name    string       `json:"name"`
+	Host    string       `json:"host"`
+	Reads   int          `json:"reads"`
+	Writes  int          `json:"writes"`
+	Latency LatencyStats `json:"latency"`
+
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+func (e *splitEndpoint) observe(d time.Duration, write bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.samples = append(e.samples, d)
+	if write {
+		e.Writes++
+	} else {
+		e.Reads++
+	}
+}
+
+// splitReport is the outcome of a read/write split run. StaleReads are
+// replica reads that didn't find a row the primary had already committed;
+// each was retried on the primary. Sticky reads went to the primary
+// because their row was written within the staleness tolerance.
+type splitReport struct {
+	Endpoints   []*splitEndpoint `json:"endpoints"`
+	Operations  int              `json:"operations"`
+	Duration    time.Duration    `json:"duration_ns"`
+	OpsPerSec   float64          `json:"ops_per_sec"`
+	StaleReads  int64            `json:"stale_reads"`
+	StickyReads int64            `json:"sticky_reads"`
+}
+
+// splitCommand load-tests a read/write split: writes go to the primary
+// (the usual DB_HOST), reads are spread round-robin over -replicas. Reads
+// of a row written less than -max-staleness ago are sent to the primary
+// instead, the way applications route read-your-writes traffic; set it to
+// 0 to send every read to a replica and measure how often replication lag
+// makes a read miss. The replicas share the primary's credentials and
+// database.
+func splitCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("split", flag.ExitOnError)
+	replicas := fs.String("replicas", getEnv("BENCHMARK_REPLICAS", ""), "comma-separated replica host[:port] list")
+	readRatio := fs.Float64("read-ratio", 80, "percentage of operations that are reads")
+	maxStaleness := fs.Duration("max-staleness", getEnvAsDuration("BENCHMARK_MAX_STALENESS", 0), "read rows written within this long from the primary")
+	workers := fs.Int("workers", 8, "concurrent clients")
+	ops := fs.Int("n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000), "operations to run (0 = bounded by -duration only)")
+	duration := fs.Duration("duration", 0, "stop after this long")
+	seed := fs.Int64("seed", 1, "seed for the read/write mix")
+	jsonPath := fs.String("json", "", `write the per-endpoint report as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+
+	var hosts []string
+	for _, h := range strings.Split(*replicas, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("-replicas is required")
+	}
+	if *readRatio < 0 || *readRatio > 100 {
+		return fmt.Errorf("-read-ratio must be between 0 and 100")
+	}
+	if *workers < 1 {
+		return fmt.Errorf("-workers must be at least 1")
+	}
+	if *ops <= 0 && *duration <= 0 {
+		return fmt.Errorf("either -n or -duration must be set")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+
+	primary, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("primary: failed to create connection pool: %v", err)
+	}
+	defer primary.Close()
+	readers := make([]*sql.DB, len(hosts))
+	for i, host := range hosts {
+		replicaConfig := config
+		replicaConfig.Host = host
+		if readers[i], err = createConnectionPool(replicaConfig); err != nil {
+			return fmt.Errorf("replica %s: failed to create connection pool: %v", host, err)
+		}
+		defer readers[i].Close()
+	}
+
+	log.Printf("Splitting %g%% reads over %d replicas, writes to %s, max staleness %v", *readRatio, len(hosts), config.Host, *maxStaleness)
+	s := &splitRun{
+		opts:         RunOptions{Rows: *ops, Duration: *duration, Engine: eng},
+		primary:      primary,
+		replicas:     readers,
+		readRatio:    *readRatio,
+		maxStaleness: *maxStaleness,
+		endpoints:    []*splitEndpoint{{Name: "primary", Host: config.Host}},
+	}
+	for i, host := range hosts {
+		s.endpoints = append(s.endpoints, &splitEndpoint{Name: fmt.Sprintf("replica%d", i), Host: host})
+	}
+	report, err := s.run(context.Background(), *workers, *seed)
+	if err != nil {
+		return err
+	}
+	reportSplit(report)
+	if *jsonPath != "" {
+		return writeJSON(*jsonPath, report)
+	}
+	return nil
+}
+
+type splitRun struct {
+	opts         RunOptions
+	primary      *sql.DB
+	replicas     []*sql.DB
+	readRatio    float64
+	maxStaleness time.Duration
+	endpoints    []*splitEndpoint // primary first, then the replicas
+
+	mu      sync.Mutex
+	written []splitRow
+	next    atomic.Int64
+	stale   atomic.Int64
+	sticky  atomic.Int64
+}
+
+// splitRow is a row the primary committed and when.
+type splitRow struct {
+	email string
+	at    time.Time
+}
+
+func (s *splitRun) run(ctx context.Context, workers int, seed int64) (splitReport, error) {
+	insertSQL := s.opts.insertSQL()
+	readSQL := s.opts.bind("SELECT name FROM " + s.opts.table() + " WHERE email = ?")
+	// The table outlives the run, so emails carry a run-unique base.
+	base := time.Now().UnixMicro()
+	var attempted atomic.Int64
+	start := time.Now()
+	err := runWorkers(ctx, workers, func(ctx context.Context, w int) error {
+		rng := rand.New(rand.NewSource(seed + int64(w)))
+		for ctx.Err() == nil {
+			if s.opts.done(int(attempted.Add(1))-1, start) {
+				return nil
+			}
+			row, ok := s.pick(rng)
+			if !ok || rng.Float64()*100 >= s.readRatio {
+				i := s.next.Add(1)
+				email := fmt.Sprintf("split%d-%d@example.com", base, i)
+				opStart := time.Now()
+				if _, err := s.primary.ExecContext(ctx, insertSQL, fmt.Sprintf("UserSplit%d", i), email); err != nil {
+					return fmt.Errorf("primary: insert error: %v", err)
+				}
+				s.endpoints[0].observe(time.Since(opStart), true)
+				s.mu.Lock()
+				s.written = append(s.written, splitRow{email, time.Now()})
+				s.mu.Unlock()
+				continue
+			}
+			if err := s.read(ctx, rng, readSQL, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return splitReport{}, err
+	}
+
+	report := splitReport{
+		Endpoints:   s.endpoints,
+		Duration:    time.Since(start),
+		StaleReads:  s.stale.Load(),
+		StickyReads: s.sticky.Load(),
+	}
+	for _, e := range s.endpoints {
+		e.Latency = summarizeLatency(e.samples)
+		report.Operations += e.Reads + e.Writes
+	}
+	report.OpsPerSec = float64(report.Operations) / report.Duration.Seconds()
+	return report, nil
+}
+
+// pick chooses a random row written so far, if any.
+func (s *splitRun) pick(rng *rand.Rand) (splitRow, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.written) == 0 {
+		return splitRow{}, false
+	}
+	return s.written[rng.Intn(len(s.written))], true
+}
+
+// read routes a read of row: to the primary while the row is younger than
+// the staleness tolerance, otherwise to a random replica, falling back to
+// the primary when the replica hasn't caught up.
+func (s *splitRun) read(ctx context.Context, rng *rand.Rand, readSQL string, row splitRow) error {
+	if time.Since(row.at) < s.maxStaleness {
+		s.sticky.Add(1)
+		return s.readFrom(ctx, 0, readSQL, row.email)
+	}
+	r := 1 + rng.Intn(len(s.replicas))
+	err := s.readFrom(ctx, r, readSQL, row.email)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.stale.Add(1)
+		return s.readFrom(ctx, 0, readSQL, row.email)
+	}
+	return err
+}
+
+// readFrom reads email from endpoint e, 0 being the primary. A missing row
+// is only an error on the primary.
+func (s *splitRun) readFrom(ctx context.Context, e int, readSQL, email string) error {
+	db := s.primary
+	if e > 0 {
+		db = s.replicas[e-1]
+	}
+	var name sql.NullString
+	opStart := time.Now()
+	err := db.QueryRowContext(ctx, readSQL, email).Scan(&name)
+	elapsed := time.Since(opStart)
+	if err != nil && !(e > 0 && errors.Is(err, sql.ErrNoRows)) {
+		return fmt.Errorf("%s: read error: %v", s.endpoints[e].Name, err)
+	}
+	s.endpoints[e].observe(elapsed, false)
+	return err
+}
+
+func reportSplit(r splitReport) {
+	log.Printf("Split: %d operations in %s, %s ops/s", r.Operations, formatDuration(r.Duration), formatRate(r.OpsPerSec))
+	for _, e := range r.Endpoints {
+		log.Printf("  %-10s %-24s %7d reads %7d writes  p50 %s  p95 %s", e.Name, e.Host, e.Reads, e.Writes, formatDuration(e.Latency.P50), formatDuration(e.Latency.P95))
+	}
+	log.Printf("Split: %d reads sent to the primary within the staleness tolerance, %d stale replica reads retried on the primary",
+		r.StickyReads, r.StaleReads)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// stmtCachePoint is the read throughput with one statement cache size
+// cycling through one number of distinct statements.
+type stmtCachePoint struct {
+	CacheSize  int           `json:"cache_size"`
+	Statements int           `json:"statements"`
+	Queries    int           `json:"queries"`
+	Duration   time.Duration `json:"duration_ns"`
+	QueriesSec float64       `json:"queries_per_sec"`
+	Latency    LatencyStats  `json:"latency"`
+}
+
+// stmtCacheCommand sweeps pgx's client-side statement cache: for every
+// -sizes capacity it runs point reads cycling through each -statements
+// count of distinct statement texts, the way an application's query
+// variety grows. While the statements fit, each is prepared once per
+// connection; past the capacity the cache evicts and every miss costs an
+// extra prepare round trip, which is where thrash starts. Frameworks that
+// generate many query shapes need a capacity above that knee.
+func stmtCacheCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("stmt-cache", flag.ExitOnError)
+	sizesFlag := fs.String("sizes", getEnv("BENCHMARK_STMT_CACHE_SIZES", "16,64,512"), "comma-separated statement cache capacities to sweep")
+	statementsFlag := fs.String("statements", getEnv("BENCHMARK_STMT_CACHE_STATEMENTS", "8,32,128,512,2048"), "comma-separated counts of distinct statements to cycle through")
+	queries := fs.Int("n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 5000), "queries per sweep point")
+	seed := fs.Int64("seed", 1, "seed for the order statements are issued in")
+	jsonPath := fs.String("json", "", `write the sweep as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+
+	sizes, err := parseIntList(*sizesFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -sizes: %v", err)
+	}
+	counts, err := parseIntList(*statementsFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -statements: %v", err)
+	}
+	if *queries < 1 {
+		return fmt.Errorf("-n must be at least 1")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	if eng.Driver != "pgx" {
+		return fmt.Errorf("engine %s has no client-side statement cache; stmt-cache needs a pgx engine such as cockroach", eng.Name)
+	}
+
+	var points []stmtCachePoint
+	for _, size := range sizes {
+		for _, n := range counts {
+			p, err := runStmtCachePoint(config, eng, size, n, *queries, *seed)
+			if err != nil {
+				return fmt.Errorf("cache size %d, %d statements: %v", size, n, err)
+			}
+			log.Printf("Statement cache %d, %d statements: %s queries/s (p50 %s, p99 %s)", size, n, formatRate(p.QueriesSec), formatDuration(p.Latency.P50), formatDuration(p.Latency.P99))
+			points = append(points, p)
+		}
+	}
+	reportStmtCache(points)
+	if *jsonPath != "" {
+		return writeJSON(*jsonPath, points)
+	}
+	return nil
+}
+
+// runStmtCachePoint opens a single-connection pool with the given cache
+// capacity, so that every statement goes through one cache, and issues
+// queries point reads spread over n distinct statement texts.
+func runStmtCachePoint(config DBConfig, eng *engine, size, n, queries int, seed int64) (stmtCachePoint, error) {
+	config = config.withParams(map[string]string{
+		"default_query_exec_mode":  "cache_statement",
+		"statement_cache_capacity": strconv.Itoa(size),
+	})
+	config.PoolSize = 1
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return stmtCachePoint{}, fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+
+	texts := make([]string, n)
+	for i := range texts {
+		// The comment makes each text distinct to the cache without
+		// changing the plan.
+		texts[i] = eng.rebind(fmt.Sprintf("SELECT name, email FROM %s WHERE id = ? /* stmt %d */", sharedTable, i))
+	}
+	rng := rand.New(rand.NewSource(seed))
+	ctx := context.Background()
+	var rec latencyRecorder
+	start := time.Now()
+	for i := 0; i < queries; i++ {
+		opStart := time.Now()
+		rows, err := db.QueryContext(ctx, texts[rng.Intn(n)], i)
+		if err != nil {
+			return stmtCachePoint{}, fmt.Errorf("query error: %v", err)
+		}
+		if err := drainRows(rows); err != nil {
+			return stmtCachePoint{}, fmt.Errorf("query error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+	elapsed := time.Since(start)
+	r := rec.result(queries, elapsed)
+	return stmtCachePoint{
+		CacheSize:  size,
+		Statements: n,
+		Queries:    queries,
+		Duration:   elapsed,
+		QueriesSec: r.RowsPerSec(),
+		Latency:    r.Latency,
+	}, nil
+}
+
+// reportStmtCache prints the sweep table and, per cache size, the first
+// statement count whose throughput fell more than a fifth below the best
+// one that fit in the cache.
+func reportStmtCache(points []stmtCachePoint) {
+	log.Printf("%-10s %-10s %12s %12s", "cache", "statements", "queries/s", "p99")
+	for _, p := range points {
+		log.Printf("%-10d %-10d %12.0f %12v", p.CacheSize, p.Statements, p.QueriesSec, roundLatency(p.Latency.P99))
+	}
+	bySize := map[int][]stmtCachePoint{}
+	var order []int
+	for _, p := range points {
+		if _, seen := bySize[p.CacheSize]; !seen {
+			order = append(order, p.CacheSize)
+		}
+		bySize[p.CacheSize] = append(bySize[p.CacheSize], p)
+	}
+	for _, size := range order {
+		var best float64
+		for _, p := range bySize[size] {
+			if p.Statements <= size && p.QueriesSec > best {
+				best = p.QueriesSec
+			}
+		}
+		if best == 0 {
+			log.Printf("Cache %d: every statement count exceeds it; add one that fits to see the knee", size)
+			continue
+		}
+		knee := -1
+		for _, p := range bySize[size] {
+			if p.Statements > size && p.QueriesSec < best*0.8 {
+				knee = p.Statements
+				break
+			}
+		}
+		if knee < 0 {
+			log.Printf("Cache %d: no thrash within the statement counts swept", size)
+		} else {
+			log.Printf("Cache %d: thrash from %d statements (below 80%% of %s queries/s)", size, knee, formatRate(best))
+		}
+	}
+}
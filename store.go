@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// storedRun is one finished run in the results store.
+type storedRun struct {
+	ID         string      `json:"id"`
+	At         time.Time   `json:"at"`
+	Target     string      `json:"target"`
+	Results    []Result    `json:"results"`
+	Error      string      `json:"error,omitempty"`
+	Provenance *provenance `json:"provenance,omitempty"`
+}
+
+// resultsStore keeps finished runs as one JSON file each in a directory,
+// named by the run ID so that they list in chronological order. With a
+// signKey every file is signed as it is saved.
+type resultsStore struct {
+	dir     string
+	signKey string
+}
+
+// save assigns run its ID and time and writes it to the store.
+func (s resultsStore) save(run storedRun) (storedRun, error) {
+	run.At = time.Now().UTC()
+	run.ID = run.At.Format("20060102T150405.000000Z")
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return run, fmt.Errorf("create results store: %v", err)
+	}
+	path := filepath.Join(s.dir, run.ID+".json")
+	if err := writeJSON(path, run); err != nil {
+		return run, err
+	}
+	if s.signKey != "" {
+		if err := signFile(s.signKey, path); err != nil {
+			return run, fmt.Errorf("sign %s: %v", path, err)
+		}
+	}
+	return run, nil
+}
+
+// list returns the stored runs, newest first.
+func (s resultsStore) list() ([]storedRun, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	runs := make([]storedRun, 0, len(paths))
+	for _, path := range paths {
+		run, err := s.load(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func (s resultsStore) load(id string) (storedRun, error) {
+	var run storedRun
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return run, fmt.Errorf("invalid run ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if err != nil {
+		return run, fmt.Errorf("read run %s: %v", id, err)
+	}
+	if err := json.Unmarshal(data, &run); err != nil {
+		return run, fmt.Errorf("parse run %s: %v", id, err)
+	}
+	return run, nil
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// RunOptions bounds how much work a single strategy performs. A strategy
+// stops once it has inserted Rows rows or Duration has elapsed, whichever
+// comes first; a zero value disables that bound. Engine is the target the
+// strategy's SQL must be adapted to; BatchSize is the rows per round trip
+// for strategies that batch; Params carries strategy-specific knobs.
+//
+// Unless SharedTable is set, runBenchmark gives every strategy a dedicated
+// copy of benchmark_users and sets Table to it.
+type RunOptions struct {
+	Rows        int
+	Duration    time.Duration
+	Engine      *engine
+	BatchSize   int
+	Params      map[string]string
+	SharedTable bool
+	Table       string
+	// Explain is explainPlan or explainAnalyze to capture the plans of the
+	// queries read strategies run.
+	Explain string
+	// Dashboard, if set, shows the run live and lets the user skip
+	// strategies or abort.
+	Dashboard *dashboard
+	// Hook, if set, runs an external command during one strategy and
+	// records its throughput timeline.
+	Hook *measuredHook
+	// Hooks, if set, are run around the setup and run of each strategy and
+	// after the run.
+	Hooks *phaseHooks
+	// ColdCache, if set, measures read strategies cold and warm apart.
+	ColdCache *coldCache
+	// Rate, if positive, caps the operations per second of the run's
+	// workers; it can be changed while the run is in progress through
+	// liveRun.
+	Rate float64
+	// ServerTime reports how much of each strategy's latency the server
+	// spent executing statements, from the engine's ServerTime counters.
+	ServerTime bool
+	// TopStatements, if positive, is how many of the statement digests the
+	// server spent most time on during each strategy to report.
+	TopStatements int
+	// HostMetrics, if set, samples the database host's CPU and disks
+	// during each strategy.
+	HostMetrics *hostMetrics
+	// Selection, if set, narrows and reorders the strategy sequence.
+	Selection *strategySelection
+	// MaxRuntime, if positive, bounds the whole run, every strategy and
+	// repetition together; the results that completed before it are kept.
+	MaxRuntime time.Duration
+	// Cost, if set, estimates what each strategy's rows cost on the
+	// database's instance type.
+	Cost *costModel
+	// Auto, if set, sizes each strategy's rows by growing them until the
+	// measurement is long and precise enough, replacing Rows.
+	Auto *autoIterations
+	// Preview, if set, estimates the run from a calibration sample and
+	// asks to confirm before it starts.
+	Preview *preview
+	// Preflight checks the user's privileges once connected, failing the
+	// run before any work if one is missing.
+	Preflight bool
+	// Probe has the target's capabilities probed once it's connected.
+	Probe bool
+	// Capabilities, if set, are what probing the target found; strategies
+	// it can't run are skipped with the reason instead of failing the run.
+	Capabilities *capabilities
+	// Trace, if set, records a Go execution trace of each strategy.
+	Trace *executionTrace
+	// Faults, if set, fails a share of each strategy's statements before
+	// running them, to measure the error path.
+	Faults *faultInjector
+}
+
+const sharedTable = "benchmark_users"
+
+// table is the table the strategy writes to and reads from.
+func (o RunOptions) table() string {
+	if o.Table == "" {
+		return sharedTable
+	}
+	return o.Table
+}
+
+const defaultBatchSize = 100
+
+func (o RunOptions) batchSize() int {
+	if o.BatchSize <= 0 {
+		return defaultBatchSize
+	}
+	return o.BatchSize
+}
+
+// nextBatch is the size of the next batch given rows already inserted,
+// trimmed so that a row-bounded run never overshoots Rows.
+func (o RunOptions) nextBatch(inserted int) int {
+	n := o.batchSize()
+	if o.Rows > 0 && o.Rows-inserted < n {
+		n = o.Rows - inserted
+	}
+	return n
+}
+
+const insertUserSQL = "INSERT INTO benchmark_users (name, email) VALUES (?, ?)"
+
+func (o RunOptions) bind(query string) string {
+	return o.Engine.rebind(query)
+}
+
+// insertSQL is insertUserSQL against the strategy's table, rebound.
+func (o RunOptions) insertSQL() string {
+	return o.bind("INSERT INTO " + o.table() + " (name, email) VALUES (?, ?)")
+}
+
+// phase divides Rows and Duration evenly between n phases run one after
+// another, keeping at least one row in row-bounded runs.
+func (o RunOptions) phase(n int) RunOptions {
+	rows := o.Rows
+	o.Rows /= n
+	if rows > 0 && o.Rows == 0 {
+		o.Rows = 1
+	}
+	o.Duration /= time.Duration(n)
+	return o
+}
+
+// done reports whether the strategy is done after rows operations. While
+// it isn't, done holds the caller back until the target rate admits its
+// next operation.
+func (o RunOptions) done(rows int, start time.Time) bool {
+	if o.Rows > 0 && rows >= o.Rows {
+		return true
+	}
+	liveRun.wait()
+	return o.Duration > 0 && time.Since(start) >= o.Duration
+}
+
+// Result is the outcome of running one strategy.
+type Result struct {
+	Strategy string        `json:"strategy"`
+	Workload string        `json:"workload,omitempty"`
+	Rows     int           `json:"rows"`
+	Duration time.Duration `json:"duration_ns"`
+	Latency  LatencyStats  `json:"latency"`
+	// Transactions and Retries are reported by strategies that commit in
+	// batches and retry serialization failures.
+	Transactions int `json:"transactions,omitempty"`
+	Retries      int `json:"retries,omitempty"`
+	// Metrics holds strategy-specific measurements, keyed by snake_case name.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// Plans are the captured query plans of read strategies.
+	Plans []queryPlan `json:"plans,omitempty"`
+	// Statements are the statement digests the server spent most time on
+	// during the strategy, with -top-statements.
+	Statements []statementDigest `json:"statements,omitempty"`
+	// Timeline and Events are the throughput over time and the window of
+	// the external command run with -hook, for the strategy it ran during.
+	Timeline []timelineSample `json:"timeline,omitempty"`
+	Events   []timelineEvent  `json:"events,omitempty"`
+	// Host is the database host's load over the strategy, with -host-metrics.
+	Host []hostSample `json:"host,omitempty"`
+	// LatencySample is an evenly spaced subset of the operation latencies,
+	// kept with the result so that later runs can be tested against it for
+	// significance.
+	LatencySample []time.Duration `json:"latency_sample_ns,omitempty"`
+	// Skipped, if set, is why the strategy didn't run on this target; the
+	// result then has no measurements.
+	Skipped string `json:"skipped,omitempty"`
+	// Trace is the file the strategy's Go execution trace was written to
+	// (-trace).
+	Trace string `json:"trace,omitempty"`
+
+	samples []time.Duration
+	// sampleTimes are when each sample's operation finished, with -heatmap.
+	sampleTimes []time.Duration
+}
+
+func (r Result) RowsPerSec() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Rows) / r.Duration.Seconds()
+}
+
+// RetryRate is the average number of retries per committed transaction.
+func (r Result) RetryRate() float64 {
+	if r.Transactions == 0 {
+		return 0
+	}
+	return float64(r.Retries) / float64(r.Transactions)
+}
+
+// MarshalJSON adds the derived throughput so consumers don't recompute it.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type plain Result
+	return json.Marshal(struct {
+		plain
+		RowsPerSec float64 `json:"rows_per_sec"`
+	}{plain(r), r.RowsPerSec()})
+}
+
+type Strategy struct {
+	Name        string
+	Description string
+	// Engines lists the engines the strategy works on; empty means all.
+	// Strategies written against the dialect rather than one engine leave
+	// it empty and list the SQL features they need in Features instead.
+	Engines  []string
+	Features feature
+	// Params documents the -param knobs the strategy reads.
+	Params []Param
+	// Read marks query workloads, whose Result.Rows counts queries executed
+	// rather than rows inserted.
+	Read bool
+	// Workload is the engine-neutral kind of work the strategy performs, so
+	// strategies of different engines can be compared side by side.
+	Workload string
+	// Table overrides the dedicated table name and is used even with
+	// SharedTable: for strategies that alter their table (e.g. add an
+	// index) or read what another strategy wrote.
+	Table string
+	// Schema, if set, returns the DDL creating the strategy's table for
+	// strategies that don't work on benchmark_users' columns, usually the
+	// dialect's createTable; it must be idempotent.
+	Schema func(e *engine, table string) string
+	// Enabled, if set, decides from the run options whether the strategy
+	// runs at all, for strategies that need explicit configuration.
+	Enabled func(opts RunOptions) bool
+	// Probe, if set, checks before the strategy runs that the target has
+	// what it needs beyond Features, e.g. a column type or function; an
+	// error skips the strategy with the error as the reason.
+	Probe func(ctx context.Context, db *sql.DB, opts RunOptions) error
+	// Requires describes the configuration Enabled looks for beyond the
+	// engine, for the list command.
+	Requires string
+	Run      func(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error)
+}
+
+// Workload kinds shared across engines.
+const (
+	workloadSingleInsert = "single-row insert"
+	workloadBatchInsert  = "batched insert"
+	workloadTxInsert     = "transactional insert"
+	workloadPointRead    = "point read"
+	workloadAnalytics    = "analytical query"
+	workloadHotUpdate    = "contended update"
+	workloadAdvisoryLock = "advisory lock"
+	workloadQueue        = "queue dequeue"
+	workloadCounter      = "counter increment"
+	workloadScan         = "row scan"
+	workloadRadius       = "radius query"
+	workloadVectorSearch = "vector search"
+	workloadTimeSeries   = "time-series append"
+	workloadRetention    = "insert with retention purge"
+	workloadAggregates   = "aggregate reads and writes"
+	workloadInterference = "bulk load with point reads"
+	workloadOutage       = "insert through an outage"
+)
+
+// table is the strategy's dedicated table, e.g. benchmark_users_pool_exec.
+func (s Strategy) table() string {
+	if s.Table != "" {
+		return s.Table
+	}
+	return sharedTable + "_" + strings.ReplaceAll(s.Name, "-", "_")
+}
+
+// tableFor is the table the strategy uses in a run with opts.
+func (s Strategy) tableFor(opts RunOptions) string {
+	if opts.SharedTable && s.Table == "" {
+		return sharedTable
+	}
+	return s.table()
+}
+
+// runsWith reports whether the strategy takes part in a run with opts.
+func (s Strategy) runsWith(opts RunOptions) bool {
+	return opts.Selection.selects(s.Name) && s.supports(opts.Engine) && (s.Enabled == nil || s.Enabled(opts))
+}
+
+// runnableCount is how many strategies a run with opts runs, for a native
+// engine how many of its own workloads the selection keeps.
+func (opts RunOptions) runnableCount() int {
+	n := 0
+	if opts.Engine != nil && opts.Engine.Native != nil {
+		for _, wl := range opts.Engine.Workloads {
+			if opts.Selection.selects(wl.Name) {
+				n++
+			}
+		}
+		return n
+	}
+	for _, s := range strategies {
+		if s.runsWith(opts) {
+			n++
+		}
+	}
+	return n
+}
+
+// prepare returns the options for running s, creating its dedicated table
+// first unless the run shares one.
+func (s Strategy) prepare(ctx context.Context, db *sql.DB, opts RunOptions) (RunOptions, error) {
+	if opts.SharedTable && s.Table == "" {
+		return opts, nil
+	}
+	opts.Table = s.table()
+	if s.Schema != nil {
+		if _, err := db.ExecContext(ctx, s.Schema(opts.Engine, opts.Table)); err != nil {
+			return opts, fmt.Errorf("create table %s: %v", opts.Table, err)
+		}
+		return opts, nil
+	}
+	if opts.Table == sharedTable {
+		return opts, nil
+	}
+	if err := opts.Engine.cloneTable(ctx, db, opts.Table); err != nil {
+		return opts, fmt.Errorf("create table %s: %v", opts.Table, err)
+	}
+	return opts, nil
+}
+
+func (s Strategy) supports(e *engine) bool {
+	name, d := "mysql", mysqlDialect
+	if e != nil {
+		name, d = e.Name, e.dialect
+	}
+	needs := s.Features
+	if s.Schema != nil {
+		needs |= featureCreateTable
+	}
+	if needs&^d.Features != 0 {
+		return false
+	}
+	if len(s.Engines) == 0 {
+		return true
+	}
+	for _, n := range s.Engines {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+var strategies = []Strategy{
+	{Name: "pool-query", Description: "Direct db.Query", Params: dataParams, Workload: workloadSingleInsert, Run: insertUsingPoolQuery},
+	{Name: "conn-exec", Description: "Using db.Conn.ExecContext", Params: dataParams, Workload: workloadSingleInsert, Run: insertUsingGetConnection},
+	{Name: "pool-exec", Description: "Direct db.Exec", Params: dataParams, Workload: workloadSingleInsert, Run: insertUsingPoolExec},
+	{Name: "transaction", Description: "Using transaction", Params: dataParams, Workload: workloadTxInsert, Run: insertUsingTransaction},
+	{Name: "batch-insert", Description: "Using multi-row INSERT", Features: featureMultiRowValues, Params: dataParams, Workload: workloadBatchInsert, Run: insertUsingMultiRowInsert},
+}
+
+func insertUsingPoolQuery(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	start := time.Now()
+	gen := opts.rowGen("Pool")
+
+	var rec latencyRecorder
+	i := 0
+	for ; !opts.done(i, start); i++ {
+		name, email := gen.row(i)
+		opStart := time.Now()
+		rows, err := db.QueryContext(ctx, opts.insertSQL(), name, email)
+		if err != nil {
+			return Result{}, fmt.Errorf("query error: %v", err)
+		}
+		rows.Close()
+		rec.observe(time.Since(opStart))
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+func insertUsingGetConnection(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	start := time.Now()
+	gen := opts.rowGen("Conn")
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("get connection error: %v", err)
+	}
+	defer conn.Close()
+
+	var rec latencyRecorder
+	i := 0
+	for ; !opts.done(i, start); i++ {
+		name, email := gen.row(i)
+		opStart := time.Now()
+		_, err := conn.ExecContext(ctx, opts.insertSQL(), name, email)
+		if err != nil {
+			return Result{}, fmt.Errorf("exec error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+func insertUsingPoolExec(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	start := time.Now()
+	gen := opts.rowGen("Exec")
+
+	var rec latencyRecorder
+	i := 0
+	for ; !opts.done(i, start); i++ {
+		name, email := gen.row(i)
+		opStart := time.Now()
+		_, err := db.ExecContext(ctx, opts.insertSQL(), name, email)
+		if err != nil {
+			return Result{}, fmt.Errorf("exec error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+func insertUsingTransaction(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	start := time.Now()
+	gen := opts.rowGen("Tx")
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("begin transaction error: %v", err)
+	}
+
+	var rec latencyRecorder
+	i := 0
+	for ; !opts.done(i, start); i++ {
+		name, email := gen.row(i)
+		opStart := time.Now()
+		_, err := tx.ExecContext(ctx, opts.insertSQL(), name, email)
+		if err != nil {
+			tx.Rollback()
+			return Result{}, fmt.Errorf("tx exec error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Result{}, fmt.Errorf("commit error: %v", err)
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+// multiRowInsert builds one INSERT into table carrying n rows starting at
+// row first.
+func multiRowInsert(table string, gen *rowGen, first, n int) (string, []any) {
+	var b strings.Builder
+	b.WriteString("INSERT INTO " + table + " (name, email) VALUES ")
+	args := make([]any, 0, 2*n)
+	for j := 0; j < n; j++ {
+		if j > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(?, ?)")
+		name, email := gen.row(first + j)
+		args = append(args, name, email)
+	}
+	return b.String(), args
+}
+
+func insertUsingMultiRowInsert(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	start := time.Now()
+	gen := opts.rowGen("Batch")
+
+	var rec latencyRecorder
+	i := 0
+	for !opts.done(i, start) {
+		n := opts.nextBatch(i)
+		query, args := multiRowInsert(opts.table(), gen, i, n)
+
+		opStart := time.Now()
+		if _, err := db.ExecContext(ctx, opts.bind(query), args...); err != nil {
+			return Result{}, fmt.Errorf("batch insert error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+		i += n
+	}
+
+	return rec.result(i, time.Since(start)), nil
+}
+
+func logResult(s Strategy, result Result) {
+	verb, unit := "Inserted", "rows"
+	switch {
+	case s.Read:
+		verb, unit = "Executed", "queries"
+	case s.Workload == workloadHotUpdate:
+		verb = "Updated"
+	case s.Workload == workloadAdvisoryLock:
+		verb, unit = "Acquired", "locks"
+	case s.Workload == workloadQueue:
+		verb, unit = "Dequeued", "jobs"
+	case s.Workload == workloadCounter:
+		verb, unit = "Applied", "increments"
+	case s.Workload == workloadScenario:
+		verb, unit = "Completed", "scenarios"
+	}
+	log.Printf("%s: %s %d %s in %s (%s/s, p50 %s, p95 %s)", s.Description, verb, result.Rows, unit, formatDuration(result.Duration),
+		formatRate(result.RowsPerSec()), formatDuration(result.Latency.P50), formatDuration(result.Latency.P95))
+	if result.Transactions > 0 {
+		log.Printf("%s: %d transactions, %d retries (%.2f retries/tx)", s.Name, result.Transactions, result.Retries, result.RetryRate())
+	}
+}
+
+func runBenchmark(ctx context.Context, db *sql.DB, opts RunOptions) ([]Result, error) {
+	log.Println("Starting benchmark...")
+
+	var results []Result
+	for _, s := range opts.Selection.ordered() {
+		if !s.runsWith(opts) {
+			continue
+		}
+		if reason := opts.Capabilities.unsupported(ctx, db, s, opts); reason != "" {
+			log.Printf("%s: skipped: %s", s.Name, reason)
+			events.emit("strategy_skipped", map[string]any{"strategy": s.Name, "reason": reason})
+			results = append(results, Result{Strategy: s.Name, Workload: s.Workload, Skipped: reason})
+			continue
+		}
+		if err := opts.Hooks.before(ctx, phaseBeforeSetup, s, opts); err != nil {
+			return results, fmt.Errorf("%s: %v", s.Name, err)
+		}
+		sOpts, err := s.prepare(ctx, db, opts)
+		if err != nil {
+			return results, fmt.Errorf("%s: %v", s.Name, err)
+		}
+		if err := opts.Hooks.before(ctx, phaseBeforeStrategy, s, sOpts); err != nil {
+			return results, fmt.Errorf("%s: %v", s.Name, err)
+		}
+		runCtx := ctx
+		if opts.Dashboard != nil {
+			runCtx = opts.Dashboard.start(ctx, s, db)
+		}
+		var hook *hookRun
+		if opts.Hook != nil && opts.Hook.matches(s) {
+			hook = opts.Hook.begin(runCtx, s, db, sOpts)
+		}
+		if opts.ServerTime {
+			s.Run = measureServerTime(s, opts.Engine)
+		}
+		if opts.TopStatements > 0 {
+			s.Run = captureTopStatements(s, opts.Engine, opts.TopStatements)
+		}
+		if opts.Auto != nil {
+			s.Run = opts.Auto.wrap(s)
+		}
+		events.emit("strategy_start", map[string]any{"strategy": s.Name, "workload": s.Workload, "table": sOpts.Table})
+		host := opts.HostMetrics.begin(runCtx)
+		traceCtx, tr := opts.Trace.begin(runCtx, s)
+		faults := opts.Faults.begin()
+		result, err := opts.ColdCache.run(traceCtx, db, s, sOpts)
+		faults.end(s, &result)
+		tr.end(s, &result)
+		host.end(s, &result)
+		if hook != nil {
+			hook.end(ctx, s, &result)
+		}
+		opts.Hooks.afterStrategy(ctx, s, sOpts, result, err)
+		if opts.Dashboard != nil {
+			skipped, abortErr := opts.Dashboard.finish(result, err)
+			if abortErr != nil {
+				return results, abortErr
+			}
+			if skipped {
+				log.Printf("%s: skipped", s.Name)
+				events.emit("strategy_skipped", map[string]any{"strategy": s.Name})
+				continue
+			}
+		}
+		if err != nil {
+			events.emit("strategy_failed", map[string]any{"strategy": s.Name, "error": redact(err.Error())})
+			return results, fmt.Errorf("%s: %v", s.Name, err)
+		}
+		result.Strategy, result.Workload = s.Name, s.Workload
+		result.LatencySample = sampleLatencies(result.samples, storedLatencySamples)
+		opts.Cost.estimate(&result)
+		logResult(s, result)
+		events.emit("strategy_result", strategyEvent(result))
+		results = append(results, result)
+	}
+
+	log.Println("Benchmark completed.")
+	return results, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type sweepPoint struct {
+	Procs      int
+	Workers    int
+	Rows       int
+	Duration   time.Duration
+	RowsPerSec float64
+	// CPUUtil is the fraction of the GOMAXPROCS cores the client kept busy,
+	// or -1 when process CPU time is unavailable on this platform.
+	CPUUtil float64
+}
+
+func sweepCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	procsFlag := fs.String("procs", defaultProcsList(), "comma-separated GOMAXPROCS values to sweep")
+	workersFlag := fs.String("workers", getEnv("BENCHMARK_SWEEP_WORKERS", "1,2,4,8,16,32"), "comma-separated worker counts to sweep")
+	rows := fs.Int("n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000), "rows to insert per sweep point")
+	threshold := fs.Float64("threshold", 0.10, "minimum relative throughput gain that counts as scaling")
+	fs.Parse(args)
+
+	procs, err := parseIntList(*procsFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -procs: %v", err)
+	}
+	workers, err := parseIntList(*workersFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -workers: %v", err)
+	}
+
+	// Every worker must be able to hold its own connection, otherwise the
+	// sweep measures pool contention instead of the client or the server.
+	for _, w := range workers {
+		if w > config.PoolSize {
+			config.PoolSize = w
+		}
+	}
+
+	db, err := createConnectionPool(config)
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	points, err := runSweep(db, eng, procs, workers, *rows)
+	if err != nil {
+		return err
+	}
+	reportSweep(points, *threshold)
+	return nil
+}
+
+func defaultProcsList() string {
+	var procs []string
+	for p := 1; p < runtime.NumCPU(); p *= 2 {
+		procs = append(procs, strconv.Itoa(p))
+	}
+	procs = append(procs, strconv.Itoa(runtime.NumCPU()))
+	return getEnv("BENCHMARK_SWEEP_PROCS", strings.Join(procs, ","))
+}
+
+func runSweep(db *sql.DB, eng *engine, procs, workers []int, n int) ([]sweepPoint, error) {
+	previous := runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(previous)
+
+	var points []sweepPoint
+	for _, p := range procs {
+		runtime.GOMAXPROCS(p)
+		for _, w := range workers {
+			cpuBefore, cpuOK := processCPUTime()
+			duration, err := runConcurrent(context.Background(), w, n, func(ctx context.Context, i int) error {
+				_, err := db.ExecContext(ctx,
+					eng.rebind(insertUserSQL),
+					fmt.Sprintf("UserSweep%d", i),
+					fmt.Sprintf("sweep%d@example.com", i),
+				)
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("sweep procs=%d workers=%d: %v", p, w, err)
+			}
+			cpuAfter, _ := processCPUTime()
+
+			point := sweepPoint{
+				Procs:      p,
+				Workers:    w,
+				Rows:       n,
+				Duration:   duration,
+				RowsPerSec: float64(n) / duration.Seconds(),
+				CPUUtil:    -1,
+			}
+			if cpuOK {
+				point.CPUUtil = (cpuAfter - cpuBefore).Seconds() / (duration.Seconds() * float64(p))
+			}
+			log.Printf("Sweep GOMAXPROCS=%d workers=%d: %d rows in %s (%s rows/s)", p, w, n, formatDuration(duration), formatRate(point.RowsPerSec))
+			points = append(points, point)
+		}
+	}
+	return points, nil
+}
+
+// reportSweep prints the sweep table and where throughput stops scaling.
+// If more GOMAXPROCS still buys throughput at the peak, or the client keeps
+// its cores busy, the driver machine is the bottleneck; otherwise it is the
+// database (or the network in between).
+func reportSweep(points []sweepPoint, threshold float64) {
+	log.Printf("%-10s %-8s %12s %8s", "GOMAXPROCS", "workers", "rows/s", "cpu")
+	byProcs := map[int][]sweepPoint{}
+	var procsOrder []int
+	for _, p := range points {
+		if _, seen := byProcs[p.Procs]; !seen {
+			procsOrder = append(procsOrder, p.Procs)
+		}
+		byProcs[p.Procs] = append(byProcs[p.Procs], p)
+		cpu := "n/a"
+		if p.CPUUtil >= 0 {
+			cpu = fmt.Sprintf("%.0f%%", p.CPUUtil*100)
+		}
+		log.Printf("%-10d %-8d %12.0f %8s", p.Procs, p.Workers, p.RowsPerSec, cpu)
+	}
+
+	peaks := make([]sweepPoint, 0, len(procsOrder))
+	for _, procs := range procsOrder {
+		series := byProcs[procs]
+		saturated := series[len(series)-1]
+		for i := 1; i < len(series); i++ {
+			if series[i].RowsPerSec < series[i-1].RowsPerSec*(1+threshold) {
+				saturated = series[i-1]
+				break
+			}
+		}
+		peak := series[0]
+		for _, p := range series {
+			if p.RowsPerSec > peak.RowsPerSec {
+				peak = p
+			}
+		}
+		peaks = append(peaks, peak)
+		log.Printf("GOMAXPROCS=%d saturates at %d workers (peak %s rows/s at %d workers)",
+			procs, saturated.Workers, formatRate(peak.RowsPerSec), peak.Workers)
+	}
+
+	if len(peaks) == 0 {
+		return
+	}
+	first, last := peaks[0], peaks[len(peaks)-1]
+	switch {
+	case len(peaks) > 1 && last.RowsPerSec >= first.RowsPerSec*(1+threshold):
+		log.Printf("Verdict: client-bound — raising GOMAXPROCS %d→%d raised peak throughput %s→%s rows/s",
+			first.Procs, last.Procs, formatRate(first.RowsPerSec), formatRate(last.RowsPerSec))
+	case last.CPUUtil >= 0.9:
+		log.Printf("Verdict: client-bound — the driver used %.0f%% of %d cores at peak", last.CPUUtil*100, last.Procs)
+	default:
+		log.Printf("Verdict: database-bound — more client CPU or workers did not raise throughput beyond %s rows/s", formatRate(last.RowsPerSec))
+	}
+}
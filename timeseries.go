@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "time-series",
+		Description: "Appending device readings with periodic range aggregations",
+		Features:    featureMultiRowValues,
+		Params: []Param{
+			{Name: "ts.devices", Default: "100", Description: "devices reporting readings, the tag of each row"},
+			{Name: "ts.interval", Default: "1s", Description: "time between two readings of a device"},
+			{Name: "ts.query_every", Default: "10", Description: "batches inserted between two range aggregations (0 = none)"},
+			{Name: "ts.window", Default: "1h", Description: "time range each aggregation covers, ending at the newest reading"},
+			{Name: "ts.bucket", Default: "1m", Description: "time bucket the aggregation groups readings by"},
+		},
+		Workload: workloadTimeSeries,
+		Table:    "benchmark_readings",
+		Schema: func(e *engine, table string) string {
+			return e.createTable(table, []column{
+				{Name: "device_id", Type: typeBigInt, NotNull: true},
+				{Name: "ts", Type: typeBigInt, NotNull: true},
+				{Name: "reading", Type: typeBigInt, NotNull: true},
+			}, "device_id", "ts")
+		},
+		Run: appendTimeSeries,
+	})
+}
+
+// appendTimeSeries inserts batches of readings in time order, each device
+// reporting once per ts.interval, and every ts.query_every batches runs the
+// dashboard query of such workloads: per device and ts.bucket the count,
+// average and maximum of the last ts.window. Timestamps are Unix
+// milliseconds in a BIGINT column so that the same schema runs on every
+// dialect (and as an integer-time hypertable); they continue from the
+// table's newest reading, so later runs keep appending. Rows counts
+// readings and the latency is per batch; Metrics report the aggregations'
+// latency as agg_p50_ns and agg_p99_ns, as the interference between
+// ingest and queries is what time-series engines are compared on.
+func appendTimeSeries(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	devices := opts.intParam("ts.devices", 100)
+	queryEvery := opts.intParam("ts.query_every", 10)
+	if devices < 1 || queryEvery < 0 {
+		return Result{}, fmt.Errorf("ts.devices must be at least 1 and ts.query_every not negative")
+	}
+	var interval, window, bucket time.Duration
+	for _, p := range []struct {
+		name, def string
+		d         *time.Duration
+	}{{"ts.interval", "1s", &interval}, {"ts.window", "1h", &window}, {"ts.bucket", "1m", &bucket}} {
+		d, err := time.ParseDuration(opts.param(p.name, p.def))
+		if err != nil || d < time.Millisecond {
+			return Result{}, fmt.Errorf("%s: invalid duration %q (at least 1ms)", p.name, opts.param(p.name, p.def))
+		}
+		*p.d = d
+	}
+
+	var newest sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT MAX(ts) FROM "+opts.table()).Scan(&newest); err != nil {
+		return Result{}, fmt.Errorf("find newest reading: %v", err)
+	}
+	first := time.Now().UnixMilli()
+	if newest.Valid {
+		first = newest.Int64 + interval.Milliseconds()
+	}
+	// Reading i is device i%devices' reading number i/devices.
+	at := func(i int) int64 { return first + int64(i/devices)*interval.Milliseconds() }
+
+	aggregate := opts.bind(fmt.Sprintf("SELECT device_id, ts - MOD(ts, %[2]d), COUNT(*), AVG(reading), MAX(reading) FROM %[1]s "+
+		"WHERE ts >= ? AND ts < ? GROUP BY device_id, ts - MOD(ts, %[2]d)", opts.table(), bucket.Milliseconds()))
+	plans := opts.planRecorder()
+	if queryEvery > 0 {
+		plans.capture(ctx, db, aggregate, first-window.Milliseconds(), first)
+	}
+	rng := rand.New(rand.NewSource(first))
+	var rec latencyRecorder
+	var aggregations []time.Duration
+	inserted, batches := 0, 0
+	start := time.Now()
+	for !opts.done(inserted, start) {
+		n := opts.nextBatch(inserted)
+		var b strings.Builder
+		b.WriteString("INSERT INTO " + opts.table() + " (device_id, ts, reading) VALUES ")
+		args := make([]any, 0, 3*n)
+		for j := 0; j < n; j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("(?, ?, ?)")
+			i := inserted + j
+			args = append(args, i%devices, at(i), 1000+rng.Int63n(100))
+		}
+		opStart := time.Now()
+		if _, err := db.ExecContext(ctx, opts.bind(b.String()), args...); err != nil {
+			return Result{}, fmt.Errorf("insert error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+		inserted += n
+		batches++
+
+		if queryEvery > 0 && batches%queryEvery == 0 {
+			end := at(inserted-1) + 1
+			opStart := time.Now()
+			if _, err := countRows(ctx, db, aggregate, end-window.Milliseconds(), end); err != nil {
+				return Result{}, fmt.Errorf("aggregation error: %v", err)
+			}
+			aggregations = append(aggregations, time.Since(opStart))
+		}
+	}
+	result := rec.result(inserted, time.Since(start))
+	result.Plans = plans.plans
+	if len(aggregations) > 0 {
+		stats := summarizeLatency(aggregations)
+		result.Metrics = map[string]float64{
+			"aggregations": float64(len(aggregations)),
+			"agg_p50_ns":   float64(stats.P50.Nanoseconds()),
+			"agg_p99_ns":   float64(stats.P99.Nanoseconds()),
+		}
+		log.Printf("time-series: %d aggregations over %v (p50 %s, p99 %s)", len(aggregations), window, formatDuration(stats.P50), formatDuration(stats.P99))
+	}
+	return result, nil
+}
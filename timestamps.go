@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampTable holds the rows timestamps writes, the same instant in a
+// DATETIME and a TIMESTAMP column.
+const timestampTable = "benchmark_timestamps"
+
+// mysqlTimeLayout is how MySQL prints DATETIME and TIMESTAMP(6) values.
+const mysqlTimeLayout = "2006-01-02 15:04:05.999999"
+
+// timestampPoint is one combination of parseTime and session time zone.
+type timestampPoint struct {
+	ParseTime bool         `json:"parse_time"`
+	TimeZone  string       `json:"time_zone"`
+	Insert    LatencyStats `json:"insert"`
+	Read      LatencyStats `json:"read"`
+	ReadsSec  float64      `json:"reads_per_sec"`
+	// The mismatches count rows whose value read back is not the instant
+	// written: in the writing session, and for TIMESTAMP also in a +00:00
+	// session, which is how other clients see it.
+	DatetimeMismatches     int `json:"datetime_mismatches"`
+	TimestampMismatches    int `json:"timestamp_mismatches"`
+	TimestampMismatchesUTC int `json:"timestamp_mismatches_utc"`
+}
+
+// timestampsCommand writes the same instants into DATETIME and TIMESTAMP
+// columns and reads them back, with the driver's parseTime on and off and
+// under each session time zone in -time-zones, measuring the conversion
+// cost and checking what comes back. The driver formats time.Time values
+// in its loc (UTC here) without a zone; a TIMESTAMP column takes that as
+// the session's local time and converts it, a DATETIME stores it as is.
+// So with a session zone other than loc, TIMESTAMP values are shifted for
+// every other client, the classic pitfall of apps serving several zones.
+// parseTime off returns the raw text, which the command parses as the
+// application would have to.
+func timestampsCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("timestamps", flag.ExitOnError)
+	n := fs.Int("n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000), "rows written and read per combination")
+	zones := fs.String("time-zones", getEnv("BENCHMARK_TIME_ZONES", "+00:00,-08:00,+05:30"), "comma-separated session time_zone values; named zones need the server's time zone tables")
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the report to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write the measurements as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+	if *n < 1 {
+		return fmt.Errorf("-n must be at least 1")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	if eng.Driver != "mysql" {
+		return fmt.Errorf("timestamps compares MySQL's DATETIME and TIMESTAMP; engine %s is not supported", eng.Name)
+	}
+
+	// Other clients' view of the TIMESTAMP column.
+	utc, err := createConnectionPool(config.withParams(map[string]string{"parseTime": "true", "loc": "UTC", "time_zone": "'+00:00'"}))
+	if err != nil {
+		return fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer utc.Close()
+	ctx := context.Background()
+	table := "CREATE TABLE IF NOT EXISTS " + timestampTable + " (id BIGINT NOT NULL PRIMARY KEY, dt DATETIME(6) NOT NULL, ts TIMESTAMP(6) NOT NULL)"
+	if _, err := utc.ExecContext(ctx, table); err != nil {
+		return fmt.Errorf("create table %s: %v", timestampTable, err)
+	}
+
+	var points []timestampPoint
+	for _, parseTime := range []bool{true, false} {
+		for _, zone := range strings.Split(*zones, ",") {
+			zone = strings.TrimSpace(zone)
+			p, err := runTimestampPoint(ctx, config, utc, parseTime, zone, *n)
+			if err != nil {
+				return fmt.Errorf("parseTime=%v, time_zone %s: %v", parseTime, zone, err)
+			}
+			log.Printf("parseTime=%v, time_zone %s: insert p50 %s, read p50 %s, wrong values read back: %d DATETIME, %d TIMESTAMP (%d from +00:00)",
+				parseTime, zone, formatDuration(p.Insert.P50), formatDuration(p.Read.P50), p.DatetimeMismatches, p.TimestampMismatches, p.TimestampMismatchesUTC)
+			points = append(points, p)
+		}
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, points); err != nil {
+			return err
+		}
+	}
+	return writeMarkdown(*markdown, renderTimestamps(config.Target(), points), false)
+}
+
+// runTimestampPoint rewrites the table in a session with the given zone
+// and parseTime, then reads every row back in it and from utc.
+func runTimestampPoint(ctx context.Context, config DBConfig, utc *sql.DB, parseTime bool, zone string, n int) (timestampPoint, error) {
+	p := timestampPoint{ParseTime: parseTime, TimeZone: zone}
+	db, err := createConnectionPool(config.withParams(map[string]string{
+		"parseTime": strconv.FormatBool(parseTime),
+		"loc":       "UTC",
+		"time_zone": "'" + zone + "'",
+	}))
+	if err != nil {
+		return p, fmt.Errorf("failed to create connection pool: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "DELETE FROM "+timestampTable); err != nil {
+		return p, fmt.Errorf("clear table: %v", err)
+	}
+
+	// Instants an hour and a bit apart from a DST switch in the US and
+	// Europe, microsecond precision included.
+	base := time.Date(2024, 3, 10, 0, 0, 0, 123456000, time.UTC)
+	instant := func(i int) time.Time { return base.Add(time.Duration(i) * 61 * time.Minute) }
+
+	var inserts []time.Duration
+	for i := 0; i < n; i++ {
+		t := instant(i)
+		start := time.Now()
+		if _, err := db.ExecContext(ctx, "INSERT INTO "+timestampTable+" (id, dt, ts) VALUES (?, ?, ?)", i, t, t); err != nil {
+			return p, fmt.Errorf("insert error: %v", err)
+		}
+		inserts = append(inserts, time.Since(start))
+	}
+	p.Insert = summarizeLatency(inserts)
+
+	var reads []time.Duration
+	readStart := time.Now()
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		dt, ts, err := readTimestamps(ctx, db, i, parseTime)
+		if err != nil {
+			return p, err
+		}
+		reads = append(reads, time.Since(start))
+		if !dt.Equal(instant(i)) {
+			p.DatetimeMismatches++
+		}
+		if !ts.Equal(instant(i)) {
+			p.TimestampMismatches++
+		}
+	}
+	p.Read = summarizeLatency(reads)
+	p.ReadsSec = float64(n) / time.Since(readStart).Seconds()
+
+	for i := 0; i < n; i++ {
+		_, ts, err := readTimestamps(ctx, utc, i, true)
+		if err != nil {
+			return p, err
+		}
+		if !ts.Equal(instant(i)) {
+			p.TimestampMismatchesUTC++
+		}
+	}
+	return p, nil
+}
+
+// readTimestamps reads row id's columns as UTC times, parsing the text of
+// a session without parseTime.
+func readTimestamps(ctx context.Context, db *sql.DB, id int, parseTime bool) (dt, ts time.Time, err error) {
+	row := db.QueryRowContext(ctx, "SELECT dt, ts FROM "+timestampTable+" WHERE id = ?", id)
+	if parseTime {
+		if err := row.Scan(&dt, &ts); err != nil {
+			return dt, ts, fmt.Errorf("read error: %v", err)
+		}
+		return dt, ts, nil
+	}
+	var rawDT, rawTS []byte
+	if err := row.Scan(&rawDT, &rawTS); err != nil {
+		return dt, ts, fmt.Errorf("read error: %v", err)
+	}
+	if dt, err = time.ParseInLocation(mysqlTimeLayout, string(rawDT), time.UTC); err != nil {
+		return dt, ts, fmt.Errorf("parse %q: %v", rawDT, err)
+	}
+	if ts, err = time.ParseInLocation(mysqlTimeLayout, string(rawTS), time.UTC); err != nil {
+		return dt, ts, fmt.Errorf("parse %q: %v", rawTS, err)
+	}
+	return dt, ts, nil
+}
+
+func renderTimestamps(target string, points []timestampPoint) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### DATETIME and TIMESTAMP handling on %s\n\n", target)
+	b.WriteString("Values are written as UTC `time.Time`s (loc=UTC); wrong values are rows not read back as the instant written.\n\n")
+	b.WriteString("| parseTime | time_zone | insert p50 | read p50 | reads/s | wrong DATETIME | wrong TIMESTAMP | wrong TIMESTAMP from +00:00 |\n|---|---|---:|---:|---:|---:|---:|---:|\n")
+	for _, p := range points {
+		fmt.Fprintf(&b, "| %v | %s | %v | %v | %.0f | %d | %d | %d |\n", p.ParseTime, p.TimeZone,
+			roundLatency(p.Insert.P50), roundLatency(p.Read.P50), p.ReadsSec,
+			p.DatetimeMismatches, p.TimestampMismatches, p.TimestampMismatchesUTC)
+	}
+	return b.String()
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// tlsTable receives the inserts of the tls command.
+const tlsTable = "benchmark_users_tls"
+
+// tlsParams are the DSN parameters turning transport encryption off and
+// on per SQL driver; verified connections also check the server's
+// certificate against the system roots (for pgx, or sslrootcert in
+// DB_PARAMS).
+var tlsParams = map[string]struct{ Plain, TLS, Verified map[string]string }{
+	"mysql": {
+		Plain:    map[string]string{"tls": "false"},
+		TLS:      map[string]string{"tls": "skip-verify"},
+		Verified: map[string]string{"tls": "true"},
+	},
+	"pgx": {
+		Plain:    map[string]string{"sslmode": "disable"},
+		TLS:      map[string]string{"sslmode": "require"},
+		Verified: map[string]string{"sslmode": "verify-full"},
+	},
+}
+
+// atRestTarget is a database set up externally with or without encryption
+// at rest, e.g. in an encrypted MySQL tablespace.
+type atRestTarget struct {
+	Label    string
+	Host     string
+	Database string
+}
+
+// tlsPoint is one statement's throughput against one target with and
+// without TLS.
+type tlsPoint struct {
+	AtRest    string       `json:"at_rest,omitempty"`
+	TLS       bool         `json:"tls"`
+	Statement string       `json:"statement"`
+	Ops       int          `json:"ops"`
+	OpsPerSec float64      `json:"ops_per_sec"`
+	Latency   LatencyStats `json:"latency"`
+}
+
+func (p tlsPoint) column() string {
+	label := "plain"
+	if p.TLS {
+		label = "TLS"
+	}
+	if p.AtRest != "" {
+		label = p.AtRest + ", " + label
+	}
+	return label
+}
+
+// tlsCommand runs the same statements over unencrypted and TLS
+// connections, and with -at-rest against each of several databases whose
+// storage is encrypted or not, to tabulate what encryption in transit and
+// at rest cost. Connects open a new connection each, which is where the
+// TLS handshake shows; the other statements reuse pooled connections.
+// Reads return the shared table's rows, so seed it in every database first.
+func tlsCommand(config DBConfig, args []string) error {
+	fs := flag.NewFlagSet("tls", flag.ExitOnError)
+	n := fs.Int("n", getEnvAsInt("BENCHMARK_INSERT_COUNT", 1000), "executions per statement and configuration")
+	connects := fs.Int("connects", 50, "new connections opened per configuration")
+	verify := fs.Bool("verify", false, "verify the server's certificate on TLS connections")
+	atRest := fs.String("at-rest", getEnv("BENCHMARK_AT_REST", ""), "comma-separated label=database or label=host/database targets, e.g. plain=bench,encrypted=bench_enc")
+	markdown := fs.String("markdown", getEnv("BENCHMARK_MARKDOWN", "-"), `write the matrix to this file ("-" for stdout)`)
+	jsonPath := fs.String("json", "", `write the measurements as JSON to this file ("-" for stdout)`)
+	fs.Parse(args)
+	if *n < 1 || *connects < 1 {
+		return fmt.Errorf("-n and -connects must be at least 1")
+	}
+	eng, err := lookupEngine(config.Engine)
+	if err != nil {
+		return err
+	}
+	params, ok := tlsParams[eng.Driver]
+	if !ok {
+		return fmt.Errorf("engine %s's driver has no TLS setting; tls supports MySQL and pgx engines", eng.Name)
+	}
+	if *verify {
+		params.TLS = params.Verified
+	}
+	targets, err := parseAtRestTargets(*atRest, config)
+	if err != nil {
+		return err
+	}
+	statements := []protocolStatement{
+		{"point read", eng.rebind("SELECT name, email FROM " + sharedTable + " WHERE id = ?"), true},
+		{"range read", eng.rebind("SELECT id, name, email FROM " + sharedTable + " WHERE id > ? ORDER BY id " + eng.limit(100)), true},
+		{"insert", eng.rebind("INSERT INTO " + tlsTable + " (name, email) VALUES (?, ?)"), false},
+	}
+
+	ctx := context.Background()
+	var points []tlsPoint
+	for _, t := range targets {
+		for _, encrypted := range []bool{false, true} {
+			c := config
+			c.Host, c.Database = t.Host, t.Database
+			c = c.withParams(params.Plain)
+			if encrypted {
+				c = c.withParams(params.TLS)
+			}
+			label := tlsPoint{AtRest: t.Label, TLS: encrypted}.column()
+
+			p, err := measureConnects(c, *connects)
+			if err != nil {
+				return fmt.Errorf("%s: connect: %v", label, err)
+			}
+			p.AtRest, p.TLS = t.Label, encrypted
+			log.Printf("%s: connect: %s/s (p50 %s)", label, formatRate(p.OpsPerSec), formatDuration(p.Latency.P50))
+			points = append(points, p)
+
+			db, err := createConnectionPool(c)
+			if err != nil {
+				return fmt.Errorf("%s: failed to create connection pool: %v", label, err)
+			}
+			if err := eng.cloneTable(ctx, db, tlsTable); err != nil {
+				db.Close()
+				return fmt.Errorf("create table %s: %v", tlsTable, err)
+			}
+			for _, s := range statements {
+				r, err := runProtocolStatement(ctx, db, s, *n, false)
+				if err != nil {
+					db.Close()
+					return fmt.Errorf("%s: %s: %v", label, s.Name, err)
+				}
+				p := tlsPoint{AtRest: t.Label, TLS: encrypted, Statement: s.Name, Ops: r.Ops, OpsPerSec: r.OpsPerSec, Latency: r.Latency}
+				log.Printf("%s: %s: %s ops/s (p50 %s)", label, s.Name, formatRate(p.OpsPerSec), formatDuration(p.Latency.P50))
+				points = append(points, p)
+			}
+			db.Close()
+		}
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, points); err != nil {
+			return err
+		}
+	}
+	names := []string{"connect"}
+	for _, s := range statements {
+		names = append(names, s.Name)
+	}
+	return writeMarkdown(*markdown, renderTLSMatrix(config.Target(), names, points), false)
+}
+
+// parseAtRestTargets parses -at-rest, keeping the targets' order; without
+// any it returns the configured database alone, unlabeled.
+func parseAtRestTargets(value string, config DBConfig) ([]atRestTarget, error) {
+	var targets []atRestTarget
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		label, where, ok := strings.Cut(field, "=")
+		if !ok || label == "" || where == "" {
+			return nil, fmt.Errorf("-at-rest: expected label=database or label=host/database, got %q", field)
+		}
+		t := atRestTarget{Label: label, Host: config.Host, Database: where}
+		if host, database, ok := strings.Cut(where, "/"); ok {
+			t.Host, t.Database = host, database
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		targets = []atRestTarget{{Host: config.Host, Database: config.Database}}
+	}
+	return targets, nil
+}
+
+// measureConnects opens and pings n single-connection pools one after the
+// other, timing each.
+func measureConnects(config DBConfig, n int) (tlsPoint, error) {
+	config.PoolSize = 1
+	var rec latencyRecorder
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		opStart := time.Now()
+		db, err := createConnectionPool(config)
+		if err != nil {
+			return tlsPoint{}, err
+		}
+		rec.observe(time.Since(opStart))
+		db.Close()
+	}
+	r := rec.result(n, time.Since(start))
+	return tlsPoint{Statement: "connect", Ops: n, OpsPerSec: r.RowsPerSec(), Latency: r.Latency}, nil
+}
+
+// renderTLSMatrix tabulates statements against configurations, with the
+// difference of each configuration's p50 from the first's, which is the
+// first target without TLS.
+func renderTLSMatrix(target string, statements []string, points []tlsPoint) string {
+	var columns []string
+	for _, p := range points {
+		if label := p.column(); len(columns) == 0 || columns[len(columns)-1] != label {
+			columns = append(columns, label)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Encryption overhead on %s\n\np50 latency and ops/s per statement; the difference is against %s.\n\n", target, columns[0])
+	fmt.Fprintf(&b, "| statement | %s |\n|---|%s\n", strings.Join(columns, " | "), strings.Repeat("---:|", len(columns)))
+	for _, s := range statements {
+		cells := make([]string, len(columns))
+		var base time.Duration
+		for i, label := range columns {
+			cells[i] = "-"
+			for _, p := range points {
+				if p.Statement != s || p.column() != label {
+					continue
+				}
+				cells[i] = fmt.Sprintf("%v, %s/s", roundLatency(p.Latency.P50), formatRate(p.OpsPerSec))
+				if i == 0 {
+					base = p.Latency.P50
+				} else if base > 0 {
+					cells[i] += fmt.Sprintf(" (%+.0f%%)", 100*(float64(p.Latency.P50)/float64(base)-1))
+				}
+			}
+		}
+		fmt.Fprintf(&b, "| %s | %s |\n", s, strings.Join(cells, " | "))
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/trace"
+)
+
+// executionTrace records a Go execution trace of each strategy to Dir, as
+// <strategy>.trace, numbering the repetitions of a strategy run more than
+// once. The trace shows how the driver's goroutines were scheduled and what
+// they blocked on, in the network, on the pool's locks or in syscalls, for
+// go tool trace, and go tool trace -pprof=net (or sync, syscall, sched)
+// turns it into a profile of those waits to view as a flame graph.
+type executionTrace struct {
+	Dir  string
+	seen map[string]int
+}
+
+// traceRun is one strategy's trace in progress.
+type traceRun struct {
+	path string
+	file *os.File
+	task *trace.Task
+}
+
+// begin starts tracing s and returns the context to run it with, in which
+// the strategy is a user task named after it; on failure the strategy runs
+// untraced.
+func (t *executionTrace) begin(ctx context.Context, s Strategy) (context.Context, *traceRun) {
+	if t == nil {
+		return ctx, nil
+	}
+	if t.seen == nil {
+		t.seen = map[string]int{}
+	}
+	t.seen[s.Name]++
+	name := s.Name
+	if n := t.seen[s.Name]; n > 1 {
+		name = fmt.Sprintf("%s-%d", s.Name, n)
+	}
+	path := filepath.Join(t.Dir, name+".trace")
+	file, err := os.Create(path)
+	if err != nil {
+		log.Printf("Warning: %s: not traced: %v", s.Name, err)
+		return ctx, nil
+	}
+	if err := trace.Start(file); err != nil {
+		file.Close()
+		os.Remove(path)
+		log.Printf("Warning: %s: not traced: %v", s.Name, err)
+		return ctx, nil
+	}
+	ctx, task := trace.NewTask(ctx, s.Name)
+	return ctx, &traceRun{path: path, file: file, task: task}
+}
+
+// end stops the trace and records its path in result.
+func (r *traceRun) end(s Strategy, result *Result) {
+	if r == nil {
+		return
+	}
+	r.task.End()
+	trace.Stop()
+	if err := r.file.Close(); err != nil {
+		log.Printf("Warning: %s: could not write execution trace: %v", s.Name, err)
+		return
+	}
+	result.Trace = r.path
+	log.Printf("Execution trace for %s written to %s; view it with go tool trace %s", s.Name, r.path, r.path)
+}
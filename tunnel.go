@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultPorts are the ports engines listen on when DB_HOST has none,
+// which a tunnel needs to know to forward to.
+var defaultPorts = map[string]string{
+	"mysql":     "3306",
+	"tidb":      "4000",
+	"vitess":    "3306",
+	"cockroach": "26257",
+	"oracle":    "1521",
+	"mongodb":   "27017",
+	"redis":     "6379",
+}
+
+// openTunnel forwards a local port through SSH to the database when
+// DB_SSH_HOST is set, for targets only reachable from a bastion, and
+// points config at it:
+//
+//	DB_SSH_HOST         user@bastion[:port], the host that can reach DB_HOST
+//	DB_SSH_JUMP         user@host[:port], a jump host to reach the bastion through
+//	DB_SSH_KEY          private key file (default: the SSH agent, then ~/.ssh/id_ed25519 and id_rsa)
+//	DB_SSH_PASSPHRASE   the key's passphrase
+//	DB_SSH_KNOWN_HOSTS  known_hosts file the host keys are checked against (default: ~/.ssh/known_hosts)
+//
+// DB_HOST is resolved on the bastion's side. The returned function closes
+// the tunnel and with it the connections through it.
+func openTunnel(config DBConfig) (DBConfig, func(), error) {
+	bastion := getEnv("DB_SSH_HOST", "")
+	if bastion == "" {
+		return config, func() {}, nil
+	}
+	if len(splitHosts(config.Host)) > 1 {
+		return config, nil, fmt.Errorf("an ssh tunnel leads to one host; DB_HOST lists several")
+	}
+	port, ok := defaultPorts[config.Engine]
+	if _, _, err := net.SplitHostPort(config.Host); err != nil && !ok {
+		return config, nil, fmt.Errorf("engine %s has no default port; give DB_HOST as host:port to tunnel to it", config.Engine)
+	}
+	target := withDefaultPort(config.Host, port)
+	auth, err := sshAuth()
+	if err != nil {
+		return config, nil, err
+	}
+	hostKeys, err := sshHostKeys()
+	if err != nil {
+		return config, nil, err
+	}
+
+	var client *ssh.Client
+	if jump := getEnv("DB_SSH_JUMP", ""); jump != "" {
+		jumpClient, err := dialSSH(config.Proxy, nil, jump, auth, hostKeys)
+		if err != nil {
+			return config, nil, fmt.Errorf("ssh jump host %s: %v", jump, err)
+		}
+		if client, err = dialSSH(nil, jumpClient, bastion, auth, hostKeys); err != nil {
+			jumpClient.Close()
+			return config, nil, fmt.Errorf("ssh %s via %s: %v", bastion, jump, err)
+		}
+	} else if client, err = dialSSH(config.Proxy, nil, bastion, auth, hostKeys); err != nil {
+		return config, nil, fmt.Errorf("ssh %s: %v", bastion, err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return config, nil, fmt.Errorf("listen for ssh tunnel: %v", err)
+	}
+	go func() {
+		for {
+			local, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go forwardSSH(client, local, target)
+		}
+	}()
+	log.Printf("Tunneling %s through %s", target, bastion)
+	config.TunneledHost, config.Host = config.Host, ln.Addr().String()
+	return config, func() {
+		ln.Close()
+		client.Close()
+	}, nil
+}
+
+// forwardSSH copies between a local connection and a connection to target
+// opened from the SSH host, until either side closes.
+func forwardSSH(client *ssh.Client, local net.Conn, target string) {
+	defer local.Close()
+	remote, err := client.Dial("tcp", target)
+	if err != nil {
+		log.Printf("Warning: ssh tunnel to %s: %v", target, err)
+		return
+	}
+	defer remote.Close()
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(remote, local); done <- struct{}{} }()
+	go func() { io.Copy(local, remote); done <- struct{}{} }()
+	<-done
+}
+
+// dialSSH connects to user@host[:port], through via or else proxy if
+// either isn't nil.
+func dialSSH(proxy *proxyDialer, via *ssh.Client, address string, auth []ssh.AuthMethod, hostKeys ssh.HostKeyCallback) (*ssh.Client, error) {
+	user, host, ok := strings.Cut(address, "@")
+	if !ok {
+		user, host = getEnv("USER", ""), address
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	cfg := &ssh.ClientConfig{User: user, Auth: auth, HostKeyCallback: hostKeys}
+	var conn net.Conn
+	var err error
+	switch {
+	case via != nil:
+		conn, err = via.Dial("tcp", host)
+	case proxy != nil:
+		conn, err = proxy.DialContext(context.Background(), "tcp", host)
+	default:
+		return ssh.Dial("tcp", host, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, host, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshAuth returns DB_SSH_KEY, or the agent's keys and the default key
+// files that exist.
+func sshAuth() ([]ssh.AuthMethod, error) {
+	passphrase := getEnv("DB_SSH_PASSPHRASE", "")
+	if key := getEnv("DB_SSH_KEY", ""); key != "" {
+		signer, err := readSSHKey(key, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+	var methods []ssh.AuthMethod
+	if conn, err := dialSSHAgent(); err == nil {
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	home, _ := os.UserHomeDir()
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_rsa"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		signer, err := readSSHKey(path, passphrase)
+		if err != nil {
+			log.Printf("Warning: skipping ssh key %s: %v", path, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no ssh keys: set DB_SSH_KEY or start an SSH agent")
+	}
+	return methods, nil
+}
+
+func readSSHKey(path, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ssh key: %v", err)
+	}
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse ssh key %s: %v", path, err)
+	}
+	return signer, nil
+}
+
+// sshHostKeys checks host keys against DB_SSH_KNOWN_HOSTS; unknown hosts
+// are refused rather than trusted on first use.
+func sshHostKeys() (ssh.HostKeyCallback, error) {
+	path := getEnv("DB_SSH_KNOWN_HOSTS", "")
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("read known hosts: %v", err)
+	}
+	return callback, nil
+}
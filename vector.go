@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vectorSQL is one engine's vector dialect. Embeddings are sent as text,
+// e.g. [0.1,0.2,0.3], and compared by Euclidean distance.
+type vectorSQL struct {
+	Schema string // DDL with %s for the table and %d for the dimensions
+	Insert string // with id and embedding, %s for the table
+	Search string // the ids nearest to an embedding, %s for the table
+}
+
+// vectorDialects are the engines with a vector type. CockroachDB's vector
+// index answers the search approximately; MySQL's VECTOR has no index, and
+// DISTANCE is only offered by HeatWave, whose scans are what gets measured.
+var vectorDialects = map[string]vectorSQL{
+	"mysql": {
+		Schema: "CREATE TABLE IF NOT EXISTS %s (id BIGINT NOT NULL PRIMARY KEY, embedding VECTOR(%d) NOT NULL)",
+		Insert: "INSERT INTO %s (id, embedding) VALUES (?, STRING_TO_VECTOR(?))",
+		Search: "SELECT id FROM %s ORDER BY DISTANCE(embedding, STRING_TO_VECTOR(?), 'EUCLIDEAN')",
+	},
+	"cockroach": {
+		Schema: "CREATE TABLE IF NOT EXISTS %s (id BIGINT NOT NULL PRIMARY KEY, embedding VECTOR(%d) NOT NULL, VECTOR INDEX (embedding))",
+		Insert: "INSERT INTO %s (id, embedding) VALUES ($1, $2::VECTOR)",
+		Search: "SELECT id FROM %s ORDER BY embedding <-> $1::VECTOR",
+	},
+}
+
+func init() {
+	strategies = append(strategies, Strategy{
+		Name:        "vector-search",
+		Description: "Nearest-neighbor queries on embeddings",
+		Engines:     []string{"mysql", "cockroach"},
+		Params: []Param{
+			{Name: "vector.enabled", Default: "false", Description: "run the strategy; it needs MySQL HeatWave or CockroachDB 25.2 or later"},
+			{Name: "vector.dimensions", Default: "384", Description: "dimensions of the embeddings"},
+			{Name: "vector.rows", Default: "10000", Description: "embeddings in the table"},
+			{Name: "vector.k", Default: "10", Description: "neighbors each query returns"},
+		},
+		Read:     true,
+		Workload: workloadVectorSearch,
+		Probe: probeSchema(func(e *engine, table string) string {
+			return fmt.Sprintf(vectorDialects[e.Name].Schema, table, 3)
+		}, func(e *engine, table string) (string, []any) {
+			return fmt.Sprintf(vectorDialects[e.Name].Search, table), []any{"[0,0,1]"}
+		}),
+		Enabled:  func(opts RunOptions) bool { return opts.param("vector.enabled", "false") == "true" },
+		Requires: "-param vector.enabled=true",
+		Run:      runVectorSearch,
+	})
+}
+
+// vectorTable is the table of embeddings with the given dimensions.
+func vectorTable(dimensions int) string {
+	return fmt.Sprintf("benchmark_vectors_%d", dimensions)
+}
+
+// embedding returns a random unit vector in the text form of the dialects.
+func embedding(rng *rand.Rand, dimensions int) string {
+	v := make([]float64, dimensions)
+	var norm float64
+	for i := range v {
+		v[i] = rng.NormFloat64()
+		norm += v[i] * v[i]
+	}
+	norm = math.Sqrt(norm)
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(x/norm, 'f', 6, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// runVectorSearch tops the table for vector.dimensions up to vector.rows
+// random embeddings and then runs k-nearest-neighbor queries for random
+// embeddings until opts is done, the retrieval step of a RAG pipeline.
+// Rows counts queries. Whether the answers are the true neighbors isn't
+// checked: the latency and throughput are the engine's at whatever recall
+// its index gives. Metrics report the insert rate of the top-up, which
+// includes building the index, as insert_rows_per_sec.
+func runVectorSearch(ctx context.Context, db *sql.DB, opts RunOptions) (Result, error) {
+	vq := vectorDialects[opts.Engine.Name]
+	dimensions := opts.intParam("vector.dimensions", 384)
+	rows := opts.intParam("vector.rows", 10000)
+	k := opts.intParam("vector.k", 10)
+	if dimensions < 1 || rows < 1 || k < 1 {
+		return Result{}, fmt.Errorf("vector.dimensions, vector.rows and vector.k must be at least 1")
+	}
+	table := vectorTable(dimensions)
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(vq.Schema, table, dimensions)); err != nil {
+		return Result{}, fmt.Errorf("create table %s: %v", table, err)
+	}
+
+	metrics := map[string]float64{}
+	inserted, insertTime, err := fillVectorTable(ctx, db, opts, fmt.Sprintf(vq.Insert, table), table, dimensions, rows)
+	if err != nil {
+		return Result{}, err
+	}
+	if inserted > 0 {
+		metrics["insert_rows_per_sec"] = float64(inserted) / insertTime.Seconds()
+		log.Printf("vector-search: inserted %d embeddings of %d dimensions at %s rows/s", inserted, dimensions, formatRate(metrics["insert_rows_per_sec"]))
+	}
+
+	query := fmt.Sprintf(vq.Search, table) + " " + opts.Engine.limit(k)
+	rng := rand.New(rand.NewSource(-1))
+	var rec latencyRecorder
+	plans := opts.planRecorder()
+	plans.capture(ctx, db, query, embedding(rng, dimensions))
+	start := time.Now()
+	queries := 0
+	for ; !opts.done(queries, start); queries++ {
+		v := embedding(rng, dimensions)
+		opStart := time.Now()
+		if _, err := countRows(ctx, db, query, v); err != nil {
+			return Result{}, fmt.Errorf("search error: %v", err)
+		}
+		rec.observe(time.Since(opStart))
+	}
+	result := rec.result(queries, time.Since(start))
+	result.Plans = plans.plans
+	result.Metrics = metrics
+	return result, nil
+}
+
+// fillVectorTable inserts random embeddings until table has n rows, a
+// transaction per batch, returning how many it inserted and how long that
+// took.
+func fillVectorTable(ctx context.Context, db *sql.DB, opts RunOptions, insert, table string, dimensions, n int) (int, time.Duration, error) {
+	var have int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&have); err != nil {
+		return 0, 0, fmt.Errorf("count rows: %v", err)
+	}
+	rng := rand.New(rand.NewSource(int64(have)))
+	start := time.Now()
+	for i := have; i < n; {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, 0, fmt.Errorf("begin: %v", err)
+		}
+		end := min(i+opts.batchSize(), n)
+		for ; i < end; i++ {
+			if _, err := tx.ExecContext(ctx, insert, i, embedding(rng, dimensions)); err != nil {
+				tx.Rollback()
+				return 0, 0, fmt.Errorf("insert error: %v", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, 0, fmt.Errorf("commit: %v", err)
+		}
+	}
+	return max(n-have, 0), time.Since(start), nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Verbosity levels: -q shows only warnings, errors and the summary; -v
+// adds a line per operation; -vv also echoes every SQL statement.
+const (
+	verbosityQuiet   = -1
+	verbosityNormal  = 0
+	verbosityVerbose = 1
+	verbosityDebug   = 2
+)
+
+// verbosity is the current level (-q, -v, -vv, BENCHMARK_VERBOSITY).
+var verbosity = verbosityNormal
+
+// logConsole is where human-facing log output goes.
+var logConsole io.Writer = os.Stderr
+
+// setLogConsole redirects the human-facing log output, which the event log
+// keeps receiving all of.
+func setLogConsole(w io.Writer) { logConsole = w }
+
+// logOutput is the standard logger's output: each line, with credentials
+// redacted, goes to logConsole unless -q hides it, and to the event log,
+// if open, without the logger's timestamp.
+type logOutput struct{}
+
+func (logOutput) Write(p []byte) (int, error) {
+	line := redact(string(p))
+	message := strings.TrimSuffix(line, "\n")
+	// Drop log's "2006/01/02 15:04:05 " prefix; the event has its own time.
+	if len(message) > 20 && message[4] == '/' && message[19] == ' ' {
+		message = message[20:]
+	}
+	level := logLevel(message)
+	events.emit("log", map[string]any{"level": level, "message": message})
+	if verbosity <= verbosityQuiet && level == "info" {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(logConsole, line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logLevel classifies a log line by the prefixes the tool's warnings and
+// fatal errors start with.
+func logLevel(message string) string {
+	switch {
+	case strings.HasPrefix(message, "Warning:"):
+		return "warning"
+	case strings.HasPrefix(message, "Benchmark failed"), strings.HasPrefix(message, "Invalid "), strings.HasPrefix(message, "Unknown command"):
+		return "error"
+	}
+	return "info"
+}
+
+// echoSQL wraps c so that at -vv every statement its connections prepare,
+// execute or query is logged with its arguments; below -vv it returns c.
+func echoSQL(c driver.Connector) driver.Connector {
+	if verbosity < verbosityDebug {
+		return c
+	}
+	return echoConnector{c}
+}
+
+type echoConnector struct{ driver.Connector }
+
+func (c echoConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return echoConn{conn}, nil
+}
+
+func logStatement(verb, query string, args []driver.NamedValue) {
+	values := make([]any, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	if len(values) > 0 {
+		log.Printf("SQL %s: %s %v", verb, query, values)
+	} else {
+		log.Printf("SQL %s: %s", verb, query)
+	}
+}
+
+// echoConn logs the statements run on conn. It implements every optional
+// interface database/sql looks for, delegating to conn's own where it has
+// one and otherwise answering as if the interface were missing, so the
+// pool behaves the same with and without -vv.
+type echoConn struct{ driver.Conn }
+
+func (c echoConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	res, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		logStatement("exec", query, args)
+	}
+	return res, err
+}
+
+func (c echoConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		logStatement("query", query, args)
+	}
+	return rows, err
+}
+
+func (c echoConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logStatement("prepare", query, nil)
+	return echoStmt{stmt, c.Conn, query}, nil
+}
+
+func (c echoConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	log.Printf("SQL begin")
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c echoConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c echoConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c echoConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c echoConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// echoStmt logs the executions of a prepared statement. Like echoConn it
+// falls back to what database/sql would do without it, which for
+// argument checks is asking the connection.
+type echoStmt struct {
+	driver.Stmt
+	conn  driver.Conn
+	query string
+}
+
+func (s echoStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	logStatement("exec prepared", s.query, args)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Exec(values)
+}
+
+func (s echoStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	logStatement("query prepared", s.query, args)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Query(values)
+}
+
+func (s echoStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return echoConn{s.conn}.CheckNamedValue(nv)
+}
+
+func (s echoStmt) ColumnConverter(idx int) driver.ValueConverter {
+	if c, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return c.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
+}
+
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		if a.Name != "" {
+			return nil, driver.ErrSkip
+		}
+		values[i] = a.Value
+	}
+	return values, nil
+}
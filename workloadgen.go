@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A statement's template replaces its fixed sample with bind parameters
+// drawn from generators, written inline as {{name(args)}}:
+//
+//	seq(name[, start])       the next value of a named sequence (default 1)
+//	int(min, max)            a uniform random integer in [min, max]
+//	choice(a:3, b, c:0.5)    one of the values, by weight (default 1)
+//	time(from, to)           a random instant between now+from and now+to,
+//	                         e.g. time(-24h, 0s)
+//	ref(name)                a random ID previously generated by a statement
+//	                         whose insert_id is name
+//	step(name.field)         in a scenario, a result of the earlier step
+//	                         name: its id, affected rows, rows read, or a
+//	                         column of the first row it read
+//
+// Values in choice may be quoted to include commas or colons. Together
+// with insert_id this lets a hand-written workload file insert parents and
+// then act on them, e.g. place orders for users it created earlier.
+
+// errNoRef is returned while a ref generator has no IDs to choose from.
+var errNoRef = errors.New("no IDs recorded yet")
+
+// generator produces one bind parameter value per execution.
+type generator func(rng *rand.Rand, state *workloadState) (any, error)
+
+// workloadState is what generators remember across executions. Sequences
+// and recorded IDs are shared by every session of one run; steps holds the
+// results of the current scenario iteration's steps and is the session's own.
+type workloadState struct {
+	mu    *sync.Mutex
+	seqs  map[string]int64
+	ids   map[string][]int64
+	steps map[string]map[string]any
+}
+
+func newWorkloadState() *workloadState {
+	return &workloadState{mu: &sync.Mutex{}, seqs: map[string]int64{}, ids: map[string][]int64{}}
+}
+
+// session returns a state sharing s's sequences and IDs, for one virtual
+// user.
+func (s *workloadState) session() *workloadState {
+	return &workloadState{mu: s.mu, seqs: s.seqs, ids: s.ids, steps: map[string]map[string]any{}}
+}
+
+// recordID remembers id under name for ref.
+func (s *workloadState) recordID(name string, id int64) {
+	s.mu.Lock()
+	s.ids[name] = append(s.ids[name], id)
+	s.mu.Unlock()
+}
+
+// paramTemplate is a compiled statement template: the query with a "?"
+// per generator, in order.
+type paramTemplate struct {
+	query string
+	gens  []generator
+}
+
+func compileTemplate(template string) (paramTemplate, error) {
+	var t paramTemplate
+	var b strings.Builder
+	rest := template
+	for {
+		open := strings.Index(rest, "{{")
+		if open < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.Index(rest[open:], "}}")
+		if end < 0 {
+			return t, fmt.Errorf("unterminated {{ in %q", template)
+		}
+		expr := strings.TrimSpace(rest[open+2 : open+end])
+		gen, err := parseGenerator(expr)
+		if err != nil {
+			return t, fmt.Errorf("{{%s}}: %v", expr, err)
+		}
+		b.WriteString(rest[:open])
+		b.WriteString("?")
+		t.gens = append(t.gens, gen)
+		rest = rest[open+end+2:]
+	}
+	t.query = b.String()
+	return t, nil
+}
+
+// args draws the template's bind parameters for one execution.
+func (t paramTemplate) args(rng *rand.Rand, state *workloadState) ([]any, error) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	args := make([]any, len(t.gens))
+	for i, gen := range t.gens {
+		v, err := gen(rng, state)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+func parseGenerator(expr string) (generator, error) {
+	name, rest, ok := strings.Cut(expr, "(")
+	if !ok || !strings.HasSuffix(rest, ")") {
+		return nil, fmt.Errorf("want name(args)")
+	}
+	args := splitGeneratorArgs(strings.TrimSuffix(rest, ")"))
+	switch strings.TrimSpace(name) {
+	case "seq":
+		return seqGenerator(args)
+	case "int":
+		return intGenerator(args)
+	case "choice":
+		return choiceGenerator(args)
+	case "time":
+		return timeGenerator(args)
+	case "step":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("step takes step.field")
+		}
+		step, field, ok := strings.Cut(args[0], ".")
+		if !ok || step == "" || field == "" {
+			return nil, fmt.Errorf("step takes step.field, e.g. step(create.id)")
+		}
+		return func(_ *rand.Rand, state *workloadState) (any, error) {
+			values, ok := state.steps[step]
+			if !ok {
+				return nil, fmt.Errorf("step(%s): step %s has not run in this scenario", args[0], step)
+			}
+			v, ok := values[field]
+			if !ok {
+				return nil, fmt.Errorf("step(%s): step %s has no %s", args[0], step, field)
+			}
+			return v, nil
+		}, nil
+	case "ref":
+		if len(args) != 1 || args[0] == "" {
+			return nil, fmt.Errorf("ref takes the insert_id name")
+		}
+		return func(rng *rand.Rand, state *workloadState) (any, error) {
+			ids := state.ids[args[0]]
+			if len(ids) == 0 {
+				return nil, fmt.Errorf("ref(%s): %w", args[0], errNoRef)
+			}
+			return ids[rng.Intn(len(ids))], nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown generator %q (expected seq, int, choice, time, ref or step)", name)
+}
+
+// splitGeneratorArgs splits on commas outside single or double quotes and
+// trims the arguments; quotes are kept for choice to strip.
+func splitGeneratorArgs(s string) []string {
+	var args []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(args) > 0 {
+		args = append(args, last)
+	}
+	return args
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func seqGenerator(args []string) (generator, error) {
+	if len(args) < 1 || len(args) > 2 || args[0] == "" {
+		return nil, fmt.Errorf("seq takes a name and an optional start")
+	}
+	name, start := args[0], int64(1)
+	if len(args) == 2 {
+		var err error
+		if start, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid start %q", args[1])
+		}
+	}
+	return func(_ *rand.Rand, state *workloadState) (any, error) {
+		v, ok := state.seqs[name]
+		if !ok {
+			v = start
+		}
+		state.seqs[name] = v + 1
+		return v, nil
+	}, nil
+}
+
+func intGenerator(args []string) (generator, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("int takes min and max")
+	}
+	lo, err1 := strconv.ParseInt(args[0], 10, 64)
+	hi, err2 := strconv.ParseInt(args[1], 10, 64)
+	if err1 != nil || err2 != nil || lo > hi {
+		return nil, fmt.Errorf("invalid range %s..%s", args[0], args[1])
+	}
+	return func(rng *rand.Rand, _ *workloadState) (any, error) {
+		return lo + rng.Int63n(hi-lo+1), nil
+	}, nil
+}
+
+func choiceGenerator(args []string) (generator, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("choice needs at least one value")
+	}
+	values := make([]string, len(args))
+	cumulative := make([]float64, len(args))
+	sum := 0.0
+	for i, arg := range args {
+		// The weight follows the last colon outside the quotes.
+		value, weightText := arg, ""
+		quoted := 0
+		if len(arg) > 0 && (arg[0] == '\'' || arg[0] == '"') {
+			if end := strings.IndexByte(arg[1:], arg[0]); end >= 0 {
+				quoted = end + 2
+			}
+		}
+		if k := strings.LastIndex(arg[quoted:], ":"); k >= 0 {
+			value, weightText = strings.TrimSpace(arg[:quoted+k]), strings.TrimSpace(arg[quoted+k+1:])
+		}
+		weight := 1.0
+		if weightText != "" {
+			var err error
+			if weight, err = strconv.ParseFloat(weightText, 64); err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight in %q", arg)
+			}
+		}
+		values[i] = unquote(value)
+		sum += weight
+		cumulative[i] = sum
+	}
+	if sum <= 0 {
+		return nil, fmt.Errorf("weights add up to zero")
+	}
+	return func(rng *rand.Rand, _ *workloadState) (any, error) {
+		k := sort.SearchFloat64s(cumulative, rng.Float64()*sum)
+		if k == len(values) {
+			k--
+		}
+		return values[k], nil
+	}, nil
+}
+
+func timeGenerator(args []string) (generator, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("time takes from and to offsets, e.g. -24h, 0s")
+	}
+	from, err1 := time.ParseDuration(args[0])
+	to, err2 := time.ParseDuration(args[1])
+	if err1 != nil || err2 != nil || from > to {
+		return nil, fmt.Errorf("invalid window %s..%s", args[0], args[1])
+	}
+	return func(rng *rand.Rand, _ *workloadState) (any, error) {
+		offset := from
+		if to > from {
+			offset += time.Duration(rng.Int63n(int64(to - from)))
+		}
+		return time.Now().Add(offset).UTC().Truncate(time.Microsecond), nil
+	}, nil
+}